@@ -0,0 +1,57 @@
+package export
+
+import (
+	"time"
+
+	"github.com/abrampers/inkle/logging"
+)
+
+// document is an event with the fields parsed from the csv logs by the
+// Logstash of the Helm chart, the duration in milliseconds.
+type document struct {
+	Timestamp     time.Time       `json:"@timestamp"`
+	EventID       string          `json:"event_id"`
+	Service       string          `json:"grpc_service_name,omitempty"`
+	Method        string          `json:"grpc_method_name,omitempty"`
+	SrcIP         string          `json:"src_ip"`
+	SrcPort       uint16          `json:"src_tcp_port"`
+	DstIP         string          `json:"dst_ip"`
+	DstPort       uint16          `json:"dst_tcp_port"`
+	StatusCode    int             `json:"grpc_status_code"`
+	Status        string          `json:"grpc_status,omitempty"`
+	Duration      float64         `json:"duration"`
+	Info          string          `json:"info"`
+	StartTime     *time.Time      `json:"start_time,omitempty"`
+	Fields        *logging.Fields `json:"fields,omitempty"`
+	SchemaVersion int             `json:"schema_version"`
+}
+
+// newDocument returns the document of r, timestamped with the end of the
+// call, or its start, or now.
+func newDocument(r logging.Record) document {
+	doc := document{
+		Timestamp:     time.Now().UTC(),
+		EventID:       r.EventID,
+		Service:       r.Service,
+		Method:        r.Method,
+		SrcIP:         r.Source.IP,
+		SrcPort:       r.Source.Port,
+		DstIP:         r.Destination.IP,
+		DstPort:       r.Destination.Port,
+		StatusCode:    -1,
+		Duration:      r.DurationMs,
+		Info:          r.Info,
+		StartTime:     r.StartTime,
+		Fields:        r.Fields,
+		SchemaVersion: r.SchemaVersion,
+	}
+	if r.EndTime != nil {
+		doc.Timestamp = *r.EndTime
+	} else if r.StartTime != nil {
+		doc.Timestamp = *r.StartTime
+	}
+	if r.Status != nil {
+		doc.StatusCode, doc.Status = r.Status.Code, r.Status.Name
+	}
+	return doc
+}
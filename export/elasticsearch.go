@@ -0,0 +1,239 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/abrampers/inkle/logging"
+)
+
+const (
+	// ElasticsearchTemplateName is the name of the index template, the one
+	// installed by the Logstash of the Helm chart.
+	ElasticsearchTemplateName = "inkle-log"
+
+	elasticsearchBulkPath = "/_bulk"
+)
+
+// ElasticsearchTemplate is the inkle-index-template of the Helm chart,
+// mapping the IPs of the indices of inkle.
+var ElasticsearchTemplate = []byte(`{
+  "index_patterns": ["inkle-*"],
+  "mappings" : {
+    "properties" : {
+      "src_ip": { "type": "ip"},
+      "dst_ip": { "type": "ip"}
+    }
+  }
+}
+`)
+
+// ElasticsearchSink indexes the events with the bulk API of Elasticsearch,
+// in daily indices. Batches which can't be indexed after their retries are
+// spilled, if there is a spill, and indexed again after the next batch
+// indexed.
+type ElasticsearchSink struct {
+	url                 string
+	index               string
+	template            []byte
+	istemplateinstalled bool
+	client              *http.Client
+	backoff             Backoff
+	spill               *Spill
+}
+
+type elasticsearchBulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+// NewElasticsearchSink returns a sink indexing to rawurl, the URL of an
+// Elasticsearch cluster, e.g. http://elasticsearch-master:9200, in the
+// index-YYYY.MM.dd indices. template is installed as the index template of
+// the indices, now or before the next batch if Elasticsearch is down. spill
+// may be nil.
+func NewElasticsearchSink(rawurl string, index string, template []byte, timeout time.Duration, backoff Backoff, spill *Spill) (*ElasticsearchSink, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("Invalid Elasticsearch URL %s", rawurl)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	s := &ElasticsearchSink{url: u.String(), index: index, template: template, client: &http.Client{Timeout: timeout}, backoff: backoff, spill: spill}
+	if err := s.installTemplate(); err != nil {
+		log.Printf("Failed to install the index template of %s, retrying before the next batch: %v\n", s.url, err)
+	}
+	return s, nil
+}
+
+func (s *ElasticsearchSink) Write(events []logging.EventLog) error {
+	return s.export(logging.Records(events))
+}
+
+func (s *ElasticsearchSink) export(records []logging.Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	items := make([][]byte, 0, len(records))
+	for _, r := range records {
+		item, err := s.item(r)
+		if err != nil {
+			return err
+		}
+		items = append(items, item)
+	}
+
+	spillable := false
+	err := s.backoff.Do(func() error {
+		err := s.installTemplate()
+		if err == nil {
+			items, err = s.bulk(items)
+		}
+		_, spillable = err.(*retryableError)
+		return err
+	})
+	if err != nil {
+		if !spillable || s.spill == nil {
+			return err
+		}
+		if spillerr := s.spill.Push(bytes.Join(items, nil)); spillerr != nil {
+			return fmt.Errorf("Failed to spill %d events after '%v': %v", len(items), err, spillerr)
+		}
+		log.Printf("Spilled %d events of %s: %v\n", len(items), s.url, err)
+		return nil
+	}
+	if s.spill != nil {
+		if err := s.spill.Replay(s.replay); err != nil {
+			log.Printf("Failed to index the spilled events of %s: %v\n", s.url, err)
+		}
+	}
+	return nil
+}
+
+// replay indexes the items of a spilled payload, without retries. The
+// payload is kept if it may be indexed later, all of it since its indexed
+// items are only overwritten.
+func (s *ElasticsearchSink) replay(payload []byte) error {
+	items := [][]byte{}
+	lines := bytes.SplitAfter(payload, []byte("\n"))
+	for i := 0; i+1 < len(lines); i += 2 {
+		items = append(items, append(lines[i], lines[i+1]...))
+	}
+	_, err := s.bulk(items)
+	if _, ok := err.(*retryableError); ok {
+		return err
+	}
+	if err != nil {
+		log.Printf("Dropped spilled events of %s: %v\n", s.url, err)
+	}
+	return nil
+}
+
+// item returns the action and the document indexing r. The ID of the event
+// is the ID of the document, so that retried items are indexed once.
+func (s *ElasticsearchSink) item(r logging.Record) ([]byte, error) {
+	doc := newDocument(r)
+	action := map[string]map[string]string{"index": {"_index": s.index + "-" + doc.Timestamp.Format("2006.01.02"), "_id": r.EventID}}
+	line, err := json.Marshal(action)
+	if err != nil {
+		return nil, err
+	}
+	source, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return append(append(append(line, '\n'), source...), '\n'), nil
+}
+
+// installTemplate installs the index template unless it is installed.
+func (s *ElasticsearchSink) installTemplate() error {
+	if s.istemplateinstalled {
+		return nil
+	}
+	req, err := http.NewRequest(http.MethodPut, s.url+"/_template/"+ElasticsearchTemplateName, bytes.NewReader(s.template))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return retryable(err)
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		err := fmt.Errorf("Elasticsearch %s returned %s to the index template", s.url, resp.Status)
+		if isRetryableStatus(resp.StatusCode) {
+			return &retryableError{err: err, delay: retryAfter(resp)}
+		}
+		return err
+	}
+	s.istemplateinstalled = true
+	return nil
+}
+
+// bulk indexes items, and returns the ones to retry, rejected with a
+// retryable status, with a retryable error. Items failing otherwise, e.g.
+// because of their mapping, are dropped with an error.
+func (s *ElasticsearchSink) bulk(items [][]byte) ([][]byte, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+	resp, err := s.client.Post(s.url+elasticsearchBulkPath, "application/x-ndjson", bytes.NewReader(bytes.Join(items, nil)))
+	if err != nil {
+		return items, retryable(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return items, retryable(err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		err := fmt.Errorf("Elasticsearch %s returned %s", s.url, resp.Status)
+		if isRetryableStatus(resp.StatusCode) {
+			return items, &retryableError{err: err, delay: retryAfter(resp)}
+		}
+		return items, err
+	}
+
+	var bulk elasticsearchBulkResponse
+	if err := json.Unmarshal(body, &bulk); err != nil {
+		return items, fmt.Errorf("Invalid bulk response of Elasticsearch %s: %v", s.url, err)
+	}
+	if !bulk.Errors {
+		return nil, nil
+	}
+	if len(bulk.Items) != len(items) {
+		return items, fmt.Errorf("Elasticsearch %s returned %d bulk items instead of %d", s.url, len(bulk.Items), len(items))
+	}
+	retries := [][]byte{}
+	var failure error
+	for i, result := range bulk.Items {
+		for _, item := range result {
+			switch {
+			case item.Status >= 200 && item.Status < 300:
+			case isRetryableStatus(item.Status):
+				retries = append(retries, items[i])
+			case failure == nil:
+				failure = fmt.Errorf("Elasticsearch %s rejected a document with %d %s: %s", s.url, item.Status, item.Error.Type, item.Error.Reason)
+			}
+		}
+	}
+	if len(retries) > 0 {
+		return retries, retryable(fmt.Errorf("Elasticsearch %s rejected %d documents with a retryable status", s.url, len(retries)))
+	}
+	return nil, failure
+}
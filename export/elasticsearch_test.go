@@ -0,0 +1,253 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abrampers/inkle/logging"
+)
+
+func TestElasticsearchSinkItem(t *testing.T) {
+	deadline := 800.0
+	timeout := testRecord(0, &logging.Fields{DeadlineMs: &deadline})
+	timeout.Status, timeout.Info = nil, "Request - TIMEOUT"
+	tests := []struct {
+		input  logging.Record
+		action string
+		doc    string
+	}{
+		{
+			input:  testRecord(4, nil),
+			action: `{"index":{"_id":"d96763c9-a9a4-49d0-9008-b63befa85b6d","_index":"inkle-2020.04.01"}}`,
+			doc:    `{"@timestamp":"2020-04-01T10:30:00.161626Z","event_id":"d96763c9-a9a4-49d0-9008-b63befa85b6d","grpc_service_name":"helloworld.Greeter","grpc_method_name":"SayHello","src_ip":"10.0.1.7","src_tcp_port":58108,"dst_ip":"10.0.0.2","dst_tcp_port":8000,"grpc_status_code":4,"grpc_status":"DEADLINE_EXCEEDED","duration":161.626,"info":"Request - Response","start_time":"2020-04-01T10:30:00Z","schema_version":1}`,
+		},
+		{
+			input:  timeout,
+			action: `{"index":{"_id":"d96763c9-a9a4-49d0-9008-b63befa85b6d","_index":"inkle-2020.04.01"}}`,
+			doc:    `{"@timestamp":"2020-04-01T10:30:00.161626Z","event_id":"d96763c9-a9a4-49d0-9008-b63befa85b6d","grpc_service_name":"helloworld.Greeter","grpc_method_name":"SayHello","src_ip":"10.0.1.7","src_tcp_port":58108,"dst_ip":"10.0.0.2","dst_tcp_port":8000,"grpc_status_code":-1,"duration":161.626,"info":"Request - TIMEOUT","start_time":"2020-04-01T10:30:00Z","fields":{"deadline_ms":800},"schema_version":1}`,
+		},
+	}
+
+	for i, test := range tests {
+		s := &ElasticsearchSink{index: "inkle"}
+		ret, err := s.item(test.input)
+		if err != nil {
+			t.Errorf("item (testcase %d): returns err = '%v', where there should be no error", i, err)
+		}
+		if want := test.action + "\n" + test.doc + "\n"; string(ret) != want {
+			t.Errorf("item (testcase %d): returns %s while it should be %s", i, ret, want)
+		}
+	}
+}
+
+// elasticsearchStub is an Elasticsearch answering the bulk requests with
+// statuses, then with the statuses of their items if the status is 200.
+type elasticsearchStub struct {
+	templates int
+	statuses  []int
+	items     [][]int
+	indexed   []string
+}
+
+func (e *elasticsearchStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPut && r.URL.Path == "/_template/inkle-log" {
+		body, _ := ioutil.ReadAll(r.Body)
+		if !bytes.Equal(body, ElasticsearchTemplate) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		e.templates++
+		return
+	}
+	if r.Method != http.MethodPost || r.URL.Path != "/_bulk" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if len(e.statuses) == 0 {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	status := e.statuses[0]
+	e.statuses = e.statuses[1:]
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+		return
+	}
+	items := []int{}
+	if len(e.items) > 0 {
+		items, e.items = e.items[0], e.items[1:]
+	}
+
+	resp := map[string]interface{}{"errors": false}
+	results := []interface{}{}
+	scanner := bufio.NewScanner(r.Body)
+	for i := 0; scanner.Scan(); i++ {
+		var action map[string]map[string]string
+		json.Unmarshal(scanner.Bytes(), &action)
+		scanner.Scan()
+		status := http.StatusCreated
+		if i < len(items) {
+			status = items[i]
+		}
+		if status == http.StatusCreated {
+			e.indexed = append(e.indexed, action["index"]["_id"])
+		} else {
+			resp["errors"] = true
+		}
+		results = append(results, map[string]interface{}{"index": map[string]interface{}{"status": status, "error": map[string]string{"type": "mapper_parsing_exception", "reason": "failed to parse"}}})
+	}
+	resp["items"] = results
+	json.NewEncoder(w).Encode(resp)
+}
+
+func TestElasticsearchSinkExport(t *testing.T) {
+	records := func(ids ...string) []logging.Record {
+		records := []logging.Record{}
+		for _, id := range ids {
+			r := testRecord(0, nil)
+			r.EventID = id
+			records = append(records, r)
+		}
+		return records
+	}
+	tests := []struct {
+		statuses []int
+		items    [][]int
+		spill    bool
+		batches  [][]logging.Record
+		ok       bool
+		indexed  []string
+	}{
+		{
+			statuses: []int{http.StatusOK},
+			batches:  [][]logging.Record{records("1", "2")},
+			ok:       true,
+			indexed:  []string{"1", "2"},
+		},
+		{
+			statuses: []int{http.StatusTooManyRequests, http.StatusOK},
+			batches:  [][]logging.Record{records("1", "2")},
+			ok:       true,
+			indexed:  []string{"1", "2"},
+		},
+		{
+			statuses: []int{http.StatusOK, http.StatusOK},
+			items:    [][]int{{http.StatusCreated, http.StatusTooManyRequests, http.StatusCreated}},
+			batches:  [][]logging.Record{records("1", "2", "3")},
+			ok:       true,
+			indexed:  []string{"1", "3", "2"},
+		},
+		{
+			statuses: []int{http.StatusOK},
+			items:    [][]int{{http.StatusCreated, http.StatusBadRequest}},
+			batches:  [][]logging.Record{records("1", "2")},
+			ok:       false,
+			indexed:  []string{"1"},
+		},
+		{
+			statuses: []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+			batches:  [][]logging.Record{records("1", "2")},
+			ok:       false,
+		},
+		{
+			statuses: []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusOK, http.StatusOK},
+			spill:    true,
+			batches:  [][]logging.Record{records("1", "2"), records("3")},
+			ok:       true,
+			indexed:  []string{"3", "1", "2"},
+		},
+		{
+			statuses: []int{http.StatusBadRequest},
+			spill:    true,
+			batches:  [][]logging.Record{records("1", "2")},
+			ok:       false,
+		},
+	}
+
+	for i, test := range tests {
+		stub := &elasticsearchStub{statuses: test.statuses, items: test.items}
+		server := httptest.NewServer(stub)
+		defer server.Close()
+		var spill *Spill
+		if test.spill {
+			dir, err := ioutil.TempDir("", "TestElasticsearchSinkExport")
+			if err != nil {
+				t.Fatalf("export (testcase %d): %v", i, err)
+			}
+			defer os.RemoveAll(dir)
+			if spill, err = OpenSpill(dir, 0); err != nil {
+				t.Fatalf("OpenSpill (testcase %d): returns err = '%v'", i, err)
+			}
+		}
+
+		s, err := NewElasticsearchSink(server.URL+"/", "inkle", ElasticsearchTemplate, time.Second, Backoff{Initial: time.Millisecond, Max: time.Millisecond, Retries: 2}, spill)
+		if err != nil {
+			t.Fatalf("NewElasticsearchSink (testcase %d): returns err = '%v'", i, err)
+		}
+		if stub.templates != 1 {
+			t.Errorf("NewElasticsearchSink (testcase %d): installs the index template %d times while it should install it once", i, stub.templates)
+		}
+		for _, batch := range test.batches {
+			err = s.export(batch)
+		}
+		if test.ok && err != nil {
+			t.Errorf("export (testcase %d): returns err = '%v', where there should be no error", i, err)
+		} else if !test.ok && err == nil {
+			t.Errorf("export (testcase %d): returns no err, where there should be error", i)
+		}
+		if len(stub.statuses) != 0 {
+			t.Errorf("export (testcase %d): sends %d requests less than it should", i, len(stub.statuses))
+		}
+		if fmt.Sprint(stub.indexed) != fmt.Sprint(test.indexed) {
+			t.Errorf("export (testcase %d): indexes %v while it should index %v", i, stub.indexed, test.indexed)
+		}
+		if spill != nil {
+			if files, _ := spill.files(); len(files) != 0 {
+				t.Errorf("export (testcase %d): keeps %d spilled files while it should keep none", i, len(files))
+			}
+		}
+	}
+}
+
+func TestElasticsearchSinkTemplate(t *testing.T) {
+	up := false
+	templates := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/_template/") {
+			templates++
+			return
+		}
+		w.Write([]byte(`{"errors":false,"items":[]}`))
+	}))
+	defer server.Close()
+
+	s, err := NewElasticsearchSink(server.URL, "inkle", ElasticsearchTemplate, time.Second, Backoff{Retries: 0}, nil)
+	if err != nil {
+		t.Fatalf("NewElasticsearchSink: returns err = '%v'", err)
+	}
+	if err := s.export([]logging.Record{testRecord(0, nil)}); err == nil {
+		t.Errorf("export: returns no err while Elasticsearch is down")
+	}
+	up = true
+	for i := 0; i < 2; i++ {
+		if err := s.export([]logging.Record{testRecord(0, nil)}); err != nil {
+			t.Errorf("export: returns err = '%v', where there should be no error", err)
+		}
+	}
+	if templates != 1 {
+		t.Errorf("export: installs the index template %d times while it should install it once", templates)
+	}
+}
@@ -0,0 +1,200 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"github.com/abrampers/inkle/logging"
+)
+
+// Frames of the Lumberjack v2 protocol of Beats.
+const (
+	lumberjackVersion    = '2'
+	lumberjackWindow     = 'W'
+	lumberjackJSON       = 'J'
+	lumberjackCompressed = 'C'
+	lumberjackACK        = 'A'
+)
+
+// DefaultLumberjackWindow is the default number of events sent before
+// waiting for their ACK, the one of Filebeat.
+const DefaultLumberjackWindow = 2048
+
+// LumberjackSink sends the events as Beats events to Logstash over the
+// Lumberjack v2 protocol, window by window, the events of a window not ACKed
+// yet being resent on a new connection until Logstash ACKs them.
+type LumberjackSink struct {
+	address     string
+	window      int
+	compression int
+	timeout     time.Duration
+	backoff     Backoff
+	hostname    string
+	conn        net.Conn
+	reader      *bufio.Reader
+}
+
+// lumberjackEvent is the event of a document sent to the beats input of
+// Logstash, whose [@metadata][beat] is inkle.
+type lumberjackEvent struct {
+	document
+	Metadata map[string]string `json:"@metadata"`
+	Host     map[string]string `json:"host"`
+}
+
+// NewLumberjackSink returns a sink sending to address, the host:port of the
+// beats input of Logstash, windows of window events, compressed with zlib at
+// compression if it isn't 0. timeout bounds the connection and the wait for
+// the progress of an ACK.
+func NewLumberjackSink(address string, window int, compression int, timeout time.Duration, backoff Backoff) (*LumberjackSink, error) {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return nil, fmt.Errorf("Invalid Lumberjack address %s", address)
+	}
+	if window <= 0 {
+		return nil, fmt.Errorf("Invalid Lumberjack window %d", window)
+	}
+	if compression < zlib.NoCompression || compression > zlib.BestCompression {
+		return nil, fmt.Errorf("Invalid Lumberjack compression level %d", compression)
+	}
+	hostname, _ := os.Hostname()
+	return &LumberjackSink{address: address, window: window, compression: compression, timeout: timeout, backoff: backoff, hostname: hostname}, nil
+}
+
+func (s *LumberjackSink) Write(events []logging.EventLog) error {
+	return s.export(logging.Records(events))
+}
+
+func (s *LumberjackSink) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func (s *LumberjackSink) export(records []logging.Record) error {
+	payloads := make([][]byte, len(records))
+	for i, r := range records {
+		event := lumberjackEvent{
+			document: newDocument(r),
+			Metadata: map[string]string{"beat": "inkle", "type": "_doc"},
+			Host:     map[string]string{"name": s.hostname},
+		}
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		payloads[i] = payload
+	}
+
+	for start := 0; start < len(payloads); start += s.window {
+		end := start + s.window
+		if end > len(payloads) {
+			end = len(payloads)
+		}
+		window := payloads[start:end]
+		err := s.backoff.Do(func() error {
+			acked, err := s.send(window)
+			window = window[acked:]
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send sends a window of payloads, waits for their ACK and returns the
+// number of payloads ACKed, so that Logstash doesn't get them again. The
+// connection is closed on errors, to be opened again by the next attempt.
+func (s *LumberjackSink) send(payloads [][]byte) (int, error) {
+	if s.conn == nil {
+		conn, err := net.DialTimeout("tcp", s.address, s.timeout)
+		if err != nil {
+			return 0, retryable(err)
+		}
+		s.conn, s.reader = conn, bufio.NewReader(conn)
+	}
+	var acked uint32
+	err := s.write(payloads)
+	if err == nil {
+		acked, err = s.waitACK(uint32(len(payloads)))
+	}
+	if err != nil {
+		s.Close()
+		return int(acked), retryable(err)
+	}
+	return int(acked), nil
+}
+
+func (s *LumberjackSink) write(payloads [][]byte) error {
+	frames := &bytes.Buffer{}
+	for i, payload := range payloads {
+		frames.Write([]byte{lumberjackVersion, lumberjackJSON})
+		binary.Write(frames, binary.BigEndian, uint32(i+1))
+		binary.Write(frames, binary.BigEndian, uint32(len(payload)))
+		frames.Write(payload)
+	}
+
+	buf := &bytes.Buffer{}
+	buf.Write([]byte{lumberjackVersion, lumberjackWindow})
+	binary.Write(buf, binary.BigEndian, uint32(len(payloads)))
+	if s.compression == zlib.NoCompression {
+		buf.Write(frames.Bytes())
+	} else {
+		compressed := &bytes.Buffer{}
+		w, err := zlib.NewWriterLevel(compressed, s.compression)
+		if err != nil {
+			return err
+		}
+		w.Write(frames.Bytes())
+		if err := w.Close(); err != nil {
+			return err
+		}
+		buf.Write([]byte{lumberjackVersion, lumberjackCompressed})
+		binary.Write(buf, binary.BigEndian, uint32(compressed.Len()))
+		buf.Write(compressed.Bytes())
+	}
+
+	s.conn.SetWriteDeadline(time.Now().Add(s.timeout))
+	_, err := s.conn.Write(buf.Bytes())
+	return err
+}
+
+// waitACK reads ACKs until the one of the last event of the window, and
+// returns the sequence number of the last event ACKed. Logstash ACKs the
+// events processed so far while it is busy, each such ACK giving it another
+// timeout.
+func (s *LumberjackSink) waitACK(last uint32) (uint32, error) {
+	var acked uint32
+	for {
+		s.conn.SetReadDeadline(time.Now().Add(s.timeout))
+		header := make([]byte, 6)
+		if _, err := io.ReadFull(s.reader, header); err != nil {
+			return acked, err
+		}
+		if header[0] != lumberjackVersion || header[1] != lumberjackACK {
+			return acked, fmt.Errorf("Unexpected Lumberjack frame %q from %s", header[:2], s.address)
+		}
+		seq := binary.BigEndian.Uint32(header[2:])
+		if seq > last {
+			return acked, fmt.Errorf("Lumberjack %s ACKed event %d of a window of %d", s.address, seq, last)
+		}
+		if seq > acked {
+			acked = seq
+		}
+		if seq == last {
+			return acked, nil
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abrampers/inkle/logging"
+)
+
+// lumberjackStub is a beats input handling the windows it receives along
+// actions: ack ACKs a window, partial ACKs its first event before it,
+// partialclose ACKs its first event only before closing the connection, and
+// close closes the connection without ACKing it.
+type lumberjackStub struct {
+	listener net.Listener
+	mutex    sync.Mutex
+	actions  []string
+	windows  [][]map[string]interface{}
+	conns    int
+}
+
+func newLumberjackStub(t *testing.T, actions []string) *lumberjackStub {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: returns err = '%v'", err)
+	}
+	stub := &lumberjackStub{listener: listener, actions: actions}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			stub.mutex.Lock()
+			stub.conns++
+			stub.mutex.Unlock()
+			go stub.serve(conn)
+		}
+	}()
+	return stub
+}
+
+func (l *lumberjackStub) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		header := make([]byte, 6)
+		if _, err := io.ReadFull(r, header); err != nil || header[1] != 'W' {
+			return
+		}
+		size := binary.BigEndian.Uint32(header[2:])
+		events := []map[string]interface{}{}
+		frames := io.Reader(r)
+		for uint32(len(events)) < size {
+			if _, err := io.ReadFull(frames, header[:2]); err != nil {
+				return
+			}
+			if header[1] == 'C' {
+				var length uint32
+				binary.Read(frames, binary.BigEndian, &length)
+				zr, err := zlib.NewReader(io.LimitReader(r, int64(length)))
+				if err != nil {
+					return
+				}
+				data, _ := ioutil.ReadAll(zr)
+				frames = bytes.NewReader(data)
+				continue
+			}
+			var seq, length uint32
+			binary.Read(frames, binary.BigEndian, &seq)
+			binary.Read(frames, binary.BigEndian, &length)
+			payload := make([]byte, length)
+			if _, err := io.ReadFull(frames, payload); err != nil || header[1] != 'J' || seq != uint32(len(events)+1) {
+				return
+			}
+			event := map[string]interface{}{}
+			json.Unmarshal(payload, &event)
+			events = append(events, event)
+		}
+
+		l.mutex.Lock()
+		action := "ack"
+		if len(l.actions) > 0 {
+			action, l.actions = l.actions[0], l.actions[1:]
+		}
+		if action != "close" {
+			l.windows = append(l.windows, events)
+		}
+		l.mutex.Unlock()
+		switch action {
+		case "close":
+			return
+		case "partial":
+			conn.Write(lumberjackACKFrame(1))
+			time.Sleep(10 * time.Millisecond)
+		case "partialclose":
+			conn.Write(lumberjackACKFrame(1))
+			return
+		}
+		conn.Write(lumberjackACKFrame(size))
+	}
+}
+
+func lumberjackACKFrame(seq uint32) []byte {
+	frame := []byte{'2', 'A', 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(frame[2:], seq)
+	return frame
+}
+
+func TestLumberjackSinkExport(t *testing.T) {
+	deadline := 800.0
+	records := []logging.Record{testRecord(0, nil), testRecord(4, &logging.Fields{DeadlineMs: &deadline}), testRecord(0, nil)}
+	tests := []struct {
+		window      int
+		compression int
+		actions     []string
+		batches     int
+		windows     []int
+		conns       int
+		ok          bool
+	}{
+		{window: 2048, compression: 0, batches: 2, windows: []int{3, 3}, conns: 1, ok: true},
+		{window: 2, compression: 3, batches: 1, windows: []int{2, 1}, conns: 1, ok: true},
+		{window: 2048, compression: 9, actions: []string{"partial"}, batches: 1, windows: []int{3}, conns: 1, ok: true},
+		{window: 2048, compression: 0, actions: []string{"close", "ack"}, batches: 1, windows: []int{3}, conns: 2, ok: true},
+		// Events ACKed before the connection is lost aren't sent again.
+		{window: 2048, compression: 0, actions: []string{"partialclose", "ack"}, batches: 1, windows: []int{3, 2}, conns: 2, ok: true},
+		{window: 2048, compression: 0, actions: []string{"close", "close", "close"}, batches: 1, windows: []int{}, conns: 3, ok: false},
+	}
+
+	for i, test := range tests {
+		stub := newLumberjackStub(t, test.actions)
+		s, err := NewLumberjackSink(stub.listener.Addr().String(), test.window, test.compression, time.Second, Backoff{Initial: time.Millisecond, Max: time.Millisecond, Retries: 2})
+		if err != nil {
+			t.Fatalf("NewLumberjackSink (testcase %d): returns err = '%v'", i, err)
+		}
+		for b := 0; b < test.batches; b++ {
+			err = s.export(records)
+		}
+		s.Close()
+		stub.listener.Close()
+
+		if test.ok && err != nil {
+			t.Errorf("export (testcase %d): returns err = '%v', where there should be no error", i, err)
+		} else if !test.ok && err == nil {
+			t.Errorf("export (testcase %d): returns no err, where there should be error", i)
+		}
+		stub.mutex.Lock()
+		windows := []int{}
+		for _, window := range stub.windows {
+			windows = append(windows, len(window))
+		}
+		if !reflect.DeepEqual(windows, test.windows) || stub.conns != test.conns {
+			t.Errorf("export (testcase %d): sends windows %v over %d connections while it should send %v over %d", i, windows, stub.conns, test.windows, test.conns)
+		}
+		if len(stub.windows) > 0 {
+			event := stub.windows[0][len(stub.windows[0])-1]
+			if meta, _ := event["@metadata"].(map[string]interface{}); meta["beat"] != "inkle" || event["grpc_method_name"] != "SayHello" || event["duration"] != 161.626 {
+				t.Errorf("export (testcase %d): sends event %v while it should send the fields of the call", i, event)
+			}
+		}
+		stub.mutex.Unlock()
+	}
+}
+
+func TestNewLumberjackSink(t *testing.T) {
+	tests := []struct {
+		address     string
+		window      int
+		compression int
+		ok          bool
+	}{
+		{address: "logstash:5044", window: 2048, compression: 3, ok: true},
+		{address: "logstash", window: 2048, compression: 3, ok: false},
+		{address: "logstash:5044", window: 0, compression: 3, ok: false},
+		{address: "logstash:5044", window: 2048, compression: 10, ok: false},
+	}
+
+	for i, test := range tests {
+		_, err := NewLumberjackSink(test.address, test.window, test.compression, time.Second, DefaultBackoff)
+		if test.ok && err != nil {
+			t.Errorf("NewLumberjackSink (testcase %d): returns err = '%v', where there should be no error", i, err)
+		} else if !test.ok && err == nil {
+			t.Errorf("NewLumberjackSink (testcase %d): returns no err, where there should be error", i)
+		}
+	}
+}
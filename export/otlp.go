@@ -0,0 +1,205 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/abrampers/inkle/grpc"
+	"github.com/abrampers/inkle/logging"
+	"github.com/abrampers/inkle/protobuf"
+	"github.com/abrampers/inkle/utils"
+)
+
+// Transports of OTLP.
+const (
+	OTLPHTTP = "http"
+	OTLPGRPC = "grpc"
+)
+
+const (
+	otlpTracesPath = "/v1/traces"
+	otlpExportPath = "/opentelemetry.proto.collector.trace.v1.TraceService/Export"
+
+	// Span.SpanKind
+	spanKindServer = 2
+	spanKindClient = 3
+	// Status.StatusCode
+	statusCodeError = 2
+)
+
+// gRPC statuses of OTLP/gRPC exports which may succeed later.
+var retryableGRPCStatuses = []string{"1", "4", "8", "10", "11", "14", "15"}
+
+// OTLPSink exports the RPCs as OpenTelemetry spans to a collector, over
+// OTLP/HTTP with protobuf payloads or OTLP/gRPC.
+type OTLPSink struct {
+	endpoint string
+	protocol string
+	client   *http.Client
+	backoff  Backoff
+	local    *net.IPNet
+	resource []byte
+}
+
+// NewOTLPSink returns a sink exporting to endpoint, the base URL of an
+// OTLP/HTTP collector (e.g. http://collector:4318) or the host:port of an
+// OTLP/gRPC one. Calls are exported as SERVER spans when their server is in
+// local, as CLIENT spans otherwise.
+func NewOTLPSink(endpoint string, protocol string, timeout time.Duration, backoff Backoff, local *net.IPNet) (*OTLPSink, error) {
+	s := &OTLPSink{protocol: protocol, backoff: backoff, local: local}
+	switch protocol {
+	case OTLPHTTP:
+		u, err := url.Parse(endpoint)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("Invalid OTLP endpoint %s", endpoint)
+		}
+		if u.Path == "" || u.Path == "/" {
+			u.Path = otlpTracesPath
+		}
+		s.endpoint, s.client = u.String(), &http.Client{Timeout: timeout}
+	case OTLPGRPC:
+		endpoint = strings.TrimPrefix(endpoint, "http://")
+		if _, _, err := net.SplitHostPort(endpoint); err != nil {
+			return nil, fmt.Errorf("Invalid OTLP endpoint %s", endpoint)
+		}
+		s.endpoint, s.client = endpoint, grpc.NewClient(timeout)
+	default:
+		return nil, fmt.Errorf("Unknown OTLP protocol %s", protocol)
+	}
+
+	hostname, _ := os.Hostname()
+	s.resource = appendAttribute(nil, 1, "service.name", "inkle")
+	s.resource = appendAttribute(s.resource, 1, "host.name", hostname)
+	return s, nil
+}
+
+func (s *OTLPSink) Write(events []logging.EventLog) error {
+	return s.export(logging.Records(events))
+}
+
+func (s *OTLPSink) export(records []logging.Record) error {
+	spans := []byte{}
+	for _, r := range records {
+		if isSpan(r) {
+			spans = protobuf.AppendBytesField(spans, 2, s.span(r))
+		}
+	}
+	if len(spans) == 0 {
+		return nil
+	}
+
+	// ExportTraceServiceRequest.resource_spans
+	scope := protobuf.AppendStringField(nil, 1, "inkle")
+	scopespans := append(protobuf.AppendBytesField(nil, 1, scope), spans...)
+	resourcespans := protobuf.AppendBytesField(nil, 1, s.resource)
+	resourcespans = protobuf.AppendBytesField(resourcespans, 2, scopespans)
+	request := protobuf.AppendBytesField(nil, 1, resourcespans)
+	return s.backoff.Do(func() error { return s.send(request) })
+}
+
+// span encodes the Span of r.
+func (s *OTLPSink) span(r logging.Record) []byte {
+	ctx := childSpanContext(r)
+	kind := spanKindClient
+	if r.IsServerSide(s.local) {
+		kind = spanKindServer
+	}
+
+	b := protobuf.AppendBytesField(nil, 1, ctx.traceid)
+	b = protobuf.AppendBytesField(b, 2, ctx.spanid)
+	if ctx.tracestate != "" {
+		b = protobuf.AppendStringField(b, 3, ctx.tracestate)
+	}
+	if ctx.parentspanid != nil {
+		b = protobuf.AppendBytesField(b, 4, ctx.parentspanid)
+	}
+	b = protobuf.AppendStringField(b, 5, r.Service+"/"+r.Method)
+	b = protobuf.AppendVarintField(b, 6, uint64(kind))
+	b = protobuf.AppendFixed64Field(b, 7, uint64(r.StartTime.UnixNano()))
+	b = protobuf.AppendFixed64Field(b, 8, uint64(r.EndTime.UnixNano()))
+
+	peer := r.Peer(s.local)
+	b = appendAttribute(b, 9, "rpc.system", "grpc")
+	b = appendAttribute(b, 9, "rpc.service", r.Service)
+	b = appendAttribute(b, 9, "rpc.method", r.Method)
+	if r.Status != nil {
+		b = appendAttribute(b, 9, "rpc.grpc.status_code", r.Status.Code)
+	}
+	b = appendAttribute(b, 9, "net.peer.ip", peer.IP)
+	b = appendAttribute(b, 9, "net.peer.port", int(peer.Port))
+	b = appendAttribute(b, 9, "inkle.event_id", r.EventID)
+	b = appendAttribute(b, 9, "inkle.info", r.Info)
+	attributes := r.Fields.Attributes()
+	keys := []string{}
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		b = appendAttribute(b, 9, "inkle."+key, attributes[key])
+	}
+
+	// Calls which failed or got no response are errors, the others are left
+	// unset.
+	if r.Status == nil || r.Status.Code != 0 {
+		message := r.Info
+		if r.Status != nil {
+			message = r.Status.Name
+		}
+		status := protobuf.AppendStringField(nil, 2, message)
+		status = protobuf.AppendVarintField(status, 3, statusCodeError)
+		b = protobuf.AppendBytesField(b, 15, status)
+	}
+	return b
+}
+
+// appendAttribute appends a KeyValue with a string or int value as field
+// number of b.
+func appendAttribute(b []byte, number int, key string, value interface{}) []byte {
+	var any []byte
+	switch v := value.(type) {
+	case string:
+		any = protobuf.AppendStringField(nil, 1, v)
+	case int:
+		any = protobuf.AppendVarintField(nil, 3, uint64(v))
+	}
+	kv := protobuf.AppendStringField(nil, 1, key)
+	kv = protobuf.AppendBytesField(kv, 2, any)
+	return protobuf.AppendBytesField(b, number, kv)
+}
+
+func (s *OTLPSink) send(request []byte) error {
+	if s.protocol == OTLPGRPC {
+		_, err := grpc.Invoke(s.client, s.endpoint, otlpExportPath, request)
+		if serr, ok := err.(*grpc.StatusError); ok && !utils.Contains(retryableGRPCStatuses, serr.Code) {
+			return err
+		} else if err != nil {
+			return retryable(err)
+		}
+		return nil
+	}
+
+	resp, err := s.client.Post(s.endpoint, "application/x-protobuf", bytes.NewReader(request))
+	if err != nil {
+		return retryable(err)
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("OTLP collector %s returned %s", s.endpoint, resp.Status)
+	if isRetryableStatus(resp.StatusCode) {
+		return &retryableError{err: err, delay: retryAfter(resp)}
+	}
+	return err
+}
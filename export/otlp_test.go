@@ -0,0 +1,358 @@
+package export
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abrampers/inkle/grpc"
+	"github.com/abrampers/inkle/logging"
+	"github.com/abrampers/inkle/protobuf"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+var (
+	tstart = time.Date(2020, 4, 1, 10, 30, 0, 0, time.UTC)
+	tend   = tstart.Add(161626 * time.Microsecond)
+	// local is the network of the server of testRecord.
+	local = &net.IPNet{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(24, 32)}
+)
+
+// testRecord returns the record of a call from 10.0.1.7:58108 to
+// 10.0.0.2:8000 which ended with status.
+func testRecord(status int, fields *logging.Fields) logging.Record {
+	return logging.Record{
+		SchemaVersion: logging.SchemaVersion,
+		EventID:       "d96763c9-a9a4-49d0-9008-b63befa85b6d",
+		StartTime:     &tstart,
+		EndTime:       &tend,
+		Service:       "helloworld.Greeter",
+		Method:        "SayHello",
+		Source:        logging.Endpoint{IP: "10.0.1.7", Port: 58108},
+		Destination:   logging.Endpoint{IP: "10.0.0.2", Port: 8000},
+		Status:        &logging.Status{Code: status, Name: []string{"OK", "CANCELLED", "UNKNOWN", "INVALID_ARGUMENT", "DEADLINE_EXCEEDED"}[status]},
+		DurationMs:    161.626,
+		Info:          "Request - Response",
+		Fields:        fields,
+	}
+}
+
+// first returns the first field number of data, decoded as a message.
+func first(t *testing.T, data []byte, number int) protobuf.Field {
+	all := all(t, data, number)
+	if len(all) == 0 {
+		t.Fatalf("Field %d is missing from %v", number, data)
+	}
+	return all[0]
+}
+
+// all returns the fields number of data.
+func all(t *testing.T, data []byte, number int) []protobuf.Field {
+	fields, err := protobuf.Decode(data)
+	if err != nil {
+		t.Fatalf("Failed to decode %v: %v", data, err)
+	}
+	ret := []protobuf.Field{}
+	for _, field := range fields {
+		if field.Number == number {
+			ret = append(ret, field)
+		}
+	}
+	return ret
+}
+
+// attributes returns the string and int KeyValues number of data.
+func attributes(t *testing.T, data []byte, number int) map[string]string {
+	ret := map[string]string{}
+	for _, kv := range all(t, data, number) {
+		value := first(t, kv.Bytes, 2)
+		if fields := all(t, value.Bytes, 1); len(fields) > 0 {
+			ret[string(first(t, kv.Bytes, 1).Bytes)] = string(fields[0].Bytes)
+		} else {
+			ret[string(first(t, kv.Bytes, 1).Bytes)] = fmt.Sprint(int64(first(t, value.Bytes, 3).Value))
+		}
+	}
+	return ret
+}
+
+// spans returns the spans of an ExportTraceServiceRequest.
+func spans(t *testing.T, request []byte) [][]byte {
+	resourcespans := first(t, request, 1).Bytes
+	scopespans := first(t, resourcespans, 2).Bytes
+	ret := [][]byte{}
+	for _, span := range all(t, scopespans, 2) {
+		ret = append(ret, span.Bytes)
+	}
+	return ret
+}
+
+func TestOTLPSinkSpan(t *testing.T) {
+	sampled := true
+	tests := []struct {
+		record     logging.Record
+		local      *net.IPNet
+		traceid    string
+		spanid     string
+		parentid   string
+		kind       uint64
+		attributes map[string]string
+		status     string
+	}{
+		{
+			record:   testRecord(0, &logging.Fields{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", TraceSampled: &sampled}),
+			local:    local,
+			traceid:  "4bf92f3577b34da6a3ce929d0e0e4736",
+			spanid:   "9008b63befa85b6d",
+			parentid: "00f067aa0ba902b7",
+			kind:     spanKindServer,
+			attributes: map[string]string{
+				"rpc.system":           "grpc",
+				"rpc.service":          "helloworld.Greeter",
+				"rpc.method":           "SayHello",
+				"rpc.grpc.status_code": "0",
+				"net.peer.ip":          "10.0.1.7",
+				"net.peer.port":        "58108",
+				"inkle.event_id":       "d96763c9-a9a4-49d0-9008-b63befa85b6d",
+				"inkle.info":           "Request - Response",
+				"inkle.trace_id":       "4bf92f3577b34da6a3ce929d0e0e4736",
+				"inkle.span_id":        "00f067aa0ba902b7",
+				"inkle.trace_sampled":  "true",
+			},
+		},
+		{
+			// The span propagated is the parent of the observed RPC.
+			record:   testRecord(4, &logging.Fields{TraceID: "a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", ParentSpanID: "6e0c63257de34c92"}),
+			local:    &net.IPNet{},
+			traceid:  "0000000000000000a3ce929d0e0e4736",
+			spanid:   "9008b63befa85b6d",
+			parentid: "00f067aa0ba902b7",
+			kind:     spanKindClient,
+			attributes: map[string]string{
+				"rpc.system":           "grpc",
+				"rpc.service":          "helloworld.Greeter",
+				"rpc.method":           "SayHello",
+				"rpc.grpc.status_code": "4",
+				"net.peer.ip":          "10.0.0.2",
+				"net.peer.port":        "8000",
+				"inkle.event_id":       "d96763c9-a9a4-49d0-9008-b63befa85b6d",
+				"inkle.info":           "Request - Response",
+				"inkle.trace_id":       "a3ce929d0e0e4736",
+				"inkle.span_id":        "00f067aa0ba902b7",
+				"inkle.parent_span_id": "6e0c63257de34c92",
+			},
+			status: "DEADLINE_EXCEEDED",
+		},
+		{
+			record:   testRecord(0, nil),
+			local:    local,
+			traceid:  "d96763c9a9a449d09008b63befa85b6d",
+			spanid:   "9008b63befa85b6d",
+			parentid: "",
+			kind:     spanKindServer,
+			attributes: map[string]string{
+				"rpc.system":           "grpc",
+				"rpc.service":          "helloworld.Greeter",
+				"rpc.method":           "SayHello",
+				"rpc.grpc.status_code": "0",
+				"net.peer.ip":          "10.0.1.7",
+				"net.peer.port":        "58108",
+				"inkle.event_id":       "d96763c9-a9a4-49d0-9008-b63befa85b6d",
+				"inkle.info":           "Request - Response",
+			},
+		},
+	}
+
+	for i, test := range tests {
+		s := &OTLPSink{local: test.local}
+		span := s.span(test.record)
+		if id := hex.EncodeToString(first(t, span, 1).Bytes); id != test.traceid {
+			t.Errorf("span (testcase %d): has trace_id %s while it should be %s", i, id, test.traceid)
+		}
+		if id := hex.EncodeToString(first(t, span, 2).Bytes); id != test.spanid {
+			t.Errorf("span (testcase %d): has span_id %s while it should be %s", i, id, test.spanid)
+		}
+		parentid := ""
+		if fields := all(t, span, 4); len(fields) > 0 {
+			parentid = hex.EncodeToString(fields[0].Bytes)
+		}
+		if parentid != test.parentid {
+			t.Errorf("span (testcase %d): has parent_span_id %s while it should be %s", i, parentid, test.parentid)
+		}
+		if name := string(first(t, span, 5).Bytes); name != "helloworld.Greeter/SayHello" {
+			t.Errorf("span (testcase %d): is named %s while it should be helloworld.Greeter/SayHello", i, name)
+		}
+		if kind := first(t, span, 6).Value; kind != test.kind {
+			t.Errorf("span (testcase %d): has kind %d while it should be %d", i, kind, test.kind)
+		}
+		if start, end := first(t, span, 7).Value, first(t, span, 8).Value; start != uint64(tstart.UnixNano()) || end != uint64(tend.UnixNano()) {
+			t.Errorf("span (testcase %d): lasts from %d to %d while it should last from %d to %d", i, start, end, tstart.UnixNano(), tend.UnixNano())
+		}
+		if attributes := attributes(t, span, 9); !reflect.DeepEqual(attributes, test.attributes) {
+			t.Errorf("span (testcase %d): has attributes %v while it should have %v", i, attributes, test.attributes)
+		}
+		status := ""
+		if fields := all(t, span, 15); len(fields) > 0 {
+			status = string(first(t, fields[0].Bytes, 2).Bytes)
+			if code := first(t, fields[0].Bytes, 3).Value; code != statusCodeError {
+				t.Errorf("span (testcase %d): has status code %d while it should be %d", i, code, statusCodeError)
+			}
+		}
+		if status != test.status {
+			t.Errorf("span (testcase %d): has status '%s' while it should be '%s'", i, status, test.status)
+		}
+	}
+}
+
+func TestOTLPSinkHTTP(t *testing.T) {
+	requests := [][]byte{}
+	statuses := []int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, body)
+		status := statuses[0]
+		statuses = statuses[1:]
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	timeout := testRecord(0, nil)
+	timeout.Status, timeout.Info = nil, "Request - TIMEOUT"
+	records := []logging.Record{
+		testRecord(0, nil),
+		{Info: "CONNECTION_OPEN"},
+		testRecord(0, &logging.Fields{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", TraceSampled: new(bool)}),
+		timeout,
+	}
+	tests := []struct {
+		statuses []int
+		requests int
+		ok       bool
+	}{
+		{
+			statuses: []int{http.StatusOK},
+			requests: 1,
+			ok:       true,
+		},
+		{
+			statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK},
+			requests: 3,
+			ok:       true,
+		},
+		{
+			statuses: []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+			requests: 3,
+			ok:       false,
+		},
+		{
+			statuses: []int{http.StatusBadRequest},
+			requests: 1,
+			ok:       false,
+		},
+	}
+
+	for i, test := range tests {
+		s, err := NewOTLPSink(server.URL, OTLPHTTP, time.Second, Backoff{Initial: time.Millisecond, Max: time.Millisecond, Retries: 2}, local)
+		if err != nil {
+			t.Fatalf("NewOTLPSink (testcase %d): returns err = '%v'", i, err)
+		}
+		requests, statuses = nil, test.statuses
+		err = s.export(records)
+		if test.ok && err != nil {
+			t.Errorf("export (testcase %d): returns err = '%v', where there should be no error", i, err)
+		} else if !test.ok && err == nil {
+			t.Errorf("export (testcase %d): returns no err, where there should be error", i)
+		}
+		if len(requests) != test.requests {
+			t.Errorf("export (testcase %d): sends %d requests while it should send %d", i, len(requests), test.requests)
+			continue
+		}
+		// The connection and the call left out by sampling aren't spans.
+		if spans := spans(t, requests[0]); len(spans) != 2 {
+			t.Errorf("export (testcase %d): sends %d spans while it should send 2", i, len(spans))
+		}
+		resource := first(t, first(t, requests[0], 1).Bytes, 1).Bytes
+		if service := attributes(t, resource, 1)["service.name"]; service != "inkle" {
+			t.Errorf("export (testcase %d): sends resource service.name %s while it should be inkle", i, service)
+		}
+	}
+}
+
+func TestOTLPSinkGRPC(t *testing.T) {
+	var request []byte
+	status := "0"
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != otlpExportPath {
+			status = "12"
+		}
+		data, _ := ioutil.ReadAll(r.Body)
+		if messages := grpc.Messages(data); len(messages) > 0 {
+			request = messages[0].Payload
+		}
+		w.Header().Set("content-type", "application/grpc")
+		w.Header().Set("trailer", "grpc-status")
+		w.WriteHeader(http.StatusOK)
+		if status == "0" {
+			w.Write(grpc.AppendMessage(nil, nil))
+		}
+		w.Header().Set("grpc-status", status)
+	})
+	server := httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+	defer server.Close()
+
+	s, err := NewOTLPSink(server.URL, OTLPGRPC, time.Second, Backoff{Initial: time.Millisecond, Max: time.Millisecond}, local)
+	if err != nil {
+		t.Fatalf("NewOTLPSink: returns err = '%v'", err)
+	}
+	if err := s.export([]logging.Record{testRecord(0, nil)}); err != nil {
+		t.Errorf("export: returns err = '%v', where there should be no error", err)
+	}
+	if spans := spans(t, request); len(spans) != 1 || !bytes.Equal(first(t, spans[0], 5).Bytes, []byte("helloworld.Greeter/SayHello")) {
+		t.Errorf("export: sends spans %v while it should send the span of helloworld.Greeter/SayHello", spans)
+	}
+
+	status = "3"
+	if err := s.export([]logging.Record{testRecord(0, nil)}); err == nil || !strings.Contains(err.Error(), "status 3") {
+		t.Errorf("export: returns err = '%v' while it should fail with status 3", err)
+	}
+}
+
+func TestNewOTLPSink(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		protocol string
+		want     string
+		ok       bool
+	}{
+		{endpoint: "http://collector:4318", protocol: OTLPHTTP, want: "http://collector:4318/v1/traces", ok: true},
+		{endpoint: "https://collector/otlp/v1/traces", protocol: OTLPHTTP, want: "https://collector/otlp/v1/traces", ok: true},
+		{endpoint: "collector:4317", protocol: OTLPGRPC, want: "collector:4317", ok: true},
+		{endpoint: "http://collector:4317", protocol: OTLPGRPC, want: "collector:4317", ok: true},
+		{endpoint: "collector", protocol: OTLPGRPC, ok: false},
+		{endpoint: "collector:4318", protocol: OTLPHTTP, ok: false},
+		{endpoint: "collector:4318", protocol: "udp", ok: false},
+	}
+
+	for i, test := range tests {
+		ret, err := NewOTLPSink(test.endpoint, test.protocol, time.Second, DefaultBackoff, local)
+		if test.ok && err != nil {
+			t.Errorf("NewOTLPSink (testcase %d): returns err = '%v', where there should be no error", i, err)
+		} else if !test.ok && err == nil {
+			t.Errorf("NewOTLPSink (testcase %d): returns no err, where there should be error", i)
+		} else if test.ok && ret.endpoint != test.want {
+			t.Errorf("NewOTLPSink (testcase %d): exports to %s while it should export to %s", i, ret.endpoint, test.want)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package export
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Backoff retries the exports failing with a retryable error, waiting
+// Initial then twice as long each time up to Max, Retries times at most.
+type Backoff struct {
+	Initial time.Duration
+	Max     time.Duration
+	Retries int
+}
+
+var DefaultBackoff = Backoff{Initial: 500 * time.Millisecond, Max: 30 * time.Second, Retries: 5}
+
+// retryableError is an error of an export worth retrying, after delay if it
+// isn't zero and shorter than the Max of the backoff.
+type retryableError struct {
+	err   error
+	delay time.Duration
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func retryable(err error) error {
+	return &retryableError{err: err}
+}
+
+// Do calls send until it succeeds or fails with an error which isn't
+// retryable.
+func (b Backoff) Do(send func() error) error {
+	delay := b.Initial
+	for attempt := 0; ; attempt++ {
+		err := send()
+		r, ok := err.(*retryableError)
+		if !ok {
+			return err
+		}
+		if attempt >= b.Retries {
+			return r.err
+		}
+		wait := delay
+		if r.delay > 0 && r.delay < b.Max {
+			wait = r.delay
+		}
+		time.Sleep(wait)
+		if delay *= 2; delay > b.Max {
+			delay = b.Max
+		}
+	}
+}
+
+// isRetryableStatus returns whether an HTTP request failing with status may
+// succeed later.
+func isRetryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter returns the delay of the Retry-After header of resp, in seconds,
+// or zero.
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,60 @@
+package export
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestBackoffDo(t *testing.T) {
+	backoff := Backoff{Initial: time.Millisecond, Max: 2 * time.Millisecond, Retries: 3}
+	tests := []struct {
+		errs  []error
+		calls int
+		ok    bool
+	}{
+		{
+			errs:  []error{nil},
+			calls: 1,
+			ok:    true,
+		},
+		{
+			errs:  []error{retryable(fmt.Errorf("unavailable")), &retryableError{err: fmt.Errorf("busy"), delay: time.Hour}, nil},
+			calls: 3,
+			ok:    true,
+		},
+		{
+			errs:  []error{retryable(fmt.Errorf("unavailable")), fmt.Errorf("bad request")},
+			calls: 2,
+			ok:    false,
+		},
+		{
+			errs:  []error{retryable(fmt.Errorf("1")), retryable(fmt.Errorf("2")), retryable(fmt.Errorf("3")), retryable(fmt.Errorf("4")), nil},
+			calls: 4,
+			ok:    false,
+		},
+	}
+
+	for i, test := range tests {
+		calls := 0
+		start := time.Now()
+		err := backoff.Do(func() error {
+			calls++
+			return test.errs[calls-1]
+		})
+		if test.ok && err != nil {
+			t.Errorf("Do (testcase %d): returns err = '%v', where there should be no error", i, err)
+		} else if !test.ok && err == nil {
+			t.Errorf("Do (testcase %d): returns no err, where there should be error", i)
+		} else if _, ok := err.(*retryableError); ok {
+			t.Errorf("Do (testcase %d): returns a retryable error", i)
+		}
+		if calls != test.calls {
+			t.Errorf("Do (testcase %d): calls %d times while it should call %d times", i, calls, test.calls)
+		}
+		// Retry-After delays longer than Max aren't waited for.
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("Do (testcase %d): waits %s", i, elapsed)
+		}
+	}
+}
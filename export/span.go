@@ -0,0 +1,69 @@
+package export
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+
+	"github.com/abrampers/inkle/logging"
+	"github.com/google/uuid"
+)
+
+// spanContext is the identity of the span of an RPC.
+type spanContext struct {
+	traceid      []byte
+	spanid       []byte
+	parentspanid []byte
+	tracestate   string
+	// eventspanid is the span ID derived from the event of the RPC.
+	eventspanid []byte
+}
+
+// isSpan returns whether r is an RPC whose span is exported: a call seen
+// from its request, not left out by the sampling of its trace.
+func isSpan(r logging.Record) bool {
+	return r.Service != "" && r.StartTime != nil && r.EndTime != nil && (r.Fields == nil || r.Fields.TraceSampled == nil || *r.Fields.TraceSampled)
+}
+
+// newSpanContext returns the trace context propagated by the call, or a new
+// one derived from the ID of the event. 64-bit trace IDs of B3 are padded.
+func newSpanContext(r logging.Record) spanContext {
+	f := r.Fields
+	if f == nil {
+		f = &logging.Fields{}
+	}
+	traceid := decodeID(f.TraceID, 16)
+	spanid := decodeID(f.SpanID, 8)
+	id, _ := uuid.Parse(r.EventID)
+	if traceid == nil || spanid == nil {
+		return spanContext{traceid: id[:], spanid: id[8:], eventspanid: id[8:]}
+	}
+	return spanContext{traceid: traceid, spanid: spanid, parentspanid: decodeID(f.ParentSpanID, 8), tracestate: f.TraceState, eventspanid: id[8:]}
+}
+
+// childSpanContext returns the context of a new span of the RPC, child of
+// the span propagated by the call, if any, for the exporters whose spans
+// aren't shared by the client and the server.
+func childSpanContext(r logging.Record) spanContext {
+	ctx := newSpanContext(r)
+	if !bytes.Equal(ctx.spanid, ctx.eventspanid) {
+		ctx.parentspanid, ctx.spanid = ctx.spanid, ctx.eventspanid
+	}
+	return ctx
+}
+
+// decodeID decodes a hex ID of at most size bytes, left padded with zeros,
+// nil if it is invalid or zero.
+func decodeID(s string, size int) []byte {
+	if s == "" || len(s) > 2*size || strings.Trim(s, "0") == "" {
+		return nil
+	}
+	if len(s)%2 == 1 {
+		s = "0" + s
+	}
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		return nil
+	}
+	return append(make([]byte, size-len(data)), data...)
+}
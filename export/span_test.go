@@ -0,0 +1,29 @@
+package export
+
+import (
+	"bytes"
+	"testing"
+)
+
+func Test_decodeID(t *testing.T) {
+	tests := []struct {
+		input string
+		size  int
+		want  []byte
+	}{
+		{input: "00f067aa0ba902b7", size: 8, want: []byte{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7}},
+		{input: "a3ce929d0e0e4736", size: 16, want: []byte{0, 0, 0, 0, 0, 0, 0, 0, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36}},
+		{input: "f067aa0ba902b7", size: 8, want: []byte{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7}},
+		{input: "67aa0ba902b7", size: 8, want: []byte{0x00, 0x00, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7}},
+		{input: "", size: 8, want: nil},
+		{input: "0000000000000000", size: 8, want: nil},
+		{input: "00f067aa0ba902b7ff", size: 8, want: nil},
+		{input: "zzf067aa0ba902b7", size: 8, want: nil},
+	}
+
+	for i, test := range tests {
+		if ret := decodeID(test.input, test.size); !bytes.Equal(ret, test.want) {
+			t.Errorf("decodeID(%s) (testcase %d): returns %x while it should be %x", test.input, i, ret, test.want)
+		}
+	}
+}
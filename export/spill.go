@@ -0,0 +1,111 @@
+package export
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const spillSuffix = ".ndjson"
+
+// Spill keeps the payloads which couldn't be exported in files of a
+// directory, up to maxsize bytes, to export them later in the order they
+// were spilled. The oldest payloads are removed to make room for new ones.
+type Spill struct {
+	dir     string
+	maxsize int64
+	seq     int
+}
+
+// OpenSpill returns the spill of dir, created if needed. Payloads spilled
+// before, e.g. by a previous run, are kept.
+func OpenSpill(dir string, maxsize int64) (*Spill, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Spill{dir: dir, maxsize: maxsize}, nil
+}
+
+// Push writes payload to a new file of the spill, then removes the oldest
+// files past the size of the spill.
+func (s *Spill) Push(payload []byte) error {
+	s.seq++
+	name := filepath.Join(s.dir, fmt.Sprintf("%020d-%06d%s", time.Now().UnixNano(), s.seq%1000000, spillSuffix))
+	// Files are written under a temporary name, so that a crash doesn't
+	// leave a truncated payload to replay.
+	if err := ioutil.WriteFile(name+".tmp", payload, 0644); err != nil {
+		os.Remove(name + ".tmp")
+		return err
+	}
+	if err := os.Rename(name+".tmp", name); err != nil {
+		return err
+	}
+	return s.prune()
+}
+
+// Replay sends the spilled payloads, oldest first, removing each one sent,
+// and stops at the first failing.
+func (s *Spill) Replay(send func(payload []byte) error) error {
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		name := filepath.Join(s.dir, f.Name())
+		payload, err := ioutil.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		if err := send(payload); err != nil {
+			return err
+		}
+		if err := os.Remove(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Spill) prune() error {
+	if s.maxsize <= 0 {
+		return nil
+	}
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+	size := int64(0)
+	for _, f := range files {
+		size += f.Size()
+	}
+	for _, f := range files {
+		if size <= s.maxsize {
+			break
+		}
+		if err := os.Remove(filepath.Join(s.dir, f.Name())); err != nil {
+			return err
+		}
+		size -= f.Size()
+	}
+	return nil
+}
+
+// files returns the spilled files, oldest first.
+func (s *Spill) files() ([]os.FileInfo, error) {
+	infos, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	files := []os.FileInfo{}
+	for _, info := range infos {
+		if info.Mode().IsRegular() && strings.HasSuffix(info.Name(), spillSuffix) {
+			files = append(files, info)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+	return files, nil
+}
@@ -0,0 +1,63 @@
+package export
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSpill(t *testing.T) {
+	tests := []struct {
+		maxsize  int64
+		payloads []string
+		failat   int
+		want     []string
+		kept     int
+	}{
+		{maxsize: 0, payloads: []string{"1", "2", "3"}, failat: -1, want: []string{"1", "2", "3"}, kept: 0},
+		{maxsize: 2, payloads: []string{"1", "2", "3"}, failat: -1, want: []string{"2", "3"}, kept: 0},
+		{maxsize: 0, payloads: []string{"1", "2", "3"}, failat: 1, want: []string{"1", "2"}, kept: 2},
+	}
+
+	for i, test := range tests {
+		dir, err := ioutil.TempDir("", "TestSpill")
+		if err != nil {
+			t.Fatalf("Spill (testcase %d): %v", i, err)
+		}
+		defer os.RemoveAll(dir)
+		// Files left by a crash while spilling are ignored.
+		ioutil.WriteFile(filepath.Join(dir, "00000000000000000001-000001.ndjson.tmp"), []byte("0"), 0644)
+
+		s, err := OpenSpill(filepath.Join(dir, "spill"), test.maxsize)
+		if err != nil {
+			t.Fatalf("OpenSpill (testcase %d): returns err = '%v'", i, err)
+		}
+		for _, payload := range test.payloads {
+			if err := s.Push([]byte(payload)); err != nil {
+				t.Errorf("Push (testcase %d): returns err = '%v', where there should be no error", i, err)
+			}
+		}
+		sent := []string{}
+		err = s.Replay(func(payload []byte) error {
+			sent = append(sent, string(payload))
+			if len(sent)-1 == test.failat {
+				return fmt.Errorf("unavailable")
+			}
+			return nil
+		})
+		if test.failat == -1 && err != nil {
+			t.Errorf("Replay (testcase %d): returns err = '%v', where there should be no error", i, err)
+		} else if test.failat != -1 && err == nil {
+			t.Errorf("Replay (testcase %d): returns no err, where there should be error", i)
+		}
+		if !reflect.DeepEqual(sent, test.want) {
+			t.Errorf("Replay (testcase %d): sends %v while it should send %v", i, sent, test.want)
+		}
+		if files, _ := s.files(); len(files) != test.kept {
+			t.Errorf("Replay (testcase %d): keeps %d files while it should keep %d", i, len(files), test.kept)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package export
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/abrampers/inkle/logging"
+)
+
+const zipkinSpansPath = "/api/v2/spans"
+
+// ZipkinSink posts the RPCs as Zipkin v2 spans to a Zipkin collector.
+type ZipkinSink struct {
+	url     string
+	client  *http.Client
+	backoff Backoff
+	local   *net.IPNet
+}
+
+// zipkinSpan is a span of the Zipkin v2 API.
+type zipkinSpan struct {
+	TraceID        string            `json:"traceId"`
+	ID             string            `json:"id"`
+	ParentID       string            `json:"parentId,omitempty"`
+	Name           string            `json:"name"`
+	Kind           string            `json:"kind"`
+	Timestamp      int64             `json:"timestamp"`
+	Duration       int64             `json:"duration"`
+	Shared         bool              `json:"shared,omitempty"`
+	LocalEndpoint  zipkinEndpoint    `json:"localEndpoint"`
+	RemoteEndpoint zipkinEndpoint    `json:"remoteEndpoint"`
+	Tags           map[string]string `json:"tags"`
+}
+
+type zipkinEndpoint struct {
+	ServiceName string `json:"serviceName,omitempty"`
+	IPv4        string `json:"ipv4,omitempty"`
+	IPv6        string `json:"ipv6,omitempty"`
+	Port        uint16 `json:"port,omitempty"`
+}
+
+// NewZipkinSink returns a sink posting to rawurl, the URL of a Zipkin
+// collector, e.g. http://zipkin:9411. Calls are posted as SERVER spans when
+// their server is in local, as CLIENT spans otherwise.
+func NewZipkinSink(rawurl string, timeout time.Duration, backoff Backoff, local *net.IPNet) (*ZipkinSink, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("Invalid Zipkin URL %s", rawurl)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = zipkinSpansPath
+	}
+	return &ZipkinSink{url: u.String(), client: &http.Client{Timeout: timeout}, backoff: backoff, local: local}, nil
+}
+
+func (s *ZipkinSink) Write(events []logging.EventLog) error {
+	return s.export(logging.Records(events))
+}
+
+func (s *ZipkinSink) export(records []logging.Record) error {
+	spans := []zipkinSpan{}
+	for _, r := range records {
+		if isSpan(r) {
+			spans = append(spans, s.span(r))
+		}
+	}
+	if len(spans) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(spans)
+	if err != nil {
+		return err
+	}
+	return s.backoff.Do(func() error { return s.send(body) })
+}
+
+// span returns the Zipkin span of r. A SERVER span reusing the B3 IDs of
+// the call shares them with the CLIENT span of the caller.
+func (s *ZipkinSink) span(r logging.Record) zipkinSpan {
+	ctx := newSpanContext(r)
+	client, server := zipkinEndpointOf(r.Source), zipkinEndpointOf(r.Destination)
+	server.ServiceName = r.Service
+	span := zipkinSpan{
+		TraceID:        zipkinID(ctx.traceid),
+		ID:             hex.EncodeToString(ctx.spanid),
+		Name:           r.Service + "/" + r.Method,
+		Kind:           "CLIENT",
+		Timestamp:      r.StartTime.UnixNano() / int64(time.Microsecond),
+		Duration:       r.EndTime.Sub(*r.StartTime).Nanoseconds() / int64(time.Microsecond),
+		LocalEndpoint:  client,
+		RemoteEndpoint: server,
+		Tags:           map[string]string{"inkle.event_id": r.EventID, "inkle.info": r.Info},
+	}
+	if ctx.parentspanid != nil {
+		span.ParentID = hex.EncodeToString(ctx.parentspanid)
+	}
+	if r.IsServerSide(s.local) {
+		span.Kind, span.LocalEndpoint, span.RemoteEndpoint = "SERVER", server, client
+		span.Shared = r.Fields != nil && r.Fields.SpanID != ""
+	}
+	// Zipkin rejects spans shorter than a microsecond.
+	if span.Duration < 1 {
+		span.Duration = 1
+	}
+
+	if r.Status != nil {
+		span.Tags["grpc.status_code"] = fmt.Sprint(r.Status.Code)
+		if r.Status.Code != 0 {
+			span.Tags["error"] = r.Status.Name
+		}
+	} else {
+		span.Tags["error"] = r.Info
+	}
+	for key, value := range r.Fields.Attributes() {
+		span.Tags["inkle."+key] = value
+	}
+	return span
+}
+
+// zipkinID encodes a trace ID, as 64 bits when its high bits are zero.
+func zipkinID(id []byte) string {
+	if len(id) == 16 && bytes.Equal(id[:8], make([]byte, 8)) {
+		id = id[8:]
+	}
+	return hex.EncodeToString(id)
+}
+
+func zipkinEndpointOf(endpoint logging.Endpoint) zipkinEndpoint {
+	ip := net.ParseIP(endpoint.IP)
+	if ip.To4() != nil {
+		return zipkinEndpoint{IPv4: ip.String(), Port: endpoint.Port}
+	}
+	return zipkinEndpoint{IPv6: endpoint.IP, Port: endpoint.Port}
+}
+
+func (s *ZipkinSink) send(body []byte) error {
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return retryable(err)
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("Zipkin %s returned %s", s.url, resp.Status)
+	if isRetryableStatus(resp.StatusCode) {
+		return &retryableError{err: err, delay: retryAfter(resp)}
+	}
+	return err
+}
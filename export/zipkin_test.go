@@ -0,0 +1,163 @@
+package export
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/abrampers/inkle/logging"
+)
+
+func TestZipkinSinkSpan(t *testing.T) {
+	client := zipkinEndpoint{IPv4: "10.0.1.7", Port: 58108}
+	server := zipkinEndpoint{ServiceName: "helloworld.Greeter", IPv4: "10.0.0.2", Port: 8000}
+	timeout := testRecord(0, nil)
+	timeout.Status, timeout.Info = nil, "Request - TIMEOUT"
+	tests := []struct {
+		record logging.Record
+		local  *net.IPNet
+		want   zipkinSpan
+	}{
+		{
+			record: testRecord(0, &logging.Fields{TraceID: "a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", ParentSpanID: "6e0c63257de34c92"}),
+			local:  local,
+			want: zipkinSpan{
+				TraceID:        "a3ce929d0e0e4736",
+				ID:             "00f067aa0ba902b7",
+				ParentID:       "6e0c63257de34c92",
+				Name:           "helloworld.Greeter/SayHello",
+				Kind:           "SERVER",
+				Timestamp:      tstart.UnixNano() / 1000,
+				Duration:       161626,
+				Shared:         true,
+				LocalEndpoint:  server,
+				RemoteEndpoint: client,
+				Tags: map[string]string{
+					"grpc.status_code":     "0",
+					"inkle.event_id":       "d96763c9-a9a4-49d0-9008-b63befa85b6d",
+					"inkle.info":           "Request - Response",
+					"inkle.trace_id":       "a3ce929d0e0e4736",
+					"inkle.span_id":        "00f067aa0ba902b7",
+					"inkle.parent_span_id": "6e0c63257de34c92",
+				},
+			},
+		},
+		{
+			record: testRecord(4, &logging.Fields{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7"}),
+			local:  &net.IPNet{},
+			want: zipkinSpan{
+				TraceID:        "4bf92f3577b34da6a3ce929d0e0e4736",
+				ID:             "00f067aa0ba902b7",
+				Name:           "helloworld.Greeter/SayHello",
+				Kind:           "CLIENT",
+				Timestamp:      tstart.UnixNano() / 1000,
+				Duration:       161626,
+				LocalEndpoint:  client,
+				RemoteEndpoint: server,
+				Tags: map[string]string{
+					"grpc.status_code": "4",
+					"error":            "DEADLINE_EXCEEDED",
+					"inkle.event_id":   "d96763c9-a9a4-49d0-9008-b63befa85b6d",
+					"inkle.info":       "Request - Response",
+					"inkle.trace_id":   "4bf92f3577b34da6a3ce929d0e0e4736",
+					"inkle.span_id":    "00f067aa0ba902b7",
+				},
+			},
+		},
+		{
+			record: timeout,
+			local:  local,
+			want: zipkinSpan{
+				TraceID:        "d96763c9a9a449d09008b63befa85b6d",
+				ID:             "9008b63befa85b6d",
+				Name:           "helloworld.Greeter/SayHello",
+				Kind:           "SERVER",
+				Timestamp:      tstart.UnixNano() / 1000,
+				Duration:       161626,
+				LocalEndpoint:  server,
+				RemoteEndpoint: client,
+				Tags: map[string]string{
+					"error":          "Request - TIMEOUT",
+					"inkle.event_id": "d96763c9-a9a4-49d0-9008-b63befa85b6d",
+					"inkle.info":     "Request - TIMEOUT",
+				},
+			},
+		},
+	}
+
+	for i, test := range tests {
+		s := &ZipkinSink{local: test.local}
+		if ret := s.span(test.record); !reflect.DeepEqual(ret, test.want) {
+			t.Errorf("span (testcase %d): returns %+v while it should be %+v", i, ret, test.want)
+		}
+	}
+}
+
+func Test_zipkinEndpointOf(t *testing.T) {
+	tests := []struct {
+		input logging.Endpoint
+		want  zipkinEndpoint
+	}{
+		{input: logging.Endpoint{IP: "10.0.0.2", Port: 8000}, want: zipkinEndpoint{IPv4: "10.0.0.2", Port: 8000}},
+		{input: logging.Endpoint{IP: "::1", Port: 8000}, want: zipkinEndpoint{IPv6: "::1", Port: 8000}},
+	}
+
+	for i, test := range tests {
+		if ret := zipkinEndpointOf(test.input); ret != test.want {
+			t.Errorf("zipkinEndpointOf (testcase %d): returns %+v while it should be %+v", i, ret, test.want)
+		}
+	}
+}
+
+func TestZipkinSinkExport(t *testing.T) {
+	var spans []map[string]interface{}
+	statuses := []int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/spans" || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		spans = nil
+		json.Unmarshal(body, &spans)
+		status := statuses[0]
+		statuses = statuses[1:]
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	records := []logging.Record{testRecord(0, nil), {Info: "CONNECTION_OPEN"}, testRecord(2, nil)}
+	tests := []struct {
+		statuses []int
+		ok       bool
+	}{
+		{statuses: []int{http.StatusAccepted}, ok: true},
+		{statuses: []int{http.StatusServiceUnavailable, http.StatusAccepted}, ok: true},
+		{statuses: []int{http.StatusBadRequest}, ok: false},
+	}
+
+	for i, test := range tests {
+		s, err := NewZipkinSink(server.URL, time.Second, Backoff{Initial: time.Millisecond, Max: time.Millisecond, Retries: 2}, local)
+		if err != nil {
+			t.Fatalf("NewZipkinSink (testcase %d): returns err = '%v'", i, err)
+		}
+		statuses = test.statuses
+		err = s.export(records)
+		if test.ok && err != nil {
+			t.Errorf("export (testcase %d): returns err = '%v', where there should be no error", i, err)
+		} else if !test.ok && err == nil {
+			t.Errorf("export (testcase %d): returns no err, where there should be error", i)
+		}
+		if len(statuses) != 0 {
+			t.Errorf("export (testcase %d): sends %d requests less than it should", i, len(statuses))
+		}
+		if len(spans) != 2 || spans[0]["kind"] != "SERVER" || spans[1]["name"] != "helloworld.Greeter/SayHello" {
+			t.Errorf("export (testcase %d): posts %v while it should post the spans of the calls", i, spans)
+		}
+	}
+}
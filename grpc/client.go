@@ -0,0 +1,100 @@
+package grpc
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// maxResponseSize bounds the size of the responses read by Invoke, as the
+// default maximum message size of gRPC servers.
+const maxResponseSize = 4 << 20
+
+// NewClient returns an HTTP client speaking cleartext HTTP/2 (h2c), which is
+// what plaintext gRPC servers expect.
+func NewClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network string, addr string, cfg *tls.Config) (net.Conn, error) {
+				return net.DialTimeout(network, addr, timeout)
+			},
+		},
+	}
+}
+
+// StatusError is the error of a gRPC call which failed with a non-OK
+// grpc-status.
+type StatusError struct {
+	Code    string
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("gRPC call failed with status %s: %s", e.Code, e.Message)
+}
+
+// AppendMessage appends payload to b as an uncompressed length-prefixed gRPC
+// message.
+func AppendMessage(b []byte, payload []byte) []byte {
+	length := uint32(len(payload))
+	b = append(b, 0, byte(length>>24), byte(length>>16), byte(length>>8), byte(length))
+	return append(b, payload...)
+}
+
+// Invoke sends a single request message to the gRPC method at path (e.g.
+// /helloworld.Greeter/SayHello) on authority and returns the payloads of the
+// response messages.
+func Invoke(client *http.Client, authority string, path string, request []byte) ([][]byte, error) {
+	req, err := http.NewRequest("POST", "http://"+authority+path, bytes.NewReader(AppendMessage(nil, request)))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("content-type", "application/grpc")
+	req.Header.Set("te", "trailers")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxResponseSize {
+		return nil, fmt.Errorf("Response larger than %d bytes", maxResponseSize)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Unexpected HTTP status %d", resp.StatusCode)
+	}
+
+	// Errors without a response message come in a trailers-only response.
+	status := resp.Trailer.Get("grpc-status")
+	message := resp.Trailer.Get("grpc-message")
+	if status == "" {
+		status = resp.Header.Get("grpc-status")
+		message = resp.Header.Get("grpc-message")
+	}
+	if status != "0" {
+		return nil, &StatusError{Code: status, Message: message}
+	}
+
+	payloads := [][]byte{}
+	for _, m := range Messages(data) {
+		if m.Compressed || m.IsTruncated() {
+			return nil, fmt.Errorf("Unsupported response message")
+		}
+		payloads = append(payloads, m.Payload)
+	}
+	return payloads, nil
+}
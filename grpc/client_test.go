@@ -0,0 +1,115 @@
+package grpc
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// newServer starts a cleartext HTTP/2 server which answers every gRPC call
+// through handle. Returning a non "0" status sends no response message.
+func newServer(handle func(path string, request []byte) ([][]byte, string)) *httptest.Server {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		request := []byte{}
+		if messages := Messages(data); len(messages) > 0 {
+			request = messages[0].Payload
+		}
+		responses, status := handle(r.URL.Path, request)
+
+		w.Header().Set("content-type", "application/grpc")
+		w.Header().Set("trailer", "grpc-status, grpc-message")
+		w.WriteHeader(http.StatusOK)
+		if status == "0" {
+			for _, response := range responses {
+				w.Write(AppendMessage(nil, response))
+			}
+		}
+		w.Header().Set("grpc-status", status)
+		if status != "0" {
+			w.Header().Set("grpc-message", "failure")
+		}
+	})
+	return httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+}
+
+func TestAppendMessage(t *testing.T) {
+	tests := []struct {
+		b, payload, want []byte
+	}{
+		{
+			payload: []byte{},
+			want:    []byte{0x00, 0x00, 0x00, 0x00, 0x00},
+		},
+		{
+			b:       []byte{0x01},
+			payload: []byte{0x0a, 0x05, 0x41, 0x62, 0x72, 0x61, 0x6d},
+			want:    []byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x07, 0x0a, 0x05, 0x41, 0x62, 0x72, 0x61, 0x6d},
+		},
+	}
+
+	for i, test := range tests {
+		if ret := AppendMessage(test.b, test.payload); !bytes.Equal(ret, test.want) {
+			t.Errorf("AppendMessage (testcase %d): returns %v while it should be %v", i, ret, test.want)
+		}
+	}
+}
+
+func TestInvoke(t *testing.T) {
+	server := newServer(func(path string, request []byte) ([][]byte, string) {
+		switch path {
+		case "/helloworld.Greeter/SayHello":
+			return [][]byte{append([]byte{0x0a, 0x0b}, []byte("Hello ")...), request}, "0"
+		default:
+			return nil, "12"
+		}
+	})
+	defer server.Close()
+	authority := strings.TrimPrefix(server.URL, "http://")
+	client := NewClient(time.Second)
+
+	tests := []struct {
+		authority, path string
+		request         []byte
+		want            [][]byte
+		err             bool
+	}{
+		{
+			authority: authority,
+			path:      "/helloworld.Greeter/SayHello",
+			request:   []byte("Abram"),
+			want:      [][]byte{append([]byte{0x0a, 0x0b}, []byte("Hello ")...), []byte("Abram")},
+		},
+		{
+			authority: authority,
+			path:      "/helloworld.Greeter/SayGoodbye",
+			request:   []byte("Abram"),
+			err:       true,
+		},
+		{
+			authority: "127.0.0.1:1",
+			path:      "/helloworld.Greeter/SayHello",
+			request:   []byte("Abram"),
+			err:       true,
+		},
+	}
+
+	for i, test := range tests {
+		ret, err := Invoke(client, test.authority, test.path, test.request)
+		if test.err && err == nil {
+			t.Errorf("Invoke (testcase %d): returns no error where there should be error", i)
+		} else if !test.err && err != nil {
+			t.Errorf("Invoke (testcase %d): returns error '%v' where there should be no error", i, err)
+		} else if !test.err && !reflect.DeepEqual(ret, test.want) {
+			t.Errorf("Invoke (testcase %d): returns %v while it should be %v", i, ret, test.want)
+		}
+	}
+}
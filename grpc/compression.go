@@ -0,0 +1,54 @@
+package grpc
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+var ErrMessageTooLarge = fmt.Errorf("Message exceeds the maximum size")
+
+// Decompress decompresses a message compressed with the grpc-encoding
+// encoding. It fails with ErrMessageTooLarge as soon as the decompressed
+// message grows past maxsize bytes.
+func Decompress(encoding string, data []byte, maxsize int) ([]byte, error) {
+	switch encoding {
+	case "", "identity":
+		if len(data) > maxsize {
+			return nil, ErrMessageTooLarge
+		}
+		return data, nil
+	case "gzip":
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return readAll(r, maxsize)
+	case "deflate":
+		// The deflate content-coding is zlib-wrapped, but some
+		// implementations send raw deflate streams.
+		if r, err := zlib.NewReader(bytes.NewReader(data)); err == nil {
+			return readAll(r, maxsize)
+		}
+		return readAll(flate.NewReader(bytes.NewReader(data)), maxsize)
+	case "snappy":
+		return decodeSnappy(data, maxsize)
+	}
+	return nil, fmt.Errorf("Unsupported grpc-encoding %s", encoding)
+}
+
+func readAll(r io.ReadCloser, maxsize int) ([]byte, error) {
+	defer r.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(r, int64(maxsize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxsize {
+		return nil, ErrMessageTooLarge
+	}
+	return data, nil
+}
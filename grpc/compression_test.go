@@ -0,0 +1,101 @@
+package grpc
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"testing"
+)
+
+func compress(encoding string, data []byte) []byte {
+	var b bytes.Buffer
+	switch encoding {
+	case "gzip":
+		w := gzip.NewWriter(&b)
+		w.Write(data)
+		w.Close()
+	case "deflate":
+		w := zlib.NewWriter(&b)
+		w.Write(data)
+		w.Close()
+	case "raw-deflate":
+		w, _ := flate.NewWriter(&b, flate.DefaultCompression)
+		w.Write(data)
+		w.Close()
+	}
+	return b.Bytes()
+}
+
+func TestDecompress(t *testing.T) {
+	message := []byte{0x0a, 0x05, 0x41, 0x62, 0x72, 0x61, 0x6d}
+	large := bytes.Repeat([]byte{0x00}, 2048)
+
+	tests := []struct {
+		encoding string
+		data     []byte
+		want     []byte
+		err      bool
+	}{
+		{
+			encoding: "identity",
+			data:     message,
+			want:     message,
+		},
+		{
+			encoding: "gzip",
+			data:     compress("gzip", message),
+			want:     message,
+		},
+		{
+			encoding: "deflate",
+			data:     compress("deflate", message),
+			want:     message,
+		},
+		{
+			encoding: "deflate",
+			data:     compress("raw-deflate", message),
+			want:     message,
+		},
+		{
+			encoding: "snappy",
+			data:     []byte{0x07, 0x18, 0x0a, 0x05, 0x41, 0x62, 0x72, 0x61, 0x6d},
+			want:     message,
+		},
+		{
+			encoding: "gzip",
+			data:     compress("gzip", large),
+			err:      true,
+		},
+		{
+			encoding: "identity",
+			data:     large,
+			err:      true,
+		},
+		{
+			encoding: "gzip",
+			data:     message,
+			err:      true,
+		},
+		{
+			encoding: "br",
+			data:     message,
+			err:      true,
+		},
+	}
+
+	for i, test := range tests {
+		ret, err := Decompress(test.encoding, test.data, 1024)
+		if test.err && err == nil {
+			t.Errorf("Decompress (testcase %d): returns no error where there should be error", i)
+		} else if !test.err && err != nil {
+			t.Errorf("Decompress (testcase %d): returns error '%v' where there should be no error", i, err)
+		} else if !bytes.Equal(ret, test.want) {
+			t.Errorf("Decompress (testcase %d): returns %v while it should be %v", i, ret, test.want)
+		}
+	}
+
+	if _, err := Decompress("gzip", compress("gzip", large), 1024); err != ErrMessageTooLarge {
+		t.Errorf("Decompress: returns error '%v' for decompression bomb", err)
+	}
+}
@@ -0,0 +1,40 @@
+package grpc
+
+// Every gRPC message on the wire is prefixed by a 1 byte compressed flag and
+// a 4 byte big-endian message length.
+const messagePrefixLength = 5
+
+type Message struct {
+	Compressed bool
+	Length     uint32
+	Payload    []byte
+}
+
+// IsTruncated reports whether the message continues past the data it was
+// parsed from.
+func (m Message) IsTruncated() bool {
+	return uint32(len(m.Payload)) < m.Length
+}
+
+// Messages splits the content of DATA frames into length-prefixed gRPC
+// messages. The last message may be truncated when it doesn't fit in data.
+func Messages(data []byte) []Message {
+	messages := []Message{}
+	idx := 0
+	for idx+messagePrefixLength <= len(data) {
+		m := Message{
+			Compressed: data[idx] == 1,
+			Length:     uint32(data[idx+1])<<24 | uint32(data[idx+2])<<16 | uint32(data[idx+3])<<8 | uint32(data[idx+4]),
+		}
+		idx += messagePrefixLength
+
+		end := len(data)
+		if uint64(idx)+uint64(m.Length) < uint64(end) {
+			end = idx + int(m.Length)
+		}
+		m.Payload = data[idx:end]
+		messages = append(messages, m)
+		idx = end
+	}
+	return messages
+}
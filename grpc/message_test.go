@@ -0,0 +1,73 @@
+package grpc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMessages(t *testing.T) {
+	tests := []struct {
+		bytes []byte
+		want  []Message
+	}{
+		{
+			bytes: []byte{},
+			want:  []Message{},
+		},
+		{
+			bytes: []byte{
+				0x00, 0x00, 0x00, 0x00, 0x07, 0x0a, 0x05, 0x41,
+				0x62, 0x72, 0x61, 0x6d,
+			},
+			want: []Message{
+				Message{Length: 7, Payload: []byte{0x0a, 0x05, 0x41, 0x62, 0x72, 0x61, 0x6d}},
+			},
+		},
+		{
+			bytes: []byte{
+				0x00, 0x00, 0x00, 0x00, 0x02, 0x08, 0x01, 0x01,
+				0x00, 0x00, 0x00, 0x03, 0x1f, 0x8b,
+			},
+			want: []Message{
+				Message{Length: 2, Payload: []byte{0x08, 0x01}},
+				Message{Compressed: true, Length: 3, Payload: []byte{0x1f, 0x8b}},
+			},
+		},
+		{
+			bytes: []byte{0x00, 0x00, 0x00},
+			want:  []Message{},
+		},
+	}
+
+	for i, test := range tests {
+		if ret := Messages(test.bytes); !reflect.DeepEqual(ret, test.want) {
+			t.Errorf("Messages (testcase %d): returns %v while it should be %v", i, ret, test.want)
+		}
+	}
+}
+
+func TestIsTruncated(t *testing.T) {
+	tests := []struct {
+		message Message
+		want    bool
+	}{
+		{
+			message: Message{Length: 2, Payload: []byte{0x08, 0x01}},
+			want:    false,
+		},
+		{
+			message: Message{Length: 3, Payload: []byte{0x08, 0x01}},
+			want:    true,
+		},
+		{
+			message: Message{},
+			want:    false,
+		},
+	}
+
+	for i, test := range tests {
+		if ret := test.message.IsTruncated(); ret != test.want {
+			t.Errorf("IsTruncated (testcase %d): returns '%t' while it should be '%t'", i, ret, test.want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package grpc
+
+import (
+	"strings"
+	"sync"
+)
+
+// Reassembler rebuilds gRPC messages split across several DATA frames. The
+// bytes of a stream are buffered until a message is complete, except for
+// messages larger than the maximum size which are skipped instead.
+type Reassembler struct {
+	mutex   sync.Mutex
+	streams map[string]*partialMessage
+}
+
+type partialMessage struct {
+	prefix  []byte
+	message Message
+	skip    uint32
+}
+
+func NewReassembler() *Reassembler {
+	return &Reassembler{streams: map[string]*partialMessage{}}
+}
+
+// Write feeds the content of a DATA frame of the stream identified by key and
+// returns the messages completed by it. A message longer than maxsize is
+// returned as soon as its prefix is read, with a nil Payload. The stream is
+// forgotten when endstream is set.
+func (r *Reassembler) Write(key string, data []byte, endstream bool, maxsize int) []Message {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	messages := []Message{}
+	stream, ok := r.streams[key]
+	if !ok {
+		stream = &partialMessage{}
+		r.streams[key] = stream
+	}
+
+	for len(data) > 0 {
+		if stream.skip > 0 {
+			n := stream.skip
+			if uint32(len(data)) < n {
+				n = uint32(len(data))
+			}
+			stream.skip -= n
+			data = data[n:]
+			continue
+		}
+
+		if len(stream.prefix) < messagePrefixLength {
+			n := messagePrefixLength - len(stream.prefix)
+			if len(data) < n {
+				n = len(data)
+			}
+			stream.prefix = append(stream.prefix, data[:n]...)
+			data = data[n:]
+			if len(stream.prefix) < messagePrefixLength {
+				break
+			}
+			stream.message = Messages(stream.prefix)[0]
+			stream.message.Payload = []byte{}
+			if uint64(stream.message.Length) > uint64(maxsize) {
+				stream.message.Payload = nil
+				stream.skip = stream.message.Length
+				messages = append(messages, stream.message)
+				stream.prefix = nil
+				continue
+			}
+		}
+
+		n := int(stream.message.Length) - len(stream.message.Payload)
+		if len(data) < n {
+			n = len(data)
+		}
+		stream.message.Payload = append(stream.message.Payload, data[:n]...)
+		data = data[n:]
+		if !stream.message.IsTruncated() {
+			messages = append(messages, stream.message)
+			stream.prefix = nil
+		}
+	}
+
+	if endstream {
+		delete(r.streams, key)
+	}
+	return messages
+}
+
+// Forget drops the partial message of the stream identified by key, e.g. once
+// its trailers or its RST_STREAM are seen.
+func (r *Reassembler) Forget(key string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.streams, key)
+}
+
+// ForgetPrefix drops the partial messages of all the streams whose key starts
+// with prefix, e.g. the streams of a closed connection.
+func (r *Reassembler) ForgetPrefix(prefix string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for key := range r.streams {
+		if strings.HasPrefix(key, prefix) {
+			delete(r.streams, key)
+		}
+	}
+}
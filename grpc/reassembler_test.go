@@ -0,0 +1,134 @@
+package grpc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReassemblerWrite(t *testing.T) {
+	type write struct {
+		key       string
+		data      []byte
+		endstream bool
+		want      []Message
+	}
+	tests := []struct {
+		writes []write
+	}{
+		{
+			writes: []write{
+				{
+					key:  "1",
+					data: []byte{0x00, 0x00, 0x00, 0x00, 0x02, 0x08, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00},
+					want: []Message{
+						Message{Length: 2, Payload: []byte{0x08, 0x01}},
+						Message{Length: 0, Payload: []byte{}},
+					},
+				},
+			},
+		},
+		{
+			writes: []write{
+				{
+					key:  "1",
+					data: []byte{0x00, 0x00, 0x00},
+					want: []Message{},
+				},
+				{
+					key:  "3",
+					data: []byte{0x01, 0x00, 0x00, 0x00, 0x01, 0xff},
+					want: []Message{Message{Compressed: true, Length: 1, Payload: []byte{0xff}}},
+				},
+				{
+					key:  "1",
+					data: []byte{0x00, 0x03, 0x08},
+					want: []Message{},
+				},
+				{
+					key:       "1",
+					data:      []byte{0x96, 0x01},
+					endstream: true,
+					want:      []Message{Message{Length: 3, Payload: []byte{0x08, 0x96, 0x01}}},
+				},
+			},
+		},
+		{
+			writes: []write{
+				{
+					key:  "1",
+					data: []byte{0x00, 0x00, 0x00, 0x00, 0x20, 0x01, 0x02},
+					want: []Message{Message{Length: 32}},
+				},
+				{
+					key:  "1",
+					data: make([]byte, 30),
+					want: []Message{},
+				},
+				{
+					key:  "1",
+					data: []byte{0x00, 0x00, 0x00, 0x00, 0x01, 0x2a},
+					want: []Message{Message{Length: 1, Payload: []byte{0x2a}}},
+				},
+			},
+		},
+		{
+			writes: []write{
+				{
+					key:       "1",
+					data:      []byte{0x00, 0x00, 0x00, 0x00, 0x02, 0x08},
+					endstream: true,
+					want:      []Message{},
+				},
+				{
+					key:  "1",
+					data: []byte{0x00, 0x00, 0x00, 0x00, 0x01, 0x2a},
+					want: []Message{Message{Length: 1, Payload: []byte{0x2a}}},
+				},
+			},
+		},
+	}
+
+	for i, test := range tests {
+		r := NewReassembler()
+		for j, w := range test.writes {
+			if ret := r.Write(w.key, w.data, w.endstream, 16); !reflect.DeepEqual(ret, w.want) {
+				t.Errorf("Reassembler.Write (testcase %d, write %d): returns %v while it should be %v", i, j, ret, w.want)
+			}
+		}
+	}
+}
+
+func TestReassemblerForget(t *testing.T) {
+	tests := []struct {
+		keys   []string
+		forget func(r *Reassembler)
+		want   []string
+	}{
+		{
+			keys:   []string{"a,1,b,2,1", "a,1,b,2,3"},
+			forget: func(r *Reassembler) { r.Forget("a,1,b,2,1") },
+			want:   []string{"a,1,b,2,3"},
+		},
+		{
+			keys:   []string{"a,1,b,2,1", "a,1,b,2,3", "a,1,b,20,1", "b,2,a,1,1"},
+			forget: func(r *Reassembler) { r.ForgetPrefix("a,1,b,2,") },
+			want:   []string{"a,1,b,20,1", "b,2,a,1,1"},
+		},
+	}
+
+	for i, test := range tests {
+		r := NewReassembler()
+		for _, key := range test.keys {
+			r.Write(key, []byte{0x00, 0x00}, false, 16)
+		}
+		test.forget(r)
+		for _, key := range test.want {
+			if _, ok := r.streams[key]; !ok {
+				t.Errorf("Forget (testcase %d): forgets stream %s while it should keep it", i, key)
+			}
+		}
+		if len(r.streams) != len(test.want) {
+			t.Errorf("Forget (testcase %d): keeps %d streams while it should keep %d", i, len(r.streams), len(test.want))
+		}
+	}
+}
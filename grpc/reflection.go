@@ -0,0 +1,199 @@
+package grpc
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/abrampers/inkle/protobuf"
+)
+
+const reflectionPath = "/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo"
+
+// Services which failed to be reflected aren't retried before this delay.
+const reflectionRetryDelay = time.Minute
+
+// Reflector fetches the descriptors of observed services through gRPC server
+// reflection and caches them by service name. Fetches run in the background
+// so that packet handling is never blocked on the network.
+type Reflector struct {
+	client   *http.Client
+	allow    []string
+	interval time.Duration
+
+	mutex     sync.Mutex
+	schemas   map[string]*protobuf.Schema
+	fetching  map[string]bool
+	failures  map[string]time.Time
+	lastfetch map[string]time.Time
+}
+
+// NewReflector returns a Reflector which only connects to authorities (host:port)
+// matching one of the allow glob patterns, none when allow is empty, and starts
+// at most one fetch per interval from each authority.
+func NewReflector(allow []string, interval time.Duration, timeout time.Duration) *Reflector {
+	return &Reflector{
+		client:    NewClient(timeout),
+		allow:     allow,
+		interval:  interval,
+		schemas:   map[string]*protobuf.Schema{},
+		fetching:  map[string]bool{},
+		failures:  map[string]time.Time{},
+		lastfetch: map[string]time.Time{},
+	}
+}
+
+func (r *Reflector) isAllowed(authority string) bool {
+	for _, pattern := range r.allow {
+		if ok, _ := path.Match(pattern, authority); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Schema returns the cached schema of servicename. If it isn't cached yet, a
+// fetch from authority is started in the background and false is returned.
+func (r *Reflector) Schema(authority string, servicename string) (*protobuf.Schema, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if schema, ok := r.schemas[servicename]; ok {
+		return schema, true
+	}
+	if !r.shouldFetch(authority, servicename, time.Now()) {
+		return nil, false
+	}
+
+	r.fetching[servicename] = true
+	r.lastfetch[authority] = time.Now()
+	go func() {
+		schema, err := r.Fetch(authority, servicename)
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		delete(r.fetching, servicename)
+		if err != nil {
+			r.failures[servicename] = time.Now()
+			return
+		}
+		delete(r.failures, servicename)
+		r.schemas[servicename] = schema
+	}()
+	return nil, false
+}
+
+func (r *Reflector) shouldFetch(authority string, servicename string, currtime time.Time) bool {
+	if r.fetching[servicename] || !r.isAllowed(authority) {
+		return false
+	}
+	if failure, ok := r.failures[servicename]; ok && currtime.Sub(failure) < reflectionRetryDelay {
+		return false
+	}
+	return currtime.Sub(r.lastfetch[authority]) >= r.interval
+}
+
+// Fetch queries authority for the file defining servicename and all of its
+// dependencies.
+func (r *Reflector) Fetch(authority string, servicename string) (*protobuf.Schema, error) {
+	schema := protobuf.NewSchema()
+	// ServerReflectionRequest.file_containing_symbol
+	files, err := r.reflect(authority, protobuf.AppendStringField(nil, 4, servicename))
+	if err != nil {
+		return nil, err
+	}
+
+	// unresolved holds the dependencies not fetched yet, seen all the ones
+	// found, so that each is only requested once.
+	unresolved, seen := []string{}, map[string]bool{}
+	for {
+		for _, file := range files {
+			_, deps, err := schema.AddFile(file)
+			if err != nil {
+				return nil, err
+			}
+			for _, dep := range deps {
+				if !seen[dep] {
+					seen[dep] = true
+					unresolved = append(unresolved, dep)
+				}
+			}
+		}
+
+		files = nil
+		for len(files) == 0 && len(unresolved) > 0 {
+			dep := unresolved[0]
+			unresolved = unresolved[1:]
+			if schema.Files[dep] {
+				continue
+			}
+			// A dependency which can't be fetched only leaves its messages
+			// undecoded, so it doesn't fail the whole schema.
+			// ServerReflectionRequest.file_by_filename
+			files, _ = r.reflect(authority, protobuf.AppendStringField(nil, 3, dep))
+		}
+		if len(files) == 0 {
+			break
+		}
+	}
+
+	if _, ok := schema.Services[servicename]; !ok {
+		return nil, fmt.Errorf("Service %s not found in reflection response", servicename)
+	}
+	return schema, nil
+}
+
+// reflect sends a ServerReflectionRequest and returns the serialized
+// FileDescriptorProtos of the response.
+func (r *Reflector) reflect(authority string, request []byte) ([][]byte, error) {
+	responses, err := Invoke(r.client, authority, reflectionPath, request)
+	if err != nil {
+		return nil, err
+	}
+
+	files := [][]byte{}
+	for _, response := range responses {
+		fields, err := protobuf.Decode(response)
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range fields {
+			if field.WireType != protobuf.WireBytes {
+				continue
+			}
+			switch field.Number {
+			case 4:
+				// ServerReflectionResponse.file_descriptor_response
+				descriptors, err := protobuf.Decode(field.Bytes)
+				if err != nil {
+					return nil, err
+				}
+				for _, descriptor := range descriptors {
+					if descriptor.Number == 1 && descriptor.WireType == protobuf.WireBytes {
+						files = append(files, descriptor.Bytes)
+					}
+				}
+			case 7:
+				// ServerReflectionResponse.error_response
+				return nil, fmt.Errorf("Reflection error: %s", reflectionError(field.Bytes))
+			}
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("No file descriptor in reflection response")
+	}
+	return files, nil
+}
+
+func reflectionError(data []byte) string {
+	fields, err := protobuf.Decode(data)
+	if err != nil {
+		return "malformed error response"
+	}
+	for _, field := range fields {
+		if field.Number == 2 && field.WireType == protobuf.WireBytes {
+			return string(field.Bytes)
+		}
+	}
+	return "unknown error"
+}
@@ -0,0 +1,191 @@
+package grpc
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abrampers/inkle/protobuf"
+)
+
+func fileDescriptor(name string, pkg string, dependencies []string, messages [][]byte, services [][]byte) []byte {
+	file := protobuf.AppendStringField(nil, 1, name)
+	file = protobuf.AppendStringField(file, 2, pkg)
+	for _, dependency := range dependencies {
+		file = protobuf.AppendStringField(file, 3, dependency)
+	}
+	for _, message := range messages {
+		file = protobuf.AppendBytesField(file, 4, message)
+	}
+	for _, service := range services {
+		file = protobuf.AppendBytesField(file, 6, service)
+	}
+	return file
+}
+
+func stringMessage(name string, fieldname string) []byte {
+	field := protobuf.AppendStringField(nil, 1, fieldname)
+	field = protobuf.AppendVarintField(field, 3, 1)
+	field = protobuf.AppendVarintField(field, 5, protobuf.TypeString)
+	message := protobuf.AppendStringField(nil, 1, name)
+	return protobuf.AppendBytesField(message, 2, field)
+}
+
+func greeterService() []byte {
+	method := protobuf.AppendStringField(nil, 1, "SayHello")
+	method = protobuf.AppendStringField(method, 2, ".helloworld.HelloRequest")
+	method = protobuf.AppendStringField(method, 3, ".common.Reply")
+	service := protobuf.AppendStringField(nil, 1, "Greeter")
+	return protobuf.AppendBytesField(service, 2, method)
+}
+
+// newReflectionServer serves helloworld.proto, which depends on
+// missing.proto, which isn't served, and on common.proto served on its own,
+// and an error for every other symbol.
+func newReflectionServer() (string, func()) {
+	files := map[string][]byte{
+		"helloworld.proto": fileDescriptor("helloworld.proto", "helloworld", []string{"missing.proto", "common.proto"}, [][]byte{stringMessage("HelloRequest", "name")}, [][]byte{greeterService()}),
+		"common.proto":     fileDescriptor("common.proto", "common", nil, [][]byte{stringMessage("Reply", "message")}, nil),
+	}
+	server := newServer(func(path string, request []byte) ([][]byte, string) {
+		if path != reflectionPath {
+			return nil, "12"
+		}
+		fields, _ := protobuf.Decode(request)
+		file := []byte{}
+		for _, field := range fields {
+			switch {
+			case field.Number == 4 && string(field.Bytes) == "helloworld.Greeter":
+				file = files["helloworld.proto"]
+			case field.Number == 3:
+				file = files[string(field.Bytes)]
+			}
+		}
+		if len(file) == 0 {
+			response := protobuf.AppendBytesField(nil, 7, protobuf.AppendStringField(protobuf.AppendVarintField(nil, 1, 5), 2, "not found"))
+			return [][]byte{response}, "0"
+		}
+		response := protobuf.AppendBytesField(nil, 4, protobuf.AppendBytesField(nil, 1, file))
+		return [][]byte{response}, "0"
+	})
+	return strings.TrimPrefix(server.URL, "http://"), server.Close
+}
+
+func TestFetch(t *testing.T) {
+	authority, close := newReflectionServer()
+	defer close()
+	reflector := NewReflector([]string{"*"}, 0, time.Second)
+
+	schema, err := reflector.Fetch(authority, "helloworld.Greeter")
+	if err != nil {
+		t.Fatalf("Fetch: returns error '%v' where there should be no error", err)
+	}
+	method, ok := schema.Method("helloworld.Greeter", "SayHello")
+	if !ok {
+		t.Fatalf("Fetch: doesn't return helloworld.Greeter/SayHello")
+	}
+	if ret := schema.Dump(protobuf.AppendStringField(nil, 1, "Abram"), method.InputType, 0); ret != `{name:"Abram"}` {
+		t.Errorf("Fetch: returns schema which dumps request as '%s'", ret)
+	}
+	// common.proto is fetched even though missing.proto, before it, failed.
+	if ret := schema.Dump(protobuf.AppendStringField(nil, 1, "Hello Abram"), method.OutputType, 0); ret != `{message:"Hello Abram"}` {
+		t.Errorf("Fetch: returns schema without dependency, dumps response as '%s'", ret)
+	}
+
+	if _, err := reflector.Fetch(authority, "datetime.Datetime"); err == nil {
+		t.Errorf("Fetch: returns no error for unknown service")
+	}
+}
+
+func TestSchema(t *testing.T) {
+	authority, close := newReflectionServer()
+	defer close()
+
+	tests := []struct {
+		allow       []string
+		servicename string
+		want        bool
+	}{
+		{
+			allow:       []string{"*"},
+			servicename: "helloworld.Greeter",
+			want:        true,
+		},
+		{
+			allow:       []string{"localhost:*"},
+			servicename: "helloworld.Greeter",
+			want:        false,
+		},
+		{
+			allow:       []string{},
+			servicename: "helloworld.Greeter",
+			want:        false,
+		},
+		{
+			allow:       []string{"*"},
+			servicename: "datetime.Datetime",
+			want:        false,
+		},
+	}
+
+	for i, test := range tests {
+		reflector := NewReflector(test.allow, 0, time.Second)
+		if _, ok := reflector.Schema(authority, test.servicename); ok {
+			t.Errorf("Schema (testcase %d): returns schema before it's fetched", i)
+		}
+		ok := false
+		for start := time.Now(); time.Since(start) < 300*time.Millisecond && !ok; time.Sleep(10 * time.Millisecond) {
+			_, ok = reflector.Schema(authority, test.servicename)
+		}
+		if ok != test.want {
+			t.Errorf("Schema (testcase %d): returns '%t' while it should be '%t'", i, ok, test.want)
+		}
+	}
+}
+
+func Test_shouldFetch(t *testing.T) {
+	currtime := time.Now()
+	tests := []struct {
+		reflector *Reflector
+		want      bool
+	}{
+		{
+			reflector: &Reflector{allow: []string{"*"}, interval: time.Second},
+			want:      true,
+		},
+		{
+			reflector: &Reflector{allow: []string{"*"}, interval: time.Second, lastfetch: map[string]time.Time{"localhost:8000": currtime.Add(-500 * time.Millisecond)}},
+			want:      false,
+		},
+		{
+			reflector: &Reflector{allow: []string{"*"}, interval: time.Second, lastfetch: map[string]time.Time{"greeter:8000": currtime.Add(-500 * time.Millisecond)}},
+			want:      true,
+		},
+		{
+			reflector: &Reflector{interval: time.Second},
+			want:      false,
+		},
+		{
+			reflector: &Reflector{allow: []string{"*"}, fetching: map[string]bool{"helloworld.Greeter": true}},
+			want:      false,
+		},
+		{
+			reflector: &Reflector{allow: []string{"*"}, failures: map[string]time.Time{"helloworld.Greeter": currtime.Add(-time.Second)}},
+			want:      false,
+		},
+		{
+			reflector: &Reflector{allow: []string{"*"}, failures: map[string]time.Time{"helloworld.Greeter": currtime.Add(-2 * reflectionRetryDelay)}},
+			want:      true,
+		},
+		{
+			reflector: &Reflector{allow: []string{"greeter:8000"}},
+			want:      false,
+		},
+	}
+
+	for i, test := range tests {
+		if ret := test.reflector.shouldFetch("localhost:8000", "helloworld.Greeter", currtime); ret != test.want {
+			t.Errorf("shouldFetch (testcase %d): returns '%t' while it should be '%t'", i, ret, test.want)
+		}
+	}
+}
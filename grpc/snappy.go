@@ -0,0 +1,148 @@
+package grpc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/abrampers/inkle/protobuf"
+)
+
+// Snappy has no standard gRPC framing, so both the block format and the
+// framing format (https://github.com/google/snappy/blob/master/framing_format.txt)
+// are accepted.
+var snappyStreamIdentifier = []byte{0xff, 0x06, 0x00, 0x00, 's', 'N', 'a', 'P', 'p', 'Y'}
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+func decodeSnappy(data []byte, maxsize int) ([]byte, error) {
+	if bytes.HasPrefix(data, snappyStreamIdentifier) {
+		return decodeSnappyStream(data[len(snappyStreamIdentifier):], maxsize)
+	}
+	return decodeSnappyBlock(data, maxsize)
+}
+
+func decodeSnappyStream(data []byte, maxsize int) ([]byte, error) {
+	decoded := []byte{}
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return nil, fmt.Errorf("Snappy chunk header is truncated")
+		}
+		chunktype := data[0]
+		length := int(data[1]) | int(data[2])<<8 | int(data[3])<<16
+		if 4+length > len(data) {
+			return nil, fmt.Errorf("Snappy chunk is truncated")
+		}
+		chunk := data[4 : 4+length]
+		data = data[4+length:]
+
+		switch {
+		case chunktype == 0x00 || chunktype == 0x01:
+			if len(chunk) < 4 {
+				return nil, fmt.Errorf("Snappy chunk is truncated")
+			}
+			checksum := binary.LittleEndian.Uint32(chunk[:4])
+			content := chunk[4:]
+			if chunktype == 0x00 {
+				var err error
+				if content, err = decodeSnappyBlock(content, maxsize-len(decoded)); err != nil {
+					return nil, err
+				}
+			}
+			if maskedChecksum(content) != checksum {
+				return nil, fmt.Errorf("Snappy chunk checksum mismatch")
+			}
+			if len(decoded)+len(content) > maxsize {
+				return nil, ErrMessageTooLarge
+			}
+			decoded = append(decoded, content...)
+		case chunktype == 0xff || chunktype >= 0x80:
+			// Repeated stream identifiers, padding and skippable chunks.
+		default:
+			return nil, fmt.Errorf("Unsupported snappy chunk type %d", chunktype)
+		}
+	}
+	return decoded, nil
+}
+
+func maskedChecksum(data []byte) uint32 {
+	c := crc32.Checksum(data, crc32c)
+	return (c>>15 | c<<17) + 0xa282ead8
+}
+
+func decodeSnappyBlock(data []byte, maxsize int) ([]byte, error) {
+	length, n := protobuf.Varint(data)
+	if n <= 0 {
+		return nil, fmt.Errorf("Invalid snappy block length")
+	}
+	if maxsize < 0 || length > uint64(maxsize) {
+		return nil, ErrMessageTooLarge
+	}
+	data = data[n:]
+
+	decoded := make([]byte, 0, length)
+	for len(data) > 0 {
+		tag := data[0]
+		switch tag & 0x03 {
+		case 0x00:
+			literal := int(tag>>2) + 1
+			data = data[1:]
+			if literal > 60 {
+				size := literal - 60
+				if len(data) < size {
+					return nil, fmt.Errorf("Snappy literal is truncated")
+				}
+				literal = 0
+				for i := size - 1; i >= 0; i-- {
+					literal = literal<<8 | int(data[i])
+				}
+				literal++
+				data = data[size:]
+			}
+			if literal > len(data) || len(decoded)+literal > int(length) {
+				return nil, fmt.Errorf("Snappy literal is truncated")
+			}
+			decoded = append(decoded, data[:literal]...)
+			data = data[literal:]
+			continue
+		}
+
+		var copylength, offset int
+		switch tag & 0x03 {
+		case 0x01:
+			if len(data) < 2 {
+				return nil, fmt.Errorf("Snappy copy is truncated")
+			}
+			copylength = 4 + int(tag>>2)&0x07
+			offset = int(tag>>5)<<8 | int(data[1])
+			data = data[2:]
+		case 0x02:
+			if len(data) < 3 {
+				return nil, fmt.Errorf("Snappy copy is truncated")
+			}
+			copylength = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint16(data[1:3]))
+			data = data[3:]
+		case 0x03:
+			if len(data) < 5 {
+				return nil, fmt.Errorf("Snappy copy is truncated")
+			}
+			copylength = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint32(data[1:5]))
+			data = data[5:]
+		}
+		if offset <= 0 || offset > len(decoded) || len(decoded)+copylength > int(length) {
+			return nil, fmt.Errorf("Invalid snappy copy")
+		}
+		// Copies may overlap their own output, so go byte by byte.
+		start := len(decoded) - offset
+		for i := 0; i < copylength; i++ {
+			decoded = append(decoded, decoded[start+i])
+		}
+	}
+	if len(decoded) != int(length) {
+		return nil, fmt.Errorf("Snappy block length mismatch")
+	}
+	return decoded, nil
+}
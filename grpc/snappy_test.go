@@ -0,0 +1,104 @@
+package grpc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func snappyChunk(chunktype byte, content []byte, checksummed []byte) []byte {
+	length := len(content) + 4
+	chunk := []byte{chunktype, byte(length), byte(length >> 8), byte(length >> 16), 0, 0, 0, 0}
+	binary.LittleEndian.PutUint32(chunk[4:], maskedChecksum(checksummed))
+	return append(chunk, content...)
+}
+
+func TestDecodeSnappy(t *testing.T) {
+	block := []byte{0x09, 0x08, 0x61, 0x62, 0x63, 0x09, 0x03}
+
+	tests := []struct {
+		data    []byte
+		maxsize int
+		want    []byte
+		err     bool
+	}{
+		{
+			// Literal "abc" and a 1-byte offset copy of length 6.
+			data:    block,
+			maxsize: 1024,
+			want:    []byte("abcabcabc"),
+		},
+		{
+			// Literal "ab" and a 2-byte offset copy of length 5.
+			data:    []byte{0x07, 0x04, 0x61, 0x62, 0x12, 0x02, 0x00},
+			maxsize: 1024,
+			want:    []byte("abababa"),
+		},
+		{
+			// Literal "a" and a 4-byte offset copy of length 3.
+			data:    []byte{0x04, 0x00, 0x61, 0x0b, 0x01, 0x00, 0x00, 0x00},
+			maxsize: 1024,
+			want:    []byte("aaaa"),
+		},
+		{
+			// Literal with its length in an extra byte.
+			data:    append([]byte{0x3d, 0xf0, 0x3c}, bytes.Repeat([]byte("a"), 61)...),
+			maxsize: 1024,
+			want:    bytes.Repeat([]byte("a"), 61),
+		},
+		{
+			data:    block,
+			maxsize: 8,
+			err:     true,
+		},
+		{
+			// Copy from before the start of the output.
+			data:    []byte{0x09, 0x08, 0x61, 0x62, 0x63, 0x09, 0x04},
+			maxsize: 1024,
+			err:     true,
+		},
+		{
+			data:    []byte{0x09, 0x08, 0x61},
+			maxsize: 1024,
+			err:     true,
+		},
+		{
+			data: bytes.Join([][]byte{
+				snappyStreamIdentifier,
+				snappyChunk(0x00, block, []byte("abcabcabc")),
+				snappyChunk(0x01, []byte("def"), []byte("def")),
+				[]byte{0xfe, 0x01, 0x00, 0x00, 0x00},
+			}, nil),
+			maxsize: 1024,
+			want:    []byte("abcabcabcdef"),
+		},
+		{
+			data: bytes.Join([][]byte{
+				snappyStreamIdentifier,
+				snappyChunk(0x01, []byte("def"), []byte("abc")),
+			}, nil),
+			maxsize: 1024,
+			err:     true,
+		},
+		{
+			data: bytes.Join([][]byte{
+				snappyStreamIdentifier,
+				snappyChunk(0x00, block, []byte("abcabcabc")),
+				snappyChunk(0x00, block, []byte("abcabcabc")),
+			}, nil),
+			maxsize: 12,
+			err:     true,
+		},
+	}
+
+	for i, test := range tests {
+		ret, err := decodeSnappy(test.data, test.maxsize)
+		if test.err && err == nil {
+			t.Errorf("decodeSnappy (testcase %d): returns no error where there should be error", i)
+		} else if !test.err && err != nil {
+			t.Errorf("decodeSnappy (testcase %d): returns error '%v' where there should be no error", i, err)
+		} else if !bytes.Equal(ret, test.want) {
+			t.Errorf("decodeSnappy (testcase %d): returns '%s' while it should be '%s'", i, ret, test.want)
+		}
+	}
+}
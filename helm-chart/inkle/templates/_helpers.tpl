@@ -53,6 +53,18 @@ app.kubernetes.io/name: {{ include "inkle.name" . }}
 app.kubernetes.io/instance: {{ .Release.Name }}
 {{- end -}}
 
+{{/*
+Whether Logstash is deployed, along with Elasticsearch unless elastic.logstash
+is set, as in the condition of its dependency.
+*/}}
+{{- define "inkle.logstash" -}}
+{{- if hasKey .Values.elastic "logstash" -}}
+{{- .Values.elastic.logstash -}}
+{{- else -}}
+{{- .Values.elastic.enabled -}}
+{{- end -}}
+{{- end -}}
+
 {{/*
 Create the name of the service account to use
 */}}
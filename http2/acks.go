@@ -0,0 +1,68 @@
+package http2
+
+type ackState struct {
+	// ack and window are the ones of the last ACK sent on the flow, if
+	// hasack.
+	ack        uint32
+	window     uint16
+	hasack     bool
+	zerowindow bool
+	// next is the sequence number following the data sent on the flow, if
+	// hasnext.
+	next    uint32
+	hasnext bool
+}
+
+// AckTracker detects duplicate ACKs and zero windows from the TCP segments
+// seen on each flow.
+type AckTracker struct {
+	flows map[ipTcpConn]*ackState
+}
+
+var Acks = NewAckTracker()
+
+func NewAckTracker() *AckTracker {
+	return &AckTracker{flows: map[ipTcpConn]*ackState{}}
+}
+
+// Track reports whether packet is a duplicate ACK, acknowledging the same
+// data with the same window as the previous segment of its flow without
+// carrying any while the other end has data in flight (RFC 5681), and
+// whether it announces a zero window not announced yet. Flows are followed
+// from their first segment carrying a SYN or data, or from their first ACK of
+// a followed flow, so that the last segments of a forgotten connection don't
+// follow it again.
+func (a *AckTracker) Track(packet InterceptedPacket) (dupack bool, zerowindow bool) {
+	conn := ipTcpConn{packet.SrcIP.String(), uint16(packet.SrcTCP), packet.DstIP.String(), uint16(packet.DstTCP)}
+	other, hasother := a.flows[ipTcpConn{conn.DstIP, conn.DstTCP, conn.SrcIP, conn.SrcTCP}]
+	state, ok := a.flows[conn]
+	if !ok {
+		if packet.FIN || packet.RST || (!packet.SYN && packet.Length == 0 && !hasother) {
+			return false, false
+		}
+		state = &ackState{}
+		a.flows[conn] = state
+	}
+	next := packet.Seq + uint32(packet.Length)
+	if packet.SYN || packet.FIN {
+		next++
+	}
+	if !state.hasnext || int32(next-state.next) > 0 {
+		state.next, state.hasnext = next, true
+	}
+	if !packet.ACK || packet.SYN || packet.RST {
+		return false, false
+	}
+
+	inflight := hasother && other.hasnext && int32(other.next-packet.Ack) > 0
+	dupack = state.hasack && inflight && packet.Length == 0 && !packet.FIN && packet.Ack == state.ack && packet.Window == state.window
+	zerowindow = packet.Window == 0 && !state.zerowindow
+	state.ack, state.window, state.hasack, state.zerowindow = packet.Ack, packet.Window, true, packet.Window == 0
+	return dupack, zerowindow
+}
+
+// Delete forgets the segments sent from srcip:srctcp to dstip:dsttcp, once
+// their connection is closed.
+func (a *AckTracker) Delete(srcip string, srctcp uint16, dstip string, dsttcp uint16) {
+	delete(a.flows, ipTcpConn{srcip, srctcp, dstip, dsttcp})
+}
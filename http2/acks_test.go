@@ -0,0 +1,88 @@
+package http2
+
+import (
+	"net"
+	"testing"
+)
+
+func TestAckTracker(t *testing.T) {
+	client, server := net.ParseIP("::1"), net.ParseIP("::2")
+	tests := []struct {
+		packet     InterceptedPacket
+		dupack     bool
+		zerowindow bool
+	}{
+		{
+			packet: InterceptedPacket{SrcIP: client, DstIP: server, SrcTCP: 58108, DstTCP: 8000, Ack: 100, Window: 512, SYN: true, ACK: true},
+		},
+		{
+			packet: InterceptedPacket{SrcIP: client, DstIP: server, SrcTCP: 58108, DstTCP: 8000, Ack: 100, Window: 512, ACK: true},
+		},
+		{
+			// Nothing sent by the server is waiting for its ACK.
+			packet: InterceptedPacket{SrcIP: client, DstIP: server, SrcTCP: 58108, DstTCP: 8000, Ack: 100, Window: 512, ACK: true},
+		},
+		{
+			packet: InterceptedPacket{SrcIP: server, DstIP: client, SrcTCP: 8000, DstTCP: 58108, Seq: 100, Length: 50, Ack: 1, Window: 512, ACK: true},
+		},
+		{
+			packet: InterceptedPacket{SrcIP: client, DstIP: server, SrcTCP: 58108, DstTCP: 8000, Ack: 100, Window: 512, ACK: true},
+			dupack: true,
+		},
+		{
+			// Segments carrying data aren't duplicate ACKs.
+			packet: InterceptedPacket{SrcIP: client, DstIP: server, SrcTCP: 58108, DstTCP: 8000, Ack: 100, Window: 512, ACK: true, Length: 10},
+		},
+		{
+			// The other flow is followed on its own.
+			packet: InterceptedPacket{SrcIP: server, DstIP: client, SrcTCP: 8000, DstTCP: 58108, Seq: 150, Ack: 10, Window: 512, ACK: true},
+		},
+		{
+			// Window updates aren't duplicate ACKs.
+			packet:     InterceptedPacket{SrcIP: client, DstIP: server, SrcTCP: 58108, DstTCP: 8000, Ack: 100, Window: 0, ACK: true},
+			zerowindow: true,
+		},
+		{
+			// Zero windows are only reported once.
+			packet: InterceptedPacket{SrcIP: client, DstIP: server, SrcTCP: 58108, DstTCP: 8000, Ack: 120, Window: 0, ACK: true},
+		},
+		{
+			packet: InterceptedPacket{SrcIP: client, DstIP: server, SrcTCP: 58108, DstTCP: 8000, Ack: 120, Window: 512, ACK: true},
+		},
+		{
+			packet:     InterceptedPacket{SrcIP: client, DstIP: server, SrcTCP: 58108, DstTCP: 8000, Ack: 140, Window: 0, ACK: true},
+			zerowindow: true,
+		},
+		{
+			packet: InterceptedPacket{SrcIP: client, DstIP: server, SrcTCP: 58108, DstTCP: 8000, Ack: 150, Window: 512, ACK: true},
+		},
+		{
+			// All the data of the server is acknowledged.
+			packet: InterceptedPacket{SrcIP: client, DstIP: server, SrcTCP: 58108, DstTCP: 8000, Ack: 150, Window: 512, ACK: true},
+		},
+	}
+
+	tracker := NewAckTracker()
+	for i, test := range tests {
+		if dupack, zerowindow := tracker.Track(test.packet); dupack != test.dupack || zerowindow != test.zerowindow {
+			t.Errorf("Track (testcase %d): returns (%t, %t) while it should be (%t, %t)", i, dupack, zerowindow, test.dupack, test.zerowindow)
+		}
+	}
+}
+
+func TestAckTrackerForgottenFlows(t *testing.T) {
+	client, server := net.ParseIP("::1"), net.ParseIP("::2")
+	tracker := NewAckTracker()
+	tracker.Track(InterceptedPacket{SrcIP: client, DstIP: server, SrcTCP: 58108, DstTCP: 8000, Seq: 1, Length: 10, Ack: 100, Window: 512, ACK: true})
+	tracker.Track(InterceptedPacket{SrcIP: server, DstIP: client, SrcTCP: 8000, DstTCP: 58108, Seq: 100, Ack: 11, Window: 512, ACK: true})
+	// The connection is forgotten at the FIN of the client, before the FIN
+	// of the server and the last ACK.
+	tracker.Delete("::1", 58108, "::2", 8000)
+	tracker.Delete("::2", 8000, "::1", 58108)
+	tracker.Track(InterceptedPacket{SrcIP: server, DstIP: client, SrcTCP: 8000, DstTCP: 58108, Seq: 100, Ack: 12, Window: 512, ACK: true, FIN: true})
+	tracker.Track(InterceptedPacket{SrcIP: client, DstIP: server, SrcTCP: 58108, DstTCP: 8000, Seq: 12, Ack: 101, Window: 512, ACK: true})
+	tracker.Track(InterceptedPacket{SrcIP: client, DstIP: server, SrcTCP: 58108, DstTCP: 8000, Seq: 12, Window: 0, RST: true})
+	if len(tracker.flows) != 0 {
+		t.Errorf("Track: follows %d flows while it should follow none after the connection is forgotten", len(tracker.flows))
+	}
+}
@@ -0,0 +1,106 @@
+package http2
+
+import (
+	"encoding/binary"
+
+	"golang.org/x/net/http2"
+)
+
+// HeadersStreamIDs returns the streams of the HEADERS frames in h2.
+func HeadersStreamIDs(h2 HTTP2) []uint32 {
+	ids := []uint32{}
+	for _, frame := range h2.Frames() {
+		if frame.Header().Type == http2.FrameHeaders {
+			ids = append(ids, frame.Header().StreamID)
+		}
+	}
+	return ids
+}
+
+// EndedStreamIDs returns the streams ended by h2 with the END_STREAM flag.
+func EndedStreamIDs(h2 HTTP2) []uint32 {
+	ids := []uint32{}
+	for _, frame := range h2.Frames() {
+		header := frame.Header()
+		if (header.Type == http2.FrameHeaders || header.Type == http2.FrameData) && header.Flags.Has(http2.FlagDataEndStream) {
+			ids = append(ids, header.StreamID)
+		}
+	}
+	return ids
+}
+
+// ResetStreamIDs returns the streams reset by the RST_STREAM frames in h2.
+func ResetStreamIDs(h2 HTTP2) []uint32 {
+	ids := []uint32{}
+	for _, frame := range h2.Frames() {
+		if frame.Header().Type == http2.FrameRSTStream {
+			ids = append(ids, frame.Header().StreamID)
+		}
+	}
+	return ids
+}
+
+// GoAway returns the error code of the GOAWAY frame in h2, e.g. NO_ERROR.
+func GoAway(h2 HTTP2) (string, bool) {
+	for _, frame := range h2.Frames() {
+		if frame.Header().Type == http2.FrameGoAway {
+			return frame.(*http2.GoAwayFrame).ErrCode.String(), true
+		}
+	}
+	return "", false
+}
+
+// Settings returns the parameters of the SETTINGS frames in h2, except their
+// acknowledgements, by name, e.g. MAX_CONCURRENT_STREAMS.
+func Settings(h2 HTTP2) map[string]uint32 {
+	settings := map[string]uint32{}
+	for _, frame := range h2.Frames() {
+		if f, ok := frame.(*http2.SettingsFrame); ok && !f.IsAck() {
+			f.ForeachSetting(func(setting http2.Setting) error {
+				settings[setting.ID.String()] = setting.Val
+				return nil
+			})
+		}
+	}
+	return settings
+}
+
+// Pings returns the opaque data of the PING frames in h2, and of the PING
+// acknowledgements.
+func Pings(h2 HTTP2) (pings []uint64, acks []uint64) {
+	for _, frame := range h2.Frames() {
+		if f, ok := frame.(*http2.PingFrame); ok {
+			data := binary.BigEndian.Uint64(f.Data[:])
+			if f.IsAck() {
+				acks = append(acks, data)
+			} else {
+				pings = append(pings, data)
+			}
+		}
+	}
+	return pings, acks
+}
+
+// DataSizes returns the size of the DATA frames in h2 counted by flow
+// control, padding included, by stream.
+func DataSizes(h2 HTTP2) map[uint32]int {
+	sizes := map[uint32]int{}
+	for _, frame := range h2.Frames() {
+		if header := frame.Header(); header.Type == http2.FrameData {
+			sizes[header.StreamID] += int(header.Length)
+		}
+	}
+	return sizes
+}
+
+// WindowUpdates returns the increments of the WINDOW_UPDATE frames in h2, by
+// stream, the connection being stream 0.
+func WindowUpdates(h2 HTTP2) map[uint32]int {
+	increments := map[uint32]int{}
+	for _, frame := range h2.Frames() {
+		if f, ok := frame.(*http2.WindowUpdateFrame); ok {
+			increments[f.Header().StreamID] += int(f.Increment)
+		}
+	}
+	return increments
+}
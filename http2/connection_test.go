@@ -0,0 +1,191 @@
+package http2
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStreamIDs(t *testing.T) {
+	tests := []struct {
+		bytes                  []byte
+		headers, ended, resets []uint32
+		goaway                 string
+		ok                     bool
+	}{
+		{
+			// HEADERS on stream 1, DATA ending stream 1.
+			bytes: []byte{
+				0x00, 0x00, 0x01, 0x01, 0x04, 0x00, 0x00, 0x00,
+				0x01, 0x88, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00,
+				0x00, 0x00, 0x01,
+			},
+			headers: []uint32{1},
+			ended:   []uint32{1},
+			resets:  []uint32{},
+		},
+		{
+			// HEADERS ending stream 3, RST_STREAM on stream 5.
+			bytes: []byte{
+				0x00, 0x00, 0x01, 0x01, 0x05, 0x00, 0x00, 0x00,
+				0x03, 0x88, 0x00, 0x00, 0x04, 0x03, 0x00, 0x00,
+				0x00, 0x00, 0x05, 0x00, 0x00, 0x00, 0x08,
+			},
+			headers: []uint32{3},
+			ended:   []uint32{3},
+			resets:  []uint32{5},
+		},
+		{
+			// GOAWAY with ENHANCE_YOUR_CALM.
+			bytes: []byte{
+				0x00, 0x00, 0x08, 0x07, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x00, 0x03, 0x00, 0x00, 0x00,
+				0x0b,
+			},
+			headers: []uint32{},
+			ended:   []uint32{},
+			resets:  []uint32{},
+			goaway:  "ENHANCE_YOUR_CALM",
+			ok:      true,
+		},
+	}
+
+	for i, test := range tests {
+		h2 := HTTP2{}
+		if err := h2.DecodeFromBytes(test.bytes, nil); err != nil {
+			t.Errorf("StreamIDs (testcase %d): wrong test case. Test case should be a valid HTTP/2 bytes", i)
+		}
+		if ret := HeadersStreamIDs(h2); !reflect.DeepEqual(ret, test.headers) {
+			t.Errorf("HeadersStreamIDs (testcase %d): returns %v while it should be %v", i, ret, test.headers)
+		}
+		if ret := EndedStreamIDs(h2); !reflect.DeepEqual(ret, test.ended) {
+			t.Errorf("EndedStreamIDs (testcase %d): returns %v while it should be %v", i, ret, test.ended)
+		}
+		if ret := ResetStreamIDs(h2); !reflect.DeepEqual(ret, test.resets) {
+			t.Errorf("ResetStreamIDs (testcase %d): returns %v while it should be %v", i, ret, test.resets)
+		}
+		if ret, ok := GoAway(h2); ret != test.goaway || ok != test.ok {
+			t.Errorf("GoAway (testcase %d): returns (%s, %t) while it should be (%s, %t)", i, ret, ok, test.goaway, test.ok)
+		}
+	}
+}
+
+func TestPreface(t *testing.T) {
+	settings := []byte{0x00, 0x00, 0x00, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00}
+	tests := []struct {
+		bytes []byte
+		want  bool
+	}{
+		{
+			bytes: append([]byte("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"), settings...),
+			want:  true,
+		},
+		{
+			bytes: settings,
+			want:  false,
+		},
+	}
+
+	for i, test := range tests {
+		h2 := HTTP2{}
+		if err := h2.DecodeFromBytes(test.bytes, nil); err != nil {
+			t.Errorf("HasPreface (testcase %d): returns err = '%v' while decoding", i, err)
+		}
+		if ret := h2.HasPreface(); ret != test.want {
+			t.Errorf("HasPreface (testcase %d): returns %t while it should be %t", i, ret, test.want)
+		}
+		if len(h2.Frames()) != 1 {
+			t.Errorf("HasPreface (testcase %d): decodes %d frames while it should be 1", i, len(h2.Frames()))
+		}
+	}
+}
+
+func TestSettingsPings(t *testing.T) {
+	tests := []struct {
+		bytes       []byte
+		settings    map[string]uint32
+		pings, acks []uint64
+	}{
+		{
+			// SETTINGS with MAX_CONCURRENT_STREAMS and INITIAL_WINDOW_SIZE,
+			// then its acknowledgement.
+			bytes: []byte{
+				0x00, 0x00, 0x0c, 0x04, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x03, 0x00, 0x00, 0x00, 0x64, 0x00,
+				0x04, 0x00, 0x00, 0xff, 0xff, 0x00, 0x00, 0x00,
+				0x04, 0x01, 0x00, 0x00, 0x00, 0x00,
+			},
+			settings: map[string]uint32{"MAX_CONCURRENT_STREAMS": 100, "INITIAL_WINDOW_SIZE": 65535},
+		},
+		{
+			// PING, then the acknowledgement of another one.
+			bytes: []byte{
+				0x00, 0x00, 0x08, 0x06, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x2a, 0x00, 0x00, 0x08, 0x06, 0x01, 0x00, 0x00,
+				0x00, 0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06,
+				0x07, 0x08,
+			},
+			settings: map[string]uint32{},
+			pings:    []uint64{42},
+			acks:     []uint64{0x0102030405060708},
+		},
+	}
+
+	for i, test := range tests {
+		h2 := HTTP2{}
+		if err := h2.DecodeFromBytes(test.bytes, nil); err != nil {
+			t.Errorf("SettingsPings (testcase %d): wrong test case. Test case should be a valid HTTP/2 bytes", i)
+		}
+		if ret := Settings(h2); !reflect.DeepEqual(ret, test.settings) {
+			t.Errorf("Settings (testcase %d): returns %v while it should be %v", i, ret, test.settings)
+		}
+		if pings, acks := Pings(h2); !reflect.DeepEqual(pings, test.pings) || !reflect.DeepEqual(acks, test.acks) {
+			t.Errorf("Pings (testcase %d): returns (%v, %v) while it should be (%v, %v)", i, pings, acks, test.pings, test.acks)
+		}
+	}
+}
+
+func TestFlowControlFrames(t *testing.T) {
+	tests := []struct {
+		bytes      []byte
+		sizes      map[uint32]int
+		increments map[uint32]int
+	}{
+		{
+			// DATA on stream 1 and 3, padded DATA on stream 1.
+			bytes: []byte{
+				0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x01, 0x00, 0x00, 0x00, 0x00, 0x03, 0x00, 0x01,
+				0x00, 0x00, 0x00, 0x03, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x04, 0x00, 0x08, 0x00, 0x00, 0x00, 0x01,
+				0x02, 0x00, 0x00, 0x00,
+			},
+			sizes:      map[uint32]int{1: 6, 3: 3},
+			increments: map[uint32]int{},
+		},
+		{
+			// WINDOW_UPDATE on the connection and on stream 1.
+			bytes: []byte{
+				0x00, 0x00, 0x04, 0x08, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x80, 0x00, 0x00, 0x00, 0x04,
+				0x08, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00,
+				0x00, 0x0d,
+			},
+			sizes:      map[uint32]int{},
+			increments: map[uint32]int{0: 32768, 1: 13},
+		},
+	}
+
+	for i, test := range tests {
+		h2 := HTTP2{}
+		if err := h2.DecodeFromBytes(test.bytes, nil); err != nil {
+			t.Errorf("FlowControlFrames (testcase %d): wrong test case. Test case should be a valid HTTP/2 bytes", i)
+		}
+		if ret := DataSizes(h2); !reflect.DeepEqual(ret, test.sizes) {
+			t.Errorf("DataSizes (testcase %d): returns %v while it should be %v", i, ret, test.sizes)
+		}
+		if ret := WindowUpdates(h2); !reflect.DeepEqual(ret, test.increments) {
+			t.Errorf("WindowUpdates (testcase %d): returns %v while it should be %v", i, ret, test.increments)
+		}
+	}
+}
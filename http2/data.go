@@ -0,0 +1,27 @@
+package http2
+
+import (
+	"golang.org/x/net/http2"
+)
+
+type DataFrame struct {
+	StreamID  uint32
+	Data      []byte
+	EndStream bool
+}
+
+// DataFrames returns the payload of every DATA frame in h2, in order.
+func DataFrames(h2 HTTP2) []DataFrame {
+	frames := []DataFrame{}
+	for _, frame := range h2.Frames() {
+		if frame.Header().Type == http2.FrameData {
+			dataframe := frame.(*http2.DataFrame)
+			frames = append(frames, DataFrame{
+				StreamID:  dataframe.StreamID,
+				Data:      dataframe.Data(),
+				EndStream: dataframe.StreamEnded(),
+			})
+		}
+	}
+	return frames
+}
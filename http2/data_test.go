@@ -0,0 +1,64 @@
+package http2
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDataFrames(t *testing.T) {
+	tests := []struct {
+		bytes []byte
+		want  []DataFrame
+	}{
+		{
+			bytes: []byte{
+				0x00, 0x00, 0x0e, 0x01, 0x04, 0x00, 0x00, 0x00,
+				0x01, 0x88, 0x5f, 0x8b, 0x1d, 0x75, 0xd0, 0x62,
+				0x0d, 0x26, 0x3d, 0x4c, 0x4d, 0x65, 0x64,
+			},
+			want: []DataFrame{},
+		},
+		{
+			bytes: []byte{
+				0x00, 0x00, 0x0e, 0x01, 0x04, 0x00, 0x00, 0x00,
+				0x01, 0x88, 0x5f, 0x8b, 0x1d, 0x75, 0xd0, 0x62,
+				0x0d, 0x26, 0x3d, 0x4c, 0x4d, 0x65, 0x64, 0x00,
+				0x00, 0x12, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
+				0x00, 0x00, 0x00, 0x00, 0x0d, 0x0a, 0x0b, 0x48,
+				0x65, 0x6c, 0x6c, 0x6f, 0x20, 0x41, 0x62, 0x72,
+				0x61, 0x6d,
+			},
+			want: []DataFrame{
+				DataFrame{
+					StreamID: 1,
+					Data: []byte{
+						0x00, 0x00, 0x00, 0x00, 0x0d, 0x0a, 0x0b, 0x48,
+						0x65, 0x6c, 0x6c, 0x6f, 0x20, 0x41, 0x62, 0x72,
+						0x61, 0x6d,
+					},
+				},
+			},
+		},
+		{
+			bytes: []byte{
+				0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x01, 0x00, 0x00, 0x00, 0x00, 0x03, 0x00, 0x01,
+				0x00, 0x00, 0x00, 0x03, 0x00, 0x00, 0x00,
+			},
+			want: []DataFrame{
+				DataFrame{StreamID: 1, Data: []byte{0x00, 0x00}},
+				DataFrame{StreamID: 3, Data: []byte{0x00, 0x00, 0x00}, EndStream: true},
+			},
+		},
+	}
+
+	for i, test := range tests {
+		h2 := HTTP2{}
+		if err := h2.DecodeFromBytes(test.bytes, nil); err != nil {
+			t.Errorf("DataFrames (testcase %d): wrong test case. Test case should be a valid HTTP/2 bytes", i)
+		}
+		if ret := DataFrames(h2); !reflect.DeepEqual(ret, test.want) {
+			t.Errorf("DataFrames (testcase %d): returns %v while it should be %v", i, ret, test.want)
+		}
+	}
+}
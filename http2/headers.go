@@ -1,6 +1,13 @@
 package http2
 
 import (
+	"encoding/base64"
+	"encoding/hex"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/abrampers/inkle/utils"
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/hpack"
 )
@@ -40,3 +47,47 @@ func Headers(h2 HTTP2) map[string]string {
 	}
 	return headers
 }
+
+// CaptureHeaders returns the headers whose name matches one of the glob
+// patterns as name=value pairs sorted by name. Values of binary headers
+// (suffixed by -bin) are base64-decoded and hex-encoded, and every value is
+// cut to maxlen bytes when maxlen is positive, without splitting a UTF-8
+// character.
+func CaptureHeaders(headers map[string]string, patterns []string, maxlen int) []string {
+	captured := []string{}
+	for name, value := range headers {
+		if !matchHeader(patterns, name) {
+			continue
+		}
+		if strings.HasSuffix(name, "-bin") {
+			value = decodeBinaryHeader(value)
+		}
+		if maxlen > 0 && len(value) > maxlen {
+			value = utils.Truncate(value, maxlen)
+		}
+		captured = append(captured, name+"="+value)
+	}
+	sort.Strings(captured)
+	return captured
+}
+
+func matchHeader(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Binary header values may be sent with or without base64 padding.
+func decodeBinaryHeader(value string) string {
+	decoded, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		decoded, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(value, "="))
+		if err != nil {
+			return value
+		}
+	}
+	return hex.EncodeToString(decoded)
+}
@@ -242,3 +242,57 @@ func TestHeaders(t *testing.T) {
 		}
 	}
 }
+
+func TestCaptureHeaders(t *testing.T) {
+	headers := map[string]string{
+		":path":          "/helloworld.Greeter/SayHello",
+		":authority":     "localhost:8000",
+		"user-agent":     "grpc-go/1.28.0-dev",
+		"x-request-id":   "a2c1f0e6-7c4e-4b83-9d43-9a0f6b0ac39b",
+		"x-tenant-id":    "inkle",
+		"x-tenant-name":  "Institut Teknologi Bandung",
+		"trace-ctx-bin":  "AAECAw==",
+		"unpadded-bin":   "AAECAw",
+		"malformed-bin":  "!!",
+		"grpc-timeout":   "999968u",
+		"content-type":   "application/grpc",
+		"x-request-path": "",
+		"grpc-message":   "déjà vu",
+	}
+
+	tests := []struct {
+		patterns []string
+		maxlen   int
+		want     []string
+	}{
+		{
+			patterns: []string{},
+			want:     []string{},
+		},
+		{
+			patterns: []string{":authority", "user-agent", "x-request-id"},
+			want:     []string{":authority=localhost:8000", "user-agent=grpc-go/1.28.0-dev", "x-request-id=a2c1f0e6-7c4e-4b83-9d43-9a0f6b0ac39b"},
+		},
+		{
+			patterns: []string{"X-Tenant-*"},
+			maxlen:   10,
+			want:     []string{"x-tenant-id=inkle", "x-tenant-name=Institut T"},
+		},
+		{
+			// Values are cut before a split character.
+			patterns: []string{"grpc-message"},
+			maxlen:   5,
+			want:     []string{"grpc-message=déj"},
+		},
+		{
+			patterns: []string{"*-bin"},
+			want:     []string{"malformed-bin=!!", "trace-ctx-bin=00010203", "unpadded-bin=00010203"},
+		},
+	}
+
+	for i, test := range tests {
+		if ret := CaptureHeaders(headers, test.patterns, test.maxlen); !reflect.DeepEqual(ret, test.want) {
+			t.Errorf("CaptureHeaders (testcase %d): returns %v while it should be %v", i, ret, test.want)
+		}
+	}
+}
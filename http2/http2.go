@@ -17,7 +17,8 @@ var LayerTypeHTTP2 = gopacket.RegisterLayerType(12345, gopacket.LayerTypeMetadat
 type HTTP2 struct {
 	layers.BaseLayer
 
-	frames []http2.Frame
+	frames  []http2.Frame
+	preface bool
 }
 
 func (h HTTP2) LayerType() gopacket.LayerType      { return LayerTypeHTTP2 }
@@ -50,12 +51,22 @@ func (h *HTTP2) Frames() []http2.Frame {
 	return h.frames
 }
 
+// HasPreface reports whether the frames are preceded by the client connection
+// preface, which starts every HTTP/2 connection.
+func (h *HTTP2) HasPreface() bool {
+	return h.preface
+}
+
 func (h *HTTP2) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
 	var frames []http2.Frame
 	frameHeaderLength := uint32(9)
 	payloadLength := len(data)
 
 	payloadIdx := 0
+	preface := bytes.HasPrefix(data, []byte(http2.ClientPreface))
+	if preface {
+		payloadIdx = len(http2.ClientPreface)
+	}
 	for payloadIdx < payloadLength {
 		if payloadIdx+int(frameHeaderLength) > payloadLength {
 			return fmt.Errorf("Payload length couldn't contain Frame Headers")
@@ -92,5 +103,6 @@ func (h *HTTP2) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
 
 	h.BaseLayer = layers.BaseLayer{Contents: data[:len(data)]}
 	h.frames = frames
+	h.preface = preface
 	return nil
 }
@@ -19,6 +19,17 @@ type InterceptedPacket struct {
 	SrcIP, DstIP   net.IP
 	SrcTCP, DstTCP layers.TCPPort
 	HTTP2          HTTP2
+	// Seq is the TCP sequence number and Length the TCP payload length.
+	Seq    uint32
+	Length int
+	// Ack is the TCP acknowledgement number and Window the TCP window.
+	Ack    uint32
+	Window uint16
+	// TCP flags, segments without payload are only intercepted when one of
+	// SYN, ACK, FIN or RST is set.
+	SYN, ACK, FIN, RST bool
+	// Timestamp is the capture time of the packet.
+	Timestamp time.Time
 }
 
 type PacketInterceptor struct {
@@ -94,23 +105,34 @@ func extractPacket(packet gopacket.Packet) (*InterceptedPacket, error) {
 		return nil, fmt.Errorf("Failed to cast TCP Layer to TCP")
 	}
 
+	packetData := []byte{}
 	applayer := packet.ApplicationLayer()
-	if applayer == nil {
+	if applayer != nil {
+		packetData = applayer.Payload()
+		if err := parser.DecodeLayers(packetData, &decoded); err != nil {
+			return nil, fmt.Errorf("Failed to parse Application Layer payload to HTTP2")
+		}
+	} else if !tcp.SYN && !tcp.ACK && !tcp.FIN && !tcp.RST {
 		return nil, fmt.Errorf("No Application Layer found")
 	}
 
-	packetData := applayer.Payload()
-	if err := parser.DecodeLayers(packetData, &decoded); err != nil {
-		return nil, fmt.Errorf("Failed to parse Application Layer payload to HTTP2")
-	}
-
 	if ipv4Ok {
 		return &InterceptedPacket{
 			SrcIP:  ipv4.SrcIP,
 			DstIP:  ipv4.DstIP,
 			SrcTCP: tcp.SrcPort,
 			DstTCP: tcp.DstPort,
+			Seq:    tcp.Seq,
+			Ack:    tcp.Ack,
+			Window: tcp.Window,
+			Length: len(packetData),
 			HTTP2:  h2c,
+			SYN:    tcp.SYN,
+			ACK:    tcp.ACK,
+			FIN:    tcp.FIN,
+			RST:    tcp.RST,
+
+			Timestamp: packet.Metadata().Timestamp,
 		}, nil
 	} else {
 		return &InterceptedPacket{
@@ -118,7 +140,17 @@ func extractPacket(packet gopacket.Packet) (*InterceptedPacket, error) {
 			DstIP:  ipv6.DstIP,
 			SrcTCP: tcp.SrcPort,
 			DstTCP: tcp.DstPort,
+			Seq:    tcp.Seq,
+			Ack:    tcp.Ack,
+			Window: tcp.Window,
+			Length: len(packetData),
 			HTTP2:  h2c,
+			SYN:    tcp.SYN,
+			ACK:    tcp.ACK,
+			FIN:    tcp.FIN,
+			RST:    tcp.RST,
+
+			Timestamp: packet.Metadata().Timestamp,
 		}, nil
 	}
 }
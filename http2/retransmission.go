@@ -0,0 +1,57 @@
+package http2
+
+// Number of segments remembered per flow to detect retransmissions.
+const segmentHistory = 1024
+
+type segmentHistoryState struct {
+	lengths map[uint32]int
+	// order of the sequence numbers in lengths, oldest first.
+	order []uint32
+}
+
+// SegmentFilter detects TCP segments which were already handled, from the
+// sequence numbers seen on each flow. Retransmissions of exactly the same
+// segment are detected, segments coalescing or splitting previous ones aren't.
+type SegmentFilter struct {
+	flows map[ipTcpConn]*segmentHistoryState
+}
+
+var Segments = NewSegmentFilter()
+
+func NewSegmentFilter() *SegmentFilter {
+	return &SegmentFilter{flows: map[ipTcpConn]*segmentHistoryState{}}
+}
+
+// IsDuplicate reports whether the payload of packet was already seen on its
+// flow.
+func (f *SegmentFilter) IsDuplicate(packet InterceptedPacket) bool {
+	if packet.Length == 0 {
+		return false
+	}
+	conn := ipTcpConn{packet.SrcIP.String(), uint16(packet.SrcTCP), packet.DstIP.String(), uint16(packet.DstTCP)}
+	history, ok := f.flows[conn]
+	if !ok {
+		history = &segmentHistoryState{lengths: map[uint32]int{}}
+		f.flows[conn] = history
+	}
+
+	length, ok := history.lengths[packet.Seq]
+	if ok && packet.Length <= length {
+		return true
+	}
+	if !ok {
+		history.order = append(history.order, packet.Seq)
+		if len(history.order) > segmentHistory {
+			delete(history.lengths, history.order[0])
+			history.order = history.order[1:]
+		}
+	}
+	history.lengths[packet.Seq] = packet.Length
+	return false
+}
+
+// Delete forgets the segments sent from srcip:srctcp to dstip:dsttcp, once
+// their connection is closed.
+func (f *SegmentFilter) Delete(srcip string, srctcp uint16, dstip string, dsttcp uint16) {
+	delete(f.flows, ipTcpConn{srcip, srctcp, dstip, dsttcp})
+}
@@ -0,0 +1,74 @@
+package http2
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIsDuplicate(t *testing.T) {
+	client, server := net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")
+	tests := []struct {
+		packet InterceptedPacket
+		want   bool
+	}{
+		{
+			packet: InterceptedPacket{SrcIP: client, DstIP: server, SrcTCP: 58108, DstTCP: 8000, Seq: 1000, Length: 100},
+			want:   false,
+		},
+		{
+			// Retransmission.
+			packet: InterceptedPacket{SrcIP: client, DstIP: server, SrcTCP: 58108, DstTCP: 8000, Seq: 1000, Length: 100},
+			want:   true,
+		},
+		{
+			// Same sequence number on the reverse flow.
+			packet: InterceptedPacket{SrcIP: server, DstIP: client, SrcTCP: 8000, DstTCP: 58108, Seq: 1000, Length: 100},
+			want:   false,
+		},
+		{
+			// Out of order segment.
+			packet: InterceptedPacket{SrcIP: client, DstIP: server, SrcTCP: 58108, DstTCP: 8000, Seq: 900, Length: 100},
+			want:   false,
+		},
+		{
+			// Retransmission carrying more data than the original segment.
+			packet: InterceptedPacket{SrcIP: client, DstIP: server, SrcTCP: 58108, DstTCP: 8000, Seq: 1000, Length: 150},
+			want:   false,
+		},
+		{
+			packet: InterceptedPacket{SrcIP: client, DstIP: server, SrcTCP: 58108, DstTCP: 8000, Seq: 1000, Length: 120},
+			want:   true,
+		},
+		{
+			// Segments without payload, e.g. ACKs, are never duplicates.
+			packet: InterceptedPacket{SrcIP: client, DstIP: server, SrcTCP: 58108, DstTCP: 8000, Seq: 1150},
+			want:   false,
+		},
+		{
+			packet: InterceptedPacket{SrcIP: client, DstIP: server, SrcTCP: 58108, DstTCP: 8000, Seq: 1150},
+			want:   false,
+		},
+	}
+
+	f := NewSegmentFilter()
+	for i, test := range tests {
+		if ret := f.IsDuplicate(test.packet); ret != test.want {
+			t.Errorf("IsDuplicate (testcase %d): returns %t while it should be %t", i, ret, test.want)
+		}
+	}
+}
+
+func TestIsDuplicateHistory(t *testing.T) {
+	client, server := net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")
+	f := NewSegmentFilter()
+	for seq := uint32(0); seq <= segmentHistory; seq++ {
+		f.IsDuplicate(InterceptedPacket{SrcIP: client, DstIP: server, SrcTCP: 58108, DstTCP: 8000, Seq: seq * 10, Length: 10})
+	}
+	// The oldest segment is forgotten, the latest ones are remembered.
+	if f.IsDuplicate(InterceptedPacket{SrcIP: client, DstIP: server, SrcTCP: 58108, DstTCP: 8000, Seq: 0, Length: 10}) {
+		t.Errorf("IsDuplicate: remembers more than %d segments", segmentHistory)
+	}
+	if !f.IsDuplicate(InterceptedPacket{SrcIP: client, DstIP: server, SrcTCP: 58108, DstTCP: 8000, Seq: segmentHistory * 10, Length: 10}) {
+		t.Errorf("IsDuplicate: doesn't remember the latest segment")
+	}
+}
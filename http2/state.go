@@ -34,3 +34,9 @@ func (s *HeadersState) UpdateState(srcip string, srctcp uint16, dstip string, ds
 		s.SetHeaders(srcip, srctcp, dstip, dsttcp, k, v)
 	}
 }
+
+// Delete forgets the headers sent from srcip:srctcp to dstip:dsttcp, once
+// their connection is closed.
+func (s *HeadersState) Delete(srcip string, srctcp uint16, dstip string, dsttcp uint16) {
+	delete(s.state, ipTcpConn{srcip, srctcp, dstip, dsttcp})
+}
@@ -3,25 +3,68 @@ package main
 import (
 	"flag"
 	"fmt"
+	"hash/fnv"
 	"log"
 	"net"
+	"net/http"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/abrampers/inkle/grpc"
 	"github.com/abrampers/inkle/http2"
 	"github.com/abrampers/inkle/logging"
+	"github.com/abrampers/inkle/metrics"
+	"github.com/abrampers/inkle/protobuf"
+	"github.com/abrampers/inkle/tracing"
 	"github.com/abrampers/inkle/utils"
 )
 
 var (
 	isstdout       = flag.Bool("stdout", false, "Write logs to stdout")
 	outputdir      = flag.String("output", ".", "Output directory of the logs. Ignored if -stdout flag set.")
-	timeout        = flag.Duration("timeout", 800*time.Millisecond, "Request timeout in nanosecond")
+	timeout        = flag.Duration("timeout", 800*time.Millisecond, "Timeout of requests without a grpc-timeout deadline")
 	device         = flag.String("device", "eth0", "Network interface to be intercepted.")
 	islocalrequest = flag.Bool("filter-by-host-cidr", false, `If this flag is set, Inkle will get the valid IP range of the network device specified in
 -device and will only print logs with source IP addres within that range.`)
-	err error
+	dumppayload = flag.String("dump-payload", "", `Comma separated service/method glob patterns (e.g. helloworld.Greeter/*). Messages of
+matching methods are decoded from the protobuf wire format and attached to the logs.`)
+	dumppayloadsize = flag.Int("dump-payload-size", 1024, "Maximum length of a decoded message attached to the logs.")
+	isreflection    = flag.Bool("reflection", false, `If this flag is set, Inkle will fetch the descriptors of services selected by -dump-payload
+through gRPC server reflection on their :authority, and use them to decode the messages.`)
+	reflectionallow = flag.String("reflection-allow", "", `Comma separated host:port glob patterns of the authorities Inkle may connect to for server reflection.
+None are allowed by default.`)
+	reflectioninterval     = flag.Duration("reflection-interval", time.Second, "Minimum interval between two server reflection requests to the same authority.")
+	captureheaders         = flag.String("capture-headers", "", "Comma separated glob patterns of request and response header and trailer names to add to the logs (e.g. x-request-id).")
+	capturerequestheaders  = flag.String("capture-request-headers", "", "Comma separated glob patterns of request header names to add to the logs (e.g. x-request-id,x-tenant-*).")
+	captureresponseheaders = flag.String("capture-response-headers", "", "Comma separated glob patterns of response header and trailer names to add to the logs.")
+	captureheadersize      = flag.Int("capture-header-size", 256, "Maximum length of a captured header value.")
+	maxmessagesize         = flag.Int("max-message-size", 4*1024*1024, "Maximum size in bytes of a gRPC message, compressed or decompressed. Larger messages are skipped.")
+	timeoutpolicy          = flag.String("timeout-policy", "", "Comma separated service/method=timeout[:action] expiry policies, action being timeout (default), wait or stream (e.g. batch.Batch/*=30s).")
+	retrywindow            = flag.Duration("retry-window", 0, "Maximum delay between two attempts of a retried or hedged call to group them. 0 disables grouping.")
+	retrymatchpayload      = flag.Bool("retry-match-payload", false, "If this flag is set, attempts are only grouped when their first request messages are the same.")
+	lateresponsewindow     = flag.Duration("late-response-window", 10*time.Second, "How long timed out requests are remembered to match their late response. 0 disables it.")
+	stallthreshold         = flag.Duration("flow-control-stall", time.Second, "How long a stream may stay blocked by HTTP/2 flow control before a stall is reported. 0 disables it.")
+	format                 = flag.String("format", logging.FormatCSV, "Format of the logs, csv, json, logfmt, pretty or a Go text/template executed against logging.Record.")
+	rotatesize             = flag.Int64("rotate-size", 0, "Size in bytes from which the log file is rotated. 0 disables rotation by size.")
+	rotateinterval         = flag.Duration("rotate-interval", 0, "Rotate the log file at every multiple of this interval (e.g. 24h for midnight UTC). 0 disables rotation by time.")
+	rotatekeep             = flag.Int("rotate-keep", 5, "Number of rotated log files kept. 0 keeps all of them.")
+	rotatecompress         = flag.Bool("rotate-compress", false, "If this flag is set, rotated log files are compressed with gzip.")
+	metricsaddress         = flag.String("metrics-address", "", "Address of the HTTP listener serving Prometheus metrics on /metrics (e.g. :9090). Disabled if empty.")
+	metricsbuckets         = flag.String("metrics-buckets", "0.005,0.01,0.025,0.05,0.1,0.25,0.5,1,2.5,5,10", "Comma separated upper bounds in seconds of the latency histograms.")
+	metricslabelvalues     = flag.Int("metrics-max-label-values", 100, "Maximum number of values of each metrics label, e.g. peers. Further values are reported as other. 0 disables the limit.")
+	sinkconfigs            sinkList
+	err                    error
+	reflector              *grpc.Reflector
+	reassembler            = grpc.NewReassembler()
+	// requestheaderpatterns and responseheaderpatterns are the patterns of
+	// the header names captured in each direction, and dumppatterns the ones
+	// of the methods whose messages are decoded, parsed from the flags.
+	requestheaderpatterns, responseheaderpatterns []string
+	dumppatterns                                  []string
 )
 
 const (
@@ -29,6 +72,8 @@ const (
 	promiscuous bool          = false
 	itcpTimeout time.Duration = 1000 * time.Millisecond
 	filename    string        = "inkle.log"
+
+	reflectionTimeout time.Duration = 5 * time.Second
 )
 
 func validateRequestFrameHeaders(headers map[string]string) error {
@@ -61,7 +106,24 @@ func validateResponseFrameHeaders(headers map[string]string) error {
 }
 
 func handlePacket(elm logging.EventLogManager, packet http2.InterceptedPacket) string {
+	// Retransmitted segments would duplicate requests, responses and messages.
+	if http2.Segments.IsDuplicate(packet) {
+		elm.InsertDuplicateSegment(packet.SrcIP.String(), uint16(packet.SrcTCP), packet.DstIP.String(), uint16(packet.DstTCP))
+		return ""
+	}
+	now := packetTime(packet)
+	handleConnection(elm, packet, now)
+	defer closeConnection(elm, packet, now)
+	// Segments without payload, e.g. bare ACKs, carry no frame.
+	if packet.Length == 0 {
+		return ""
+	}
+	defer forgetStreams(packet)
+
 	headers := http2.Headers(packet.HTTP2)
+	// Headers are captured from the packet only, as the connection state may
+	// hold values of previous calls.
+	packetheaders := headers
 	// Check whether this request is response or not
 	if err := validateRequestFrameHeaders(headers); err == nil {
 		http2.State.UpdateState(packet.SrcIP.String(), uint16(packet.SrcTCP), packet.DstIP.String(), uint16(packet.DstTCP), headers)
@@ -70,7 +132,26 @@ func handlePacket(elm logging.EventLogManager, packet http2.InterceptedPacket) s
 		if err != nil {
 			return ""
 		}
-		return elm.CreatePendingRequest(time.Now(), servicename, methodname, packet.SrcIP.String(), uint16(packet.SrcTCP), packet.DstIP.String(), uint16(packet.DstTCP))
+		ret := elm.CreatePendingRequest(now, servicename, methodname, packet.SrcIP.String(), uint16(packet.SrcTCP), packet.DstIP.String(), uint16(packet.DstTCP))
+		for _, streamid := range http2.HeadersStreamIDs(packet.HTTP2) {
+			elm.InsertStream(now, packet.SrcIP.String(), uint16(packet.SrcTCP), packet.DstIP.String(), uint16(packet.DstTCP), streamid)
+		}
+		if captured := http2.CaptureHeaders(packetheaders, requestheaderpatterns, *captureheadersize); len(captured) > 0 {
+			elm.InsertRequestHeaders(packet.SrcIP.String(), uint16(packet.SrcTCP), captured)
+		}
+		if deadline, err := utils.ParseGrpcTimeout(packetheaders["grpc-timeout"]); err == nil {
+			elm.InsertDeadline(packet.SrcIP.String(), uint16(packet.SrcTCP), deadline)
+		}
+		if trace, ok := tracing.Extract(packetheaders); ok {
+			elm.InsertTraceContext(packet.SrcIP.String(), uint16(packet.SrcTCP), trace)
+		}
+		handlePayload(elm, packet, now)
+		handleRequestEnd(elm, packet, now)
+		// The first request message is usually in the same packet, so that
+		// its hash is known when grouping attempts.
+		previousattempts, _ := strconv.Atoi(packetheaders["grpc-previous-rpc-attempts"])
+		elm.InsertAttempt(packet.SrcIP.String(), uint16(packet.SrcTCP), previousattempts)
+		return ret + endStreams(elm, packet, now)
 	} else if err := validateResponseFrameHeaders(headers); err == nil {
 		http2.State.UpdateState(packet.SrcIP.String(), uint16(packet.SrcTCP), packet.DstIP.String(), uint16(packet.DstTCP), headers)
 		headers = http2.State.Headers(packet.SrcIP.String(), uint16(packet.SrcTCP), packet.DstIP.String(), uint16(packet.DstTCP))
@@ -78,41 +159,392 @@ func handlePacket(elm logging.EventLogManager, packet http2.InterceptedPacket) s
 		if !ok {
 			statuscode = "-1"
 		}
-		return elm.InsertResponse(time.Now(), packet.SrcIP.String(), uint16(packet.SrcTCP), packet.DstIP.String(), uint16(packet.DstTCP), statuscode)
+		if captured := http2.CaptureHeaders(packetheaders, responseheaderpatterns, *captureheadersize); len(captured) > 0 {
+			elm.InsertResponseHeaders(packet.DstIP.String(), uint16(packet.DstTCP), captured)
+		}
+		ret := elm.StartResponse(now, packet.SrcIP.String(), uint16(packet.SrcTCP), packet.DstIP.String(), uint16(packet.DstTCP), statuscode)
+		handlePayload(elm, packet, now)
+		if _, ok := packetheaders["grpc-status"]; ok {
+			elm.InsertTrailers(now, packet.DstIP.String(), uint16(packet.DstTCP), statuscode)
+		}
+		return ret + endStreams(elm, packet, now)
+	} else if statuscode, ok := packetheaders["grpc-status"]; ok {
+		// Trailers sent after the response HEADERS and messages.
+		if captured := http2.CaptureHeaders(packetheaders, responseheaderpatterns, *captureheadersize); len(captured) > 0 {
+			elm.InsertResponseHeaders(packet.DstIP.String(), uint16(packet.DstTCP), captured)
+		}
+		handlePayload(elm, packet, now)
+		elm.InsertTrailers(now, packet.DstIP.String(), uint16(packet.DstTCP), statuscode)
+		return endStreams(elm, packet, now)
 	}
-	return ""
+	handlePayload(elm, packet, now)
+	handleRequestEnd(elm, packet, now)
+	return endStreams(elm, packet, now)
 }
 
-func outputFile(isstdout bool, filepath string) (*os.File, error) {
-	var f *os.File
-	if !isstdout {
-		f, err = os.OpenFile(filepath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			return nil, err
+// headerPatterns returns the patterns of the header names captured in a
+// direction, from -capture-headers and the flag of the direction.
+func headerPatterns(both string, direction string) []string {
+	return append(utils.SplitList(both), utils.SplitList(direction)...)
+}
+
+// packetTime returns the capture time of packet, or the current time when
+// it's unknown.
+func packetTime(packet http2.InterceptedPacket) time.Time {
+	if packet.Timestamp.IsZero() {
+		return time.Now()
+	}
+	return packet.Timestamp
+}
+
+// handleRequestEnd records the end of the request streams closed by packet.
+// Streams closed by the server don't match any pending request, as requests
+// are looked up by their client.
+func handleRequestEnd(elm logging.EventLogManager, packet http2.InterceptedPacket, now time.Time) {
+	if len(http2.EndedStreamIDs(packet.HTTP2)) > 0 {
+		elm.InsertRequestEnd(now, packet.SrcIP.String(), uint16(packet.SrcTCP))
+	}
+}
+
+// handleConnection follows the connection of packet from its SYN or its
+// client preface, its TCP handshake and health, its SETTINGS, PINGs and flow
+// control. Its opening is printed once its client preface or SETTINGS show it
+// carries HTTP/2.
+func handleConnection(elm logging.EventLogManager, packet http2.InterceptedPacket, now time.Time) {
+	srcip, srctcp, dstip, dsttcp := packet.SrcIP.String(), uint16(packet.SrcTCP), packet.DstIP.String(), uint16(packet.DstTCP)
+	if packet.SYN && !packet.ACK {
+		elm.FollowConnection(now, srcip, srctcp, dstip, dsttcp)
+	}
+	if packet.HTTP2.HasPreface() {
+		elm.OpenConnection(now, srcip, srctcp, dstip, dsttcp)
+	}
+	// The segments and frames of connections which aren't followed, e.g. the
+	// ones of the sinks, are skipped.
+	if !elm.IsFollowed(srcip, srctcp, dstip, dsttcp) {
+		return
+	}
+	if packet.SYN || packet.ACK {
+		elm.InsertHandshake(now, srcip, srctcp, dstip, dsttcp, packet.SYN, packet.ACK)
+	}
+	dupack, zerowindow := http2.Acks.Track(packet)
+	if dupack {
+		elm.InsertDuplicateAck(srcip, srctcp, dstip, dsttcp)
+	}
+	if zerowindow {
+		elm.InsertZeroWindow(srcip, srctcp, dstip, dsttcp)
+	}
+	if errcode, ok := http2.GoAway(packet.HTTP2); ok {
+		elm.InsertGoAway(srcip, srctcp, dstip, dsttcp, errcode)
+	}
+	if settings := http2.Settings(packet.HTTP2); len(settings) > 0 {
+		elm.InsertSettings(now, srcip, srctcp, dstip, dsttcp, settings)
+	}
+	if sizes := http2.DataSizes(packet.HTTP2); len(sizes) > 0 {
+		elm.InsertData(now, srcip, srctcp, dstip, dsttcp, sizes)
+	}
+	if increments := http2.WindowUpdates(packet.HTTP2); len(increments) > 0 {
+		elm.InsertWindowUpdate(now, srcip, srctcp, dstip, dsttcp, increments)
+	}
+	pings, acks := http2.Pings(packet.HTTP2)
+	for _, data := range pings {
+		elm.InsertPing(now, srcip, srctcp, dstip, dsttcp, data, false)
+	}
+	for _, data := range acks {
+		elm.InsertPing(now, srcip, srctcp, dstip, dsttcp, data, true)
+	}
+}
+
+// endStreams ends the streams reset or ended by packet, once its frames are
+// handled, and returns the calls they finish.
+func endStreams(elm logging.EventLogManager, packet http2.InterceptedPacket, now time.Time) string {
+	srcip, srctcp, dstip, dsttcp := packet.SrcIP.String(), uint16(packet.SrcTCP), packet.DstIP.String(), uint16(packet.DstTCP)
+	ret := ""
+	for _, streamid := range http2.ResetStreamIDs(packet.HTTP2) {
+		ret += elm.EndStream(now, srcip, srctcp, dstip, dsttcp, streamid, true)
+	}
+	for _, streamid := range http2.EndedStreamIDs(packet.HTTP2) {
+		ret += elm.EndStream(now, srcip, srctcp, dstip, dsttcp, streamid, false)
+	}
+	return ret
+}
+
+// closeConnection prints the closing of the connection of packet when it
+// carries a FIN or a RST, and forgets the state of the connection.
+func closeConnection(elm logging.EventLogManager, packet http2.InterceptedPacket, now time.Time) {
+	if !packet.FIN && !packet.RST {
+		return
+	}
+	reason := "FIN"
+	if packet.RST {
+		reason = "RST"
+	}
+	srcip, srctcp, dstip, dsttcp := packet.SrcIP.String(), uint16(packet.SrcTCP), packet.DstIP.String(), uint16(packet.DstTCP)
+	elm.CloseConnection(now, srcip, srctcp, dstip, dsttcp, reason)
+	http2.State.Delete(srcip, srctcp, dstip, dsttcp)
+	http2.State.Delete(dstip, dsttcp, srcip, srctcp)
+	http2.Segments.Delete(srcip, srctcp, dstip, dsttcp)
+	http2.Segments.Delete(dstip, dsttcp, srcip, srctcp)
+	http2.Acks.Delete(srcip, srctcp, dstip, dsttcp)
+	http2.Acks.Delete(dstip, dsttcp, srcip, srctcp)
+	reassembler.ForgetPrefix(reassemblyPrefix(srcip, srctcp, dstip, dsttcp))
+	reassembler.ForgetPrefix(reassemblyPrefix(dstip, dsttcp, srcip, srctcp))
+}
+
+// forgetStreams drops the partial messages of the streams ended by packet,
+// once its DATA frames are reassembled. A stream ended by END_STREAM, e.g. by
+// its trailers, is only ended in the direction of packet, while a stream
+// reset by RST_STREAM is ended in both directions.
+func forgetStreams(packet http2.InterceptedPacket) {
+	srcip, srctcp, dstip, dsttcp := packet.SrcIP.String(), uint16(packet.SrcTCP), packet.DstIP.String(), uint16(packet.DstTCP)
+	for _, streamid := range http2.EndedStreamIDs(packet.HTTP2) {
+		reassembler.Forget(reassemblyKey(srcip, srctcp, dstip, dsttcp, streamid))
+	}
+	for _, streamid := range http2.ResetStreamIDs(packet.HTTP2) {
+		reassembler.Forget(reassemblyKey(srcip, srctcp, dstip, dsttcp, streamid))
+		reassembler.Forget(reassemblyKey(dstip, dsttcp, srcip, srctcp, streamid))
+	}
+}
+
+// reassemblyPrefix returns the prefix of the reassembler keys of the streams
+// sent from srcip:srctcp to dstip:dsttcp.
+func reassemblyPrefix(srcip string, srctcp uint16, dstip string, dsttcp uint16) string {
+	return fmt.Sprintf("%s,%d,%s,%d,", srcip, srctcp, dstip, dsttcp)
+}
+
+// reassemblyKey returns the reassembler key of the stream streamid sent from
+// srcip:srctcp to dstip:dsttcp.
+func reassemblyKey(srcip string, srctcp uint16, dstip string, dsttcp uint16, streamid uint32) string {
+	return fmt.Sprintf("%s%d", reassemblyPrefix(srcip, srctcp, dstip, dsttcp), streamid)
+}
+
+// handlePayload reassembles the gRPC messages carried by the DATA frames of
+// packet and counts them in the sizes of the pending request. Messages of
+// methods selected by -dump-payload are also decoded and attached to it. The
+// direction of the packet is derived from which side sent the :path header.
+func handlePayload(elm logging.EventLogManager, packet http2.InterceptedPacket, now time.Time) {
+	frames := http2.DataFrames(packet.HTTP2)
+	if len(frames) == 0 {
+		return
+	}
+
+	isrequest := true
+	serverip, servertcp := packet.DstIP.String(), uint16(packet.DstTCP)
+	headers := http2.State.Headers(packet.SrcIP.String(), uint16(packet.SrcTCP), packet.DstIP.String(), uint16(packet.DstTCP))
+	encoding := headers["grpc-encoding"]
+	if headers[":path"] == "" {
+		isrequest = false
+		serverip, servertcp = packet.SrcIP.String(), uint16(packet.SrcTCP)
+		headers = http2.State.Headers(packet.DstIP.String(), uint16(packet.DstTCP), packet.SrcIP.String(), uint16(packet.SrcTCP))
+	}
+	servicename, methodname, err := utils.ParseGrpcPath(headers[":path"])
+	if err != nil {
+		return
+	}
+
+	var dump func(payload []byte) string
+	if utils.MatchMethod(dumppatterns, servicename, methodname) {
+		dump = func(payload []byte) string { return protobuf.Dump(payload, *dumppayloadsize) }
+		if reflector != nil {
+			authority := reflectionAuthority(headers[":authority"], serverip, servertcp)
+			if schema, ok := reflector.Schema(authority, servicename); ok {
+				if method, ok := schema.Method(servicename, methodname); ok {
+					typename := method.OutputType
+					if isrequest {
+						typename = method.InputType
+					}
+					dump = func(payload []byte) string { return schema.Dump(payload, typename, *dumppayloadsize) }
+				}
+			}
+		}
+	}
+
+	dumps := []string{}
+	for _, frame := range frames {
+		key := reassemblyKey(packet.SrcIP.String(), uint16(packet.SrcTCP), packet.DstIP.String(), uint16(packet.DstTCP), frame.StreamID)
+		for _, message := range reassembler.Write(key, frame.Data, frame.EndStream, *maxmessagesize) {
+			payload, err := decodeMessage(message, encoding, *maxmessagesize)
+			uncompressedsize := -1
+			if err == nil {
+				uncompressedsize = len(payload)
+			}
+			if isrequest {
+				elm.InsertRequestMessage(packet.SrcIP.String(), uint16(packet.SrcTCP), int(message.Length), uncompressedsize)
+				if *retrymatchpayload && err == nil {
+					elm.InsertRequestHash(packet.SrcIP.String(), uint16(packet.SrcTCP), messageHash(payload))
+				}
+			} else {
+				elm.InsertResponseMessage(now, packet.DstIP.String(), uint16(packet.DstTCP), int(message.Length), uncompressedsize)
+			}
+			if dump != nil {
+				dumps = append(dumps, dumpMessage(payload, err, dump))
+			}
 		}
+	}
+	if len(dumps) == 0 {
+		return
+	}
+
+	if isrequest {
+		elm.InsertRequestPayload(packet.SrcIP.String(), uint16(packet.SrcTCP), strings.Join(dumps, " "))
 	} else {
-		f = os.Stdout
+		elm.InsertResponsePayload(packet.DstIP.String(), uint16(packet.DstTCP), strings.Join(dumps, " "))
+	}
+}
+
+// decodeMessage returns the serialized protobuf of message, decompressed with
+// the grpc-encoding of its stream if needed.
+func decodeMessage(message grpc.Message, encoding string, maxsize int) ([]byte, error) {
+	if message.Payload == nil {
+		return nil, grpc.ErrMessageTooLarge
+	}
+	if !message.Compressed {
+		return message.Payload, nil
+	}
+	return grpc.Decompress(encoding, message.Payload, maxsize)
+}
+
+func dumpMessage(payload []byte, err error, dump func(payload []byte) string) string {
+	if err == grpc.ErrMessageTooLarge {
+		return "<too large>"
+	} else if err != nil {
+		return "<undecodable>"
+	}
+	return dump(payload)
+}
+
+// messageHash returns a hash of a request message, to match the attempts of
+// retried calls.
+func messageHash(payload []byte) string {
+	h := fnv.New64a()
+	h.Write(payload)
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+// reflectionAuthority returns the host:port to query for server reflection,
+// falling back to the observed server address when :authority is missing and
+// to the observed server port when :authority has no port.
+func reflectionAuthority(authority string, serverip string, servertcp uint16) string {
+	if authority == "" {
+		return net.JoinHostPort(serverip, strconv.Itoa(int(servertcp)))
+	}
+	if _, _, err := net.SplitHostPort(authority); err != nil {
+		return net.JoinHostPort(authority, strconv.Itoa(int(servertcp)))
+	}
+	return authority
+}
+
+func outputFile(isstdout bool, filepath string, policy logging.RotationPolicy) (logging.LogFile, error) {
+	if isstdout {
+		return os.Stdout, nil
+	}
+	f, err := logging.OpenRotatingFile(filepath, policy)
+	if err != nil {
+		return nil, err
 	}
 	return f, nil
 }
 
+// reopenOnSignal reopens f on SIGHUP, sent by logrotate once it moved the
+// file away.
+func reopenOnSignal(f *logging.RotatingFile) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	for range signals {
+		if err := f.Reopen(); err != nil {
+			log.Printf("Failed to reopen %s: %v\n", f.Name(), err)
+		}
+	}
+}
+
+// stopOnSignal sends the events still queued for the sinks when inkle is
+// stopped.
+func stopOnSignal(elm logging.EventLogManager) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	<-signals
+	elm.Stop()
+	os.Exit(0)
+}
+
+// serveMetrics serves the metrics on /metrics of listener.
+func serveMetrics(listener net.Listener, handler http.Handler) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", handler)
+	log.Printf("Serving metrics on %s/metrics.\n", listener.Addr())
+	if err := http.Serve(listener, mux); err != nil {
+		log.Printf("Failed to serve metrics: %v\n", err)
+	}
+}
+
+func init() {
+	flag.Var(&sinkconfigs, "sink", `Sink of the logs as type[:key=value,...], repeated for several sinks (e.g. webhook:url=http://alerts/inkle,errors=true).
+Types are file, stdout, webhook, otlp, zipkin, statsd, dogstatsd, elasticsearch and lumberjack. Defaults to the file of -output, or stdout with -stdout.`)
+}
+
 func main() {
 	flag.Parse()
+	requestheaderpatterns = headerPatterns(*captureheaders, *capturerequestheaders)
+	responseheaderpatterns = headerPatterns(*captureheaders, *captureresponseheaders)
+	dumppatterns = utils.SplitList(*dumppayload)
 	interceptor := http2.NewPacketInterceptor(*device, snaplen, promiscuous, itcpTimeout)
 	defer interceptor.Close()
-	filepath := filepath.Join(*outputdir, filename)
-	f, err := outputFile(*isstdout, filepath)
+	cidr := &net.IPNet{}
+	if *islocalrequest {
+		cidr = utils.CIDR(*device)
+	}
+	if *isreflection {
+		if *reflectionallow == "" {
+			log.Println("-reflection is set without -reflection-allow, no authority will be queried.")
+		}
+		reflector = grpc.NewReflector(utils.SplitList(*reflectionallow), *reflectioninterval, reflectionTimeout)
+	}
+
+	policies, err := logging.ParseExpiryPolicies(*timeoutpolicy)
 	if err != nil {
-		log.Println("Failed to create output file")
+		log.Println("Failed to parse -timeout-policy")
 		panic(err)
 	}
 
-	cidr := &net.IPNet{}
-	if *islocalrequest {
-		cidr = utils.CIDR(*device)
+	formatter, err := logging.ParseFormat(*format)
+	if err != nil {
+		log.Println("Failed to parse -format")
+		panic(err)
+	}
+
+	policy := logging.RotationPolicy{MaxSize: *rotatesize, Interval: *rotateinterval, MaxFiles: *rotatekeep, Compress: *rotatecompress}
+	local := cidr
+	if !*islocalrequest {
+		local = utils.CIDR(*device)
+	}
+	sinks, err := newSinks(sinkconfigs, policy, local)
+	if err != nil {
+		log.Println("Failed to create sinks")
+		panic(err)
+	}
+
+	var collector *metrics.Collector
+	var listener net.Listener
+	if *metricsaddress != "" {
+		buckets, err := metrics.ParseBuckets(*metricsbuckets)
+		if err != nil {
+			log.Println("Failed to parse -metrics-buckets")
+			panic(err)
+		}
+		listener, err = net.Listen("tcp", *metricsaddress)
+		if err != nil {
+			log.Println("Failed to listen on -metrics-address")
+			panic(err)
+		}
+		collector = metrics.NewCollector(buckets, *metricslabelvalues, local)
+		sinks = append(sinks, collector)
 	}
-	elm := logging.NewEventLogManager(*timeout, f, cidr)
+
+	elm := logging.NewEventLogManager(*timeout, policies, *lateresponsewindow, *retrywindow, *stallthreshold, formatter, sinks, cidr)
 	defer elm.Stop()
+	go stopOnSignal(elm)
+	if listener != nil {
+		go serveMetrics(listener, metrics.NewHandler(collector, elm.InFlight, sinks))
+	}
 
 	go elm.CleanupExpiredRequests()
 
@@ -1,15 +1,21 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/abrampers/inkle/grpc"
 	"github.com/abrampers/inkle/http2"
 	"github.com/abrampers/inkle/logging"
+	"github.com/abrampers/inkle/protobuf"
+	"github.com/abrampers/inkle/utils"
 )
 
 func Test_validateRequestFrameHeaders(t *testing.T) {
@@ -90,46 +96,46 @@ func Test_outputFile(t *testing.T) {
 	tests := []struct {
 		isstdout bool
 		filename string
-		want     *os.File
+		want     string
 		err      error
 	}{
 		{
 			isstdout: true,
-			want:     os.Stdout,
+			want:     os.Stdout.Name(),
 			err:      nil,
 		},
 		{
 			isstdout: true,
 			filename: "asdf/asdf",
-			want:     os.Stdout,
+			want:     os.Stdout.Name(),
 			err:      nil,
 		},
 		{
 			isstdout: false,
 			filename: file.Name(),
-			want:     file,
+			want:     file.Name(),
 			err:      nil,
 		},
 		{
 			isstdout: false,
 			filename: "asdf/asdf",
-			want:     nil,
+			want:     "",
 			err:      fmt.Errorf("open asdf/asdf: no such file or directory"),
 		},
 	}
 
 	for i, test := range tests {
-		f, err := outputFile(test.isstdout, test.filename)
-		if err == nil && test.err == nil {
-			continue
-		} else if (err == nil && test.err != nil) || (err != nil && test.err == nil) || (err.Error() != test.err.Error()) {
+		f, err := outputFile(test.isstdout, test.filename, logging.RotationPolicy{})
+		if (err == nil && test.err != nil) || (err != nil && test.err == nil) || (err != nil && err.Error() != test.err.Error()) {
 			t.Errorf("outputFile (testcase %d): returns incorrect error", i)
 			t.Log(err)
 			t.Log(test.err)
-		} else if f != test.want {
+		} else if err == nil && f.Name() != test.want {
 			t.Errorf("outputFile (testcase %d): returns incorrect file", i)
 		}
-		f.Close()
+		if rf, ok := f.(*logging.RotatingFile); ok {
+			rf.Close()
+		}
 	}
 }
 
@@ -399,14 +405,16 @@ func Test_handlePacket(t *testing.T) {
 		if err != nil {
 			t.Errorf("handlePacket (testcase %d): wrong test case. Test case should be a valid HTTP/2 bytes", i)
 		}
-		packet := http2.InterceptedPacket{SrcIP: net.IPv6loopback, DstIP: net.IPv6loopback, SrcTCP: 58108, DstTCP: 8000, HTTP2: h2}
+		packet := http2.InterceptedPacket{SrcIP: net.IPv6loopback, DstIP: net.IPv6loopback, SrcTCP: 58108, DstTCP: 8000, HTTP2: h2, Length: len(test.bytes)}
+		// Each testcase is a new segment of the flow.
+		http2.Segments.Delete("::1", 58108, "::1", 8000)
 		f, err := ioutil.TempFile("", "Test_printEvent*.log")
 		if err != nil {
 			t.Errorf("handlePacket (testcase %d): %v", i, err)
 		}
 		defer f.Close()
 		defer os.Remove(f.Name())
-		elm := logging.NewEventLogManager(10*time.Millisecond, f, test.cidr)
+		elm := logging.NewEventLogManager(10*time.Millisecond, nil, 0, 0, 0, nil, []logging.Sink{logging.NewWriterSink(f, nil)}, test.cidr)
 
 		if ret := handlePacket(elm, packet); ret != test.want {
 			t.Errorf("handlePacket (testcase %d): returns incorrect log line", i)
@@ -415,3 +423,290 @@ func Test_handlePacket(t *testing.T) {
 		}
 	}
 }
+
+func Test_decodeMessage(t *testing.T) {
+	var gzipped bytes.Buffer
+	w := gzip.NewWriter(&gzipped)
+	w.Write([]byte{0x0a, 0x05, 0x41, 0x62, 0x72, 0x61, 0x6d})
+	w.Close()
+
+	tests := []struct {
+		message  grpc.Message
+		encoding string
+		want     []byte
+		err      error
+	}{
+		{
+			message: grpc.Message{Length: 7, Payload: []byte{0x0a, 0x05, 0x41, 0x62, 0x72, 0x61, 0x6d}},
+			want:    []byte{0x0a, 0x05, 0x41, 0x62, 0x72, 0x61, 0x6d},
+		},
+		{
+			message:  grpc.Message{Compressed: true, Length: uint32(gzipped.Len()), Payload: gzipped.Bytes()},
+			encoding: "gzip",
+			want:     []byte{0x0a, 0x05, 0x41, 0x62, 0x72, 0x61, 0x6d},
+		},
+		{
+			message:  grpc.Message{Compressed: true, Length: 1 << 30},
+			encoding: "gzip",
+			err:      grpc.ErrMessageTooLarge,
+		},
+	}
+
+	for i, test := range tests {
+		ret, err := decodeMessage(test.message, test.encoding, 1024)
+		if err != test.err {
+			t.Errorf("decodeMessage (testcase %d): returns error '%v' while it should be '%v'", i, err, test.err)
+		} else if !bytes.Equal(ret, test.want) {
+			t.Errorf("decodeMessage (testcase %d): returns %v while it should be %v", i, ret, test.want)
+		}
+	}
+}
+
+func Test_dumpMessage(t *testing.T) {
+	tests := []struct {
+		payload []byte
+		err     error
+		want    string
+	}{
+		{
+			payload: []byte{0x0a, 0x05, 0x41, 0x62, 0x72, 0x61, 0x6d},
+			want:    `{1:"Abram"}`,
+		},
+		{
+			err:  grpc.ErrMessageTooLarge,
+			want: "<too large>",
+		},
+		{
+			err:  fmt.Errorf("Unsupported grpc-encoding br"),
+			want: "<undecodable>",
+		},
+	}
+
+	for i, test := range tests {
+		if ret := dumpMessage(test.payload, test.err, func(payload []byte) string { return protobuf.Dump(payload, 0) }); ret != test.want {
+			t.Errorf("dumpMessage (testcase %d): returns '%s' while it should be '%s'", i, ret, test.want)
+		}
+	}
+}
+
+func Test_reflectionAuthority(t *testing.T) {
+	tests := []struct {
+		authority string
+		serverip  string
+		servertcp uint16
+		want      string
+	}{
+		{
+			authority: "localhost:8000",
+			serverip:  "::1",
+			servertcp: 8000,
+			want:      "localhost:8000",
+		},
+		{
+			authority: "greeter.default.svc",
+			serverip:  "10.0.0.1",
+			servertcp: 8000,
+			want:      "greeter.default.svc:8000",
+		},
+		{
+			authority: "",
+			serverip:  "::1",
+			servertcp: 8000,
+			want:      "[::1]:8000",
+		},
+	}
+
+	for i, test := range tests {
+		if ret := reflectionAuthority(test.authority, test.serverip, test.servertcp); ret != test.want {
+			t.Errorf("reflectionAuthority (testcase %d): returns '%s' while it should be '%s'", i, ret, test.want)
+		}
+	}
+}
+
+func Test_handlePacketColumns(t *testing.T) {
+	request := []byte{
+		0x00, 0x00, 0x5e, 0x01, 0x04, 0x00, 0x00, 0x00,
+		0x01, 0x83, 0x86, 0x45, 0x95, 0x62, 0x72, 0xd1,
+		0x41, 0xfc, 0x1e, 0xca, 0x24, 0x5f, 0x15, 0x85,
+		0x2a, 0x4b, 0x63, 0x1b, 0x87, 0xeb, 0x19, 0x68,
+		0xa0, 0xff, 0x41, 0x8a, 0xa0, 0xe4, 0x1d, 0x13,
+		0x9d, 0x09, 0xb8, 0xf0, 0x00, 0x0f, 0x5f, 0x8b,
+		0x1d, 0x75, 0xd0, 0x62, 0x0d, 0x26, 0x3d, 0x4c,
+		0x4d, 0x65, 0x64, 0x7a, 0x8d, 0x9a, 0xca, 0xc8,
+		0xb4, 0xc7, 0x60, 0x2b, 0x89, 0xe5, 0xc0, 0xb4,
+		0x85, 0xef, 0x40, 0x02, 0x74, 0x65, 0x86, 0x4d,
+		0x83, 0x35, 0x05, 0xb1, 0x1f, 0x40, 0x89, 0x9a,
+		0xca, 0xc8, 0xb2, 0x4d, 0x49, 0x4f, 0x6a, 0x7f,
+		0x86, 0x7d, 0xf7, 0xdf, 0x71, 0xeb, 0x7f, 0x00,
+		0x00, 0x0c, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01,
+		0x00, 0x00, 0x00, 0x00, 0x07, 0x0a, 0x05, 0x41,
+		0x62, 0x72, 0x61, 0x6d,
+	}
+	response := []byte{
+		0x00, 0x00, 0x0e, 0x01, 0x04, 0x00, 0x00, 0x00,
+		0x01, 0x88, 0x5f, 0x8b, 0x1d, 0x75, 0xd0, 0x62,
+		0x0d, 0x26, 0x3d, 0x4c, 0x4d, 0x65, 0x64, 0x00,
+		0x00, 0x12, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
+		0x00, 0x00, 0x00, 0x00, 0x0d, 0x0a, 0x0b, 0x48,
+		0x65, 0x6c, 0x6c, 0x6f, 0x20, 0x41, 0x62, 0x72,
+		0x61, 0x6d, 0x00, 0x00, 0x18, 0x01, 0x05, 0x00,
+		0x00, 0x00, 0x01, 0x40, 0x88, 0x9a, 0xca, 0xc8,
+		0xb2, 0x12, 0x34, 0xda, 0x8f, 0x01, 0x30, 0x40,
+		0x89, 0x9a, 0xca, 0xc8, 0xb5, 0x25, 0x42, 0x07,
+		0x31, 0x7f, 0x00,
+	}
+	tests := []struct {
+		patterns                                 string
+		headers, requestheaders, responseheaders string
+		retransmit                               bool
+		// splits are the offsets where the response is split in packets,
+		// sent delays after the request.
+		splits []int
+		delays []time.Duration
+		want   string
+	}{
+		{
+			patterns: "",
+			want:     "helloworld.Greeter,SayHello,::1,58109,::1,8000,0,deadline=999.968ms,phase_upload=0s,phase_server=10ms,phase_first_message=0s,phase_trailers=0s,request_messages=1,request_bytes=7,request_uncompressed_bytes=7,response_messages=1,response_bytes=13,response_uncompressed_bytes=13",
+		},
+		{
+			patterns: "datetime.Datetime/*",
+			want:     "helloworld.Greeter,SayHello,::1,58109,::1,8000,0,deadline=999.968ms,phase_upload=0s,phase_server=10ms,phase_first_message=0s,phase_trailers=0s,request_messages=1,request_bytes=7,request_uncompressed_bytes=7,response_messages=1,response_bytes=13,response_uncompressed_bytes=13",
+		},
+		{
+			patterns: "helloworld.Greeter/*",
+			want:     `helloworld.Greeter,SayHello,::1,58109,::1,8000,0,deadline=999.968ms,phase_upload=0s,phase_server=10ms,phase_first_message=0s,phase_trailers=0s,request_messages=1,request_bytes=7,request_uncompressed_bytes=7,response_messages=1,response_bytes=13,response_uncompressed_bytes=13,"request_payload={1:""Abram""}","response_payload={1:""Hello Abram""}"`,
+		},
+		{
+			requestheaders:  ":authority,user-*",
+			responseheaders: "grpc-*",
+			want:            "helloworld.Greeter,SayHello,::1,58109,::1,8000,0,deadline=999.968ms,phase_upload=0s,phase_server=10ms,phase_first_message=0s,phase_trailers=0s,request_messages=1,request_bytes=7,request_uncompressed_bytes=7,response_messages=1,response_bytes=13,response_uncompressed_bytes=13,request_header.:authority=localhost:8000,request_header.user-agent=grpc-go/1.28.0-dev,response_header.grpc-message=,response_header.grpc-status=0",
+		},
+		{
+			// -capture-headers applies to both directions.
+			headers: "user-agent,grpc-status",
+			want:    "helloworld.Greeter,SayHello,::1,58109,::1,8000,0,deadline=999.968ms,phase_upload=0s,phase_server=10ms,phase_first_message=0s,phase_trailers=0s,request_messages=1,request_bytes=7,request_uncompressed_bytes=7,response_messages=1,response_bytes=13,response_uncompressed_bytes=13,request_header.user-agent=grpc-go/1.28.0-dev,response_header.grpc-status=0",
+		},
+		{
+			// Retransmitted segments are ignored and counted.
+			retransmit: true,
+			want:       "helloworld.Greeter,SayHello,::1,58109,::1,8000,0,deadline=999.968ms,phase_upload=0s,phase_server=10ms,phase_first_message=0s,phase_trailers=0s,duplicate_segments=1,request_messages=1,request_bytes=7,request_uncompressed_bytes=7,response_messages=1,response_bytes=13,response_uncompressed_bytes=13",
+		},
+		{
+			// The DATA and trailers come in a packet after the response
+			// HEADERS.
+			splits: []int{23},
+			delays: []time.Duration{4 * time.Millisecond, 10 * time.Millisecond},
+			want:   "helloworld.Greeter,SayHello,::1,58109,::1,8000,0,deadline=999.968ms,phase_upload=0s,phase_server=4ms,phase_first_message=6ms,phase_trailers=0s,request_messages=1,request_bytes=7,request_uncompressed_bytes=7,response_messages=1,response_bytes=13,response_uncompressed_bytes=13",
+		},
+		{
+			// The call is logged at its trailers, with the messages and
+			// trailers which came after its response HEADERS.
+			responseheaders: "grpc-*",
+			splits:          []int{23, 50},
+			delays:          []time.Duration{4 * time.Millisecond, 6 * time.Millisecond, 10 * time.Millisecond},
+			want:            "helloworld.Greeter,SayHello,::1,58109,::1,8000,0,deadline=999.968ms,phase_upload=0s,phase_server=4ms,phase_first_message=2ms,phase_trailers=4ms,request_messages=1,request_bytes=7,request_uncompressed_bytes=7,response_messages=1,response_bytes=13,response_uncompressed_bytes=13,response_header.grpc-message=,response_header.grpc-status=0",
+		},
+	}
+
+	defer func(patterns, requestheaders, responseheaders []string) {
+		dumppatterns, requestheaderpatterns, responseheaderpatterns = patterns, requestheaders, responseheaders
+	}(dumppatterns, requestheaderpatterns, responseheaderpatterns)
+	cidr := &net.IPNet{IP: net.ParseIP("::"), Mask: net.CIDRMask(0, 128)}
+	for i, test := range tests {
+		dumppatterns = utils.SplitList(test.patterns)
+		requestheaderpatterns = headerPatterns(test.headers, test.requestheaders)
+		responseheaderpatterns = headerPatterns(test.headers, test.responseheaders)
+		f, err := ioutil.TempFile("", "Test_handlePacketColumns*.log")
+		if err != nil {
+			t.Errorf("handlePacket (testcase %d): %v", i, err)
+		}
+		defer f.Close()
+		defer os.Remove(f.Name())
+		elm := logging.NewEventLogManager(time.Second, nil, 0, 0, 0, nil, []logging.Sink{logging.NewWriterSink(f, nil)}, cidr)
+		// The connection state would otherwise hold the trailers of the
+		// previous testcase, and the segment filter its sequence numbers.
+		http2.State.Delete("::1", 58109, "::1", 8000)
+		http2.State.Delete("::1", 8000, "::1", 58109)
+		http2.Segments.Delete("::1", 58109, "::1", 8000)
+		http2.Segments.Delete("::1", 8000, "::1", 58109)
+
+		h2 := http2.HTTP2{}
+		h2.DecodeFromBytes(request, nil)
+		requestpacket := http2.InterceptedPacket{SrcIP: net.IPv6loopback, DstIP: net.IPv6loopback, SrcTCP: 58109, DstTCP: 8000, HTTP2: h2, Length: len(request)}
+		h2 = http2.HTTP2{}
+		h2.DecodeFromBytes(response, nil)
+		responsepacket := http2.InterceptedPacket{SrcIP: net.IPv6loopback, DstIP: net.IPv6loopback, SrcTCP: 8000, DstTCP: 58109, HTTP2: h2, Length: len(response)}
+		requestpacket.Timestamp = time.Now()
+		responsepacket.Timestamp = requestpacket.Timestamp.Add(10 * time.Millisecond)
+
+		handlePacket(elm, requestpacket)
+		if test.retransmit {
+			handlePacket(elm, requestpacket)
+		}
+		var ret string
+		if len(test.splits) > 0 {
+			parts, start := [][]byte{}, 0
+			for _, end := range test.splits {
+				parts, start = append(parts, response[start:end]), end
+			}
+			parts = append(parts, response[start:])
+			for j, part := range parts {
+				h2 = http2.HTTP2{}
+				h2.DecodeFromBytes(part, nil)
+				packet := responsepacket
+				packet.HTTP2, packet.Length = h2, len(part)
+				packet.Timestamp = requestpacket.Timestamp.Add(test.delays[j])
+				if line := handlePacket(elm, packet); j == len(parts)-1 {
+					ret = line
+				} else if line != "" {
+					t.Errorf("handlePacket (testcase %d): returns '%s' before the trailers", i, line)
+				}
+			}
+		} else {
+			ret = handlePacket(elm, responsepacket)
+		}
+		if test.retransmit {
+			if dup := handlePacket(elm, responsepacket); dup != "" {
+				t.Errorf("handlePacket (testcase %d): returns '%s' for a retransmitted response", i, dup)
+			}
+		}
+
+		fields := strings.Split(strings.TrimSuffix(ret, "\n"), ",")
+		if len(fields) < 9 {
+			t.Errorf("handlePacket (testcase %d): returns incorrect log line '%s'", i, ret)
+			continue
+		}
+		// Skip the duration, info and deadline_used columns which depend on
+		// time, and the random connection_id.
+		columns := fields[:7]
+		for _, field := range fields[9:] {
+			if !strings.HasPrefix(field, "deadline_used=") && !strings.HasPrefix(field, "connection_id=") {
+				columns = append(columns, field)
+			}
+		}
+		ret = strings.Join(columns, ",")
+		if ret != test.want {
+			t.Errorf("handlePacket (testcase %d): returns incorrect log line", i)
+			t.Log(ret)
+			t.Log(test.want)
+		}
+	}
+}
+
+func Test_messageHash(t *testing.T) {
+	tests := []struct {
+		a, b []byte
+		want bool
+	}{
+		{a: []byte{0x0a, 0x05, 0x41, 0x62, 0x72, 0x61, 0x6d}, b: []byte{0x0a, 0x05, 0x41, 0x62, 0x72, 0x61, 0x6d}, want: true},
+		{a: []byte{0x0a, 0x05, 0x41, 0x62, 0x72, 0x61, 0x6d}, b: []byte{0x0a, 0x05, 0x41, 0x62, 0x72, 0x61, 0x6e}, want: false},
+		{a: []byte{}, b: []byte{0x00}, want: false},
+	}
+
+	for i, test := range tests {
+		if ret := messageHash(test.a) == messageHash(test.b); ret != test.want {
+			t.Errorf("messageHash (testcase %d): returns equal hashes '%t' while it should be '%t'", i, ret, test.want)
+		}
+	}
+}
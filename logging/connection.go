@@ -0,0 +1,286 @@
+package logging
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// connectionLog follows an HTTP/2 connection from its client to its server
+// and the streams carried by it.
+type connectionLog struct {
+	id        uuid.UUID
+	topen     time.Time
+	clientip  string
+	clienttcp uint16
+	serverip  string
+	servertcp uint16
+	// opened is set once the connection is known to carry HTTP/2, from its
+	// client preface, its SETTINGS or a request, when its opening is printed.
+	opened bool
+
+	streams     map[uint32]bool
+	rpcs        int
+	peakstreams int
+	// goaway is the error code of the GOAWAY frame received, if any.
+	goaway string
+
+	// clientsettings and serversettings are the SETTINGS sent by each end.
+	clientsettings, serversettings map[string]uint32
+	// pings holds when each PING waiting for its acknowledgement was sent.
+	pings                  map[pingKey]time.Time
+	npings                 int
+	pingrttmin, pingrttmax time.Duration
+	// tsaturated is set while the streams opened reach the
+	// MAX_CONCURRENT_STREAMS of the server.
+	tsaturated    time.Time
+	saturations   int
+	saturatedtime time.Duration
+	// clientflow and serverflow are the flow-control windows granted to each
+	// end, only followed when the connection was seen from its start.
+	clientflow, serverflow *flowControl
+	// tsyn and tsynack are set when the handshake of the connection is seen.
+	tsyn, tsynack time.Time
+	tcp           tcpStats
+}
+
+type pingKey struct {
+	data       uint64
+	fromclient bool
+}
+
+func newConnectionLog(timestamp time.Time, clientip string, clienttcp uint16, serverip string, servertcp uint16) *connectionLog {
+	return &connectionLog{
+		id:        uuid.New(),
+		topen:     timestamp,
+		clientip:  clientip,
+		clienttcp: clienttcp,
+		serverip:  serverip,
+		servertcp: servertcp,
+		streams:   map[uint32]bool{},
+
+		clientsettings: map[string]uint32{},
+		serversettings: map[string]uint32{},
+		pings:          map[pingKey]time.Time{},
+	}
+}
+
+// isMatchingConnection reports whether a packet from ipsource:tcpsource to
+// ipdest:tcpdest, in any direction, belongs to the connection.
+func (c *connectionLog) isMatchingConnection(ipsource string, tcpsource uint16, ipdest string, tcpdest uint16) bool {
+	return c.isFromClient(ipsource, tcpsource, ipdest, tcpdest) || c.isFromClient(ipdest, tcpdest, ipsource, tcpsource)
+}
+
+func (c *connectionLog) isFromClient(ipsource string, tcpsource uint16, ipdest string, tcpdest uint16) bool {
+	return c.clientip == ipsource && c.clienttcp == tcpsource && c.serverip == ipdest && c.servertcp == tcpdest
+}
+
+// startStream counts streamid as open, and reports whether it saturates the
+// connection, which makes the client queue its next RPCs.
+func (c *connectionLog) startStream(timestamp time.Time, streamid uint32) bool {
+	if c.streams[streamid] {
+		return false
+	}
+	c.streams[streamid] = true
+	c.rpcs++
+	if len(c.streams) > c.peakstreams {
+		c.peakstreams = len(c.streams)
+	}
+	max, ok := c.serversettings["MAX_CONCURRENT_STREAMS"]
+	if !ok || !c.tsaturated.IsZero() || len(c.streams) < int(max) {
+		return false
+	}
+	c.tsaturated = timestamp
+	c.saturations++
+	return true
+}
+
+func (c *connectionLog) endStream(timestamp time.Time, streamid uint32) {
+	delete(c.streams, streamid)
+	max := c.serversettings["MAX_CONCURRENT_STREAMS"]
+	if !c.tsaturated.IsZero() && len(c.streams) < int(max) {
+		c.saturatedtime += timestamp.Sub(c.tsaturated)
+		c.tsaturated = time.Time{}
+	}
+}
+
+// insertSettings records the SETTINGS sent by one end, and returns the
+// streams of the other end its INITIAL_WINDOW_SIZE unblocks after a stall
+// longer than threshold.
+func (c *connectionLog) insertSettings(timestamp time.Time, fromclient bool, settings map[string]uint32, threshold time.Duration) []EventLog {
+	dest := c.serversettings
+	if fromclient {
+		dest = c.clientsettings
+	}
+	for name, value := range settings {
+		dest[name] = value
+	}
+	initial, ok := settings["INITIAL_WINDOW_SIZE"]
+	if flow := c.flow(!fromclient); ok && flow != nil {
+		return c.stallEventLogs(!fromclient, flow.setInitialWindow(timestamp, int(initial), threshold))
+	}
+	return []EventLog{}
+}
+
+// flow returns the flow-control windows granted to the client, or the
+// server, nil if they aren't followed.
+func (c *connectionLog) flow(client bool) *flowControl {
+	if client {
+		return c.clientflow
+	}
+	return c.serverflow
+}
+
+// insertData consumes the windows of the end sending the DATA frames of
+// sizes, by stream.
+func (c *connectionLog) insertData(timestamp time.Time, fromclient bool, sizes map[uint32]int) {
+	flow := c.flow(fromclient)
+	if flow == nil {
+		return
+	}
+	for streamid, size := range sizes {
+		flow.data(timestamp, streamid, size)
+	}
+}
+
+// insertWindowUpdate grows the windows of the other end, and returns the
+// streams it unblocks after a stall longer than threshold.
+func (c *connectionLog) insertWindowUpdate(timestamp time.Time, fromclient bool, increments map[uint32]int, threshold time.Duration) []EventLog {
+	flow := c.flow(!fromclient)
+	if flow == nil {
+		return []EventLog{}
+	}
+	stalls := []flowStall{}
+	// The connection window is updated first to unblock the streams once.
+	if increment, ok := increments[0]; ok {
+		stalls = append(stalls, flow.windowUpdate(timestamp, 0, increment, threshold)...)
+	}
+	for streamid, increment := range increments {
+		if streamid != 0 {
+			stalls = append(stalls, flow.windowUpdate(timestamp, streamid, increment, threshold)...)
+		}
+	}
+	sortStalls(stalls)
+	return c.stallEventLogs(!fromclient, stalls)
+}
+
+// stalls returns the streams blocked by flow control longer than threshold,
+// which weren't reported yet.
+func (c *connectionLog) stalls(currtime time.Time, threshold time.Duration) []EventLog {
+	events := []EventLog{}
+	if c.clientflow != nil {
+		events = append(events, c.stallEventLogs(true, c.clientflow.stalls(currtime, threshold))...)
+		events = append(events, c.stallEventLogs(false, c.serverflow.stalls(currtime, threshold))...)
+	}
+	return events
+}
+
+// flowBlocked forgets the flow control of streamid, and returns the time it
+// spent blocked in both directions.
+func (c *connectionLog) flowBlocked(timestamp time.Time, streamid uint32) time.Duration {
+	if c.clientflow == nil {
+		return 0
+	}
+	return c.clientflow.endStream(timestamp, streamid) + c.serverflow.endStream(timestamp, streamid)
+}
+
+// insertHandshake follows the SYN, SYN-ACK and ACK of the handshake to
+// measure its round trip time.
+func (c *connectionLog) insertHandshake(timestamp time.Time, fromclient bool, syn bool, ack bool) {
+	switch {
+	case syn && !ack && fromclient:
+		c.tsyn = timestamp
+	case syn && ack && !fromclient && !c.tsyn.IsZero():
+		c.tsynack = timestamp
+	case !syn && ack && fromclient && !c.tsynack.IsZero() && c.tcp.handshakertt == 0:
+		c.tcp.handshakertt = timestamp.Sub(c.tsyn)
+	}
+}
+
+func (c *connectionLog) insertPing(timestamp time.Time, fromclient bool, data uint64) {
+	c.pings[pingKey{data, fromclient}] = timestamp
+}
+
+// stallEventLogs returns the events logged for stalls of the streams of the
+// client, or the server.
+func (c *connectionLog) stallEventLogs(client bool, stalls []flowStall) []EventLog {
+	events := []EventLog{}
+	for _, stall := range stalls {
+		event := c.eventLog(time.Time{}, "")
+		event.duration = stall.blocked
+		event.info = "FLOW_CONTROL_STALL"
+		event.streamid = stall.streamid
+		event.blockedsender = "server"
+		if client {
+			event.blockedsender = "client"
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// ackPing measures the round trip time of the PING acknowledged by the other
+// end with data.
+func (c *connectionLog) ackPing(timestamp time.Time, fromclient bool, data uint64) {
+	key := pingKey{data, !fromclient}
+	tsent, ok := c.pings[key]
+	if !ok {
+		return
+	}
+	delete(c.pings, key)
+	rtt := timestamp.Sub(tsent)
+	if c.npings == 0 || rtt < c.pingrttmin {
+		c.pingrttmin = rtt
+	}
+	if rtt > c.pingrttmax {
+		c.pingrttmax = rtt
+	}
+	c.npings++
+}
+
+// saturationEventLog returns the event logged when the connection reaches the
+// MAX_CONCURRENT_STREAMS of the server.
+func (c *connectionLog) saturationEventLog(timestamp time.Time) EventLog {
+	event := c.eventLog(timestamp, "")
+	event.tstart = timestamp
+	event.info = "STREAMS_SATURATED"
+	event.maxstreams = int(c.serversettings["MAX_CONCURRENT_STREAMS"])
+	return event
+}
+
+// eventLog returns the event logged when the connection opens, or closes
+// when reason is set.
+func (c *connectionLog) eventLog(timestamp time.Time, reason string) EventLog {
+	event := EventLog{
+		id:           c.id,
+		tstart:       c.topen,
+		servicename:  "NULL",
+		methodname:   "NULL",
+		ipsource:     c.clientip,
+		tcpsource:    c.clienttcp,
+		ipdest:       c.serverip,
+		tcpdest:      c.servertcp,
+		info:         "CONNECTION_OPEN",
+		connectionid: c.id,
+	}
+	if reason != "" {
+		event.tfinish = timestamp
+		event.duration = timestamp.Sub(c.topen)
+		event.info = "CONNECTION_CLOSE"
+		event.rpcs = c.rpcs
+		event.peakstreams = c.peakstreams
+		event.closereason = reason
+		event.clientsettings = c.clientsettings
+		event.serversettings = c.serversettings
+		event.pings = c.npings
+		event.pingrttmin = c.pingrttmin
+		event.pingrttmax = c.pingrttmax
+		event.tcp = c.tcp
+		event.saturations = c.saturations
+		event.saturatedtime = c.saturatedtime
+		if !c.tsaturated.IsZero() {
+			event.saturatedtime += timestamp.Sub(c.tsaturated)
+		}
+	}
+	return event
+}
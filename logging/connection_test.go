@@ -0,0 +1,144 @@
+package logging
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func Test_isMatchingConnection(t *testing.T) {
+	conn := newConnectionLog(time.Now(), "::1", 58108, "::1", 8000)
+	tests := []struct {
+		ipsource  string
+		tcpsource uint16
+		ipdest    string
+		tcpdest   uint16
+		want      bool
+	}{
+		{ipsource: "::1", tcpsource: 58108, ipdest: "::1", tcpdest: 8000, want: true},
+		{ipsource: "::1", tcpsource: 8000, ipdest: "::1", tcpdest: 58108, want: true},
+		{ipsource: "::1", tcpsource: 58109, ipdest: "::1", tcpdest: 8000, want: false},
+		{ipsource: "::2", tcpsource: 58108, ipdest: "::1", tcpdest: 8000, want: false},
+	}
+
+	for i, test := range tests {
+		if ret := conn.isMatchingConnection(test.ipsource, test.tcpsource, test.ipdest, test.tcpdest); ret != test.want {
+			t.Errorf("isMatchingConnection (testcase %d): returns %t while it should be %t", i, ret, test.want)
+		}
+	}
+}
+
+func Test_startStream(t *testing.T) {
+	currtime := time.Now()
+	conn := newConnectionLog(currtime, "::1", 58108, "::1", 8000)
+	conn.insertSettings(currtime, false, map[string]uint32{"MAX_CONCURRENT_STREAMS": 2}, 0)
+	tests := []struct {
+		streamid  uint32
+		end       bool
+		saturates bool
+	}{
+		{streamid: 1, saturates: false},
+		{streamid: 3, saturates: true},
+		{streamid: 3, saturates: false},
+		{streamid: 1, end: true},
+		{streamid: 5, saturates: true},
+		{streamid: 3, end: true},
+		{streamid: 5, end: true},
+	}
+
+	for i, test := range tests {
+		timestamp := currtime.Add(time.Duration(i) * time.Second)
+		if test.end {
+			conn.endStream(timestamp, test.streamid)
+		} else if ret := conn.startStream(timestamp, test.streamid); ret != test.saturates {
+			t.Errorf("startStream (testcase %d): returns %t while it should be %t", i, ret, test.saturates)
+		}
+	}
+	if conn.rpcs != 3 || conn.peakstreams != 2 || len(conn.streams) != 0 {
+		t.Errorf("startStream: counts %d rpcs, %d peak streams and %d open streams while it should be 3, 2 and 0", conn.rpcs, conn.peakstreams, len(conn.streams))
+	}
+	if conn.saturations != 2 || conn.saturatedtime != 3*time.Second {
+		t.Errorf("startStream: counts %d saturations for %v while it should be 2 for 3s", conn.saturations, conn.saturatedtime)
+	}
+}
+
+func Test_ackPing(t *testing.T) {
+	currtime := time.Now()
+	conn := newConnectionLog(currtime, "::1", 58108, "::1", 8000)
+	conn.insertPing(currtime, true, 1)
+	conn.insertPing(currtime, false, 2)
+	// Acknowledgements sent by the end which sent the PING are ignored.
+	conn.ackPing(currtime.Add(time.Millisecond), true, 1)
+	conn.ackPing(currtime.Add(3*time.Millisecond), false, 1)
+	conn.ackPing(currtime.Add(5*time.Millisecond), true, 2)
+	conn.ackPing(currtime.Add(7*time.Millisecond), true, 2)
+	if conn.npings != 2 || conn.pingrttmin != 3*time.Millisecond || conn.pingrttmax != 5*time.Millisecond {
+		t.Errorf("ackPing: measures %d pings from %v to %v while it should be 2 from 3ms to 5ms", conn.npings, conn.pingrttmin, conn.pingrttmax)
+	}
+	if len(conn.pings) != 0 {
+		t.Errorf("ackPing: doesn't forget the acknowledged pings")
+	}
+}
+
+func Test_connectionEventLog(t *testing.T) {
+	currtime := time.Now()
+	id := uuid.MustParse("d96763c9-a9a4-49d0-9008-b63befa85b6d")
+	conn := &connectionLog{id: id, topen: currtime, clientip: "::1", clienttcp: 58108, serverip: "::1", servertcp: 8000, rpcs: 4, peakstreams: 2}
+	saturated := &connectionLog{
+		id:             id,
+		topen:          currtime,
+		clientip:       "::1",
+		clienttcp:      58108,
+		serverip:       "::1",
+		servertcp:      8000,
+		rpcs:           4,
+		peakstreams:    2,
+		clientsettings: map[string]uint32{"INITIAL_WINDOW_SIZE": 65535, "ENABLE_PUSH": 0},
+		serversettings: map[string]uint32{"MAX_CONCURRENT_STREAMS": 2, "MAX_FRAME_SIZE": 16384},
+		npings:         2,
+		pingrttmin:     time.Millisecond,
+		pingrttmax:     3 * time.Millisecond,
+		tsaturated:     currtime.Add(time.Second),
+		saturations:    2,
+		saturatedtime:  200 * time.Millisecond,
+	}
+	tests := []struct {
+		conn   *connectionLog
+		reason string
+		want   string
+	}{
+		{
+			conn:   conn,
+			reason: "",
+			want:   "NULL,NULL,::1,58108,::1,8000,-1,0,CONNECTION_OPEN,connection_id=d96763c9-a9a4-49d0-9008-b63befa85b6d\n",
+		},
+		{
+			conn:   conn,
+			reason: "FIN",
+			want:   "NULL,NULL,::1,58108,::1,8000,-1,1500000000,CONNECTION_CLOSE,connection_id=d96763c9-a9a4-49d0-9008-b63befa85b6d,rpcs=4,peak_streams=2,close_reason=FIN\n",
+		},
+		{
+			conn:   saturated,
+			reason: "RST",
+			want: "NULL,NULL,::1,58108,::1,8000,-1,1500000000,CONNECTION_CLOSE,connection_id=d96763c9-a9a4-49d0-9008-b63befa85b6d,rpcs=4,peak_streams=2,close_reason=RST," +
+				"server_max_concurrent_streams=2,server_max_frame_size=16384,client_initial_window_size=65535,pings=2,ping_rtt_min=1ms,ping_rtt_max=3ms,saturations=2,saturated_time=700ms\n",
+		},
+	}
+
+	for i, test := range tests {
+		if ret := logString(test.conn.eventLog(currtime.Add(1500*time.Millisecond), test.reason)); ret != test.want {
+			t.Errorf("eventLog (testcase %d): returns '%s' while it should be '%s'", i, ret, test.want)
+		}
+	}
+}
+
+func Test_saturationEventLog(t *testing.T) {
+	currtime := time.Now()
+	id := uuid.MustParse("d96763c9-a9a4-49d0-9008-b63befa85b6d")
+	conn := &connectionLog{id: id, topen: currtime, clientip: "::1", clienttcp: 58108, serverip: "::1", servertcp: 8000, serversettings: map[string]uint32{"MAX_CONCURRENT_STREAMS": 100}}
+	want := "NULL,NULL,::1,58108,::1,8000,-1,0,STREAMS_SATURATED,connection_id=d96763c9-a9a4-49d0-9008-b63befa85b6d,max_concurrent_streams=100\n"
+	if ret := logString(conn.saturationEventLog(currtime.Add(time.Second))); ret != want {
+		t.Errorf("saturationEventLog: returns '%s' while it should be '%s'", ret, want)
+	}
+}
@@ -1,23 +1,78 @@
 package logging
 
 import (
-	"github.com/google/uuid"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/abrampers/inkle/tracing"
+	"github.com/google/uuid"
 )
 
 type EventLog struct {
-	id             uuid.UUID
-	tstart         time.Time
-	tfinish        time.Time
-	servicename    string
-	methodname     string
-	ipsource       string
-	tcpsource      uint16
-	ipdest         string
-	tcpdest        uint16
-	grpcstatuscode string
-	duration       time.Duration
-	info           string
+	id              uuid.UUID
+	tstart          time.Time
+	tfinish         time.Time
+	servicename     string
+	methodname      string
+	ipsource        string
+	tcpsource       uint16
+	ipdest          string
+	tcpdest         uint16
+	grpcstatuscode  string
+	duration        time.Duration
+	info            string
+	requestpayload  string
+	responsepayload string
+	requestheaders  []string
+	responseheaders []string
+	trace           tracing.SpanContext
+
+	// deadline is the client deadline sent in grpc-timeout, if hasdeadline.
+	// A zero deadline had already expired when the request was sent.
+	deadline         time.Duration
+	hasdeadline      bool
+	deadlineexceeded bool
+
+	// isexpired is set on expired events remembered for a late response,
+	// which links back to them with timeouteventid.
+	isexpired      bool
+	timeouteventid uuid.UUID
+
+	// callid groups the attempts of a retried or hedged call, attempt
+	// numbering them from 1. attempts is only set on the event of the call.
+	callid            uuid.UUID
+	attempt, attempts int
+	requesthash       string
+
+	// connectionid is set on the events of a followed connection, the other
+	// fields only on its closing event.
+	connectionid      uuid.UUID
+	rpcs, peakstreams int
+	closereason       string
+	// maxstreams is only set on the event of a saturated connection.
+	clientsettings, serversettings map[string]uint32
+	pings                          int
+	pingrttmin, pingrttmax         time.Duration
+	saturations, maxstreams        int
+	saturatedtime                  time.Duration
+	// streamid is the stream of an RPC, or the stalled stream on the event of
+	// a flow-control stall, which blockedsender is only set on. flowblocked
+	// is set on the events of the RPCs blocked by flow control.
+	streamid      uint32
+	blockedsender string
+	flowblocked   time.Duration
+
+	// trequestend, tresponse, tfirstmessage, tlastmessage and ttrailers split
+	// the call in phases: the request END_STREAM, the response HEADERS, the
+	// first and last response messages and the trailers. The event is
+	// printed at the server END_STREAM or RST_STREAM of its stream.
+	trequestend, tresponse, tfirstmessage, tlastmessage, ttrailers time.Time
+
+	requestmessages, responsemessages                   int
+	requestbytes, responsebytes                         int
+	requestuncompressedbytes, responseuncompressedbytes int
+	tcp                                                 tcpStats
 }
 
 func NewEventLog(timestamp time.Time, servicename string, methodname string, ipsource string, tcpsource uint16, ipdest string, tcpdest uint16, info string) *EventLog {
@@ -38,12 +93,244 @@ func NewEventLog(timestamp time.Time, servicename string, methodname string, ips
 func (e *EventLog) insertResponse(timestamp time.Time, grpcstatuscode string, responseinfo string) {
 	e.tfinish = timestamp
 	e.grpcstatuscode = grpcstatuscode
-	if !e.tstart.IsZero() {
+	// The duration runs to the response HEADERS, the call to its END_STREAM.
+	if !e.tstart.IsZero() && !e.tresponse.IsZero() {
+		e.duration = e.tresponse.Sub(e.tstart)
+	} else if !e.tstart.IsZero() {
 		e.duration = e.tfinish.Sub(e.tstart)
 	}
 	e.info += responseinfo
 }
 
+func (e *EventLog) insertRequestEnd(timestamp time.Time) {
+	if e.trequestend.IsZero() {
+		e.trequestend = timestamp
+	}
+}
+
+func (e *EventLog) startResponse(timestamp time.Time) {
+	if e.tresponse.IsZero() {
+		e.tresponse = timestamp
+		// The client has already given up on responses past its deadline.
+		e.deadlineexceeded = e.hasdeadline && timestamp.After(e.tstart.Add(e.deadline))
+	}
+}
+
+func (e *EventLog) insertTrailers(timestamp time.Time, grpcstatuscode string) {
+	if e.ttrailers.IsZero() {
+		e.ttrailers = timestamp
+	}
+	e.grpcstatuscode = grpcstatuscode
+}
+
+// phaseColumns returns the durations of the phases of the call known.
+func (e *EventLog) phaseColumns() []string {
+	columns := []string{}
+	if !e.trequestend.IsZero() {
+		columns = append(columns, "phase_upload="+e.trequestend.Sub(e.tstart).String())
+		if !e.tresponse.IsZero() {
+			columns = append(columns, "phase_server="+e.tresponse.Sub(e.trequestend).String())
+		}
+	}
+	if !e.tresponse.IsZero() && !e.tfirstmessage.IsZero() {
+		columns = append(columns, "phase_first_message="+e.tfirstmessage.Sub(e.tresponse).String())
+	}
+	if !e.tlastmessage.IsZero() && !e.ttrailers.IsZero() {
+		columns = append(columns, "phase_trailers="+e.ttrailers.Sub(e.tlastmessage).String())
+	}
+	return columns
+}
+
+// lateResponse returns a new event for the response of the expired event e,
+// linked to it.
+func (e *EventLog) lateResponse() *EventLog {
+	late := *e
+	late.id = uuid.New()
+	late.info = "Request"
+	late.isexpired = false
+	late.timeouteventid = e.id
+	return &late
+}
+
+func (e *EventLog) insertRequestPayload(payload string) {
+	e.requestpayload = joinPayload(e.requestpayload, payload)
+}
+
+func (e *EventLog) insertResponsePayload(payload string) {
+	e.responsepayload = joinPayload(e.responsepayload, payload)
+}
+
+// insertRequestMessage counts a request message of size bytes on the wire.
+// uncompressedsize is negative when the message couldn't be decompressed.
+func (e *EventLog) insertRequestMessage(size int, uncompressedsize int) {
+	e.requestmessages++
+	e.requestbytes += size
+	if uncompressedsize >= 0 {
+		e.requestuncompressedbytes += uncompressedsize
+	}
+}
+
+func (e *EventLog) insertResponseMessage(timestamp time.Time, size int, uncompressedsize int) {
+	if e.tfirstmessage.IsZero() {
+		e.tfirstmessage = timestamp
+	}
+	e.tlastmessage = timestamp
+	e.responsemessages++
+	e.responsebytes += size
+	if uncompressedsize >= 0 {
+		e.responseuncompressedbytes += uncompressedsize
+	}
+}
+
+func (e *EventLog) insertRequestHeaders(headers []string) {
+	e.requestheaders = append(e.requestheaders, headers...)
+}
+
+func (e *EventLog) insertResponseHeaders(headers []string) {
+	e.responseheaders = append(e.responseheaders, headers...)
+}
+
+func (e *EventLog) insertDeadline(deadline time.Duration) {
+	e.deadline = deadline
+	e.hasdeadline = true
+}
+
+// expiry returns how long the event waits for a response before timing out.
+func (e *EventLog) expiry(timeout time.Duration) time.Duration {
+	if e.hasdeadline {
+		return e.deadline
+	}
+	return timeout
+}
+
+func (e *EventLog) insertTraceContext(trace tracing.SpanContext) {
+	e.trace = trace
+}
+
+func joinPayload(a, b string) string {
+	if a == "" {
+		return b
+	}
+	return a + " " + b
+}
+
+// loggedSettings are the SETTINGS parameters logged for each end of a
+// connection.
+var loggedSettings = []string{"MAX_CONCURRENT_STREAMS", "INITIAL_WINDOW_SIZE", "HEADER_TABLE_SIZE", "MAX_FRAME_SIZE"}
+
+func settingsColumns(prefix string, settings map[string]uint32) []string {
+	columns := []string{}
+	for _, name := range loggedSettings {
+		if value, ok := settings[name]; ok {
+			columns = append(columns, prefix+strings.ToLower(name)+"="+strconv.FormatUint(uint64(value), 10))
+		}
+	}
+	return columns
+}
+
+// extraColumns returns the optional columns of the event as key=value pairs.
+// They're appended after the info column and only when they're set.
+func (e *EventLog) extraColumns() []string {
+	columns := []string{}
+	if e.isexpired {
+		columns = append(columns, "event_id="+e.id.String())
+	}
+	if e.timeouteventid != uuid.Nil {
+		columns = append(columns, "timeout_event_id="+e.timeouteventid.String())
+	}
+	if e.connectionid != uuid.Nil {
+		columns = append(columns, "connection_id="+e.connectionid.String())
+	}
+	if e.closereason != "" {
+		columns = append(columns,
+			"rpcs="+strconv.Itoa(e.rpcs),
+			"peak_streams="+strconv.Itoa(e.peakstreams),
+			"close_reason="+e.closereason)
+		columns = append(columns, settingsColumns("server_", e.serversettings)...)
+		columns = append(columns, settingsColumns("client_", e.clientsettings)...)
+		if e.pings > 0 {
+			columns = append(columns,
+				"pings="+strconv.Itoa(e.pings),
+				"ping_rtt_min="+e.pingrttmin.String(),
+				"ping_rtt_max="+e.pingrttmax.String())
+		}
+		if e.saturations > 0 {
+			columns = append(columns,
+				"saturations="+strconv.Itoa(e.saturations),
+				"saturated_time="+e.saturatedtime.String())
+		}
+	}
+	if e.maxstreams > 0 {
+		columns = append(columns, "max_concurrent_streams="+strconv.Itoa(e.maxstreams))
+	}
+	if e.blockedsender != "" {
+		columns = append(columns, "stream_id="+strconv.FormatUint(uint64(e.streamid), 10), "blocked_sender="+e.blockedsender)
+	}
+	if e.flowblocked > 0 {
+		columns = append(columns, "flow_control_blocked="+e.flowblocked.String())
+	}
+	if e.callid != uuid.Nil {
+		columns = append(columns, "call_id="+e.callid.String())
+	}
+	if e.attempt > 0 {
+		columns = append(columns, "attempt="+strconv.Itoa(e.attempt))
+	}
+	if e.attempts > 0 {
+		columns = append(columns, "attempts="+strconv.Itoa(e.attempts))
+	}
+	if e.trace.TraceID != "" {
+		columns = append(columns, "trace_id="+e.trace.TraceID, "span_id="+e.trace.SpanID)
+		if e.trace.ParentSpanID != "" {
+			columns = append(columns, "parent_span_id="+e.trace.ParentSpanID)
+		}
+		if e.trace.Sampled != tracing.SampledUnknown {
+			columns = append(columns, "trace_sampled="+e.trace.Sampled)
+		}
+		if e.trace.TraceState != "" {
+			columns = append(columns, "trace_state="+e.trace.TraceState)
+		}
+	}
+	if e.hasdeadline {
+		columns = append(columns, "deadline="+e.deadline.String())
+		if !e.tfinish.IsZero() && e.deadline > 0 {
+			used := float64(e.duration) / float64(e.deadline) * 100
+			columns = append(columns, "deadline_used="+strconv.FormatFloat(used, 'f', 1, 64)+"%")
+		}
+		if e.deadlineexceeded {
+			columns = append(columns, "deadline_exceeded=1")
+		}
+	}
+	if !e.tfinish.IsZero() {
+		columns = append(columns, e.phaseColumns()...)
+	}
+	columns = append(columns, e.tcp.columns()...)
+	if e.requestmessages > 0 {
+		columns = append(columns,
+			"request_messages="+strconv.Itoa(e.requestmessages),
+			"request_bytes="+strconv.Itoa(e.requestbytes),
+			"request_uncompressed_bytes="+strconv.Itoa(e.requestuncompressedbytes))
+	}
+	if e.responsemessages > 0 {
+		columns = append(columns,
+			"response_messages="+strconv.Itoa(e.responsemessages),
+			"response_bytes="+strconv.Itoa(e.responsebytes),
+			"response_uncompressed_bytes="+strconv.Itoa(e.responseuncompressedbytes))
+	}
+	for _, header := range e.requestheaders {
+		columns = append(columns, "request_header."+header)
+	}
+	for _, header := range e.responseheaders {
+		columns = append(columns, "response_header."+header)
+	}
+	if e.requestpayload != "" {
+		columns = append(columns, "request_payload="+e.requestpayload)
+	}
+	if e.responsepayload != "" {
+		columns = append(columns, "response_payload="+e.responsepayload)
+	}
+	return columns
+}
+
 func (e *EventLog) isMatchingRequest(ipdest string, tcpdest uint16) bool {
 	return e.ipsource == ipdest && e.tcpsource == tcpdest
 }
@@ -1,8 +1,12 @@
 package logging
 
 import (
+	"reflect"
 	"testing"
 	"time"
+
+	"github.com/abrampers/inkle/tracing"
+	"github.com/google/uuid"
 )
 
 func isEventEqualValue(a, b EventLog) bool {
@@ -16,7 +20,48 @@ func isEventEqualValue(a, b EventLog) bool {
 		a.tcpdest != b.tcpdest ||
 		a.grpcstatuscode != b.grpcstatuscode ||
 		a.duration != b.duration ||
-		a.info != b.info {
+		a.info != b.info ||
+		a.requestpayload != b.requestpayload ||
+		a.responsepayload != b.responsepayload ||
+		!reflect.DeepEqual(a.requestheaders, b.requestheaders) ||
+		!reflect.DeepEqual(a.responseheaders, b.responseheaders) ||
+		a.requestmessages != b.requestmessages ||
+		a.responsemessages != b.responsemessages ||
+		a.requestbytes != b.requestbytes ||
+		a.responsebytes != b.responsebytes ||
+		a.requestuncompressedbytes != b.requestuncompressedbytes ||
+		a.responseuncompressedbytes != b.responseuncompressedbytes ||
+		a.trace != b.trace ||
+		a.deadline != b.deadline ||
+		a.hasdeadline != b.hasdeadline ||
+		a.deadlineexceeded != b.deadlineexceeded ||
+		a.isexpired != b.isexpired ||
+		a.timeouteventid != b.timeouteventid ||
+		a.tcp != b.tcp ||
+		a.callid != b.callid ||
+		a.attempt != b.attempt ||
+		a.attempts != b.attempts ||
+		a.requesthash != b.requesthash ||
+		a.connectionid != b.connectionid ||
+		a.rpcs != b.rpcs ||
+		a.peakstreams != b.peakstreams ||
+		a.closereason != b.closereason ||
+		!reflect.DeepEqual(a.clientsettings, b.clientsettings) ||
+		!reflect.DeepEqual(a.serversettings, b.serversettings) ||
+		a.pings != b.pings ||
+		a.pingrttmin != b.pingrttmin ||
+		a.pingrttmax != b.pingrttmax ||
+		a.saturations != b.saturations ||
+		a.maxstreams != b.maxstreams ||
+		a.saturatedtime != b.saturatedtime ||
+		a.streamid != b.streamid ||
+		a.blockedsender != b.blockedsender ||
+		a.flowblocked != b.flowblocked ||
+		a.trequestend != b.trequestend ||
+		a.tresponse != b.tresponse ||
+		a.tfirstmessage != b.tfirstmessage ||
+		a.tlastmessage != b.tlastmessage ||
+		a.ttrailers != b.ttrailers {
 		return false
 	}
 	return true
@@ -164,6 +209,36 @@ func Test_insertResponse(t *testing.T) {
 				info:           "Request - TIMEOUT",
 			},
 		},
+		{
+			endtimestamp:   etimestamp,
+			grpcstatuscode: "0",
+			responseinfo:   " - Response",
+			initialevent:   EventLog{tstart: stimestamp, deadline: time.Second, hasdeadline: true, info: "Request"},
+			finalevent: EventLog{
+				tstart:         stimestamp,
+				tfinish:        etimestamp,
+				grpcstatuscode: "0",
+				duration:       etimestamp.Sub(stimestamp),
+				info:           "Request - Response",
+				deadline:       time.Second,
+				hasdeadline:    true,
+			},
+		},
+		{
+			endtimestamp:   etimestamp,
+			grpcstatuscode: "0",
+			responseinfo:   " - Response",
+			initialevent:   EventLog{tstart: stimestamp, deadline: 100 * time.Millisecond, hasdeadline: true, info: "Request"},
+			finalevent: EventLog{
+				tstart:         stimestamp,
+				tfinish:        etimestamp,
+				grpcstatuscode: "0",
+				duration:       etimestamp.Sub(stimestamp),
+				info:           "Request - Response",
+				deadline:       100 * time.Millisecond,
+				hasdeadline:    true,
+			},
+		},
 	}
 
 	for i, test := range tests {
@@ -174,6 +249,292 @@ func Test_insertResponse(t *testing.T) {
 	}
 }
 
+func Test_startResponse(t *testing.T) {
+	stimestamp := time.Now()
+	tests := []struct {
+		event     EventLog
+		timestamp time.Time
+		want      bool
+	}{
+		{
+			event:     EventLog{tstart: stimestamp},
+			timestamp: stimestamp.Add(time.Second),
+			want:      false,
+		},
+		{
+			event:     EventLog{tstart: stimestamp, deadline: time.Second, hasdeadline: true},
+			timestamp: stimestamp.Add(500 * time.Millisecond),
+			want:      false,
+		},
+		{
+			event:     EventLog{tstart: stimestamp, deadline: 100 * time.Millisecond, hasdeadline: true},
+			timestamp: stimestamp.Add(150 * time.Millisecond),
+			want:      true,
+		},
+		{
+			event:     EventLog{tstart: stimestamp, hasdeadline: true},
+			timestamp: stimestamp.Add(time.Millisecond),
+			want:      true,
+		},
+		{
+			// Only the first response HEADERS count.
+			event:     EventLog{tstart: stimestamp, tresponse: stimestamp.Add(50 * time.Millisecond), deadline: 100 * time.Millisecond, hasdeadline: true},
+			timestamp: stimestamp.Add(150 * time.Millisecond),
+			want:      false,
+		},
+	}
+
+	for i, test := range tests {
+		test.event.startResponse(test.timestamp)
+		if test.event.deadlineexceeded != test.want {
+			t.Errorf("startResponse (testcase %d): sets deadline exceeded to %t while it should be %t", i, test.event.deadlineexceeded, test.want)
+		}
+	}
+}
+
+func Test_insertPayload(t *testing.T) {
+	tests := []struct {
+		requestpayloads, responsepayloads []string
+		want                              EventLog
+	}{
+		{
+			want: EventLog{},
+		},
+		{
+			requestpayloads: []string{`{1:"Abram"}`},
+			want:            EventLog{requestpayload: `{1:"Abram"}`},
+		},
+		{
+			requestpayloads:  []string{`{1:"Abram"}`, `{1:"Inkle"}`},
+			responsepayloads: []string{`{1:"Hello Abram"}`},
+			want:             EventLog{requestpayload: `{1:"Abram"} {1:"Inkle"}`, responsepayload: `{1:"Hello Abram"}`},
+		},
+	}
+
+	for i, test := range tests {
+		event := EventLog{}
+		for _, payload := range test.requestpayloads {
+			event.insertRequestPayload(payload)
+		}
+		for _, payload := range test.responsepayloads {
+			event.insertResponsePayload(payload)
+		}
+		if !isEventEqualValue(event, test.want) {
+			t.Errorf("insertPayload (testcase %d): doesn't modify event as expected", i)
+		}
+	}
+}
+
+func Test_insertHeaders(t *testing.T) {
+	tests := []struct {
+		requestheaders, responseheaders [][]string
+		want                            EventLog
+	}{
+		{
+			want: EventLog{},
+		},
+		{
+			requestheaders: [][]string{{"x-request-id=1"}, {"x-tenant-id=inkle", "x-tenant-name=itb"}},
+			want:           EventLog{requestheaders: []string{"x-request-id=1", "x-tenant-id=inkle", "x-tenant-name=itb"}},
+		},
+		{
+			requestheaders:  [][]string{{"x-request-id=1"}},
+			responseheaders: [][]string{{"grpc-message=ok"}},
+			want:            EventLog{requestheaders: []string{"x-request-id=1"}, responseheaders: []string{"grpc-message=ok"}},
+		},
+	}
+
+	for i, test := range tests {
+		event := EventLog{}
+		for _, headers := range test.requestheaders {
+			event.insertRequestHeaders(headers)
+		}
+		for _, headers := range test.responseheaders {
+			event.insertResponseHeaders(headers)
+		}
+		if !isEventEqualValue(event, test.want) {
+			t.Errorf("insertHeaders (testcase %d): doesn't modify event as expected", i)
+		}
+	}
+}
+
+func Test_insertMessage(t *testing.T) {
+	tests := []struct {
+		requestsizes, responsesizes [][2]int
+		want                        EventLog
+	}{
+		{
+			want: EventLog{},
+		},
+		{
+			requestsizes: [][2]int{{7, 7}, {20, 64}},
+			want:         EventLog{requestmessages: 2, requestbytes: 27, requestuncompressedbytes: 71},
+		},
+		{
+			requestsizes:  [][2]int{{7, 7}},
+			responsesizes: [][2]int{{13, 13}, {1 << 30, -1}},
+			want:          EventLog{requestmessages: 1, requestbytes: 7, requestuncompressedbytes: 7, responsemessages: 2, responsebytes: 13 + 1<<30, responseuncompressedbytes: 13},
+		},
+	}
+
+	for i, test := range tests {
+		event := EventLog{}
+		for _, size := range test.requestsizes {
+			event.insertRequestMessage(size[0], size[1])
+		}
+		for _, size := range test.responsesizes {
+			event.insertResponseMessage(time.Time{}, size[0], size[1])
+		}
+		if !isEventEqualValue(event, test.want) {
+			t.Errorf("insertMessage (testcase %d): doesn't modify event as expected", i)
+		}
+	}
+}
+
+func Test_expiry(t *testing.T) {
+	tests := []struct {
+		event   EventLog
+		timeout time.Duration
+		want    time.Duration
+	}{
+		{
+			event:   EventLog{},
+			timeout: 800 * time.Millisecond,
+			want:    800 * time.Millisecond,
+		},
+		{
+			event:   EventLog{deadline: 5 * time.Second, hasdeadline: true},
+			timeout: 800 * time.Millisecond,
+			want:    5 * time.Second,
+		},
+		{
+			event:   EventLog{deadline: 100 * time.Millisecond, hasdeadline: true},
+			timeout: 800 * time.Millisecond,
+			want:    100 * time.Millisecond,
+		},
+		{
+			// grpc-timeout: 0n has already expired.
+			event:   EventLog{hasdeadline: true},
+			timeout: 800 * time.Millisecond,
+			want:    0,
+		},
+	}
+
+	for i, test := range tests {
+		if ret := test.event.expiry(test.timeout); ret != test.want {
+			t.Errorf("expiry (testcase %d): returns %v while it should be %v", i, ret, test.want)
+		}
+	}
+}
+
+func Test_lateResponse(t *testing.T) {
+	id := uuid.MustParse("d96763c9-a9a4-49d0-9008-b63befa85b6d")
+	stimestamp := time.Now()
+	expired := EventLog{
+		id:             id,
+		tstart:         stimestamp,
+		tfinish:        stimestamp.Add(time.Second),
+		servicename:    "helloworld.Greeter",
+		methodname:     "SayHello",
+		grpcstatuscode: "-1",
+		duration:       time.Second,
+		info:           "Request - TIMEOUT",
+		isexpired:      true,
+	}
+	want := EventLog{
+		tstart:         stimestamp,
+		tfinish:        stimestamp.Add(time.Second),
+		servicename:    "helloworld.Greeter",
+		methodname:     "SayHello",
+		grpcstatuscode: "-1",
+		duration:       time.Second,
+		info:           "Request",
+		timeouteventid: id,
+	}
+
+	late := expired.lateResponse()
+	if !isEventEqualValue(*late, want) {
+		t.Errorf("lateResponse: doesn't return event as expected")
+	}
+	if late.id == id {
+		t.Errorf("lateResponse: returns event with the id of the expired event")
+	}
+}
+
+func Test_insertTraceContext(t *testing.T) {
+	trace := tracing.SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Sampled: tracing.SampledNo}
+	event := EventLog{servicename: "helloworld.Greeter"}
+	event.insertTraceContext(trace)
+	if !isEventEqualValue(event, EventLog{servicename: "helloworld.Greeter", trace: trace}) {
+		t.Errorf("insertTraceContext: doesn't modify event as expected")
+	}
+}
+
+func Test_extraColumns(t *testing.T) {
+	tests := []struct {
+		event EventLog
+		want  []string
+	}{
+		{
+			event: EventLog{},
+			want:  []string{},
+		},
+		{
+			event: EventLog{responsepayload: `{1:"Hello Abram"}`},
+			want:  []string{`response_payload={1:"Hello Abram"}`},
+		},
+		{
+			event: EventLog{requestpayload: `{1:"Abram"}`, responsepayload: `{1:"Hello Abram"}`},
+			want:  []string{`request_payload={1:"Abram"}`, `response_payload={1:"Hello Abram"}`},
+		},
+		{
+			event: EventLog{requestmessages: 1, requestbytes: 7, requestuncompressedbytes: 7, responsemessages: 2, responsebytes: 30, responseuncompressedbytes: 64},
+			want: []string{
+				"request_messages=1", "request_bytes=7", "request_uncompressed_bytes=7",
+				"response_messages=2", "response_bytes=30", "response_uncompressed_bytes=64",
+			},
+		},
+		{
+			event: EventLog{requestheaders: []string{"x-request-id=1", "x-tenant-id=inkle"}, responseheaders: []string{"grpc-message=ok"}, requestpayload: `{1:"Abram"}`},
+			want:  []string{"request_header.x-request-id=1", "request_header.x-tenant-id=inkle", "response_header.grpc-message=ok", `request_payload={1:"Abram"}`},
+		},
+		{
+			event: EventLog{trace: tracing.SpanContext{TraceID: "463ac35c9f6413ad48485a3953bb6124", SpanID: "a2fb4a1d1a96d312"}, requestmessages: 1, requestbytes: 7, requestuncompressedbytes: 7},
+			want:  []string{"trace_id=463ac35c9f6413ad48485a3953bb6124", "span_id=a2fb4a1d1a96d312", "request_messages=1", "request_bytes=7", "request_uncompressed_bytes=7"},
+		},
+		{
+			event: EventLog{trace: tracing.SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", ParentSpanID: "0020000000000001", Sampled: tracing.SampledYes, TraceState: "congo=t61rcWkgMzE"}},
+			want:  []string{"trace_id=4bf92f3577b34da6a3ce929d0e0e4736", "span_id=00f067aa0ba902b7", "parent_span_id=0020000000000001", "trace_sampled=1", "trace_state=congo=t61rcWkgMzE"},
+		},
+		{
+			event: EventLog{tcp: tcpStats{duplicatesegments: 2}, requestmessages: 1, requestbytes: 7, requestuncompressedbytes: 7},
+			want:  []string{"duplicate_segments=2", "request_messages=1", "request_bytes=7", "request_uncompressed_bytes=7"},
+		},
+		{
+			event: EventLog{deadline: 999968 * time.Microsecond, hasdeadline: true},
+			want:  []string{"deadline=999.968ms"},
+		},
+		{
+			event: EventLog{hasdeadline: true, tfinish: time.Unix(1, 0), duration: 150 * time.Millisecond, deadlineexceeded: true},
+			want:  []string{"deadline=0s", "deadline_exceeded=1"},
+		},
+		{
+			event: EventLog{deadline: time.Second, hasdeadline: true, tfinish: time.Unix(1, 0), duration: 161626 * time.Microsecond},
+			want:  []string{"deadline=1s", "deadline_used=16.2%"},
+		},
+		{
+			event: EventLog{deadline: 100 * time.Millisecond, hasdeadline: true, tfinish: time.Unix(1, 0), duration: 150 * time.Millisecond, deadlineexceeded: true},
+			want:  []string{"deadline=100ms", "deadline_used=150.0%", "deadline_exceeded=1"},
+		},
+	}
+
+	for i, test := range tests {
+		if ret := test.event.extraColumns(); !reflect.DeepEqual(ret, test.want) {
+			t.Errorf("extraColumns (testcase %d): returns %v while it should be %v", i, ret, test.want)
+		}
+	}
+}
+
 func Test_isMatchingRequest(t *testing.T) {
 	tests := []struct {
 		ipdest  string
@@ -216,3 +577,67 @@ func Test_isMatchingRequest(t *testing.T) {
 		}
 	}
 }
+
+func Test_phaseColumns(t *testing.T) {
+	currtime := time.Now()
+	tests := []struct {
+		event EventLog
+		want  []string
+	}{
+		{
+			event: EventLog{tstart: currtime, tfinish: currtime.Add(time.Second)},
+			want:  []string{},
+		},
+		{
+			event: EventLog{
+				tstart:        currtime,
+				trequestend:   currtime.Add(10 * time.Millisecond),
+				tresponse:     currtime.Add(200 * time.Millisecond),
+				tfirstmessage: currtime.Add(210 * time.Millisecond),
+				tlastmessage:  currtime.Add(900 * time.Millisecond),
+				ttrailers:     currtime.Add(time.Second),
+				tfinish:       currtime.Add(200 * time.Millisecond),
+			},
+			want: []string{"phase_upload=10ms", "phase_server=190ms", "phase_first_message=10ms", "phase_trailers=100ms"},
+		},
+		{
+			// Trailers sent after the response HEADERS are unknown.
+			event: EventLog{
+				tstart:        currtime,
+				trequestend:   currtime.Add(10 * time.Millisecond),
+				tresponse:     currtime.Add(200 * time.Millisecond),
+				tfirstmessage: currtime.Add(200 * time.Millisecond),
+				tlastmessage:  currtime.Add(200 * time.Millisecond),
+				tfinish:       currtime.Add(200 * time.Millisecond),
+			},
+			want: []string{"phase_upload=10ms", "phase_server=190ms", "phase_first_message=0s"},
+		},
+		{
+			// A Trailers-Only response.
+			event: EventLog{tstart: currtime, trequestend: currtime.Add(10 * time.Millisecond), tresponse: currtime.Add(time.Second), ttrailers: currtime.Add(time.Second), tfinish: currtime.Add(time.Second)},
+			want:  []string{"phase_upload=10ms", "phase_server=990ms"},
+		},
+		{
+			// A request expired without response.
+			event: EventLog{tstart: currtime, trequestend: currtime.Add(10 * time.Millisecond), tfinish: currtime.Add(time.Second)},
+			want:  []string{"phase_upload=10ms"},
+		},
+	}
+
+	for i, test := range tests {
+		if ret := test.event.phaseColumns(); !reflect.DeepEqual(ret, test.want) {
+			t.Errorf("phaseColumns (testcase %d): returns %v while it should be %v", i, ret, test.want)
+		}
+	}
+}
+
+func Test_insertResponseMessageTime(t *testing.T) {
+	currtime := time.Now()
+	event := EventLog{}
+	for i := 0; i < 3; i++ {
+		event.insertResponseMessage(currtime.Add(time.Duration(i)*time.Second), 1, 1)
+	}
+	if event.tfirstmessage != currtime || event.tlastmessage != currtime.Add(2*time.Second) {
+		t.Errorf("insertResponseMessage: records messages from %v to %v while it should be from %v to %v", event.tfirstmessage, event.tlastmessage, currtime, currtime.Add(2*time.Second))
+	}
+}
@@ -2,65 +2,745 @@ package logging
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"net"
-	"os"
 	"sync"
 	"time"
 
+	"github.com/abrampers/inkle/tracing"
 	"github.com/google/uuid"
 )
 
 type EventLogManager interface {
 	CreatePendingRequest(timestamp time.Time, servicename string, methodname string, ipsource string, tcpsource uint16, ipdest string, tcpdest uint16) string
 	InsertResponse(timestamp time.Time, ipsource string, tcpsource uint16, ipdest string, tcpdest uint16, grpcstatuscode string) string
+	StartResponse(timestamp time.Time, ipsource string, tcpsource uint16, ipdest string, tcpdest uint16, grpcstatuscode string) string
+	InsertRequestPayload(ipsource string, tcpsource uint16, payload string)
+	InsertResponsePayload(ipdest string, tcpdest uint16, payload string)
+	InsertRequestHeaders(ipsource string, tcpsource uint16, headers []string)
+	InsertResponseHeaders(ipdest string, tcpdest uint16, headers []string)
+	InsertRequestMessage(ipsource string, tcpsource uint16, size int, uncompressedsize int)
+	InsertResponseMessage(timestamp time.Time, ipdest string, tcpdest uint16, size int, uncompressedsize int)
+	InsertTrailers(timestamp time.Time, ipdest string, tcpdest uint16, grpcstatuscode string)
+	InsertRequestEnd(timestamp time.Time, ipsource string, tcpsource uint16)
+	InsertTraceContext(ipsource string, tcpsource uint16, trace tracing.SpanContext)
+	InsertDeadline(ipsource string, tcpsource uint16, deadline time.Duration)
+	InsertDuplicateSegment(ipsource string, tcpsource uint16, ipdest string, tcpdest uint16)
+	InsertDuplicateAck(ipsource string, tcpsource uint16, ipdest string, tcpdest uint16)
+	InsertZeroWindow(ipsource string, tcpsource uint16, ipdest string, tcpdest uint16)
+	InsertHandshake(timestamp time.Time, ipsource string, tcpsource uint16, ipdest string, tcpdest uint16, syn bool, ack bool)
+	InsertRequestHash(ipsource string, tcpsource uint16, hash string)
+	InsertAttempt(ipsource string, tcpsource uint16, previousattempts int)
+	FollowConnection(timestamp time.Time, clientip string, clienttcp uint16, serverip string, servertcp uint16)
+	IsFollowed(ipsource string, tcpsource uint16, ipdest string, tcpdest uint16) bool
+	OpenConnection(timestamp time.Time, clientip string, clienttcp uint16, serverip string, servertcp uint16) string
+	CloseConnection(timestamp time.Time, ipsource string, tcpsource uint16, ipdest string, tcpdest uint16, reason string) string
+	InsertGoAway(ipsource string, tcpsource uint16, ipdest string, tcpdest uint16, errcode string)
+	InsertStream(timestamp time.Time, ipsource string, tcpsource uint16, ipdest string, tcpdest uint16, streamid uint32) string
+	EndStream(timestamp time.Time, ipsource string, tcpsource uint16, ipdest string, tcpdest uint16, streamid uint32, isreset bool) string
+	InsertSettings(timestamp time.Time, ipsource string, tcpsource uint16, ipdest string, tcpdest uint16, settings map[string]uint32) string
+	InsertData(timestamp time.Time, ipsource string, tcpsource uint16, ipdest string, tcpdest uint16, sizes map[uint32]int)
+	InsertWindowUpdate(timestamp time.Time, ipsource string, tcpsource uint16, ipdest string, tcpdest uint16, increments map[uint32]int) string
+	InsertPing(timestamp time.Time, ipsource string, tcpsource uint16, ipdest string, tcpdest uint16, data uint64, isack bool)
 	CleanupExpiredRequests()
+	InFlight() map[string]int
 	Stop()
 }
 
 type eventLogManager struct {
-	events  []*EventLog
-	tticker *time.Ticker
+	events []*EventLog
+	// Expired requests are looked for every tick, or earlier when one is due
+	// before. wakeup is signaled when a shorter deadline is set.
+	tick    time.Duration
+	wakeup  chan struct{}
+	done    chan struct{}
+	stop    sync.Once
 	timeout time.Duration
-	mutex   sync.RWMutex
-	file    *os.File
-	cidr    *net.IPNet
+	// policies override the timeout of matching methods.
+	policies []ExpiryPolicy
+	// expired events are remembered for latewindow to match late responses.
+	expired    []*EventLog
+	latewindow time.Duration
+	// calls group the attempts started within retrywindow of each other.
+	calls       []*logicalCall
+	retrywindow time.Duration
+	connections []*connectionLog
+	// streams blocked by flow control longer than stallthreshold are
+	// reported.
+	stallthreshold time.Duration
+	// format returns the lines of the events, csv if nil.
+	format Formatter
+	mutex  sync.RWMutex
+	// sinks receive the events printed.
+	sinks []Sink
+	cidr  *net.IPNet
 }
 
-func NewEventLogManager(t time.Duration, f *os.File, cidr *net.IPNet) EventLogManager {
-	log.Printf("Printing logs to %s.\n", f.Name())
-	return &eventLogManager{timeout: t, tticker: time.NewTicker(t), file: f, cidr: cidr}
+func NewEventLogManager(t time.Duration, policies []ExpiryPolicy, latewindow time.Duration, retrywindow time.Duration, stallthreshold time.Duration, format Formatter, sinks []Sink, cidr *net.IPNet) EventLogManager {
+	// Expired requests are looked for as often as the shortest timeout.
+	tick := t
+	for _, policy := range policies {
+		if policy.Timeout > 0 && policy.Timeout < tick {
+			tick = policy.Timeout
+		}
+	}
+	return &eventLogManager{timeout: t, policies: policies, latewindow: latewindow, retrywindow: retrywindow, stallthreshold: stallthreshold, format: format, tick: tick, wakeup: make(chan struct{}, 1), done: make(chan struct{}), sinks: sinks, cidr: cidr}
 }
 
 // TODO: Print all remaining events as timeout
 func (m *eventLogManager) Stop() {
-	m.tticker.Stop()
+	m.stop.Do(func() { close(m.done) })
+	for _, sink := range m.sinks {
+		if closer, ok := sink.(io.Closer); ok {
+			closer.Close()
+		}
+	}
 }
 
 func (m *eventLogManager) CreatePendingRequest(timestamp time.Time, servicename string, methodname string, ipsource string, tcpsource uint16, ipdest string, tcpdest uint16) string {
 	e := NewEventLog(timestamp, servicename, methodname, ipsource, tcpsource, ipdest, tcpdest, "Request")
 	m.addEvent(e)
-	return logString(*e)
+	return m.formatEvent(*e)
 }
 
+// InsertResponse prints the whole response sent to ipdest:tcpdest, of the
+// pending request or of a recently expired one, or else as NO_REQUEST.
 func (m *eventLogManager) InsertResponse(timestamp time.Time, ipsource string, tcpsource uint16, ipdest string, tcpdest uint16, grpcstatuscode string) string {
-	var event *EventLog
-	var idx int
-	event, idx = m.getEvent(ipdest, tcpdest)
+	event, idx := m.getEvent(ipdest, tcpdest)
 	if idx == -1 {
-		event = NewEventLog(time.Time{}, "NULL", "NULL", ipdest, tcpdest, ipsource, tcpsource, "NO_REQUEST")
-	} else {
-		m.removeEvent(event.id)
+		return m.printUnmatchedResponse(timestamp, ipsource, tcpsource, ipdest, tcpdest, grpcstatuscode)
+	}
+	m.mutex.Lock()
+	event.startResponse(timestamp)
+	m.mutex.Unlock()
+	return m.finishEvent(event, timestamp, grpcstatuscode, " - Response")
+}
+
+// StartResponse records the response HEADERS sent to ipdest:tcpdest for the
+// pending request, which is printed at the END_STREAM or RST_STREAM of its
+// stream. Responses of recently expired requests, or without a request, are
+// printed right away.
+func (m *eventLogManager) StartResponse(timestamp time.Time, ipsource string, tcpsource uint16, ipdest string, tcpdest uint16, grpcstatuscode string) string {
+	event, idx := m.getEvent(ipdest, tcpdest)
+	if idx == -1 {
+		return m.printUnmatchedResponse(timestamp, ipsource, tcpsource, ipdest, tcpdest, grpcstatuscode)
 	}
+	m.mutex.Lock()
+	event.startResponse(timestamp)
+	m.mutex.Unlock()
+	return ""
+}
 
+// printUnmatchedResponse prints the response sent to ipdest:tcpdest as the
+// late response of a recently expired request, or else as NO_REQUEST.
+func (m *eventLogManager) printUnmatchedResponse(timestamp time.Time, ipsource string, tcpsource uint16, ipdest string, tcpdest uint16, grpcstatuscode string) string {
+	if expired, idx := m.getExpiredEvent(ipdest, tcpdest); idx != -1 {
+		m.removeExpiredEvent(expired.id)
+		event := expired.lateResponse()
+		event.startResponse(timestamp)
+		event.insertResponse(timestamp, grpcstatuscode, " - LATE_RESPONSE")
+		return m.printEvent(*event)
+	}
+	event := NewEventLog(time.Time{}, "NULL", "NULL", ipdest, tcpdest, ipsource, tcpsource, "NO_REQUEST")
+	event.startResponse(timestamp)
 	event.insertResponse(timestamp, grpcstatuscode, " - Response")
-	return m.printEvent(*event) // Consider spawn goroutine
+	return m.printEvent(*event)
+}
+
+// finishEvent removes the pending event and prints it as finished at
+// timestamp, along with the calls its attempt settles.
+func (m *eventLogManager) finishEvent(event *EventLog, timestamp time.Time, grpcstatuscode string, responseinfo string) string {
+	m.removeEvent(event.id)
+	m.mutex.Lock()
+	event.insertResponse(timestamp, grpcstatuscode, responseinfo)
+	m.mutex.Unlock()
+	ret := m.printEvent(*event)
+	m.finishAttempt(event)
+	return ret + m.printSettledCalls(timestamp)
+}
+
+// responseStatus returns the grpc-status received for the event, or -1.
+func responseStatus(event *EventLog) string {
+	if event.grpcstatuscode == "" {
+		return "-1"
+	}
+	return event.grpcstatuscode
+}
+
+// InsertTrailers records the trailers sent to ipdest:tcpdest for the pending
+// request, and the status they carry.
+func (m *eventLogManager) InsertTrailers(timestamp time.Time, ipdest string, tcpdest uint16, grpcstatuscode string) {
+	event, idx := m.getResponseEvent(ipdest, tcpdest)
+	if idx == -1 {
+		return
+	}
+	m.mutex.Lock()
+	event.insertTrailers(timestamp, grpcstatuscode)
+	m.mutex.Unlock()
+}
+
+// InsertRequestEnd records the END_STREAM of the pending request sent from
+// ipsource:tcpsource.
+func (m *eventLogManager) InsertRequestEnd(timestamp time.Time, ipsource string, tcpsource uint16) {
+	event, idx := m.getEvent(ipsource, tcpsource)
+	if idx == -1 {
+		return
+	}
+	m.mutex.Lock()
+	event.insertRequestEnd(timestamp)
+	m.mutex.Unlock()
+}
+
+// InsertRequestPayload attaches a decoded request message to the pending
+// request sent from ipsource:tcpsource.
+func (m *eventLogManager) InsertRequestPayload(ipsource string, tcpsource uint16, payload string) {
+	event, idx := m.getEvent(ipsource, tcpsource)
+	if idx == -1 {
+		return
+	}
+	m.mutex.Lock()
+	event.insertRequestPayload(payload)
+	m.mutex.Unlock()
+}
+
+// InsertResponsePayload attaches a decoded response message to the pending
+// request whose response is sent to ipdest:tcpdest.
+func (m *eventLogManager) InsertResponsePayload(ipdest string, tcpdest uint16, payload string) {
+	event, idx := m.getResponseEvent(ipdest, tcpdest)
+	if idx == -1 {
+		return
+	}
+	m.mutex.Lock()
+	event.insertResponsePayload(payload)
+	m.mutex.Unlock()
+}
+
+// InsertRequestHeaders attaches captured name=value headers to the pending
+// request sent from ipsource:tcpsource.
+func (m *eventLogManager) InsertRequestHeaders(ipsource string, tcpsource uint16, headers []string) {
+	event, idx := m.getEvent(ipsource, tcpsource)
+	if idx == -1 {
+		return
+	}
+	m.mutex.Lock()
+	event.insertRequestHeaders(headers)
+	m.mutex.Unlock()
+}
+
+// InsertResponseHeaders attaches captured name=value headers to the pending
+// request whose response is sent to ipdest:tcpdest.
+func (m *eventLogManager) InsertResponseHeaders(ipdest string, tcpdest uint16, headers []string) {
+	event, idx := m.getResponseEvent(ipdest, tcpdest)
+	if idx == -1 {
+		return
+	}
+	m.mutex.Lock()
+	event.insertResponseHeaders(headers)
+	m.mutex.Unlock()
+}
+
+// InsertRequestMessage counts a request message sent from ipsource:tcpsource
+// in the sizes of the pending request.
+func (m *eventLogManager) InsertRequestMessage(ipsource string, tcpsource uint16, size int, uncompressedsize int) {
+	event, idx := m.getEvent(ipsource, tcpsource)
+	if idx == -1 {
+		return
+	}
+	m.mutex.Lock()
+	event.insertRequestMessage(size, uncompressedsize)
+	m.mutex.Unlock()
+}
+
+// InsertResponseMessage counts a response message sent to ipdest:tcpdest in
+// the sizes of the pending request.
+func (m *eventLogManager) InsertResponseMessage(timestamp time.Time, ipdest string, tcpdest uint16, size int, uncompressedsize int) {
+	event, idx := m.getResponseEvent(ipdest, tcpdest)
+	if idx == -1 {
+		return
+	}
+	m.mutex.Lock()
+	event.insertResponseMessage(timestamp, size, uncompressedsize)
+	m.mutex.Unlock()
+}
+
+// InsertTraceContext attaches the trace context propagated by the pending
+// request sent from ipsource:tcpsource.
+func (m *eventLogManager) InsertTraceContext(ipsource string, tcpsource uint16, trace tracing.SpanContext) {
+	event, idx := m.getEvent(ipsource, tcpsource)
+	if idx == -1 {
+		return
+	}
+	m.mutex.Lock()
+	event.insertTraceContext(trace)
+	m.mutex.Unlock()
+}
+
+// InsertDeadline sets the client deadline of the pending request sent from
+// ipsource:tcpsource. The request then expires at its deadline instead of
+// the manager timeout.
+func (m *eventLogManager) InsertDeadline(ipsource string, tcpsource uint16, deadline time.Duration) {
+	event, idx := m.getEvent(ipsource, tcpsource)
+	if idx == -1 {
+		return
+	}
+	m.mutex.Lock()
+	event.insertDeadline(deadline)
+	m.mutex.Unlock()
+	if deadline < m.tick {
+		select {
+		case m.wakeup <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// InsertDuplicateSegment counts a retransmitted TCP segment sent from
+// ipsource:tcpsource to ipdest:tcpdest on their connection and the calls
+// pending on it.
+func (m *eventLogManager) InsertDuplicateSegment(ipsource string, tcpsource uint16, ipdest string, tcpdest uint16) {
+	m.countTCP(ipsource, tcpsource, ipdest, tcpdest, func(stats *tcpStats) { stats.duplicatesegments++ })
+}
+
+// InsertDuplicateAck counts a duplicate ACK sent from ipsource:tcpsource to
+// ipdest:tcpdest on their connection and the calls pending on it.
+func (m *eventLogManager) InsertDuplicateAck(ipsource string, tcpsource uint16, ipdest string, tcpdest uint16) {
+	m.countTCP(ipsource, tcpsource, ipdest, tcpdest, func(stats *tcpStats) { stats.dupacks++ })
+}
+
+// InsertZeroWindow counts a zero window announced by ipsource:tcpsource to
+// ipdest:tcpdest on their connection and the calls pending on it.
+func (m *eventLogManager) InsertZeroWindow(ipsource string, tcpsource uint16, ipdest string, tcpdest uint16) {
+	m.countTCP(ipsource, tcpsource, ipdest, tcpdest, func(stats *tcpStats) { stats.zerowindows++ })
+}
+
+// countTCP counts a TCP event of the connection between ipsource:tcpsource
+// and ipdest:tcpdest, and of the calls pending on it, from either end.
+func (m *eventLogManager) countTCP(ipsource string, tcpsource uint16, ipdest string, tcpdest uint16, count func(stats *tcpStats)) {
+	conn, idx := m.getConnection(ipsource, tcpsource, ipdest, tcpdest)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if idx != -1 {
+		count(&conn.tcp)
+	}
+	for _, event := range m.events {
+		if event.isMatchingRequest(ipsource, tcpsource) || event.isMatchingRequest(ipdest, tcpdest) {
+			count(&event.tcp)
+		}
+	}
+}
+
+// InsertHandshake follows the TCP handshake of the connection between
+// ipsource:tcpsource and ipdest:tcpdest from the SYN and ACK flags of their
+// segments.
+func (m *eventLogManager) InsertHandshake(timestamp time.Time, ipsource string, tcpsource uint16, ipdest string, tcpdest uint16, syn bool, ack bool) {
+	conn, idx := m.getConnection(ipsource, tcpsource, ipdest, tcpdest)
+	if idx == -1 {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	conn.insertHandshake(timestamp, conn.isFromClient(ipsource, tcpsource, ipdest, tcpdest), syn, ack)
+}
+
+// InsertRequestHash sets the hash of the first request message of the
+// pending request sent from ipsource:tcpsource, used to match its attempts.
+func (m *eventLogManager) InsertRequestHash(ipsource string, tcpsource uint16, hash string) {
+	event, idx := m.getEvent(ipsource, tcpsource)
+	if idx == -1 {
+		return
+	}
+	m.mutex.Lock()
+	if event.requesthash == "" {
+		event.requesthash = hash
+	}
+	m.mutex.Unlock()
+}
+
+// InsertAttempt groups the pending request sent from ipsource:tcpsource with
+// the previous attempts of its call, from its grpc-previous-rpc-attempts.
+// Attempts aren't grouped when the retry window is 0.
+func (m *eventLogManager) InsertAttempt(ipsource string, tcpsource uint16, previousattempts int) {
+	if m.retrywindow <= 0 {
+		return
+	}
+	event, idx := m.getEvent(ipsource, tcpsource)
+	if idx == -1 {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var call *logicalCall
+	if previousattempts > 0 {
+		for i := len(m.calls) - 1; i >= 0; i-- {
+			if m.calls[i].isMatchingAttempt(event, previousattempts, m.retrywindow) {
+				call = m.calls[i]
+				break
+			}
+		}
+	}
+	if call == nil {
+		call = newLogicalCall(event)
+		m.calls = append(m.calls, call)
+	}
+	call.insertAttempt(event, previousattempts+1)
+}
+
+// finishAttempt records the outcome of a finished attempt in its call.
+func (m *eventLogManager) finishAttempt(event *EventLog) {
+	if event.callid == uuid.Nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, call := range m.calls {
+		if call.id == event.callid {
+			call.finishAttempt(event)
+			return
+		}
+	}
+}
+
+// printSettledCalls forgets the calls which won't get another attempt and
+// prints the retried ones.
+func (m *eventLogManager) printSettledCalls(currtime time.Time) string {
+	m.mutex.Lock()
+	calls, settled := []*logicalCall{}, []*logicalCall{}
+	for _, call := range m.calls {
+		if call.isSettled(currtime, m.retrywindow) {
+			settled = append(settled, call)
+		} else {
+			calls = append(calls, call)
+		}
+	}
+	m.calls = calls
+	m.mutex.Unlock()
+
+	ret := ""
+	for _, call := range settled {
+		if call.attempts > 1 {
+			ret += m.printEvent(call.eventLog())
+		}
+	}
+	return ret
+}
+
+// maxUnopenedAge bounds how long connections followed from their SYN are
+// kept before they show they carry HTTP/2.
+const maxUnopenedAge = time.Minute
+
+// FollowConnection starts following the connection from clientip:clienttcp
+// to serverip:servertcp from its SYN, unless it's already followed. Its
+// opening is only printed once it shows it carries HTTP/2.
+func (m *eventLogManager) FollowConnection(timestamp time.Time, clientip string, clienttcp uint16, serverip string, servertcp uint16) {
+	m.followConnection(timestamp, clientip, clienttcp, serverip, servertcp, true)
+}
+
+// OpenConnection prints the opening of the connection from
+// clientip:clienttcp to serverip:servertcp once its client preface is seen,
+// following it unless it's already followed.
+func (m *eventLogManager) OpenConnection(timestamp time.Time, clientip string, clienttcp uint16, serverip string, servertcp uint16) string {
+	return m.openConnection(m.followConnection(timestamp, clientip, clienttcp, serverip, servertcp, true))
+}
+
+// followConnection returns the followed connection from clientip:clienttcp
+// to serverip:servertcp, or follows it. The flow control of connections seen
+// from their start, whose windows are known, is followed too.
+func (m *eventLogManager) followConnection(timestamp time.Time, clientip string, clienttcp uint16, serverip string, servertcp uint16, fromstart bool) *connectionLog {
+	if conn, idx := m.getConnection(clientip, clienttcp, serverip, servertcp); idx != -1 {
+		return conn
+	}
+	conn := newConnectionLog(timestamp, clientip, clienttcp, serverip, servertcp)
+	if fromstart {
+		conn.clientflow, conn.serverflow = newFlowControl(), newFlowControl()
+	}
+	m.mutex.Lock()
+	m.connections = append(m.connections, conn)
+	m.mutex.Unlock()
+	return conn
+}
+
+// openConnection prints the opening of conn, unless it's already printed.
+func (m *eventLogManager) openConnection(conn *connectionLog) string {
+	m.mutex.Lock()
+	if conn.opened {
+		m.mutex.Unlock()
+		return ""
+	}
+	conn.opened = true
+	m.mutex.Unlock()
+	return m.printEvent(conn.eventLog(conn.topen, ""))
+}
+
+// forgetUnopenedConnections stops following the connections which didn't
+// show they carry HTTP/2 within maxUnopenedAge of their SYN.
+func (m *eventLogManager) forgetUnopenedConnections(currtime time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	connections := []*connectionLog{}
+	for _, conn := range m.connections {
+		if conn.opened || currtime.Sub(conn.topen) < maxUnopenedAge {
+			connections = append(connections, conn)
+		}
+	}
+	m.connections = connections
+}
+
+// CloseConnection prints the closing of the connection between
+// ipsource:tcpsource and ipdest:tcpdest, if its opening was printed, and
+// stops following it. reason is replaced by the GOAWAY error code when the
+// server sent one.
+func (m *eventLogManager) CloseConnection(timestamp time.Time, ipsource string, tcpsource uint16, ipdest string, tcpdest uint16, reason string) string {
+	conn, idx := m.getConnection(ipsource, tcpsource, ipdest, tcpdest)
+	if idx == -1 {
+		return ""
+	}
+	m.mutex.Lock()
+	for i := range m.connections {
+		if m.connections[i] == conn {
+			m.connections = append(m.connections[:i], m.connections[i+1:]...)
+			break
+		}
+	}
+	opened := conn.opened
+	m.mutex.Unlock()
+
+	if !opened {
+		return ""
+	}
+	if conn.goaway != "" {
+		reason = "GOAWAY_" + conn.goaway
+	}
+	return m.printEvent(conn.eventLog(timestamp, reason))
+}
+
+// InsertGoAway records the GOAWAY error code sent on the connection between
+// ipsource:tcpsource and ipdest:tcpdest.
+func (m *eventLogManager) InsertGoAway(ipsource string, tcpsource uint16, ipdest string, tcpdest uint16, errcode string) {
+	conn, idx := m.getConnection(ipsource, tcpsource, ipdest, tcpdest)
+	if idx == -1 {
+		return
+	}
+	m.mutex.Lock()
+	conn.goaway = errcode
+	m.mutex.Unlock()
+}
+
+// InsertStream counts the stream of the pending request sent from
+// ipsource:tcpsource to ipdest:tcpdest in its connection, and attaches the
+// connection to the request. Connections whose start wasn't seen are
+// followed from their first request. The saturation of the connection by the
+// stream is printed.
+func (m *eventLogManager) InsertStream(timestamp time.Time, ipsource string, tcpsource uint16, ipdest string, tcpdest uint16, streamid uint32) string {
+	conn := m.followConnection(timestamp, ipsource, tcpsource, ipdest, tcpdest, false)
+	ret := m.openConnection(conn)
+	// The request of the stream is the last one without a stream yet.
+	event, idx := m.getStreamEvent(ipsource, tcpsource, 0)
+	m.mutex.Lock()
+	saturated := conn.startStream(timestamp, streamid)
+	if idx != -1 {
+		event.streamid = streamid
+		event.connectionid = conn.id
+		event.tcp.handshakertt = conn.tcp.handshakertt
+	}
+	m.mutex.Unlock()
+	if saturated {
+		ret += m.printEvent(conn.saturationEventLog(timestamp))
+	}
+	return ret
 }
 
+// EndStream stops counting a stream sent from ipsource:tcpsource to
+// ipdest:tcpdest as open, once it was reset or ended by the server. The time
+// the stream was blocked by flow control is added to its pending request,
+// which is then printed.
+func (m *eventLogManager) EndStream(timestamp time.Time, ipsource string, tcpsource uint16, ipdest string, tcpdest uint16, streamid uint32, isreset bool) string {
+	conn, idx := m.getConnection(ipsource, tcpsource, ipdest, tcpdest)
+	if idx == -1 {
+		return ""
+	}
+	event, eventidx := m.getStreamEvent(conn.clientip, conn.clienttcp, streamid)
+	m.mutex.Lock()
+	if !isreset && conn.isFromClient(ipsource, tcpsource, ipdest, tcpdest) {
+		m.mutex.Unlock()
+		return ""
+	}
+	conn.endStream(timestamp, streamid)
+	blocked := conn.flowBlocked(timestamp, streamid)
+	if eventidx == -1 {
+		m.mutex.Unlock()
+		return ""
+	}
+	event.flowblocked += blocked
+	isexpired, grpcstatuscode := event.isexpired, responseStatus(event)
+	responseinfo := " - Response"
+	if isreset && event.ttrailers.IsZero() {
+		responseinfo = " - RST_STREAM"
+	}
+	m.mutex.Unlock()
+	if isexpired {
+		return ""
+	}
+	return m.finishEvent(event, timestamp, grpcstatuscode, responseinfo)
+}
+
+// InsertSettings records the SETTINGS sent from ipsource:tcpsource to
+// ipdest:tcpdest on their connection, which shows it carries HTTP/2, and
+// prints its opening and the flow-control stalls they end.
+func (m *eventLogManager) InsertSettings(timestamp time.Time, ipsource string, tcpsource uint16, ipdest string, tcpdest uint16, settings map[string]uint32) string {
+	conn, idx := m.getConnection(ipsource, tcpsource, ipdest, tcpdest)
+	if idx == -1 {
+		return ""
+	}
+	ret := m.openConnection(conn)
+	m.mutex.Lock()
+	stalls := conn.insertSettings(timestamp, conn.isFromClient(ipsource, tcpsource, ipdest, tcpdest), settings, m.stallthreshold)
+	m.mutex.Unlock()
+	return ret + m.printStalls(stalls)
+}
+
+// InsertData consumes the flow-control windows of ipsource:tcpsource with
+// the sizes of the DATA frames it sent, by stream.
+func (m *eventLogManager) InsertData(timestamp time.Time, ipsource string, tcpsource uint16, ipdest string, tcpdest uint16, sizes map[uint32]int) {
+	conn, idx := m.getConnection(ipsource, tcpsource, ipdest, tcpdest)
+	if idx == -1 {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	conn.insertData(timestamp, conn.isFromClient(ipsource, tcpsource, ipdest, tcpdest), sizes)
+}
+
+// InsertWindowUpdate grows the flow-control windows of ipdest:tcpdest by the
+// increments sent by ipsource:tcpsource, by stream, and prints the
+// flow-control stalls they end.
+func (m *eventLogManager) InsertWindowUpdate(timestamp time.Time, ipsource string, tcpsource uint16, ipdest string, tcpdest uint16, increments map[uint32]int) string {
+	conn, idx := m.getConnection(ipsource, tcpsource, ipdest, tcpdest)
+	if idx == -1 {
+		return ""
+	}
+	m.mutex.Lock()
+	stalls := conn.insertWindowUpdate(timestamp, conn.isFromClient(ipsource, tcpsource, ipdest, tcpdest), increments, m.stallthreshold)
+	m.mutex.Unlock()
+	return m.printStalls(stalls)
+}
+
+func (m *eventLogManager) printStalls(stalls []EventLog) string {
+	ret := ""
+	for _, stall := range stalls {
+		ret += m.printEvent(stall)
+	}
+	return ret
+}
+
+// printStalledConnections prints the streams blocked by flow control longer
+// than the stall threshold at currtime.
+func (m *eventLogManager) printStalledConnections(currtime time.Time) {
+	if m.stallthreshold <= 0 {
+		return
+	}
+	m.mutex.Lock()
+	stalls := []EventLog{}
+	for _, conn := range m.connections {
+		stalls = append(stalls, conn.stalls(currtime, m.stallthreshold)...)
+	}
+	m.mutex.Unlock()
+	m.printStalls(stalls)
+}
+
+// InsertPing records the PING sent from ipsource:tcpsource to ipdest:tcpdest,
+// or measures the round trip time of the PING it acknowledges.
+func (m *eventLogManager) InsertPing(timestamp time.Time, ipsource string, tcpsource uint16, ipdest string, tcpdest uint16, data uint64, isack bool) {
+	conn, idx := m.getConnection(ipsource, tcpsource, ipdest, tcpdest)
+	if idx == -1 {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	fromclient := conn.isFromClient(ipsource, tcpsource, ipdest, tcpdest)
+	if isack {
+		conn.ackPing(timestamp, fromclient, data)
+	} else {
+		conn.insertPing(timestamp, fromclient, data)
+	}
+}
+
+// IsFollowed reports whether the connection between ipsource:tcpsource and
+// ipdest:tcpdest is followed, from its SYN, its client preface or a request.
+func (m *eventLogManager) IsFollowed(ipsource string, tcpsource uint16, ipdest string, tcpdest uint16) bool {
+	_, idx := m.getConnection(ipsource, tcpsource, ipdest, tcpdest)
+	return idx != -1
+}
+
+func (m *eventLogManager) getConnection(ipsource string, tcpsource uint16, ipdest string, tcpdest uint16) (conn *connectionLog, idx int) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	for i, conn := range m.connections {
+		if conn.isMatchingConnection(ipsource, tcpsource, ipdest, tcpdest) {
+			return conn, i
+		}
+	}
+	return nil, -1
+}
+
+// getEvent returns the first pending event of the requests sent from
+// ipdest:tcpdest which got no response yet, or else the first one.
 func (m *eventLogManager) getEvent(ipdest string, tcpdest uint16) (event *EventLog, idx int) {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
-	for i, event := range m.events {
+	idx = -1
+	for i, e := range m.events {
+		if !e.isMatchingRequest(ipdest, tcpdest) {
+			continue
+		}
+		if e.tresponse.IsZero() {
+			return e, i
+		}
+		if idx == -1 {
+			event, idx = e, i
+		}
+	}
+	return event, idx
+}
+
+// getResponseEvent returns the first pending event whose response sent to
+// ipdest:tcpdest started, or else the first one, or else the recently
+// expired one still waiting for it.
+func (m *eventLogManager) getResponseEvent(ipdest string, tcpdest uint16) (event *EventLog, idx int) {
+	m.mutex.RLock()
+	for i, e := range m.events {
+		if e.isMatchingRequest(ipdest, tcpdest) && !e.tresponse.IsZero() {
+			m.mutex.RUnlock()
+			return e, i
+		}
+	}
+	m.mutex.RUnlock()
+	if event, idx = m.getEvent(ipdest, tcpdest); idx != -1 {
+		return event, idx
+	}
+	return m.getExpiredEvent(ipdest, tcpdest)
+}
+
+// getStreamEvent returns the last pending or recently expired event of the
+// stream streamid whose response is sent to ipdest:tcpdest, as streams of
+// different RPCs share the connection.
+func (m *eventLogManager) getStreamEvent(ipdest string, tcpdest uint16, streamid uint32) (event *EventLog, idx int) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	for _, events := range [][]*EventLog{m.events, m.expired} {
+		for i := len(events) - 1; i >= 0; i-- {
+			if events[i].isMatchingRequest(ipdest, tcpdest) && events[i].streamid == streamid {
+				return events[i], i
+			}
+		}
+	}
+	return nil, -1
+}
+
+func (m *eventLogManager) getExpiredEvent(ipdest string, tcpdest uint16) (event *EventLog, idx int) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	for i, event := range m.expired {
 		if event.isMatchingRequest(ipdest, tcpdest) {
 			return event, i
 		}
@@ -68,6 +748,56 @@ func (m *eventLogManager) getEvent(ipdest string, tcpdest uint16) (event *EventL
 	return nil, -1
 }
 
+func (m *eventLogManager) removeExpiredEvent(id uuid.UUID) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for idx, event := range m.expired {
+		if event.id == id {
+			m.expired = append(m.expired[:idx], m.expired[idx+1:]...)
+			return
+		}
+	}
+}
+
+// rememberExpired keeps events for the late response window and forgets the
+// ones expired before it.
+func (m *eventLogManager) rememberExpired(events []*EventLog, currtime time.Time) {
+	if m.latewindow <= 0 {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	expired := []*EventLog{}
+	for _, event := range m.expired {
+		if currtime.Sub(event.tfinish) < m.latewindow {
+			expired = append(expired, event)
+		}
+	}
+	for _, event := range events {
+		// Events which got a response already wait for no late one.
+		if !event.tresponse.IsZero() {
+			continue
+		}
+		event.isexpired = true
+		expired = append(expired, event)
+	}
+	m.expired = expired
+}
+
+// InFlight returns the number of pending requests by service/method, among
+// the ones which would be printed.
+func (m *eventLogManager) InFlight() map[string]int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	inflight := map[string]int{}
+	for _, event := range m.events {
+		if m.cidr.Contains(net.ParseIP(event.ipsource)) {
+			inflight[event.servicename+"/"+event.methodname]++
+		}
+	}
+	return inflight
+}
+
 func (m *eventLogManager) addEvent(event *EventLog) {
 	m.mutex.Lock()
 	m.events = append(m.events, event)
@@ -94,15 +824,55 @@ func (m *eventLogManager) removeEvent(id uuid.UUID) {
 }
 
 func (m *eventLogManager) CleanupExpiredRequests() {
-	for currtime := range m.tticker.C {
-		m.cleanup(currtime)
+	timer := time.NewTimer(m.tick)
+	defer timer.Stop()
+	for {
+		select {
+		case currtime := <-timer.C:
+			m.cleanup(currtime)
+		case <-m.wakeup:
+			if !timer.Stop() {
+				<-timer.C
+			}
+		case <-m.done:
+			return
+		}
+		timer.Reset(m.nextCleanup(time.Now()))
 	}
 }
 
+// nextCleanup returns how long to wait from currtime for the next pending
+// request to expire, at most a tick.
+func (m *eventLogManager) nextCleanup(currtime time.Time) time.Duration {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	next := m.tick
+	for _, event := range m.events {
+		policy := m.expiryPolicy(event)
+		if policy.Action == ExpiryWait {
+			continue
+		}
+		if d := event.tstart.Add(event.expiry(policy.Timeout)).Sub(currtime); d < next {
+			next = d
+		}
+	}
+	if next < 0 {
+		return 0
+	}
+	return next
+}
+
 func (m *eventLogManager) cleanup(t time.Time) {
 	expiredevents := m.expiredEvents(t)
 	m.removeEvents(expiredevents)
+	m.rememberExpired(expiredevents, t)
 	m.printEvents(expiredevents)
+	for _, event := range expiredevents {
+		m.finishAttempt(event)
+	}
+	m.printSettledCalls(t)
+	m.printStalledConnections(t)
+	m.forgetUnopenedConnections(t)
 }
 
 // This should return the events in the same order with events in the array
@@ -112,14 +882,40 @@ func (m *eventLogManager) expiredEvents(currtime time.Time) []*EventLog {
 	expiredevents := []*EventLog{}
 
 	for _, event := range m.events {
-		if currtime.Sub(event.tstart) >= m.timeout {
+		policy := m.expiryPolicy(event)
+		expiry := event.expiry(policy.Timeout)
+		if policy.Action == ExpiryWait {
+			expiry = maxWaitAge
+		}
+		if currtime.Sub(event.tstart) < expiry {
+			continue
+		}
+		if policy.Action == ExpiryStream {
+			event.insertResponse(currtime, "-1", " - STREAM")
+		} else if !event.tresponse.IsZero() {
+			// The response started but its stream never ended.
+			event.insertResponse(currtime, responseStatus(event), " - Response")
+		} else {
 			event.insertResponse(currtime, "-1", " - TIMEOUT")
-			expiredevents = append(expiredevents, event)
 		}
+		expiredevents = append(expiredevents, event)
 	}
 	return expiredevents
 }
 
+// expiryPolicy returns the policy of the event's method, falling back to
+// emitting it as TIMEOUT after the manager timeout.
+func (m *eventLogManager) expiryPolicy(event *EventLog) ExpiryPolicy {
+	policy, ok := matchPolicy(m.policies, event.servicename, event.methodname)
+	if !ok {
+		policy = ExpiryPolicy{Action: ExpiryTimeout}
+	}
+	if policy.Timeout == 0 {
+		policy.Timeout = m.timeout
+	}
+	return policy
+}
+
 // This should remove the records in order
 func (m *eventLogManager) removeEvents(events []*EventLog) {
 	m.mutex.Lock()
@@ -142,13 +938,28 @@ func logString(e EventLog) string {
 	if e.grpcstatuscode != "" {
 		grpcstatuscode = e.grpcstatuscode
 	}
-	return fmt.Sprintf("%s,%s,%s,%d,%s,%d,%s,%d,%s\n", e.servicename, e.methodname, e.ipsource, e.tcpsource, e.ipdest, e.tcpdest, grpcstatuscode, e.duration, e.info)
+	line := fmt.Sprintf("%s,%s,%s,%d,%s,%d,%s,%d,%s", csvField(e.servicename), csvField(e.methodname), e.ipsource, e.tcpsource, e.ipdest, e.tcpdest, grpcstatuscode, e.duration, csvField(e.info))
+	for _, column := range e.extraColumns() {
+		line += "," + csvField(column)
+	}
+	return line + "\n"
+}
+
+func (m *eventLogManager) formatEvent(e EventLog) string {
+	if m.format == nil {
+		return logString(e)
+	}
+	return m.format(e)
 }
 
 func (m *eventLogManager) printEvent(e EventLog) string {
 	if m.cidr.Contains(net.ParseIP(e.ipsource)) {
-		m.file.WriteString(logString(e))
-		return logString(e)
+		for _, sink := range m.sinks {
+			if err := sink.Write([]EventLog{e}); err != nil {
+				log.Printf("Failed to write logs: %v\n", err)
+			}
+		}
+		return m.formatEvent(e)
 	}
 	return ""
 }
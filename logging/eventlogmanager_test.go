@@ -1,10 +1,14 @@
 package logging
 
 import (
+	"github.com/abrampers/inkle/tracing"
 	"github.com/google/uuid"
 	"io/ioutil"
 	"net"
 	"os"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 )
@@ -264,6 +268,37 @@ func Test_logString(t *testing.T) {
 			},
 			want: "helloworld.Greeter,SayHello,::1,58108,::1,8000,0,50000000,Request - Response\n",
 		},
+		{
+			input: EventLog{
+				servicename:     "helloworld.Greeter",
+				methodname:      "SayHello",
+				ipsource:        "::1",
+				tcpsource:       58108,
+				ipdest:          "::1",
+				tcpdest:         8000,
+				grpcstatuscode:  "0",
+				duration:        50 * time.Millisecond,
+				info:            "Request - Response",
+				requestpayload:  `{1:"Abram"}`,
+				responsepayload: `{1:"Hello Abram"}`,
+			},
+			want: "helloworld.Greeter,SayHello,::1,58108,::1,8000,0,50000000,Request - Response,\"request_payload={1:\"\"Abram\"\"}\",\"response_payload={1:\"\"Hello Abram\"\"}\"\n",
+		},
+		{
+			input: EventLog{
+				servicename:    "helloworld.Greeter",
+				methodname:     "SayHello",
+				ipsource:       "::1",
+				tcpsource:      58108,
+				ipdest:         "::1",
+				tcpdest:        8000,
+				grpcstatuscode: "0",
+				duration:       50 * time.Millisecond,
+				info:           "Request - Response",
+				requestheaders: []string{"x-tenant-id=a,b"},
+			},
+			want: "helloworld.Greeter,SayHello,::1,58108,::1,8000,0,50000000,Request - Response,\"request_header.x-tenant-id=a,b\"\n",
+		},
 	}
 
 	for i, test := range tests {
@@ -351,6 +386,319 @@ func TestCreatePendingRequest(t *testing.T) {
 	}
 }
 
+func TestInsertPayload(t *testing.T) {
+	tests := []struct {
+		ip                         string
+		tcp                        uint16
+		isrequest                  bool
+		payload                    string
+		initialevents, finalevents []*EventLog
+	}{
+		{
+			ip:            "::1",
+			tcp:           58108,
+			isrequest:     true,
+			payload:       `{1:"Abram"}`,
+			initialevents: []*EventLog{},
+			finalevents:   []*EventLog{},
+		},
+		{
+			ip:        "::1",
+			tcp:       58108,
+			isrequest: true,
+			payload:   `{1:"Abram"}`,
+			initialevents: []*EventLog{
+				&EventLog{ipsource: "::1", tcpsource: 58107},
+				&EventLog{ipsource: "::1", tcpsource: 58108},
+			},
+			finalevents: []*EventLog{
+				&EventLog{ipsource: "::1", tcpsource: 58107},
+				&EventLog{ipsource: "::1", tcpsource: 58108, requestpayload: `{1:"Abram"}`},
+			},
+		},
+		{
+			ip:        "::1",
+			tcp:       58108,
+			isrequest: false,
+			payload:   `{1:"Hello Abram"}`,
+			initialevents: []*EventLog{
+				&EventLog{ipsource: "::1", tcpsource: 58108, requestpayload: `{1:"Abram"}`},
+			},
+			finalevents: []*EventLog{
+				&EventLog{ipsource: "::1", tcpsource: 58108, requestpayload: `{1:"Abram"}`, responsepayload: `{1:"Hello Abram"}`},
+			},
+		},
+	}
+
+	for i, test := range tests {
+		elm := &eventLogManager{events: test.initialevents}
+		if test.isrequest {
+			elm.InsertRequestPayload(test.ip, test.tcp, test.payload)
+		} else {
+			elm.InsertResponsePayload(test.ip, test.tcp, test.payload)
+		}
+		if !isEventsEqual(elm.events, test.finalevents) {
+			t.Errorf("InsertPayload (testcase %d): doesn't insert payload as expected", i)
+		}
+	}
+}
+
+func TestInsertHeaders(t *testing.T) {
+	tests := []struct {
+		ip                         string
+		tcp                        uint16
+		isrequest                  bool
+		headers                    []string
+		initialevents, finalevents []*EventLog
+	}{
+		{
+			ip:            "::1",
+			tcp:           58108,
+			isrequest:     true,
+			headers:       []string{"x-request-id=1"},
+			initialevents: []*EventLog{},
+			finalevents:   []*EventLog{},
+		},
+		{
+			ip:        "::1",
+			tcp:       58108,
+			isrequest: true,
+			headers:   []string{"x-request-id=1"},
+			initialevents: []*EventLog{
+				&EventLog{ipsource: "::1", tcpsource: 58107},
+				&EventLog{ipsource: "::1", tcpsource: 58108},
+			},
+			finalevents: []*EventLog{
+				&EventLog{ipsource: "::1", tcpsource: 58107},
+				&EventLog{ipsource: "::1", tcpsource: 58108, requestheaders: []string{"x-request-id=1"}},
+			},
+		},
+		{
+			ip:        "::1",
+			tcp:       58108,
+			isrequest: false,
+			headers:   []string{"grpc-message=ok"},
+			initialevents: []*EventLog{
+				&EventLog{ipsource: "::1", tcpsource: 58108},
+			},
+			finalevents: []*EventLog{
+				&EventLog{ipsource: "::1", tcpsource: 58108, responseheaders: []string{"grpc-message=ok"}},
+			},
+		},
+	}
+
+	for i, test := range tests {
+		elm := &eventLogManager{events: test.initialevents}
+		if test.isrequest {
+			elm.InsertRequestHeaders(test.ip, test.tcp, test.headers)
+		} else {
+			elm.InsertResponseHeaders(test.ip, test.tcp, test.headers)
+		}
+		if !isEventsEqual(elm.events, test.finalevents) {
+			t.Errorf("InsertHeaders (testcase %d): doesn't insert headers as expected", i)
+		}
+	}
+}
+
+func TestInsertMessage(t *testing.T) {
+	tests := []struct {
+		ip                         string
+		tcp                        uint16
+		isrequest                  bool
+		size, uncompressedsize     int
+		initialevents, finalevents []*EventLog
+	}{
+		{
+			ip:               "::1",
+			tcp:              58108,
+			isrequest:        true,
+			size:             7,
+			uncompressedsize: 7,
+			initialevents:    []*EventLog{},
+			finalevents:      []*EventLog{},
+		},
+		{
+			ip:               "::1",
+			tcp:              58108,
+			isrequest:        true,
+			size:             20,
+			uncompressedsize: 64,
+			initialevents: []*EventLog{
+				&EventLog{ipsource: "::1", tcpsource: 58107},
+				&EventLog{ipsource: "::1", tcpsource: 58108},
+			},
+			finalevents: []*EventLog{
+				&EventLog{ipsource: "::1", tcpsource: 58107},
+				&EventLog{ipsource: "::1", tcpsource: 58108, requestmessages: 1, requestbytes: 20, requestuncompressedbytes: 64},
+			},
+		},
+		{
+			ip:               "::1",
+			tcp:              58108,
+			isrequest:        false,
+			size:             13,
+			uncompressedsize: 13,
+			initialevents: []*EventLog{
+				&EventLog{ipsource: "::1", tcpsource: 58108},
+			},
+			finalevents: []*EventLog{
+				&EventLog{ipsource: "::1", tcpsource: 58108, responsemessages: 1, responsebytes: 13, responseuncompressedbytes: 13},
+			},
+		},
+	}
+
+	for i, test := range tests {
+		elm := &eventLogManager{events: test.initialevents}
+		if test.isrequest {
+			elm.InsertRequestMessage(test.ip, test.tcp, test.size, test.uncompressedsize)
+		} else {
+			elm.InsertResponseMessage(time.Time{}, test.ip, test.tcp, test.size, test.uncompressedsize)
+		}
+		if !isEventsEqual(elm.events, test.finalevents) {
+			t.Errorf("InsertMessage (testcase %d): doesn't count message as expected", i)
+		}
+	}
+}
+
+func TestInsertTraceContext(t *testing.T) {
+	trace := tracing.SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Sampled: tracing.SampledYes}
+	tests := []struct {
+		ip                         string
+		tcp                        uint16
+		initialevents, finalevents []*EventLog
+	}{
+		{
+			ip:            "::1",
+			tcp:           58108,
+			initialevents: []*EventLog{},
+			finalevents:   []*EventLog{},
+		},
+		{
+			ip:  "::1",
+			tcp: 58108,
+			initialevents: []*EventLog{
+				&EventLog{ipsource: "::1", tcpsource: 58107},
+				&EventLog{ipsource: "::1", tcpsource: 58108},
+			},
+			finalevents: []*EventLog{
+				&EventLog{ipsource: "::1", tcpsource: 58107},
+				&EventLog{ipsource: "::1", tcpsource: 58108, trace: trace},
+			},
+		},
+	}
+
+	for i, test := range tests {
+		elm := &eventLogManager{events: test.initialevents}
+		elm.InsertTraceContext(test.ip, test.tcp, trace)
+		if !isEventsEqual(elm.events, test.finalevents) {
+			t.Errorf("InsertTraceContext (testcase %d): doesn't insert trace context as expected", i)
+		}
+	}
+}
+
+func TestInsertDeadline(t *testing.T) {
+	tests := []struct {
+		ip                         string
+		tcp                        uint16
+		initialevents, finalevents []*EventLog
+	}{
+		{
+			ip:            "::1",
+			tcp:           58108,
+			initialevents: []*EventLog{},
+			finalevents:   []*EventLog{},
+		},
+		{
+			ip:  "::1",
+			tcp: 58108,
+			initialevents: []*EventLog{
+				&EventLog{ipsource: "::1", tcpsource: 58107},
+				&EventLog{ipsource: "::1", tcpsource: 58108},
+			},
+			finalevents: []*EventLog{
+				&EventLog{ipsource: "::1", tcpsource: 58107},
+				&EventLog{ipsource: "::1", tcpsource: 58108, deadline: 999968 * time.Microsecond, hasdeadline: true},
+			},
+		},
+	}
+
+	for i, test := range tests {
+		elm := &eventLogManager{events: test.initialevents}
+		elm.InsertDeadline(test.ip, test.tcp, 999968*time.Microsecond)
+		if !isEventsEqual(elm.events, test.finalevents) {
+			t.Errorf("InsertDeadline (testcase %d): doesn't insert deadline as expected", i)
+		}
+	}
+}
+
+func TestInsertDuplicateSegment(t *testing.T) {
+	tests := []struct {
+		ipsource, ipdest           string
+		tcpsource, tcpdest         uint16
+		initialevents, finalevents []*EventLog
+	}{
+		{
+			ipsource:      "::1",
+			tcpsource:     58108,
+			ipdest:        "::1",
+			tcpdest:       8000,
+			initialevents: []*EventLog{},
+			finalevents:   []*EventLog{},
+		},
+		{
+			ipsource:  "::1",
+			tcpsource: 58108,
+			ipdest:    "::1",
+			tcpdest:   8000,
+			initialevents: []*EventLog{
+				&EventLog{ipsource: "::1", tcpsource: 58107},
+				&EventLog{ipsource: "::1", tcpsource: 58108},
+			},
+			finalevents: []*EventLog{
+				&EventLog{ipsource: "::1", tcpsource: 58107},
+				&EventLog{ipsource: "::1", tcpsource: 58108, tcp: tcpStats{duplicatesegments: 1}},
+			},
+		},
+		{
+			ipsource:  "::1",
+			tcpsource: 8000,
+			ipdest:    "::1",
+			tcpdest:   58108,
+			initialevents: []*EventLog{
+				&EventLog{ipsource: "::1", tcpsource: 58108, tcp: tcpStats{duplicatesegments: 1}},
+			},
+			finalevents: []*EventLog{
+				&EventLog{ipsource: "::1", tcpsource: 58108, tcp: tcpStats{duplicatesegments: 2}},
+			},
+		},
+		{
+			// Every call pending on the connection overlaps the segment.
+			ipsource:  "::1",
+			tcpsource: 8000,
+			ipdest:    "::1",
+			tcpdest:   58108,
+			initialevents: []*EventLog{
+				&EventLog{ipsource: "::1", tcpsource: 58108},
+				&EventLog{ipsource: "::1", tcpsource: 58107},
+				&EventLog{ipsource: "::1", tcpsource: 58108},
+			},
+			finalevents: []*EventLog{
+				&EventLog{ipsource: "::1", tcpsource: 58108, tcp: tcpStats{duplicatesegments: 1}},
+				&EventLog{ipsource: "::1", tcpsource: 58107},
+				&EventLog{ipsource: "::1", tcpsource: 58108, tcp: tcpStats{duplicatesegments: 1}},
+			},
+		},
+	}
+
+	for i, test := range tests {
+		elm := &eventLogManager{events: test.initialevents}
+		elm.InsertDuplicateSegment(test.ipsource, test.tcpsource, test.ipdest, test.tcpdest)
+		if !isEventsEqual(elm.events, test.finalevents) {
+			t.Errorf("InsertDuplicateSegment (testcase %d): doesn't count segment as expected", i)
+		}
+	}
+}
+
 func TestInsertResponse(t *testing.T) {
 	currtime := time.Now()
 	tests := []struct {
@@ -696,6 +1044,7 @@ func Test_expiredEvents(t *testing.T) {
 	currtime := time.Now()
 	tests := []struct {
 		timeout  time.Duration
+		policies []ExpiryPolicy
 		currtime time.Time
 		events   []*EventLog
 		want     []*EventLog
@@ -809,16 +1158,173 @@ func Test_expiredEvents(t *testing.T) {
 				},
 			},
 		},
+		{
+			// Deadlines override the timeout.
+			timeout:  100 * time.Millisecond,
+			currtime: currtime,
+			events: []*EventLog{
+				&EventLog{
+					tstart:      currtime.Add(-150 * time.Millisecond),
+					info:        "Request",
+					deadline:    time.Second,
+					hasdeadline: true,
+				},
+				&EventLog{
+					tstart:      currtime.Add(-60 * time.Millisecond),
+					info:        "Request",
+					deadline:    50 * time.Millisecond,
+					hasdeadline: true,
+				},
+			},
+			want: []*EventLog{
+				&EventLog{
+					tstart:         currtime.Add(-60 * time.Millisecond),
+					tfinish:        currtime,
+					grpcstatuscode: "-1",
+					duration:       60 * time.Millisecond,
+					info:           "Request - TIMEOUT",
+					deadline:       50 * time.Millisecond,
+					hasdeadline:    true,
+				},
+			},
+		},
+		{
+			timeout: 100 * time.Millisecond,
+			policies: []ExpiryPolicy{
+				{Pattern: "batch.Batch/*", Timeout: time.Second, Action: ExpiryTimeout},
+				{Pattern: "helloworld.Greeter/*", Timeout: 50 * time.Millisecond, Action: ExpiryTimeout},
+				{Pattern: "chat.Chat/Watch", Action: ExpiryStream},
+				{Pattern: "chat.Chat/*", Action: ExpiryWait},
+			},
+			currtime: currtime,
+			events: []*EventLog{
+				&EventLog{
+					tstart:      currtime.Add(-150 * time.Millisecond),
+					servicename: "batch.Batch",
+					methodname:  "Run",
+					info:        "Request",
+				},
+				&EventLog{
+					tstart:      currtime.Add(-60 * time.Millisecond),
+					servicename: "helloworld.Greeter",
+					methodname:  "SayHello",
+					info:        "Request",
+				},
+				&EventLog{
+					tstart:      currtime.Add(-150 * time.Millisecond),
+					servicename: "chat.Chat",
+					methodname:  "Watch",
+					info:        "Request",
+				},
+				&EventLog{
+					tstart:      currtime.Add(-30 * time.Minute),
+					servicename: "chat.Chat",
+					methodname:  "Send",
+					info:        "Request",
+				},
+				&EventLog{
+					tstart:      currtime.Add(-2 * time.Hour),
+					servicename: "chat.Chat",
+					methodname:  "Join",
+					info:        "Request",
+				},
+				&EventLog{
+					tstart:      currtime.Add(-110 * time.Millisecond),
+					servicename: "datetime.Datetime",
+					methodname:  "GetDatetime",
+					info:        "Request",
+				},
+			},
+			want: []*EventLog{
+				&EventLog{
+					tstart:         currtime.Add(-60 * time.Millisecond),
+					tfinish:        currtime,
+					servicename:    "helloworld.Greeter",
+					methodname:     "SayHello",
+					grpcstatuscode: "-1",
+					duration:       60 * time.Millisecond,
+					info:           "Request - TIMEOUT",
+				},
+				&EventLog{
+					tstart:         currtime.Add(-150 * time.Millisecond),
+					tfinish:        currtime,
+					servicename:    "chat.Chat",
+					methodname:     "Watch",
+					grpcstatuscode: "-1",
+					duration:       150 * time.Millisecond,
+					info:           "Request - STREAM",
+				},
+				&EventLog{
+					tstart:         currtime.Add(-2 * time.Hour),
+					tfinish:        currtime,
+					servicename:    "chat.Chat",
+					methodname:     "Join",
+					grpcstatuscode: "-1",
+					duration:       2 * time.Hour,
+					info:           "Request - TIMEOUT",
+				},
+				&EventLog{
+					tstart:         currtime.Add(-110 * time.Millisecond),
+					tfinish:        currtime,
+					servicename:    "datetime.Datetime",
+					methodname:     "GetDatetime",
+					grpcstatuscode: "-1",
+					duration:       110 * time.Millisecond,
+					info:           "Request - TIMEOUT",
+				},
+			},
+		},
 	}
 
 	for i, test := range tests {
-		elm := &eventLogManager{timeout: test.timeout, events: test.events}
+		elm := &eventLogManager{timeout: test.timeout, policies: test.policies, events: test.events}
 		if ret := elm.expiredEvents(test.currtime); !isEventsEqual(ret, test.want) {
 			t.Errorf("expiredEvents('%v') (testcase %d): doesn't return events as expected", test.timeout, i)
 		}
 	}
 }
 
+func Test_nextCleanup(t *testing.T) {
+	currtime := time.Now()
+	tests := []struct {
+		policies []ExpiryPolicy
+		events   []*EventLog
+		want     time.Duration
+	}{
+		{
+			events: []*EventLog{},
+			want:   time.Second,
+		},
+		{
+			events: []*EventLog{
+				&EventLog{tstart: currtime.Add(-200 * time.Millisecond), servicename: "helloworld.Greeter", methodname: "SayHello"},
+				&EventLog{tstart: currtime.Add(-10 * time.Millisecond), servicename: "helloworld.Greeter", methodname: "SayHello", deadline: 50 * time.Millisecond, hasdeadline: true},
+			},
+			want: 40 * time.Millisecond,
+		},
+		{
+			events: []*EventLog{
+				&EventLog{tstart: currtime.Add(-100 * time.Millisecond), servicename: "helloworld.Greeter", methodname: "SayHello", deadline: 50 * time.Millisecond, hasdeadline: true},
+			},
+			want: 0,
+		},
+		{
+			policies: []ExpiryPolicy{{Pattern: "chat.Chat/*", Action: ExpiryWait}},
+			events: []*EventLog{
+				&EventLog{tstart: currtime.Add(-10 * time.Millisecond), servicename: "chat.Chat", methodname: "Send", deadline: 50 * time.Millisecond, hasdeadline: true},
+			},
+			want: time.Second,
+		},
+	}
+
+	for i, test := range tests {
+		elm := &eventLogManager{timeout: 10 * time.Second, tick: time.Second, policies: test.policies, events: test.events}
+		if ret := elm.nextCleanup(currtime); ret != test.want {
+			t.Errorf("nextCleanup (testcase %d): returns %v while it should be %v", i, ret, test.want)
+		}
+	}
+}
+
 func Test_removeEvents(t *testing.T) {
 	tests := []struct {
 		expiredevents, initialevents, finalevents []*EventLog
@@ -961,7 +1467,7 @@ func Test_printEvent(t *testing.T) {
 		}
 		defer f.Close()
 		defer os.Remove(f.Name())
-		elm := &eventLogManager{file: f, cidr: test.cidr}
+		elm := &eventLogManager{sinks: []Sink{NewWriterSink(f, nil)}, cidr: test.cidr}
 		elm.printEvent(test.input)
 
 		buf, err := ioutil.ReadFile(f.Name())
@@ -974,6 +1480,40 @@ func Test_printEvent(t *testing.T) {
 	}
 }
 
+func TestInFlight(t *testing.T) {
+	now := time.Date(2000, 2, 1, 12, 13, 14, 0, time.UTC)
+	events := []*EventLog{
+		NewEventLog(now, "helloworld.Greeter", "SayHello", "10.0.1.7", 58108, "10.0.0.2", 8000, ""),
+		NewEventLog(now, "helloworld.Greeter", "SayHello", "10.0.1.7", 58110, "10.0.0.2", 8000, ""),
+		NewEventLog(now, "helloworld.Greeter", "SayBye", "10.0.1.7", 58112, "10.0.0.2", 8000, ""),
+		NewEventLog(now, "helloworld.Greeter", "SayBye", "192.168.0.3", 40000, "10.0.0.2", 8000, ""),
+	}
+	tests := []struct {
+		cidr *net.IPNet
+		want map[string]int
+	}{
+		{
+			cidr: &net.IPNet{IP: net.ParseIP("0.0.0.0"), Mask: net.CIDRMask(0, 32)},
+			want: map[string]int{"helloworld.Greeter/SayHello": 2, "helloworld.Greeter/SayBye": 2},
+		},
+		{
+			cidr: &net.IPNet{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(8, 32)},
+			want: map[string]int{"helloworld.Greeter/SayHello": 2, "helloworld.Greeter/SayBye": 1},
+		},
+		{
+			cidr: &net.IPNet{},
+			want: map[string]int{},
+		},
+	}
+
+	for i, test := range tests {
+		elm := &eventLogManager{events: events, cidr: test.cidr}
+		if ret := elm.InFlight(); !reflect.DeepEqual(ret, test.want) {
+			t.Errorf("InFlight (testcase %d): returns %v while it should be %v", i, ret, test.want)
+		}
+	}
+}
+
 func Test_cleanup(t *testing.T) {
 	currtime := time.Now()
 	tests := []struct {
@@ -1101,7 +1641,7 @@ func Test_cleanup(t *testing.T) {
 		}
 		defer f.Close()
 		defer os.Remove(f.Name())
-		elm := &eventLogManager{file: f, events: test.initialevents, cidr: test.cidr}
+		elm := &eventLogManager{sinks: []Sink{NewWriterSink(f, nil)}, events: test.initialevents, cidr: test.cidr}
 		elm.cleanup(test.time)
 
 		buf, err := ioutil.ReadFile(f.Name())
@@ -1115,3 +1655,498 @@ func Test_cleanup(t *testing.T) {
 		}
 	}
 }
+
+func Test_rememberExpired(t *testing.T) {
+	currtime := time.Now()
+	tests := []struct {
+		latewindow           time.Duration
+		initialexpired, want []*EventLog
+		events               []*EventLog
+	}{
+		{
+			latewindow:     0,
+			initialexpired: []*EventLog{},
+			events:         []*EventLog{&EventLog{tfinish: currtime}},
+			want:           []*EventLog{},
+		},
+		{
+			latewindow: time.Second,
+			initialexpired: []*EventLog{
+				&EventLog{tfinish: currtime.Add(-2 * time.Second), isexpired: true},
+				&EventLog{tfinish: currtime.Add(-500 * time.Millisecond), isexpired: true},
+			},
+			events: []*EventLog{&EventLog{tfinish: currtime}},
+			want: []*EventLog{
+				&EventLog{tfinish: currtime.Add(-500 * time.Millisecond), isexpired: true},
+				&EventLog{tfinish: currtime, isexpired: true},
+			},
+		},
+	}
+
+	for i, test := range tests {
+		elm := &eventLogManager{latewindow: test.latewindow, expired: test.initialexpired}
+		elm.rememberExpired(test.events, currtime)
+		if !isEventsEqual(elm.expired, test.want) {
+			t.Errorf("rememberExpired (testcase %d): doesn't remember events as expected", i)
+		}
+	}
+}
+
+func TestLateResponse(t *testing.T) {
+	currtime := time.Now()
+	tests := []struct {
+		latewindow   time.Duration
+		responsetime time.Time
+		want         string
+	}{
+		{
+			latewindow:   0,
+			responsetime: currtime.Add(50 * time.Millisecond),
+			want: "helloworld.Greeter,SayHello,::1,58108,::1,8000,-1,25000000,Request - TIMEOUT\n" +
+				"NULL,NULL,::1,58108,::1,8000,0,0,NO_REQUEST - Response\n",
+		},
+		{
+			latewindow:   time.Second,
+			responsetime: currtime.Add(50 * time.Millisecond),
+			want: "helloworld.Greeter,SayHello,::1,58108,::1,8000,-1,25000000,Request - TIMEOUT,event_id=d96763c9-a9a4-49d0-9008-b63befa85b6d\n" +
+				"helloworld.Greeter,SayHello,::1,58108,::1,8000,0,75000000,Request - LATE_RESPONSE,timeout_event_id=d96763c9-a9a4-49d0-9008-b63befa85b6d,response_header.grpc-message=ok\n",
+		},
+		{
+			// The second cleanup forgets the expired request.
+			latewindow:   time.Second,
+			responsetime: currtime.Add(2 * time.Second),
+			want: "helloworld.Greeter,SayHello,::1,58108,::1,8000,-1,25000000,Request - TIMEOUT,event_id=d96763c9-a9a4-49d0-9008-b63befa85b6d\n" +
+				"NULL,NULL,::1,58108,::1,8000,0,0,NO_REQUEST - Response\n",
+		},
+	}
+
+	cidr := &net.IPNet{IP: net.ParseIP("::"), Mask: net.CIDRMask(0, 128)}
+	for i, test := range tests {
+		f, err := ioutil.TempFile("", "TestLateResponse*.log")
+		if err != nil {
+			t.Errorf("LateResponse (testcase %d): %v", i, err)
+		}
+		defer f.Close()
+		defer os.Remove(f.Name())
+		elm := &eventLogManager{sinks: []Sink{NewWriterSink(f, nil)}, cidr: cidr, timeout: 20 * time.Millisecond, latewindow: test.latewindow}
+		elm.addEvent(&EventLog{
+			id:          uuid.MustParse("d96763c9-a9a4-49d0-9008-b63befa85b6d"),
+			tstart:      currtime.Add(-25 * time.Millisecond),
+			servicename: "helloworld.Greeter",
+			methodname:  "SayHello",
+			ipsource:    "::1",
+			tcpsource:   58108,
+			ipdest:      "::1",
+			tcpdest:     8000,
+			info:        "Request",
+		})
+		elm.cleanup(currtime)
+		elm.cleanup(test.responsetime)
+		elm.InsertResponseHeaders("::1", 58108, []string{"grpc-message=ok"})
+		elm.InsertResponse(test.responsetime, "::1", 8000, "::1", 58108, "0")
+
+		buf, err := ioutil.ReadFile(f.Name())
+		if err != nil {
+			t.Errorf("LateResponse (testcase %d): %v", i, err)
+		}
+		if string(buf) != test.want {
+			t.Errorf("LateResponse (testcase %d): incorrect string", i)
+			t.Log(string(buf))
+		}
+		if len(elm.expired) != 0 {
+			t.Errorf("LateResponse (testcase %d): doesn't forget the expired event", i)
+		}
+	}
+}
+
+func TestInsertRequestHash(t *testing.T) {
+	elm := &eventLogManager{events: []*EventLog{&EventLog{ipsource: "::1", tcpsource: 58108}}}
+	elm.InsertRequestHash("::1", 58108, "af63bd4c8601b7be")
+	elm.InsertRequestHash("::1", 58108, "af63ad4c8601b7be")
+	elm.InsertRequestHash("::1", 58109, "af63ad4c8601b7be")
+	if want := []*EventLog{&EventLog{ipsource: "::1", tcpsource: 58108, requesthash: "af63bd4c8601b7be"}}; !isEventsEqual(elm.events, want) {
+		t.Errorf("InsertRequestHash: doesn't keep the hash of the first message")
+	}
+}
+
+func TestRetriedCall(t *testing.T) {
+	currtime := time.Now()
+	type attempt struct {
+		tcpsource        uint16
+		previousattempts int
+		tstart, tfinish  time.Time
+		grpcstatuscode   string
+	}
+	tests := []struct {
+		retrywindow time.Duration
+		attempts    []attempt
+		cleanup     time.Time
+		want        []string
+	}{
+		{
+			// Grouping is disabled.
+			attempts: []attempt{
+				{tcpsource: 58108, tstart: currtime, tfinish: currtime.Add(10 * time.Millisecond), grpcstatuscode: "14"},
+				{tcpsource: 58108, previousattempts: 1, tstart: currtime.Add(50 * time.Millisecond), tfinish: currtime.Add(60 * time.Millisecond), grpcstatuscode: "0"},
+			},
+			want: []string{
+				"helloworld.Greeter,SayHello,::1,58108,::1,8000,14,10000000,Request - Response",
+				"helloworld.Greeter,SayHello,::1,58108,::1,8000,0,10000000,Request - Response",
+			},
+		},
+		{
+			// Retry succeeding.
+			retrywindow: time.Second,
+			attempts: []attempt{
+				{tcpsource: 58108, tstart: currtime, tfinish: currtime.Add(10 * time.Millisecond), grpcstatuscode: "14"},
+				{tcpsource: 58108, previousattempts: 1, tstart: currtime.Add(50 * time.Millisecond), tfinish: currtime.Add(60 * time.Millisecond), grpcstatuscode: "0"},
+			},
+			want: []string{
+				"helloworld.Greeter,SayHello,::1,58108,::1,8000,14,10000000,Request - Response,call_id=*,attempt=1",
+				"helloworld.Greeter,SayHello,::1,58108,::1,8000,0,10000000,Request - Response,call_id=*,attempt=2",
+				"helloworld.Greeter,SayHello,::1,58108,::1,8000,0,60000000,CALL,call_id=*,attempts=2",
+			},
+		},
+		{
+			// Hedged attempts, the second one wins.
+			retrywindow: time.Second,
+			attempts: []attempt{
+				{tcpsource: 58108, tstart: currtime, tfinish: currtime.Add(90 * time.Millisecond), grpcstatuscode: "1"},
+				{tcpsource: 58109, previousattempts: 1, tstart: currtime.Add(20 * time.Millisecond), tfinish: currtime.Add(80 * time.Millisecond), grpcstatuscode: "0"},
+			},
+			want: []string{
+				"helloworld.Greeter,SayHello,::1,58109,::1,8000,0,60000000,Request - Response,call_id=*,attempt=2",
+				"helloworld.Greeter,SayHello,::1,58108,::1,8000,0,80000000,CALL,call_id=*,attempts=2",
+				"helloworld.Greeter,SayHello,::1,58108,::1,8000,1,90000000,Request - Response,call_id=*,attempt=1",
+			},
+		},
+		{
+			// Retries failing are settled after the retry window.
+			retrywindow: time.Second,
+			attempts: []attempt{
+				{tcpsource: 58108, tstart: currtime, tfinish: currtime.Add(10 * time.Millisecond), grpcstatuscode: "14"},
+				{tcpsource: 58109, previousattempts: 1, tstart: currtime.Add(50 * time.Millisecond), tfinish: currtime.Add(60 * time.Millisecond), grpcstatuscode: "14"},
+			},
+			cleanup: currtime.Add(2 * time.Second),
+			want: []string{
+				"helloworld.Greeter,SayHello,::1,58108,::1,8000,14,10000000,Request - Response,call_id=*,attempt=1",
+				"helloworld.Greeter,SayHello,::1,58109,::1,8000,14,10000000,Request - Response,call_id=*,attempt=2",
+				"helloworld.Greeter,SayHello,::1,58108,::1,8000,14,60000000,CALL,call_id=*,attempts=2",
+			},
+		},
+		{
+			// Calls without retry aren't printed twice.
+			retrywindow: time.Second,
+			attempts: []attempt{
+				{tcpsource: 58108, tstart: currtime, tfinish: currtime.Add(10 * time.Millisecond), grpcstatuscode: "14"},
+			},
+			cleanup: currtime.Add(2 * time.Second),
+			want: []string{
+				"helloworld.Greeter,SayHello,::1,58108,::1,8000,14,10000000,Request - Response,call_id=*,attempt=1",
+			},
+		},
+	}
+
+	cidr := &net.IPNet{IP: net.ParseIP("::"), Mask: net.CIDRMask(0, 128)}
+	for i, test := range tests {
+		f, err := ioutil.TempFile("", "TestRetriedCall*.log")
+		if err != nil {
+			t.Errorf("RetriedCall (testcase %d): %v", i, err)
+		}
+		defer f.Close()
+		defer os.Remove(f.Name())
+		elm := &eventLogManager{sinks: []Sink{NewWriterSink(f, nil)}, cidr: cidr, timeout: time.Hour, retrywindow: test.retrywindow}
+
+		// Requests and responses are replayed in the order of their time.
+		type step struct {
+			t         time.Time
+			isrequest bool
+			attempt   attempt
+		}
+		steps := []step{}
+		for _, attempt := range test.attempts {
+			steps = append(steps, step{attempt.tstart, true, attempt}, step{attempt.tfinish, false, attempt})
+		}
+		sort.SliceStable(steps, func(a, b int) bool { return steps[a].t.Before(steps[b].t) })
+		for _, step := range steps {
+			if step.isrequest {
+				elm.CreatePendingRequest(step.t, "helloworld.Greeter", "SayHello", "::1", step.attempt.tcpsource, "::1", 8000)
+				elm.InsertAttempt("::1", step.attempt.tcpsource, step.attempt.previousattempts)
+			} else {
+				elm.InsertResponse(step.t, "::1", 8000, "::1", step.attempt.tcpsource, step.attempt.grpcstatuscode)
+			}
+		}
+		if !test.cleanup.IsZero() {
+			elm.cleanup(test.cleanup)
+		}
+
+		buf, err := ioutil.ReadFile(f.Name())
+		if err != nil {
+			t.Errorf("RetriedCall (testcase %d): %v", i, err)
+		}
+		lines := strings.Split(strings.TrimSuffix(string(buf), "\n"), "\n")
+		callid := ""
+		for j, line := range lines {
+			// Call IDs are random, but the same for all attempts.
+			if idx := strings.Index(line, "call_id="); idx != -1 {
+				id := line[idx+len("call_id=") : idx+len("call_id=")+36]
+				if callid != "" && id != callid {
+					t.Errorf("RetriedCall (testcase %d): attempts have different call IDs", i)
+				}
+				callid = id
+				lines[j] = strings.Replace(line, id, "*", 1)
+			}
+		}
+		if !reflect.DeepEqual(lines, test.want) {
+			t.Errorf("RetriedCall (testcase %d): incorrect string", i)
+			t.Log(strings.Join(lines, "\n"))
+		}
+	}
+}
+
+func TestConnectionLifecycle(t *testing.T) {
+	currtime := time.Now()
+	tests := []struct {
+		goaway string
+		want   string
+	}{
+		{
+			goaway: "",
+			want:   ",rpcs=3,peak_streams=2,close_reason=FIN\n",
+		},
+		{
+			goaway: "ENHANCE_YOUR_CALM",
+			want:   ",rpcs=3,peak_streams=2,close_reason=GOAWAY_ENHANCE_YOUR_CALM\n",
+		},
+	}
+
+	cidr := &net.IPNet{IP: net.ParseIP("::"), Mask: net.CIDRMask(0, 128)}
+	for i, test := range tests {
+		f, err := ioutil.TempFile("", "TestConnectionLifecycle*.log")
+		if err != nil {
+			t.Errorf("ConnectionLifecycle (testcase %d): %v", i, err)
+		}
+		defer f.Close()
+		defer os.Remove(f.Name())
+		elm := &eventLogManager{sinks: []Sink{NewWriterSink(f, nil)}, cidr: cidr}
+		if ret := elm.OpenConnection(currtime, "::1", 58108, "::1", 8000); !strings.Contains(ret, "CONNECTION_OPEN") {
+			t.Errorf("OpenConnection (testcase %d): returns '%s' while it should open the connection", i, ret)
+		}
+		if ret := elm.OpenConnection(currtime, "::1", 58108, "::1", 8000); ret != "" {
+			t.Errorf("OpenConnection (testcase %d): returns '%s' for a connection already open", i, ret)
+		}
+		elm.CreatePendingRequest(currtime, "helloworld.Greeter", "SayHello", "::1", 58108, "::1", 8000)
+		elm.InsertStream(currtime, "::1", 58108, "::1", 8000, 1)
+		elm.InsertStream(currtime, "::1", 58108, "::1", 8000, 3)
+		if elm.events[0].connectionid != elm.connections[0].id {
+			t.Errorf("InsertStream (testcase %d): doesn't attach the connection to the request", i)
+		}
+		// Ending the stream from the client only half closes it.
+		elm.EndStream(currtime, "::1", 58108, "::1", 8000, 3, false)
+		elm.EndStream(currtime, "::1", 8000, "::1", 58108, 1, false)
+		elm.EndStream(currtime, "::1", 58108, "::1", 8000, 3, true)
+		elm.InsertStream(currtime, "::1", 58108, "::1", 8000, 5)
+		if test.goaway != "" {
+			elm.InsertGoAway("::1", 8000, "::1", 58108, test.goaway)
+		}
+
+		ret := elm.CloseConnection(currtime.Add(time.Second), "::1", 8000, "::1", 58108, "FIN")
+		if !strings.HasPrefix(ret, "NULL,NULL,::1,58108,::1,8000,-1,1000000000,CONNECTION_CLOSE,") || !strings.HasSuffix(ret, test.want) {
+			t.Errorf("CloseConnection (testcase %d): returns incorrect log line '%s'", i, ret)
+		}
+		if len(elm.connections) != 0 {
+			t.Errorf("CloseConnection (testcase %d): doesn't forget the connection", i)
+		}
+		if ret := elm.CloseConnection(currtime.Add(time.Second), "::1", 8000, "::1", 58108, "FIN"); ret != "" {
+			t.Errorf("CloseConnection (testcase %d): returns '%s' for a closed connection", i, ret)
+		}
+	}
+}
+
+func TestConnectionFollowedFromSyn(t *testing.T) {
+	currtime := time.Now()
+	cidr := &net.IPNet{IP: net.ParseIP("::"), Mask: net.CIDRMask(0, 128)}
+	f, err := ioutil.TempFile("", "TestConnectionFollowedFromSyn*.log")
+	if err != nil {
+		t.Errorf("ConnectionFollowedFromSyn: %v", err)
+	}
+	defer f.Close()
+	defer os.Remove(f.Name())
+	elm := &eventLogManager{sinks: []Sink{NewWriterSink(f, nil)}, cidr: cidr}
+
+	// A connection which doesn't carry HTTP/2 isn't printed.
+	elm.FollowConnection(currtime, "::1", 58107, "::1", 9200)
+	if ret := elm.CloseConnection(currtime.Add(time.Second), "::1", 9200, "::1", 58107, "FIN"); ret != "" {
+		t.Errorf("CloseConnection: returns '%s' for a connection which doesn't carry HTTP/2", ret)
+	}
+	elm.FollowConnection(currtime, "::1", 58106, "::1", 9200)
+	elm.cleanup(currtime.Add(maxUnopenedAge))
+	if len(elm.connections) != 0 {
+		t.Errorf("cleanup: follows %d connections while it should forget the one without HTTP/2", len(elm.connections))
+	}
+
+	elm.FollowConnection(currtime, "::1", 58108, "::1", 8000)
+	elm.InsertHandshake(currtime, "::1", 58108, "::1", 8000, true, false)
+	elm.InsertHandshake(currtime.Add(time.Millisecond), "::1", 8000, "::1", 58108, true, true)
+	elm.InsertHandshake(currtime.Add(2*time.Millisecond), "::1", 58108, "::1", 8000, false, true)
+	want := "NULL,NULL,::1,58108,::1,8000,-1,0,CONNECTION_OPEN,connection_id=" + elm.connections[0].id.String() + "\n"
+	if ret := elm.InsertSettings(currtime.Add(3*time.Millisecond), "::1", 8000, "::1", 58108, map[string]uint32{"MAX_CONCURRENT_STREAMS": 100}); ret != want {
+		t.Errorf("InsertSettings: returns '%s' while it should be '%s'", ret, want)
+	}
+	if ret := elm.OpenConnection(currtime.Add(3*time.Millisecond), "::1", 58108, "::1", 8000); ret != "" {
+		t.Errorf("OpenConnection: returns '%s' for a connection already open", ret)
+	}
+	if ret := elm.CloseConnection(currtime.Add(time.Second), "::1", 8000, "::1", 58108, "FIN"); !strings.Contains(ret, ",CONNECTION_CLOSE,") {
+		t.Errorf("CloseConnection: returns incorrect log line '%s'", ret)
+	}
+}
+
+func TestConnectionSettingsPings(t *testing.T) {
+	currtime := time.Now()
+	cidr := &net.IPNet{IP: net.ParseIP("::"), Mask: net.CIDRMask(0, 128)}
+	f, err := ioutil.TempFile("", "TestConnectionSettingsPings*.log")
+	if err != nil {
+		t.Errorf("ConnectionSettingsPings: %v", err)
+	}
+	defer f.Close()
+	defer os.Remove(f.Name())
+	elm := &eventLogManager{sinks: []Sink{NewWriterSink(f, nil)}, cidr: cidr}
+
+	elm.OpenConnection(currtime, "::1", 58108, "::1", 8000)
+	elm.InsertSettings(currtime, "::1", 8000, "::1", 58108, map[string]uint32{"MAX_CONCURRENT_STREAMS": 1})
+	elm.InsertSettings(currtime, "::1", 58108, "::1", 8000, map[string]uint32{"INITIAL_WINDOW_SIZE": 65535})
+	elm.InsertPing(currtime, "::1", 58108, "::1", 8000, 42, false)
+	elm.InsertPing(currtime.Add(2*time.Millisecond), "::1", 8000, "::1", 58108, 42, true)
+	if ret := elm.InsertStream(currtime, "::1", 58108, "::1", 8000, 1); !strings.Contains(ret, ",STREAMS_SATURATED,") || !strings.HasSuffix(ret, ",max_concurrent_streams=1\n") {
+		t.Errorf("InsertStream: returns '%s' while it should report the saturation", ret)
+	}
+	elm.EndStream(currtime.Add(time.Second), "::1", 8000, "::1", 58108, 1, false)
+
+	want := ",server_max_concurrent_streams=1,client_initial_window_size=65535,pings=1,ping_rtt_min=2ms,ping_rtt_max=2ms,saturations=1,saturated_time=1s\n"
+	if ret := elm.CloseConnection(currtime.Add(2*time.Second), "::1", 58108, "::1", 8000, "FIN"); !strings.HasSuffix(ret, want) {
+		t.Errorf("CloseConnection: returns incorrect log line '%s'", ret)
+	}
+}
+
+func TestFlowControlStall(t *testing.T) {
+	currtime := time.Now()
+	cidr := &net.IPNet{IP: net.ParseIP("::"), Mask: net.CIDRMask(0, 128)}
+	f, err := ioutil.TempFile("", "TestFlowControlStall*.log")
+	if err != nil {
+		t.Errorf("FlowControlStall: %v", err)
+	}
+	defer f.Close()
+	defer os.Remove(f.Name())
+	elm := &eventLogManager{sinks: []Sink{NewWriterSink(f, nil)}, cidr: cidr, timeout: time.Minute, stallthreshold: time.Second}
+
+	elm.OpenConnection(currtime, "::1", 58108, "::1", 8000)
+	elm.CreatePendingRequest(currtime, "helloworld.Greeter", "SayHello", "::1", 58108, "::1", 8000)
+	elm.InsertStream(currtime, "::1", 58108, "::1", 8000, 1)
+	elm.StartResponse(currtime.Add(time.Second), "::1", 8000, "::1", 58108, "-1")
+	elm.InsertData(currtime.Add(time.Second), "::1", 8000, "::1", 58108, map[uint32]int{1: 65535})
+	elm.cleanup(currtime.Add(1500 * time.Millisecond))
+	elm.cleanup(currtime.Add(2500 * time.Millisecond))
+	elm.cleanup(currtime.Add(3 * time.Second))
+	if ret := elm.InsertWindowUpdate(currtime.Add(4*time.Second), "::1", 58108, "::1", 8000, map[uint32]int{0: 65535, 1: 65535}); ret != "" {
+		t.Errorf("InsertWindowUpdate: returns '%s' for a stall already reported", ret)
+	}
+	elm.InsertTrailers(currtime.Add(5*time.Second), "::1", 58108, "0")
+	elm.EndStream(currtime.Add(5*time.Second), "::1", 8000, "::1", 58108, 1, false)
+
+	buf, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Errorf("FlowControlStall: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(buf), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("FlowControlStall: prints %d lines while it should be 3", len(lines))
+	}
+	connectionid := "connection_id=" + elm.connections[0].id.String()
+	if want := "NULL,NULL,::1,58108,::1,8000,-1,1500000000,FLOW_CONTROL_STALL," + connectionid + ",stream_id=1,blocked_sender=server"; lines[1] != want {
+		t.Errorf("FlowControlStall: prints '%s' while it should be '%s'", lines[1], want)
+	}
+	if want := "helloworld.Greeter,SayHello,::1,58108,::1,8000,0,1000000000,Request - Response," + connectionid + ",flow_control_blocked=3s"; lines[2] != want {
+		t.Errorf("FlowControlStall: prints '%s' while it should be '%s'", lines[2], want)
+	}
+}
+
+func TestTCPHealth(t *testing.T) {
+	currtime := time.Now()
+	cidr := &net.IPNet{IP: net.ParseIP("::"), Mask: net.CIDRMask(0, 128)}
+	f, err := ioutil.TempFile("", "TestTCPHealth*.log")
+	if err != nil {
+		t.Errorf("TCPHealth: %v", err)
+	}
+	defer f.Close()
+	defer os.Remove(f.Name())
+	elm := &eventLogManager{sinks: []Sink{NewWriterSink(f, nil)}, cidr: cidr, timeout: time.Minute}
+
+	elm.OpenConnection(currtime, "::1", 58108, "::1", 8000)
+	elm.InsertHandshake(currtime, "::1", 58108, "::1", 8000, true, false)
+	elm.InsertHandshake(currtime.Add(time.Millisecond), "::1", 8000, "::1", 58108, true, true)
+	elm.InsertHandshake(currtime.Add(3*time.Millisecond), "::1", 58108, "::1", 8000, false, true)
+	elm.InsertHandshake(currtime.Add(5*time.Millisecond), "::1", 58108, "::1", 8000, false, true)
+	// Segments before the call aren't counted on it.
+	elm.InsertDuplicateAck("::1", 8000, "::1", 58108)
+	elm.CreatePendingRequest(currtime, "helloworld.Greeter", "SayHello", "::1", 58108, "::1", 8000)
+	elm.InsertStream(currtime, "::1", 58108, "::1", 8000, 1)
+	elm.InsertDuplicateAck("::1", 58108, "::1", 8000)
+	elm.InsertZeroWindow("::1", 8000, "::1", 58108)
+	elm.InsertDuplicateSegment("::1", 8000, "::1", 58108)
+
+	connectionid := "connection_id=" + elm.connections[0].id.String()
+	want := "helloworld.Greeter,SayHello,::1,58108,::1,8000,0,10000000,Request - Response," + connectionid + ",duplicate_segments=1,dup_acks=1,zero_windows=1,handshake_rtt=3ms\n"
+	if ret := elm.InsertResponse(currtime.Add(10*time.Millisecond), "::1", 8000, "::1", 58108, "0"); ret != want {
+		t.Errorf("InsertResponse: returns '%s' while it should be '%s'", ret, want)
+	}
+	want = "rpcs=1,peak_streams=1,close_reason=FIN,duplicate_segments=1,dup_acks=2,zero_windows=1,handshake_rtt=3ms\n"
+	if ret := elm.CloseConnection(currtime.Add(time.Second), "::1", 8000, "::1", 58108, "FIN"); !strings.HasSuffix(ret, want) {
+		t.Errorf("CloseConnection: returns incorrect log line '%s'", ret)
+	}
+}
+
+func TestFlowControlBlockedStream(t *testing.T) {
+	currtime := time.Now()
+	cidr := &net.IPNet{IP: net.ParseIP("::"), Mask: net.CIDRMask(0, 128)}
+	f, err := ioutil.TempFile("", "TestFlowControlBlockedStream*.log")
+	if err != nil {
+		t.Errorf("FlowControlBlockedStream: %v", err)
+	}
+	defer f.Close()
+	defer os.Remove(f.Name())
+	elm := &eventLogManager{sinks: []Sink{NewWriterSink(f, nil)}, cidr: cidr, timeout: time.Minute, stallthreshold: time.Minute}
+
+	// Two RPCs multiplexed on a connection, the second one blocked by flow
+	// control after its response HEADERS until the WINDOW_UPDATE of the
+	// client.
+	elm.OpenConnection(currtime, "::1", 58108, "::1", 8000)
+	elm.CreatePendingRequest(currtime, "helloworld.Greeter", "SayHello", "::1", 58108, "::1", 8000)
+	elm.InsertStream(currtime, "::1", 58108, "::1", 8000, 1)
+	elm.CreatePendingRequest(currtime, "helloworld.Greeter", "SayHello", "::1", 58108, "::1", 8000)
+	elm.InsertStream(currtime, "::1", 58108, "::1", 8000, 3)
+	elm.StartResponse(currtime.Add(100*time.Millisecond), "::1", 8000, "::1", 58108, "-1")
+	elm.StartResponse(currtime.Add(100*time.Millisecond), "::1", 8000, "::1", 58108, "-1")
+	elm.InsertData(currtime.Add(100*time.Millisecond), "::1", 8000, "::1", 58108, map[uint32]int{1: 12})
+	elm.InsertTrailers(currtime.Add(200*time.Millisecond), "::1", 58108, "0")
+	elm.EndStream(currtime.Add(200*time.Millisecond), "::1", 8000, "::1", 58108, 1, false)
+	elm.InsertData(currtime.Add(300*time.Millisecond), "::1", 8000, "::1", 58108, map[uint32]int{3: 65523})
+	elm.InsertWindowUpdate(currtime.Add(1300*time.Millisecond), "::1", 58108, "::1", 8000, map[uint32]int{0: 65535, 3: 65535})
+	elm.InsertTrailers(currtime.Add(2*time.Second), "::1", 58108, "0")
+	elm.EndStream(currtime.Add(2*time.Second), "::1", 8000, "::1", 58108, 3, false)
+
+	buf, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Errorf("FlowControlBlockedStream: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(buf), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("FlowControlBlockedStream: prints %d lines while it should be 3", len(lines))
+	}
+	connectionid := "connection_id=" + elm.connections[0].id.String()
+	if want := "helloworld.Greeter,SayHello,::1,58108,::1,8000,0,100000000,Request - Response," + connectionid; lines[1] != want {
+		t.Errorf("FlowControlBlockedStream: prints '%s' while it should be '%s'", lines[1], want)
+	}
+	if want := "helloworld.Greeter,SayHello,::1,58108,::1,8000,0,100000000,Request - Response," + connectionid + ",flow_control_blocked=1s"; lines[2] != want {
+		t.Errorf("FlowControlBlockedStream: prints '%s' while it should be '%s'", lines[2], want)
+	}
+}
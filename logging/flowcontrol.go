@@ -0,0 +1,130 @@
+package logging
+
+import (
+	"sort"
+	"time"
+)
+
+// Initial flow-control window of HTTP/2 connections and streams.
+const initialWindowSize = 65535
+
+// flowControl follows the flow-control windows granted to one end of a
+// connection by the other, which block its DATA frames once exhausted.
+type flowControl struct {
+	window int
+	// initial is the window of new streams, from the INITIAL_WINDOW_SIZE
+	// setting of the other end.
+	initial int
+	streams map[uint32]*streamFlow
+}
+
+type streamFlow struct {
+	window int
+	// tblocked is set while the stream can't send, blocked the time it
+	// spent so.
+	tblocked time.Time
+	blocked  time.Duration
+	warned   bool
+}
+
+// flowStall is a stream blocked by flow control.
+type flowStall struct {
+	streamid uint32
+	blocked  time.Duration
+}
+
+func newFlowControl() *flowControl {
+	return &flowControl{window: initialWindowSize, initial: initialWindowSize, streams: map[uint32]*streamFlow{}}
+}
+
+func (f *flowControl) stream(streamid uint32) *streamFlow {
+	stream, ok := f.streams[streamid]
+	if !ok {
+		stream = &streamFlow{window: f.initial}
+		f.streams[streamid] = stream
+	}
+	return stream
+}
+
+// setInitialWindow applies a new INITIAL_WINDOW_SIZE to the windows of the
+// open streams.
+func (f *flowControl) setInitialWindow(timestamp time.Time, initial int, threshold time.Duration) []flowStall {
+	delta := initial - f.initial
+	f.initial = initial
+	for _, stream := range f.streams {
+		stream.window += delta
+	}
+	return f.unblock(timestamp, threshold)
+}
+
+// data consumes the windows of streamid with size bytes of DATA.
+func (f *flowControl) data(timestamp time.Time, streamid uint32, size int) {
+	stream := f.stream(streamid)
+	f.window -= size
+	stream.window -= size
+	if stream.tblocked.IsZero() && (f.window <= 0 || stream.window <= 0) {
+		stream.tblocked = timestamp
+	}
+}
+
+// windowUpdate grows the window of streamid, or of the connection for stream
+// 0, and returns the stalls of the streams it unblocks longer than threshold
+// which weren't warned about yet.
+func (f *flowControl) windowUpdate(timestamp time.Time, streamid uint32, increment int, threshold time.Duration) []flowStall {
+	if streamid == 0 {
+		f.window += increment
+	} else {
+		f.stream(streamid).window += increment
+	}
+	return f.unblock(timestamp, threshold)
+}
+
+func (f *flowControl) unblock(timestamp time.Time, threshold time.Duration) []flowStall {
+	stalls := []flowStall{}
+	for streamid, stream := range f.streams {
+		if stream.tblocked.IsZero() || f.window <= 0 || stream.window <= 0 {
+			continue
+		}
+		blocked := timestamp.Sub(stream.tblocked)
+		stream.blocked += blocked
+		stream.tblocked = time.Time{}
+		if threshold > 0 && blocked > threshold && !stream.warned {
+			stalls = append(stalls, flowStall{streamid, blocked})
+		}
+		stream.warned = false
+	}
+	sortStalls(stalls)
+	return stalls
+}
+
+// stalls returns the streams blocked longer than threshold at currtime,
+// which weren't warned about yet.
+func (f *flowControl) stalls(currtime time.Time, threshold time.Duration) []flowStall {
+	stalls := []flowStall{}
+	for streamid, stream := range f.streams {
+		if stream.tblocked.IsZero() || stream.warned || currtime.Sub(stream.tblocked) <= threshold {
+			continue
+		}
+		stream.warned = true
+		stalls = append(stalls, flowStall{streamid, currtime.Sub(stream.tblocked)})
+	}
+	sortStalls(stalls)
+	return stalls
+}
+
+func sortStalls(stalls []flowStall) {
+	sort.Slice(stalls, func(i, j int) bool { return stalls[i].streamid < stalls[j].streamid })
+}
+
+// endStream forgets streamid and returns the time it was blocked.
+func (f *flowControl) endStream(timestamp time.Time, streamid uint32) time.Duration {
+	stream, ok := f.streams[streamid]
+	if !ok {
+		return 0
+	}
+	delete(f.streams, streamid)
+	if !stream.tblocked.IsZero() {
+		return stream.blocked + timestamp.Sub(stream.tblocked)
+	}
+	return stream.blocked
+}
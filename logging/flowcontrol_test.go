@@ -0,0 +1,83 @@
+package logging
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFlowControl(t *testing.T) {
+	currtime := time.Now()
+	tests := []struct {
+		// Each step sends size bytes of DATA on streamid, or a WINDOW_UPDATE
+		// of increment.
+		streamid  uint32
+		size      int
+		increment int
+		want      []flowStall
+	}{
+		{streamid: 1, size: 40000},
+		// The connection window is exhausted, blocking stream 3.
+		{streamid: 3, size: 25535},
+		{streamid: 1, increment: 10000},
+		// Stream 3 is still blocked by the connection window.
+		{streamid: 3, increment: 25535},
+		{streamid: 0, increment: 65535, want: []flowStall{{3, 3 * time.Second}}},
+		// Stream 1 exhausts its own window, the connection has room left.
+		{streamid: 1, size: 35535},
+		{streamid: 1, increment: 100},
+	}
+
+	flow := newFlowControl()
+	for i, test := range tests {
+		timestamp := currtime.Add(time.Duration(i) * time.Second)
+		var ret []flowStall
+		if test.increment > 0 {
+			ret = flow.windowUpdate(timestamp, test.streamid, test.increment, 1500*time.Millisecond)
+		} else {
+			flow.data(timestamp, test.streamid, test.size)
+		}
+		if len(test.want) > 0 && !reflect.DeepEqual(ret, test.want) {
+			t.Errorf("windowUpdate (testcase %d): returns %v while it should be %v", i, ret, test.want)
+		} else if len(test.want) == 0 && len(ret) > 0 {
+			t.Errorf("windowUpdate (testcase %d): returns %v while it should be empty", i, ret)
+		}
+	}
+
+	end := currtime.Add(10 * time.Second)
+	if ret := flow.endStream(end, 1); ret != time.Second {
+		t.Errorf("endStream: returns %v for stream 1 while it should be 1s", ret)
+	}
+	if ret := flow.endStream(end, 3); ret != 3*time.Second {
+		t.Errorf("endStream: returns %v for stream 3 while it should be 3s", ret)
+	}
+	if len(flow.streams) != 0 {
+		t.Errorf("endStream: doesn't forget the streams")
+	}
+}
+
+func Test_flowStalls(t *testing.T) {
+	currtime := time.Now()
+	flow := newFlowControl()
+	flow.setInitialWindow(currtime, 100, 0)
+	flow.data(currtime, 1, 100)
+	flow.data(currtime, 3, 50)
+
+	if ret := flow.stalls(currtime.Add(time.Second), time.Second); len(ret) != 0 {
+		t.Errorf("stalls: returns %v before the threshold", ret)
+	}
+	if ret, want := flow.stalls(currtime.Add(2*time.Second), time.Second), []flowStall{{1, 2 * time.Second}}; !reflect.DeepEqual(ret, want) {
+		t.Errorf("stalls: returns %v while it should be %v", ret, want)
+	}
+	// Stalls are only reported once.
+	if ret := flow.stalls(currtime.Add(3*time.Second), time.Second); len(ret) != 0 {
+		t.Errorf("stalls: returns %v for a stall already reported", ret)
+	}
+	// A larger INITIAL_WINDOW_SIZE unblocks the stream.
+	if ret := flow.setInitialWindow(currtime.Add(4*time.Second), 200, time.Second); len(ret) != 0 {
+		t.Errorf("setInitialWindow: returns %v for a stall already reported", ret)
+	}
+	if flow.streams[1].window != 100 || !flow.streams[1].tblocked.IsZero() || flow.streams[1].blocked != 4*time.Second {
+		t.Errorf("setInitialWindow: doesn't unblock the stream")
+	}
+}
@@ -0,0 +1,123 @@
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Formats of the logs.
+const (
+	FormatCSV    = "csv"
+	FormatJSON   = "json"
+	FormatLogfmt = "logfmt"
+	FormatPretty = "pretty"
+)
+
+// Templates of the logfmt and pretty formats, executed against the Record of
+// each event.
+const (
+	logfmtTemplate = `schema_version={{.SchemaVersion}} event_id={{.EventID}}` +
+		`{{with .StartTime}} start_time={{.Format "2006-01-02T15:04:05.999999999Z07:00"}}{{end}}` +
+		`{{with .EndTime}} end_time={{.Format "2006-01-02T15:04:05.999999999Z07:00"}}{{end}}` +
+		`{{with .Service}} service={{logfmt .}}{{end}}{{with .Method}} method={{logfmt .}}{{end}}` +
+		` src_ip={{.Source.IP}} src_port={{.Source.Port}} dst_ip={{.Destination.IP}} dst_port={{.Destination.Port}}` +
+		`{{with .Status}} status_code={{.Code}} status={{.Name}}{{end}}` +
+		` duration_ms={{.DurationMs}} info={{logfmt .Info}}` +
+		`{{with .Fields}}{{range $key, $value := .Attributes}} {{$key}}={{logfmt $value}}{{end}}{{end}}`
+	prettyTemplate = `{{with .EndTime}}{{.Format "15:04:05.000"}}{{else}}{{printf "%-12s" "-"}}{{end}}` +
+		` {{with .Status}}{{printf "%-19s" .Name}}{{else}}{{printf "%-19s" "-"}}{{end}}` +
+		` {{printf "%10.3fms" .DurationMs}}` +
+		`  {{.Source.IP}}:{{.Source.Port}} -> {{.Destination.IP}}:{{.Destination.Port}}` +
+		`  {{if .Service}}{{.Service}}/{{.Method}}{{else}}-{{end}}  {{.Info}}` +
+		`{{with .Fields}}{{range $key, $value := .Attributes}}` + "\n    " + `{{$key}}: {{$value}}{{end}}{{end}}`
+)
+
+// Formatter returns the line of the logs of an event.
+type Formatter func(e EventLog) string
+
+// templateFuncs are the functions available to the templates of -format.
+var templateFuncs = template.FuncMap{
+	"csv":    csvLine,
+	"logfmt": logfmtValue,
+}
+
+// ParseFormat returns the formatter of the format named s, or of the Go
+// text/template s executed against the Record of each event, e.g.
+// `{{.Service}}/{{.Method}} {{.DurationMs}}`.
+func ParseFormat(s string) (Formatter, error) {
+	switch s {
+	case FormatCSV:
+		return logString, nil
+	case FormatJSON:
+		return jsonString, nil
+	case FormatLogfmt:
+		return parseTemplate(logfmtTemplate)
+	case FormatPretty:
+		return parseTemplate(prettyTemplate)
+	}
+	if !strings.Contains(s, "{{") {
+		return nil, fmt.Errorf("Unknown log format %s", s)
+	}
+	return parseTemplate(s)
+}
+
+func parseTemplate(text string) (Formatter, error) {
+	tmpl, err := template.New("format").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid log format template: %v", err)
+	}
+	// Fields misspelled in the template only fail on execution, so it is tried
+	// on a record having all of them.
+	now := time.Now()
+	if err := tmpl.Execute(ioutil.Discard, Record{StartTime: &now, EndTime: &now, Status: &Status{}}); err != nil {
+		return nil, fmt.Errorf("Invalid log format template: %v", err)
+	}
+	return func(e EventLog) string {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, e.Record()); err != nil {
+			return ""
+		}
+		if buf.Len() == 0 || buf.Bytes()[buf.Len()-1] != '\n' {
+			buf.WriteByte('\n')
+		}
+		return buf.String()
+	}, nil
+}
+
+// csvField quotes field as of RFC 4180 when it contains a comma, a double
+// quote or a line break.
+func csvField(field string) string {
+	if !strings.ContainsAny(field, ",\"\r\n") {
+		return field
+	}
+	return `"` + strings.Replace(field, `"`, `""`, -1) + `"`
+}
+
+// csvLine joins fields into a line of CSV, for templates choosing their own
+// columns.
+func csvLine(fields ...interface{}) string {
+	line := make([]string, len(fields))
+	for i, field := range fields {
+		line[i] = csvField(fmt.Sprint(field))
+	}
+	return strings.Join(line, ",")
+}
+
+// logfmtValue quotes value when it is empty or contains spaces, equal signs,
+// double quotes or control characters.
+func logfmtValue(value string) string {
+	if value == "" {
+		return `""`
+	}
+	for _, r := range value {
+		if r <= ' ' || r == '=' || r == '"' || r == 0x7f {
+			return strconv.Quote(value)
+		}
+	}
+	return value
+}
@@ -0,0 +1,124 @@
+package logging
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestParseFormat(t *testing.T) {
+	tfinish := time.Date(2020, 4, 1, 10, 30, 0, 0, time.UTC)
+	event := EventLog{
+		id:             uuid.MustParse("d96763c9-a9a4-49d0-9008-b63befa85b6d"),
+		tfinish:        tfinish,
+		servicename:    "helloworld.Greeter",
+		methodname:     "SayHello",
+		ipsource:       "::1",
+		tcpsource:      58108,
+		ipdest:         "::1",
+		tcpdest:        8000,
+		grpcstatuscode: "4",
+		duration:       1500 * time.Microsecond,
+		info:           "Request - Response",
+		requestheaders: []string{"x-tenant-id=a b"},
+	}
+	tests := []struct {
+		input string
+		want  string
+		ok    bool
+	}{
+		{
+			input: "csv",
+			want:  logString(event),
+			ok:    true,
+		},
+		{
+			input: "json",
+			want:  jsonString(event),
+			ok:    true,
+		},
+		{
+			input: "logfmt",
+			want: `schema_version=1 event_id=d96763c9-a9a4-49d0-9008-b63befa85b6d end_time=2020-04-01T10:30:00Z service=helloworld.Greeter method=SayHello ` +
+				`src_ip=::1 src_port=58108 dst_ip=::1 dst_port=8000 status_code=4 status=DEADLINE_EXCEEDED duration_ms=1.5 info="Request - Response" request_headers.x-tenant-id="a b"` + "\n",
+			ok: true,
+		},
+		{
+			input: "pretty",
+			want:  "10:30:00.000 DEADLINE_EXCEEDED        1.500ms  ::1:58108 -> ::1:8000  helloworld.Greeter/SayHello  Request - Response\n    request_headers.x-tenant-id: a b\n",
+			ok:    true,
+		},
+		{
+			input: `{{csv .Info .Service .Method .DurationMs}}`,
+			want:  "Request - Response,helloworld.Greeter,SayHello,1.5\n",
+			ok:    true,
+		},
+		{
+			input: "{{.Service}}/{{.Method}} {{.Status.Code}}\n",
+			want:  "helloworld.Greeter/SayHello 4\n",
+			ok:    true,
+		},
+		{
+			input: "xml",
+			ok:    false,
+		},
+		{
+			input: "{{.Service",
+			ok:    false,
+		},
+		{
+			input: "{{.Nonexistent}}",
+			ok:    false,
+		},
+	}
+
+	for i, test := range tests {
+		ret, err := ParseFormat(test.input)
+		if test.ok && err != nil {
+			t.Errorf("ParseFormat(%s) (testcase %d): returns err = '%v', where there should be no error", test.input, i, err)
+		} else if !test.ok && err == nil {
+			t.Errorf("ParseFormat(%s) (testcase %d): returns no err, where there should be error", test.input, i)
+		} else if test.ok && ret(event) != test.want {
+			t.Errorf("ParseFormat(%s) (testcase %d): formats '%s' while it should be '%s'", test.input, i, ret(event), test.want)
+		}
+	}
+}
+
+func Test_csvField(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "Request - Response", want: "Request - Response"},
+		{input: "request_header.x-tenant-id=a,b", want: `"request_header.x-tenant-id=a,b"`},
+		{input: `request_payload={1:"Abram"}`, want: `"request_payload={1:""Abram""}"`},
+		{input: "response_header.grpc-message=a\nb", want: "\"response_header.grpc-message=a\nb\""},
+		{input: "", want: ""},
+	}
+
+	for i, test := range tests {
+		if ret := csvField(test.input); ret != test.want {
+			t.Errorf("csvField (testcase %d): returns '%s' while it should be '%s'", i, ret, test.want)
+		}
+	}
+}
+
+func Test_logfmtValue(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "SayHello", want: "SayHello"},
+		{input: "Request - Response", want: `"Request - Response"`},
+		{input: "a=b", want: `"a=b"`},
+		{input: `{1:"Abram"}`, want: `"{1:\"Abram\"}"`},
+		{input: "", want: `""`},
+	}
+
+	for i, test := range tests {
+		if ret := logfmtValue(test.input); ret != test.want {
+			t.Errorf("logfmtValue (testcase %d): returns '%s' while it should be '%s'", i, ret, test.want)
+		}
+	}
+}
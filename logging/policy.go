@@ -0,0 +1,85 @@
+package logging
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// Actions taken on a pending request which got no response before its
+// expiry.
+const (
+	// ExpiryTimeout emits the request as TIMEOUT.
+	ExpiryTimeout = "timeout"
+	// ExpiryWait keeps waiting for the response, up to maxWaitAge.
+	ExpiryWait = "wait"
+	// ExpiryStream emits the request as an open STREAM, for long-lived
+	// streaming calls whose response isn't expected before the expiry.
+	ExpiryStream = "stream"
+)
+
+// maxWaitAge bounds how long requests of the wait action are kept, after which
+// they're emitted as TIMEOUT all the same.
+const maxWaitAge = time.Hour
+
+// ExpiryPolicy sets how long the requests of methods matching Pattern, a
+// service/method glob, wait for a response and what happens then. A zero
+// Timeout falls back to the manager timeout.
+type ExpiryPolicy struct {
+	Pattern string
+	Timeout time.Duration
+	Action  string
+}
+
+// ParseExpiryPolicies parses comma separated pattern=timeout[:action] items,
+// e.g. "helloworld.Greeter/*=100ms,batch.Batch/*=30s,chat.Chat/Watch=stream".
+// Either the timeout or the action may be left out.
+func ParseExpiryPolicies(s string) ([]ExpiryPolicy, error) {
+	policies := []ExpiryPolicy{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		idx := strings.LastIndex(item, "=")
+		if idx <= 0 {
+			return nil, fmt.Errorf("Invalid expiry policy %s", item)
+		}
+		policy := ExpiryPolicy{Pattern: item[:idx], Action: ExpiryTimeout}
+		if _, err := path.Match(policy.Pattern, ""); err != nil {
+			return nil, fmt.Errorf("Invalid expiry policy pattern %s", policy.Pattern)
+		}
+		for _, value := range strings.Split(item[idx+1:], ":") {
+			switch value {
+			case ExpiryTimeout, ExpiryWait, ExpiryStream:
+				policy.Action = value
+			default:
+				timeout, err := time.ParseDuration(value)
+				if err != nil || timeout <= 0 {
+					return nil, fmt.Errorf("Invalid expiry policy timeout %s", value)
+				}
+				policy.Timeout = timeout
+			}
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+// matchPolicy returns the first policy matching servicename/methodname.
+func matchPolicy(policies []ExpiryPolicy, servicename string, methodname string) (ExpiryPolicy, bool) {
+	for _, policy := range policies {
+		if matchMethod(policy.Pattern, servicename, methodname) {
+			return policy, true
+		}
+	}
+	return ExpiryPolicy{}, false
+}
+
+// matchMethod reports whether servicename/methodname matches the glob
+// pattern, e.g. "helloworld.Greeter/*" or "*/Get*". utils.MatchMethod isn't
+// used so that logging doesn't depend on pcap.
+func matchMethod(pattern string, servicename string, methodname string) bool {
+	ok, _ := path.Match(pattern, servicename+"/"+methodname)
+	return ok
+}
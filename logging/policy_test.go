@@ -0,0 +1,103 @@
+package logging
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseExpiryPolicies(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []ExpiryPolicy
+		ok    bool
+	}{
+		{
+			input: "",
+			want:  []ExpiryPolicy{},
+			ok:    true,
+		},
+		{
+			input: "helloworld.Greeter/*=100ms, batch.Batch/*=30s:wait,chat.Chat/Watch=stream",
+			want: []ExpiryPolicy{
+				{Pattern: "helloworld.Greeter/*", Timeout: 100 * time.Millisecond, Action: ExpiryTimeout},
+				{Pattern: "batch.Batch/*", Timeout: 30 * time.Second, Action: ExpiryWait},
+				{Pattern: "chat.Chat/Watch", Action: ExpiryStream},
+			},
+			ok: true,
+		},
+		{
+			input: "*/Get*=timeout:2s",
+			want:  []ExpiryPolicy{{Pattern: "*/Get*", Timeout: 2 * time.Second, Action: ExpiryTimeout}},
+			ok:    true,
+		},
+		{
+			input: "helloworld.Greeter/*",
+			ok:    false,
+		},
+		{
+			input: "=100ms",
+			ok:    false,
+		},
+		{
+			input: "helloworld.Greeter/*=forever",
+			ok:    false,
+		},
+		{
+			input: "helloworld.Greeter/*=-1s",
+			ok:    false,
+		},
+		{
+			input: "[helloworld/*=1s",
+			ok:    false,
+		},
+	}
+
+	for i, test := range tests {
+		ret, err := ParseExpiryPolicies(test.input)
+		if test.ok && err != nil {
+			t.Errorf("ParseExpiryPolicies(%s) (testcase %d): returns err = '%v', where there should be no error", test.input, i, err)
+		} else if !test.ok && err == nil {
+			t.Errorf("ParseExpiryPolicies(%s) (testcase %d): returns no err, where there should be error", test.input, i)
+		} else if test.ok && !reflect.DeepEqual(ret, test.want) {
+			t.Errorf("ParseExpiryPolicies(%s) (testcase %d): returns %v while it should be %v", test.input, i, ret, test.want)
+		}
+	}
+}
+
+func Test_matchPolicy(t *testing.T) {
+	policies := []ExpiryPolicy{
+		{Pattern: "helloworld.Greeter/SayHello", Timeout: time.Second, Action: ExpiryTimeout},
+		{Pattern: "helloworld.Greeter/*", Action: ExpiryWait},
+	}
+	tests := []struct {
+		servicename, methodname string
+		want                    ExpiryPolicy
+		ok                      bool
+	}{
+		{
+			servicename: "helloworld.Greeter",
+			methodname:  "SayHello",
+			want:        policies[0],
+			ok:          true,
+		},
+		{
+			servicename: "helloworld.Greeter",
+			methodname:  "SayGoodbye",
+			want:        policies[1],
+			ok:          true,
+		},
+		{
+			servicename: "datetime.Datetime",
+			methodname:  "GetDatetime",
+			ok:          false,
+		},
+	}
+
+	for i, test := range tests {
+		ret, ok := matchPolicy(policies, test.servicename, test.methodname)
+		if ret != test.want || ok != test.ok {
+			t.Errorf("matchPolicy (testcase %d): returns (%v, %t) while it should be (%v, %t)", i, ret, ok, test.want, test.ok)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abrampers/inkle/tracing"
+	"github.com/google/uuid"
+)
+
+// SchemaVersion is the version of the fields of Record, bumped when they
+// change incompatibly.
+const SchemaVersion = 1
+
+// Record is an event as written by the json format, one object per line.
+// The optional columns of the event are in Fields.
+type Record struct {
+	SchemaVersion int        `json:"schema_version"`
+	EventID       string     `json:"event_id"`
+	StartTime     *time.Time `json:"start_time,omitempty"`
+	EndTime       *time.Time `json:"end_time,omitempty"`
+	Service       string     `json:"service,omitempty"`
+	Method        string     `json:"method,omitempty"`
+	Source        Endpoint   `json:"source"`
+	Destination   Endpoint   `json:"destination"`
+	Status        *Status    `json:"status,omitempty"`
+	DurationMs    float64    `json:"duration_ms"`
+	Info          string     `json:"info"`
+	Fields        *Fields    `json:"fields,omitempty"`
+}
+
+// Fields are the optional columns of an event, only set when they're known.
+// Durations are in milliseconds.
+type Fields struct {
+	// TimeoutEventID links a late response to the event of its TIMEOUT.
+	TimeoutEventID string `json:"timeout_event_id,omitempty"`
+	ConnectionID   string `json:"connection_id,omitempty"`
+
+	// RPCs, PeakStreams, CloseReason, the SETTINGS of both ends by lowercase
+	// name, pings and saturations are set on the event closing a connection.
+	RPCs            *int              `json:"rpcs,omitempty"`
+	PeakStreams     *int              `json:"peak_streams,omitempty"`
+	CloseReason     string            `json:"close_reason,omitempty"`
+	ServerSettings  map[string]uint32 `json:"server_settings,omitempty"`
+	ClientSettings  map[string]uint32 `json:"client_settings,omitempty"`
+	Pings           int               `json:"pings,omitempty"`
+	PingRTTMinMs    *float64          `json:"ping_rtt_min_ms,omitempty"`
+	PingRTTMaxMs    *float64          `json:"ping_rtt_max_ms,omitempty"`
+	Saturations     int               `json:"saturations,omitempty"`
+	SaturatedTimeMs *float64          `json:"saturated_time_ms,omitempty"`
+	// MaxConcurrentStreams is set on the event of a saturated connection.
+	MaxConcurrentStreams int `json:"max_concurrent_streams,omitempty"`
+
+	// StreamID is the stream of an RPC, or of a flow-control stall along
+	// with the side whose window blocked it.
+	StreamID             uint32   `json:"stream_id,omitempty"`
+	BlockedSender        string   `json:"blocked_sender,omitempty"`
+	FlowControlBlockedMs *float64 `json:"flow_control_blocked_ms,omitempty"`
+
+	// CallID groups the attempts of a retried call, numbered by Attempt.
+	// Attempts is only set on the event of the call.
+	CallID   string `json:"call_id,omitempty"`
+	Attempt  int    `json:"attempt,omitempty"`
+	Attempts int    `json:"attempts,omitempty"`
+
+	TraceID      string `json:"trace_id,omitempty"`
+	SpanID       string `json:"span_id,omitempty"`
+	ParentSpanID string `json:"parent_span_id,omitempty"`
+	TraceSampled *bool  `json:"trace_sampled,omitempty"`
+	TraceState   string `json:"trace_state,omitempty"`
+
+	// DeadlineMs is the grpc-timeout of the request, DeadlineUsedPercent the
+	// part of it the call took.
+	DeadlineMs          *float64 `json:"deadline_ms,omitempty"`
+	DeadlineUsedPercent *float64 `json:"deadline_used_percent,omitempty"`
+	DeadlineExceeded    bool     `json:"deadline_exceeded,omitempty"`
+
+	PhaseUploadMs       *float64 `json:"phase_upload_ms,omitempty"`
+	PhaseServerMs       *float64 `json:"phase_server_ms,omitempty"`
+	PhaseFirstMessageMs *float64 `json:"phase_first_message_ms,omitempty"`
+	PhaseTrailersMs     *float64 `json:"phase_trailers_ms,omitempty"`
+
+	DuplicateSegments int      `json:"duplicate_segments,omitempty"`
+	DupAcks           int      `json:"dup_acks,omitempty"`
+	ZeroWindows       int      `json:"zero_windows,omitempty"`
+	HandshakeRTTMs    *float64 `json:"handshake_rtt_ms,omitempty"`
+
+	// The sizes of the messages are in bytes, on the wire and after the
+	// grpc-encoding decompression.
+	RequestMessages           *int `json:"request_messages,omitempty"`
+	RequestBytes              *int `json:"request_bytes,omitempty"`
+	RequestUncompressedBytes  *int `json:"request_uncompressed_bytes,omitempty"`
+	ResponseMessages          *int `json:"response_messages,omitempty"`
+	ResponseBytes             *int `json:"response_bytes,omitempty"`
+	ResponseUncompressedBytes *int `json:"response_uncompressed_bytes,omitempty"`
+
+	// RequestHeaders and ResponseHeaders are the captured headers by name.
+	RequestHeaders  map[string]string `json:"request_headers,omitempty"`
+	ResponseHeaders map[string]string `json:"response_headers,omitempty"`
+	RequestPayload  string            `json:"request_payload,omitempty"`
+	ResponsePayload string            `json:"response_payload,omitempty"`
+}
+
+// Endpoint is the IP address and TCP port of one end of a call.
+type Endpoint struct {
+	IP   string `json:"ip"`
+	Port uint16 `json:"port"`
+}
+
+// Status is the gRPC status of a call, e.g. 4 and DEADLINE_EXCEEDED.
+type Status struct {
+	Code int    `json:"code"`
+	Name string `json:"name"`
+}
+
+var statusNames = []string{
+	"OK",
+	"CANCELLED",
+	"UNKNOWN",
+	"INVALID_ARGUMENT",
+	"DEADLINE_EXCEEDED",
+	"NOT_FOUND",
+	"ALREADY_EXISTS",
+	"PERMISSION_DENIED",
+	"RESOURCE_EXHAUSTED",
+	"FAILED_PRECONDITION",
+	"ABORTED",
+	"OUT_OF_RANGE",
+	"UNIMPLEMENTED",
+	"INTERNAL",
+	"UNAVAILABLE",
+	"DATA_LOSS",
+	"UNAUTHENTICATED",
+}
+
+// Record returns the fields of the event. Events without a status, e.g.
+// timed out requests, have a nil Status.
+func (e EventLog) Record() Record {
+	r := Record{
+		SchemaVersion: SchemaVersion,
+		EventID:       e.id.String(),
+		Source:        Endpoint{e.ipsource, e.tcpsource},
+		Destination:   Endpoint{e.ipdest, e.tcpdest},
+		DurationMs:    float64(e.duration) / float64(time.Millisecond),
+		Info:          e.info,
+	}
+	if !e.tstart.IsZero() {
+		tstart := e.tstart.UTC()
+		r.StartTime = &tstart
+	}
+	if !e.tfinish.IsZero() {
+		tfinish := e.tfinish.UTC()
+		r.EndTime = &tfinish
+	}
+	if e.servicename != "NULL" {
+		r.Service, r.Method = e.servicename, e.methodname
+	}
+	if code, err := strconv.Atoi(e.grpcstatuscode); err == nil && code >= 0 {
+		r.Status = &Status{Code: code, Name: "UNKNOWN"}
+		if code < len(statusNames) {
+			r.Status.Name = statusNames[code]
+		}
+	}
+	if fields := e.fields(); !reflect.DeepEqual(fields, Fields{}) {
+		r.Fields = &fields
+	}
+	return r
+}
+
+// Records returns the records of events.
+func Records(events []EventLog) []Record {
+	records := make([]Record, len(events))
+	for i, e := range events {
+		records[i] = e.Record()
+	}
+	return records
+}
+
+// fields returns the optional columns of the event, as extraColumns does.
+func (e EventLog) fields() Fields {
+	f := Fields{
+		TimeoutEventID:       idString(e.timeouteventid),
+		ConnectionID:         idString(e.connectionid),
+		MaxConcurrentStreams: e.maxstreams,
+		StreamID:             e.streamid,
+		BlockedSender:        e.blockedsender,
+		FlowControlBlockedMs: milliseconds(e.flowblocked),
+		CallID:               idString(e.callid),
+		Attempt:              e.attempt,
+		Attempts:             e.attempts,
+		DuplicateSegments:    e.tcp.duplicatesegments,
+		DupAcks:              e.tcp.dupacks,
+		ZeroWindows:          e.tcp.zerowindows,
+		HandshakeRTTMs:       milliseconds(e.tcp.handshakertt),
+		RequestHeaders:       headerMap(e.requestheaders),
+		ResponseHeaders:      headerMap(e.responseheaders),
+		RequestPayload:       e.requestpayload,
+		ResponsePayload:      e.responsepayload,
+	}
+	if e.closereason != "" {
+		rpcs, peakstreams := e.rpcs, e.peakstreams
+		f.RPCs, f.PeakStreams, f.CloseReason = &rpcs, &peakstreams, e.closereason
+		f.ServerSettings, f.ClientSettings = settingsMap(e.serversettings), settingsMap(e.clientsettings)
+		if e.pings > 0 {
+			f.Pings = e.pings
+			f.PingRTTMinMs, f.PingRTTMaxMs = durationMs(e.pingrttmin), durationMs(e.pingrttmax)
+		}
+		if e.saturations > 0 {
+			f.Saturations, f.SaturatedTimeMs = e.saturations, durationMs(e.saturatedtime)
+		}
+	}
+	if e.trace.TraceID != "" {
+		f.TraceID, f.SpanID, f.ParentSpanID, f.TraceState = e.trace.TraceID, e.trace.SpanID, e.trace.ParentSpanID, e.trace.TraceState
+		if e.trace.Sampled != tracing.SampledUnknown {
+			sampled := e.trace.Sampled == tracing.SampledYes
+			f.TraceSampled = &sampled
+		}
+	}
+	if e.hasdeadline {
+		f.DeadlineMs = durationMs(e.deadline)
+		if !e.tfinish.IsZero() && e.deadline > 0 {
+			used := float64(e.duration) / float64(e.deadline) * 100
+			f.DeadlineUsedPercent = &used
+		}
+		f.DeadlineExceeded = e.deadlineexceeded
+	}
+	if !e.tfinish.IsZero() {
+		if !e.trequestend.IsZero() {
+			f.PhaseUploadMs = durationMs(e.trequestend.Sub(e.tstart))
+			if !e.tresponse.IsZero() {
+				f.PhaseServerMs = durationMs(e.tresponse.Sub(e.trequestend))
+			}
+		}
+		if !e.tresponse.IsZero() && !e.tfirstmessage.IsZero() {
+			f.PhaseFirstMessageMs = durationMs(e.tfirstmessage.Sub(e.tresponse))
+		}
+		if !e.tlastmessage.IsZero() && !e.ttrailers.IsZero() {
+			f.PhaseTrailersMs = durationMs(e.ttrailers.Sub(e.tlastmessage))
+		}
+	}
+	if e.requestmessages > 0 {
+		messages, size, uncompressed := e.requestmessages, e.requestbytes, e.requestuncompressedbytes
+		f.RequestMessages, f.RequestBytes, f.RequestUncompressedBytes = &messages, &size, &uncompressed
+	}
+	if e.responsemessages > 0 {
+		messages, size, uncompressed := e.responsemessages, e.responsebytes, e.responseuncompressedbytes
+		f.ResponseMessages, f.ResponseBytes, f.ResponseUncompressedBytes = &messages, &size, &uncompressed
+	}
+	return f
+}
+
+// Attributes returns the set fields by their JSON name, as strings, the
+// ones of objects named by the field and their key, e.g.
+// request_headers.x-request-id.
+func (f *Fields) Attributes() map[string]string {
+	attributes := map[string]string{}
+	if f == nil {
+		return attributes
+	}
+	data, err := json.Marshal(f)
+	if err != nil {
+		return attributes
+	}
+	values := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return attributes
+	}
+	flattenAttributes(attributes, "", values)
+	return attributes
+}
+
+func flattenAttributes(attributes map[string]string, prefix string, values map[string]interface{}) {
+	for key, value := range values {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			flattenAttributes(attributes, prefix+key+".", v)
+		case string:
+			attributes[prefix+key] = v
+		case json.Number:
+			attributes[prefix+key] = v.String()
+		case bool:
+			attributes[prefix+key] = strconv.FormatBool(v)
+		}
+	}
+}
+
+// durationMs returns d in milliseconds.
+func durationMs(d time.Duration) *float64 {
+	ms := float64(d) / float64(time.Millisecond)
+	return &ms
+}
+
+// milliseconds returns d in milliseconds, nil if it isn't positive.
+func milliseconds(d time.Duration) *float64 {
+	if d <= 0 {
+		return nil
+	}
+	return durationMs(d)
+}
+
+func idString(id uuid.UUID) string {
+	if id == uuid.Nil {
+		return ""
+	}
+	return id.String()
+}
+
+// headerMap returns the captured name=value headers by name.
+func headerMap(headers []string) map[string]string {
+	if len(headers) == 0 {
+		return nil
+	}
+	m := map[string]string{}
+	for _, header := range headers {
+		idx := strings.Index(header, "=")
+		m[header[:idx]] = header[idx+1:]
+	}
+	return m
+}
+
+// settingsMap returns the logged SETTINGS parameters by lowercase name.
+func settingsMap(settings map[string]uint32) map[string]uint32 {
+	m := map[string]uint32{}
+	for _, name := range loggedSettings {
+		if value, ok := settings[name]; ok {
+			m[strings.ToLower(name)] = value
+		}
+	}
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
+
+// IsServerSide returns whether the call was captured on the node of its
+// server, from local, the network of the captured device.
+func (r Record) IsServerSide(local *net.IPNet) bool {
+	return local != nil && local.Contains(net.ParseIP(r.Destination.IP))
+}
+
+// Peer returns the other end of the call, seen from the node it was captured
+// on.
+func (r Record) Peer(local *net.IPNet) Endpoint {
+	if r.IsServerSide(local) {
+		return r.Source
+	}
+	return r.Destination
+}
+
+func jsonString(e EventLog) string {
+	line, err := json.Marshal(e.Record())
+	if err != nil {
+		return ""
+	}
+	return string(line) + "\n"
+}
@@ -0,0 +1,172 @@
+package logging
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRecord(t *testing.T) {
+	tstart := time.Date(2020, 4, 1, 10, 30, 0, 0, time.UTC)
+	tfinish := tstart.Add(161626 * time.Microsecond)
+	id := uuid.MustParse("d96763c9-a9a4-49d0-9008-b63befa85b6d")
+	deadline, used, upload, messages, size := 100.0, 161.626, 0.5, 1, 7
+	tests := []struct {
+		event EventLog
+		want  Record
+	}{
+		{
+			event: EventLog{
+				id:             id,
+				tstart:         tstart,
+				tfinish:        tfinish,
+				servicename:    "helloworld.Greeter",
+				methodname:     "SayHello",
+				ipsource:       "::1",
+				tcpsource:      58108,
+				ipdest:         "::1",
+				tcpdest:        8000,
+				grpcstatuscode: "4",
+				duration:       161626 * time.Microsecond,
+				info:           "Request - Response",
+				deadline:       100 * time.Millisecond,
+				hasdeadline:    true,
+			},
+			want: Record{
+				SchemaVersion: SchemaVersion,
+				EventID:       "d96763c9-a9a4-49d0-9008-b63befa85b6d",
+				StartTime:     &tstart,
+				EndTime:       &tfinish,
+				Service:       "helloworld.Greeter",
+				Method:        "SayHello",
+				Source:        Endpoint{"::1", 58108},
+				Destination:   Endpoint{"::1", 8000},
+				Status:        &Status{4, "DEADLINE_EXCEEDED"},
+				DurationMs:    161.626,
+				Info:          "Request - Response",
+				Fields:        &Fields{DeadlineMs: &deadline, DeadlineUsedPercent: &used},
+			},
+		},
+		{
+			event: EventLog{
+				id:             id,
+				tfinish:        tfinish,
+				servicename:    "NULL",
+				methodname:     "NULL",
+				ipsource:       "::1",
+				tcpsource:      58108,
+				ipdest:         "::1",
+				tcpdest:        8000,
+				grpcstatuscode: "-1",
+				info:           "NO_REQUEST - Response",
+			},
+			want: Record{
+				SchemaVersion: SchemaVersion,
+				EventID:       "d96763c9-a9a4-49d0-9008-b63befa85b6d",
+				EndTime:       &tfinish,
+				Source:        Endpoint{"::1", 58108},
+				Destination:   Endpoint{"::1", 8000},
+				Info:          "NO_REQUEST - Response",
+			},
+		},
+		{
+			// Expired events don't repeat their ID in the fields.
+			event: EventLog{
+				id:                       id,
+				tstart:                   tstart,
+				tfinish:                  tfinish,
+				servicename:              "helloworld.Greeter",
+				methodname:               "SayHello",
+				grpcstatuscode:           "-1",
+				info:                     "Request - TIMEOUT",
+				isexpired:                true,
+				trequestend:              tstart.Add(500 * time.Microsecond),
+				streamid:                 1,
+				requestmessages:          1,
+				requestbytes:             7,
+				requestuncompressedbytes: 7,
+			},
+			want: Record{
+				SchemaVersion: SchemaVersion,
+				EventID:       "d96763c9-a9a4-49d0-9008-b63befa85b6d",
+				StartTime:     &tstart,
+				EndTime:       &tfinish,
+				Service:       "helloworld.Greeter",
+				Method:        "SayHello",
+				Info:          "Request - TIMEOUT",
+				Fields:        &Fields{StreamID: 1, PhaseUploadMs: &upload, RequestMessages: &messages, RequestBytes: &size, RequestUncompressedBytes: &size},
+			},
+		},
+		{
+			event: EventLog{id: id, grpcstatuscode: "42"},
+			want:  Record{SchemaVersion: SchemaVersion, EventID: "d96763c9-a9a4-49d0-9008-b63befa85b6d", Status: &Status{42, "UNKNOWN"}},
+		},
+	}
+
+	for i, test := range tests {
+		if ret := test.event.Record(); !reflect.DeepEqual(ret, test.want) {
+			t.Errorf("Record (testcase %d): returns %+v while it should be %+v", i, ret, test.want)
+		}
+	}
+}
+
+func Test_jsonString(t *testing.T) {
+	tstart := time.Date(2020, 4, 1, 10, 30, 0, 0, time.FixedZone("WIB", 7*60*60))
+	event := EventLog{
+		id:             uuid.MustParse("d96763c9-a9a4-49d0-9008-b63befa85b6d"),
+		tstart:         tstart,
+		tfinish:        tstart.Add(1500 * time.Microsecond),
+		servicename:    "helloworld.Greeter",
+		methodname:     "SayHello",
+		ipsource:       "::1",
+		tcpsource:      58108,
+		ipdest:         "::1",
+		tcpdest:        8000,
+		grpcstatuscode: "0",
+		duration:       1500 * time.Microsecond,
+		info:           "Request - Response",
+		requestheaders: []string{"x-request-id=a,b"},
+		deadline:       1500 * time.Microsecond,
+		hasdeadline:    true,
+	}
+	want := `{"schema_version":1,"event_id":"d96763c9-a9a4-49d0-9008-b63befa85b6d","start_time":"2020-04-01T03:30:00Z","end_time":"2020-04-01T03:30:00.0015Z",` +
+		`"service":"helloworld.Greeter","method":"SayHello","source":{"ip":"::1","port":58108},"destination":{"ip":"::1","port":8000},` +
+		`"status":{"code":0,"name":"OK"},"duration_ms":1.5,"info":"Request - Response","fields":{"deadline_ms":1.5,"deadline_used_percent":100,"request_headers":{"x-request-id":"a,b"}}}` + "\n"
+	if ret := jsonString(event); ret != want {
+		t.Errorf("jsonString: returns '%s' while it should be '%s'", ret, want)
+	}
+}
+
+func TestFieldsAttributes(t *testing.T) {
+	rtt, sampled := 1.25, true
+	tests := []struct {
+		fields *Fields
+		want   map[string]string
+	}{
+		{fields: nil, want: map[string]string{}},
+		{
+			fields: &Fields{
+				RequestHeaders: map[string]string{"x-request-id": "a,b"},
+				ServerSettings: map[string]uint32{"max_concurrent_streams": 100},
+				HandshakeRTTMs: &rtt,
+				TraceSampled:   &sampled,
+				Attempt:        2,
+			},
+			want: map[string]string{
+				"request_headers.x-request-id":           "a,b",
+				"server_settings.max_concurrent_streams": "100",
+				"handshake_rtt_ms":                       "1.25",
+				"trace_sampled":                          "true",
+				"attempt":                                "2",
+			},
+		},
+	}
+
+	for i, test := range tests {
+		if ret := test.fields.Attributes(); !reflect.DeepEqual(ret, test.want) {
+			t.Errorf("Attributes (testcase %d): returns %v while it should be %v", i, ret, test.want)
+		}
+	}
+}
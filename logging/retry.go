@@ -0,0 +1,111 @@
+package logging
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// logicalCall groups the attempts of a call retried or hedged by the client,
+// which are sent as separate RPCs.
+type logicalCall struct {
+	id          uuid.UUID
+	servicename string
+	methodname  string
+	ipsource    string
+	tcpsource   uint16
+	ipdest      string
+	tcpdest     uint16
+	// requesthash is the hash of the first request message of the first
+	// attempt, empty if it isn't known.
+	requesthash string
+
+	tstart, tlast, tfinish time.Time
+	// attempts is the number of attempts seen, lastattempt the highest
+	// attempt number.
+	attempts, lastattempt, finished int
+	grpcstatuscode                  string
+}
+
+func newLogicalCall(event *EventLog) *logicalCall {
+	return &logicalCall{
+		id:          uuid.New(),
+		servicename: event.servicename,
+		methodname:  event.methodname,
+		ipsource:    event.ipsource,
+		tcpsource:   event.tcpsource,
+		requesthash: event.requesthash,
+		tstart:      event.tstart,
+	}
+}
+
+// isMatchingAttempt reports whether event, the attempt following
+// previousattempts attempts, may belong to the call.
+func (c *logicalCall) isMatchingAttempt(event *EventLog, previousattempts int, window time.Duration) bool {
+	if c.ipsource != event.ipsource || c.servicename != event.servicename || c.methodname != event.methodname {
+		return false
+	}
+	if c.lastattempt > previousattempts || event.tstart.Sub(c.tlast) > window {
+		return false
+	}
+	return c.requesthash == "" || event.requesthash == "" || c.requesthash == event.requesthash
+}
+
+func (c *logicalCall) insertAttempt(event *EventLog, attempt int) {
+	c.attempts++
+	if attempt > c.lastattempt {
+		c.lastattempt = attempt
+	}
+	c.tlast = event.tstart
+	event.callid = c.id
+	event.attempt = attempt
+}
+
+func (c *logicalCall) finishAttempt(event *EventLog) {
+	c.finished++
+	c.ipdest = event.ipdest
+	c.tcpdest = event.tcpdest
+	c.grpcstatuscode = event.grpcstatuscode
+	if event.tfinish.After(c.tfinish) {
+		c.tfinish = event.tfinish
+	}
+}
+
+// isSettled reports whether the call won't get another attempt: one of them
+// succeeded, or none started or finished for window, whether the pending
+// ones ever finish or not.
+func (c *logicalCall) isSettled(currtime time.Time, window time.Duration) bool {
+	if c.grpcstatuscode == "0" {
+		return true
+	}
+	last := c.tlast
+	if c.tfinish.After(last) {
+		last = c.tfinish
+	}
+	return currtime.Sub(last) >= window
+}
+
+// eventLog returns the event of the call, spanning all of its attempts.
+func (c *logicalCall) eventLog() EventLog {
+	tfinish, grpcstatuscode := c.tfinish, c.grpcstatuscode
+	// Calls settled before any attempt finished are logged as timeouts.
+	if c.finished == 0 {
+		tfinish, grpcstatuscode = c.tlast, "-1"
+	}
+	return EventLog{
+		id:             c.id,
+		tstart:         c.tstart,
+		tfinish:        tfinish,
+		servicename:    c.servicename,
+		methodname:     c.methodname,
+		ipsource:       c.ipsource,
+		tcpsource:      c.tcpsource,
+		ipdest:         c.ipdest,
+		tcpdest:        c.tcpdest,
+		grpcstatuscode: grpcstatuscode,
+		duration:       tfinish.Sub(c.tstart),
+		info:           "CALL",
+		callid:         c.id,
+		attempts:       c.attempts,
+	}
+}
@@ -0,0 +1,163 @@
+package logging
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func Test_isMatchingAttempt(t *testing.T) {
+	currtime := time.Now()
+	call := &logicalCall{
+		servicename: "helloworld.Greeter",
+		methodname:  "SayHello",
+		ipsource:    "::1",
+		requesthash: "af63bd4c8601b7be",
+		tlast:       currtime,
+		attempts:    1,
+		lastattempt: 1,
+	}
+	tests := []struct {
+		event            EventLog
+		previousattempts int
+		want             bool
+	}{
+		{
+			event:            EventLog{servicename: "helloworld.Greeter", methodname: "SayHello", ipsource: "::1", tstart: currtime.Add(100 * time.Millisecond)},
+			previousattempts: 1,
+			want:             true,
+		},
+		{
+			event:            EventLog{servicename: "helloworld.Greeter", methodname: "SayHello", ipsource: "::1", tstart: currtime.Add(100 * time.Millisecond), requesthash: "af63bd4c8601b7be"},
+			previousattempts: 1,
+			want:             true,
+		},
+		{
+			event:            EventLog{servicename: "helloworld.Greeter", methodname: "SayHello", ipsource: "::1", tstart: currtime.Add(100 * time.Millisecond), requesthash: "af63ad4c8601b7be"},
+			previousattempts: 1,
+			want:             false,
+		},
+		{
+			event:            EventLog{servicename: "helloworld.Greeter", methodname: "SayHello", ipsource: "::1", tstart: currtime.Add(2 * time.Second)},
+			previousattempts: 1,
+			want:             false,
+		},
+		{
+			event:            EventLog{servicename: "helloworld.Greeter", methodname: "SayHello", ipsource: "::2", tstart: currtime.Add(100 * time.Millisecond)},
+			previousattempts: 1,
+			want:             false,
+		},
+		{
+			event:            EventLog{servicename: "helloworld.Greeter", methodname: "SayGoodbye", ipsource: "::1", tstart: currtime.Add(100 * time.Millisecond)},
+			previousattempts: 1,
+			want:             false,
+		},
+		{
+			// The call already has a later attempt.
+			event:            EventLog{servicename: "helloworld.Greeter", methodname: "SayHello", ipsource: "::1", tstart: currtime.Add(100 * time.Millisecond)},
+			previousattempts: 0,
+			want:             false,
+		},
+	}
+
+	for i, test := range tests {
+		if ret := call.isMatchingAttempt(&test.event, test.previousattempts, time.Second); ret != test.want {
+			t.Errorf("isMatchingAttempt (testcase %d): returns %t while it should be %t", i, ret, test.want)
+		}
+	}
+}
+
+func Test_isSettled(t *testing.T) {
+	currtime := time.Now()
+	tests := []struct {
+		call logicalCall
+		want bool
+	}{
+		{
+			call: logicalCall{attempts: 2, finished: 1, grpcstatuscode: "0", tfinish: currtime},
+			want: true,
+		},
+		{
+			call: logicalCall{attempts: 2, finished: 1, grpcstatuscode: "14", tlast: currtime.Add(-500 * time.Millisecond), tfinish: currtime.Add(-2 * time.Second)},
+			want: false,
+		},
+		{
+			// Attempts which never finish don't keep the call forever.
+			call: logicalCall{attempts: 2, finished: 1, grpcstatuscode: "14", tlast: currtime.Add(-3 * time.Second), tfinish: currtime.Add(-2 * time.Second)},
+			want: true,
+		},
+		{
+			call: logicalCall{attempts: 2, tlast: currtime.Add(-2 * time.Second)},
+			want: true,
+		},
+		{
+			call: logicalCall{attempts: 2, finished: 2, grpcstatuscode: "14", tfinish: currtime.Add(-500 * time.Millisecond)},
+			want: false,
+		},
+		{
+			call: logicalCall{attempts: 2, finished: 2, grpcstatuscode: "14", tfinish: currtime.Add(-2 * time.Second)},
+			want: true,
+		},
+	}
+
+	for i, test := range tests {
+		if ret := test.call.isSettled(currtime, time.Second); ret != test.want {
+			t.Errorf("isSettled (testcase %d): returns %t while it should be %t", i, ret, test.want)
+		}
+	}
+}
+
+func Test_logicalCallEventLog(t *testing.T) {
+	id := uuid.MustParse("d96763c9-a9a4-49d0-9008-b63befa85b6d")
+	currtime := time.Now()
+	call := &logicalCall{id: id, servicename: "helloworld.Greeter", methodname: "SayHello", ipsource: "::1", tcpsource: 58108, tstart: currtime}
+	call.insertAttempt(&EventLog{tstart: currtime}, 1)
+	call.finishAttempt(&EventLog{ipdest: "::1", tcpdest: 8000, grpcstatuscode: "14", tfinish: currtime.Add(100 * time.Millisecond)})
+	call.insertAttempt(&EventLog{tstart: currtime.Add(200 * time.Millisecond)}, 2)
+	call.finishAttempt(&EventLog{ipdest: "::1", tcpdest: 8001, grpcstatuscode: "0", tfinish: currtime.Add(250 * time.Millisecond)})
+
+	want := EventLog{
+		tstart:         currtime,
+		tfinish:        currtime.Add(250 * time.Millisecond),
+		servicename:    "helloworld.Greeter",
+		methodname:     "SayHello",
+		ipsource:       "::1",
+		tcpsource:      58108,
+		ipdest:         "::1",
+		tcpdest:        8001,
+		grpcstatuscode: "0",
+		duration:       250 * time.Millisecond,
+		info:           "CALL",
+		callid:         id,
+		attempts:       2,
+	}
+	if ret := call.eventLog(); !isEventEqualValue(ret, want) {
+		t.Errorf("eventLog: doesn't return event as expected")
+	}
+}
+
+func Test_logicalCallEventLogUnfinished(t *testing.T) {
+	id := uuid.MustParse("d96763c9-a9a4-49d0-9008-b63befa85b6d")
+	currtime := time.Now()
+	call := &logicalCall{id: id, servicename: "helloworld.Greeter", methodname: "SayHello", ipsource: "::1", tcpsource: 58108, tstart: currtime}
+	call.insertAttempt(&EventLog{tstart: currtime}, 1)
+	call.insertAttempt(&EventLog{tstart: currtime.Add(200 * time.Millisecond)}, 2)
+
+	want := EventLog{
+		tstart:         currtime,
+		tfinish:        currtime.Add(200 * time.Millisecond),
+		servicename:    "helloworld.Greeter",
+		methodname:     "SayHello",
+		ipsource:       "::1",
+		tcpsource:      58108,
+		grpcstatuscode: "-1",
+		duration:       200 * time.Millisecond,
+		info:           "CALL",
+		callid:         id,
+		attempts:       2,
+	}
+	if ret := call.eventLog(); !isEventEqualValue(ret, want) {
+		t.Errorf("eventLog: doesn't return event as expected")
+	}
+}
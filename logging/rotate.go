@@ -0,0 +1,335 @@
+package logging
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Lines which couldn't be written are kept up to maxPendingSize bytes
+	// and written again retryInterval later at the earliest.
+	maxPendingSize = 4 * 1024 * 1024
+	retryInterval  = time.Second
+
+	rotatedTimeFormat = "20060102-150405"
+)
+
+// LogFile is where the lines of the logs are written, an *os.File or a
+// RotatingFile.
+type LogFile interface {
+	io.Writer
+	Name() string
+}
+
+// RotationPolicy sets when a RotatingFile is rotated. A zero MaxSize or
+// Interval disables rotation by size or by time, a zero MaxFiles keeps all
+// the rotated files.
+type RotationPolicy struct {
+	// MaxSize is the size in bytes from which the file is rotated.
+	MaxSize int64
+	// Interval rotates the file at every multiple of it, e.g. at midnight
+	// UTC for 24h.
+	Interval time.Duration
+	// MaxFiles is the number of rotated files kept, the oldest ones are
+	// removed.
+	MaxFiles int
+	// Compress gzips the rotated files.
+	Compress bool
+}
+
+// RotatingFile is a log file rotated along its RotationPolicy and reopened on
+// demand, e.g. after an external logrotate moved it. Lines which fail to be
+// written, e.g. on ENOSPC, are kept and written again once the file works.
+type RotatingFile struct {
+	path   string
+	policy RotationPolicy
+	file   *os.File
+	size   int64
+	topen  time.Time
+	// pending are the bytes which couldn't be written since tfailed.
+	pending []byte
+	tfailed time.Time
+	dropped int
+	mutex   sync.Mutex
+	// compressions are the rotated files being gzipped.
+	compressions sync.WaitGroup
+	prunemutex   sync.Mutex
+	now          func() time.Time
+}
+
+// OpenRotatingFile opens the file at path in append mode.
+func OpenRotatingFile(path string, policy RotationPolicy) (*RotatingFile, error) {
+	f := &RotatingFile{path: path, policy: policy, now: time.Now}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size, f.topen = file, info.Size(), f.now()
+	return nil
+}
+
+func (f *RotatingFile) Name() string {
+	return f.path
+}
+
+// Write appends p to the file, rotating it before if needed. When the file
+// can't be written, p is kept to be written later and only an error for the
+// bytes dropped once too many are kept is returned.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	now := f.now()
+	if len(f.pending) > 0 {
+		if now.Sub(f.tfailed) < retryInterval {
+			return f.keep(p)
+		}
+		if err := f.recover(); err != nil {
+			f.tfailed = now
+			return f.keep(p)
+		}
+		if f.dropped > 0 {
+			log.Printf("Writing logs to %s again, %d bytes were dropped.\n", f.path, f.dropped)
+		} else {
+			log.Printf("Writing logs to %s again.\n", f.path)
+		}
+		f.dropped = 0
+	}
+
+	if f.shouldRotate(now, len(p)) {
+		if err := f.rotate(now); err != nil {
+			log.Printf("Failed to rotate %s: %v\n", f.path, err)
+		}
+	}
+	if n, err := f.write(p); err != nil {
+		log.Printf("Failed to write logs to %s: %v\n", f.path, err)
+		f.tfailed = now
+		kept, err := f.keep(p[n:])
+		return n + kept, err
+	}
+	return len(p), nil
+}
+
+func (f *RotatingFile) write(p []byte) (int, error) {
+	if f.file == nil {
+		return 0, fmt.Errorf("File %s is not open", f.path)
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// recover reopens the file and writes the pending bytes.
+func (f *RotatingFile) recover() error {
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	n, err := f.write(f.pending)
+	f.pending = f.pending[n:]
+	return err
+}
+
+func (f *RotatingFile) keep(p []byte) (int, error) {
+	if len(f.pending)+len(p) > maxPendingSize {
+		f.dropped += len(p)
+		return 0, fmt.Errorf("Dropped %d bytes of logs, %s can't be written", len(p), f.path)
+	}
+	f.pending = append(f.pending, p...)
+	return len(p), nil
+}
+
+func (f *RotatingFile) shouldRotate(now time.Time, size int) bool {
+	if f.policy.MaxSize > 0 && f.size > 0 && f.size+int64(size) > f.policy.MaxSize {
+		return true
+	}
+	interval := f.policy.Interval
+	return interval > 0 && !now.Truncate(interval).Equal(f.topen.Truncate(interval))
+}
+
+// rotate renames the file after the time it is rotated at and opens a new
+// one.
+func (f *RotatingFile) rotate(now time.Time) error {
+	name := f.path + "." + now.UTC().Format(rotatedTimeFormat)
+	for i := 1; exists(name) || exists(name+".gz"); i++ {
+		name = fmt.Sprintf("%s.%s.%d", f.path, now.UTC().Format(rotatedTimeFormat), i)
+	}
+	f.file.Close()
+	f.file = nil
+	if err := os.Rename(f.path, name); err != nil {
+		f.open()
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	if !f.policy.Compress {
+		f.prune()
+		return nil
+	}
+	f.compressions.Add(1)
+	go func() {
+		defer f.compressions.Done()
+		if err := compressFile(name); err != nil {
+			log.Printf("Failed to compress %s: %v\n", name, err)
+		}
+		f.prune()
+	}()
+	return nil
+}
+
+func exists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+// compressFile replaces name by name.gz.
+func compressFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	tmp := name + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	w := gzip.NewWriter(dst)
+	_, err = io.Copy(w, src)
+	if err == nil {
+		err = w.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, name+".gz")
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(name)
+}
+
+// rotatedFile is a file named by rotate, possibly compressed since.
+type rotatedFile struct {
+	name   string
+	time   time.Time
+	suffix int
+}
+
+// rotatedFiles returns the rotated files of the file, oldest first. Other
+// files sharing its name, e.g. rotated by logrotate, are left out.
+func (f *RotatingFile) rotatedFiles() []string {
+	names, _ := filepath.Glob(f.path + ".*")
+	rotated := []rotatedFile{}
+	for _, name := range names {
+		if file, ok := parseRotatedName(f.path, name); ok {
+			rotated = append(rotated, file)
+		}
+	}
+	sort.Slice(rotated, func(i, j int) bool {
+		if !rotated[i].time.Equal(rotated[j].time) {
+			return rotated[i].time.Before(rotated[j].time)
+		}
+		return rotated[i].suffix < rotated[j].suffix
+	})
+	files := make([]string, len(rotated))
+	for i, file := range rotated {
+		files[i] = file.name
+	}
+	return files
+}
+
+// parseRotatedName parses name as path.<time>[.<suffix>][.gz].
+func parseRotatedName(path string, name string) (rotatedFile, bool) {
+	file := rotatedFile{name: name}
+	parts := strings.Split(strings.TrimSuffix(strings.TrimPrefix(name, path+"."), ".gz"), ".")
+	if len(parts) > 2 {
+		return file, false
+	}
+	t, err := time.Parse(rotatedTimeFormat, parts[0])
+	if err != nil {
+		return file, false
+	}
+	file.time = t
+	if len(parts) == 2 {
+		suffix, err := strconv.Atoi(parts[1])
+		if err != nil || suffix < 1 {
+			return file, false
+		}
+		file.suffix = suffix
+	}
+	return file, true
+}
+
+// prune removes the oldest rotated files beyond MaxFiles.
+func (f *RotatingFile) prune() {
+	if f.policy.MaxFiles <= 0 {
+		return
+	}
+	f.prunemutex.Lock()
+	defer f.prunemutex.Unlock()
+	files := f.rotatedFiles()
+	for i := 0; i < len(files)-f.policy.MaxFiles; i++ {
+		if err := os.Remove(files[i]); err != nil {
+			log.Printf("Failed to remove %s: %v\n", files[i], err)
+		}
+	}
+}
+
+// Reopen closes the file and opens it again at its path, for logrotate to
+// signal it moved it away.
+func (f *RotatingFile) Reopen() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+	return f.open()
+}
+
+// Close closes the file once the rotated files are compressed. Pending
+// bytes are written if possible.
+func (f *RotatingFile) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.compressions.Wait()
+	if len(f.pending) > 0 {
+		f.recover()
+	}
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
@@ -0,0 +1,212 @@
+package logging
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// clock returns a now function starting at t and moving by step on each call.
+func clock(t time.Time, step time.Duration) func() time.Time {
+	return func() time.Time {
+		t = t.Add(step)
+		return t
+	}
+}
+
+func openTestRotatingFile(t *testing.T, policy RotationPolicy, now func() time.Time) (*RotatingFile, string) {
+	dir, err := ioutil.TempDir("", "inkle")
+	if err != nil {
+		t.Fatal("RotatingFile: failed to create temporary directory")
+	}
+	f := &RotatingFile{path: filepath.Join(dir, "inkle.log"), policy: policy, now: now}
+	if err := f.open(); err != nil {
+		t.Fatalf("RotatingFile: failed to open file: %v", err)
+	}
+	return f, dir
+}
+
+func readFile(t *testing.T, name string) string {
+	content, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Errorf("RotatingFile: failed to read %s: %v", name, err)
+	}
+	return string(content)
+}
+
+func TestRotatingFile(t *testing.T) {
+	tstart := time.Date(2020, 4, 1, 10, 58, 40, 0, time.UTC)
+	tests := []struct {
+		policy RotationPolicy
+		step   time.Duration
+		lines  []string
+		// want are the contents of the rotated files, oldest first, then of
+		// the file.
+		want []string
+	}{
+		{
+			policy: RotationPolicy{},
+			step:   time.Hour,
+			lines:  []string{"a\n", "b\n", "c\n"},
+			want:   []string{"a\nb\nc\n"},
+		},
+		{
+			policy: RotationPolicy{MaxSize: 5},
+			step:   time.Second,
+			lines:  []string{"a\n", "b\n", "c\n", "d\n"},
+			want:   []string{"a\nb\n", "c\nd\n"},
+		},
+		{
+			policy: RotationPolicy{MaxSize: 1, MaxFiles: 2},
+			step:   time.Second,
+			lines:  []string{"a\n", "b\n", "c\n", "d\n"},
+			want:   []string{"b\n", "c\n", "d\n"},
+		},
+		{
+			policy: RotationPolicy{Interval: time.Hour},
+			step:   20 * time.Second,
+			lines:  []string{"a\n", "b\n", "c\n", "d\n"},
+			want:   []string{"a\nb\n", "c\nd\n"},
+		},
+	}
+
+	for i, test := range tests {
+		f, dir := openTestRotatingFile(t, test.policy, clock(tstart, test.step))
+		for _, line := range test.lines {
+			if _, err := f.Write([]byte(line)); err != nil {
+				t.Errorf("Write (testcase %d): returns err = '%v', where there should be no error", i, err)
+			}
+		}
+		f.Close()
+
+		files := append(f.rotatedFiles(), f.path)
+		if len(files) != len(test.want) {
+			t.Errorf("RotatingFile (testcase %d): has %d files while it should have %d", i, len(files), len(test.want))
+		} else {
+			for j, name := range files {
+				if content := readFile(t, name); content != test.want[j] {
+					t.Errorf("RotatingFile (testcase %d): %s has '%s' while it should have '%s'", i, name, content, test.want[j])
+				}
+			}
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestRotatingFileCompress(t *testing.T) {
+	f, dir := openTestRotatingFile(t, RotationPolicy{MaxSize: 1, Compress: true}, clock(time.Now(), time.Second))
+	defer os.RemoveAll(dir)
+	f.Write([]byte("a\n"))
+	f.Write([]byte("b\n"))
+	f.Close()
+
+	files := f.rotatedFiles()
+	if len(files) != 1 || filepath.Ext(files[0]) != ".gz" {
+		t.Fatalf("RotatingFile: has rotated files %v while it should have one gzipped file", files)
+	}
+	gz, err := os.Open(files[0])
+	if err != nil {
+		t.Fatalf("RotatingFile: failed to open %s: %v", files[0], err)
+	}
+	defer gz.Close()
+	r, err := gzip.NewReader(gz)
+	if err != nil {
+		t.Fatalf("RotatingFile: %s isn't gzipped: %v", files[0], err)
+	}
+	if content, _ := ioutil.ReadAll(r); string(content) != "a\n" {
+		t.Errorf("RotatingFile: %s has '%s' while it should have 'a\n'", files[0], content)
+	}
+	if content := readFile(t, f.path); content != "b\n" {
+		t.Errorf("RotatingFile: %s has '%s' while it should have 'b\n'", f.path, content)
+	}
+}
+
+func TestRotatingFileRotatedFiles(t *testing.T) {
+	f, dir := openTestRotatingFile(t, RotationPolicy{}, time.Now)
+	defer os.RemoveAll(dir)
+	defer f.Close()
+	for _, name := range []string{
+		"inkle.log.20200401-103000.10.gz",
+		"inkle.log.1",
+		"inkle.log.20200402-000000",
+		"inkle.log.20200401-103000.2",
+		"inkle.log.20200401-103000.gz.tmp",
+		"inkle.log.20200401-103000.gz",
+		"inkle.log.20200401-103000.x",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatalf("RotatingFile: failed to create %s: %v", name, err)
+		}
+	}
+
+	want := []string{
+		filepath.Join(dir, "inkle.log.20200401-103000.gz"),
+		filepath.Join(dir, "inkle.log.20200401-103000.2"),
+		filepath.Join(dir, "inkle.log.20200401-103000.10.gz"),
+		filepath.Join(dir, "inkle.log.20200402-000000"),
+	}
+	if files := f.rotatedFiles(); !reflect.DeepEqual(files, want) {
+		t.Errorf("RotatingFile: has rotated files %v while it should have %v", files, want)
+	}
+}
+
+func TestRotatingFileReopen(t *testing.T) {
+	f, dir := openTestRotatingFile(t, RotationPolicy{}, time.Now)
+	defer os.RemoveAll(dir)
+	f.Write([]byte("a\n"))
+	// As logrotate would do before sending SIGHUP.
+	if err := os.Rename(f.path, f.path+".1"); err != nil {
+		t.Fatalf("RotatingFile: failed to move file: %v", err)
+	}
+	if err := f.Reopen(); err != nil {
+		t.Errorf("Reopen: returns err = '%v', where there should be no error", err)
+	}
+	f.Write([]byte("b\n"))
+	f.Close()
+
+	if content := readFile(t, f.path+".1"); content != "a\n" {
+		t.Errorf("RotatingFile: moved file has '%s' while it should have 'a\n'", content)
+	}
+	if content := readFile(t, f.path); content != "b\n" {
+		t.Errorf("RotatingFile: reopened file has '%s' while it should have 'b\n'", content)
+	}
+}
+
+func TestRotatingFileWriteError(t *testing.T) {
+	now := time.Now()
+	f, dir := openTestRotatingFile(t, RotationPolicy{}, func() time.Time { return now })
+	defer os.RemoveAll(dir)
+	f.Write([]byte("a\n"))
+	// Writes fail on the closed file until it is reopened.
+	f.file.Close()
+
+	tests := []struct {
+		line    string
+		elapsed time.Duration
+		pending string
+		want    string
+	}{
+		{line: "b\n", elapsed: 0, pending: "b\n", want: "a\n"},
+		{line: "c\n", elapsed: retryInterval / 2, pending: "b\nc\n", want: "a\n"},
+		{line: "d\n", elapsed: retryInterval, pending: "", want: "a\nb\nc\nd\n"},
+	}
+
+	tstart := now
+	for i, test := range tests {
+		now = tstart.Add(test.elapsed)
+		if n, err := f.Write([]byte(test.line)); err != nil || n != len(test.line) {
+			t.Errorf("Write (testcase %d): returns %d, '%v' while it should return %d, no error", i, n, err, len(test.line))
+		}
+		if string(f.pending) != test.pending {
+			t.Errorf("Write (testcase %d): keeps '%s' while it should keep '%s'", i, f.pending, test.pending)
+		}
+		if content := readFile(t, f.path); content != test.want {
+			t.Errorf("Write (testcase %d): file has '%s' while it should have '%s'", i, content, test.want)
+		}
+	}
+	f.Close()
+}
@@ -0,0 +1,327 @@
+package logging
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults of the batching of the events to a sink.
+const (
+	DefaultSinkQueueSize     = 10000
+	DefaultSinkBatchSize     = 100
+	DefaultSinkFlushInterval = time.Second
+)
+
+// Sink receives the finished events, in batches. The slice given to Write
+// is reused for the next batch once Write returns, so sinks must not keep it.
+type Sink interface {
+	Write(events []EventLog) error
+}
+
+// WriterSink writes the lines of the events to a file.
+type WriterSink struct {
+	w      LogFile
+	format Formatter
+}
+
+// NewWriterSink returns a sink writing the events to w in format, csv if nil.
+func NewWriterSink(w LogFile, format Formatter) *WriterSink {
+	if format == nil {
+		format = logString
+	}
+	return &WriterSink{w: w, format: format}
+}
+
+func (s *WriterSink) Write(events []EventLog) error {
+	var lines strings.Builder
+	for _, e := range events {
+		lines.WriteString(s.format(e))
+	}
+	_, err := io.WriteString(s.w, lines.String())
+	return err
+}
+
+// Close closes the file, unless it is stdout.
+func (s *WriterSink) Close() error {
+	if f, ok := s.w.(*RotatingFile); ok {
+		return f.Close()
+	}
+	return nil
+}
+
+// EventFilter selects the events sent to a sink. Zero fields select all the
+// events.
+type EventFilter struct {
+	// Errors only selects the calls which failed or timed out.
+	Errors bool
+	// Method is a service/method glob, e.g. helloworld.Greeter/*.
+	Method      string
+	MinDuration time.Duration
+}
+
+// Match returns whether e is selected by the filter.
+func (f EventFilter) Match(e EventLog) bool {
+	if f.Errors && !e.isError() {
+		return false
+	}
+	if f.Method != "" && !matchMethod(f.Method, e.servicename, e.methodname) {
+		return false
+	}
+	return e.duration >= f.MinDuration
+}
+
+func (e EventLog) isError() bool {
+	if code, err := strconv.Atoi(e.grpcstatuscode); err == nil && code > 0 {
+		return true
+	}
+	return strings.HasSuffix(e.info, "TIMEOUT")
+}
+
+// SinkOptions set which events a sink gets and how they are batched.
+type SinkOptions struct {
+	Filter EventFilter
+	// SampleRate is the share of the events sent, all of them if 0. Events
+	// of the same trace are sampled together.
+	SampleRate float64
+	// QueueSize events wait to be sent at most, the next ones are dropped.
+	QueueSize     int
+	BatchSize     int
+	FlushInterval time.Duration
+}
+
+// sampled returns whether e is kept at rate, from the hash of its trace ID or
+// of its ID.
+func sampled(e EventLog, rate float64) bool {
+	if rate <= 0 || rate >= 1 {
+		return true
+	}
+	key := e.trace.TraceID
+	if key == "" {
+		key = e.id.String()
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return float64(h.Sum64()) < rate*math.MaxUint64
+}
+
+// SinkStats counts the events delivered to a sink, dropped because its queue
+// was full and failed to be written.
+type SinkStats struct {
+	Delivered, Dropped, Failed uint64
+}
+
+func (s SinkStats) String() string {
+	return fmt.Sprintf("delivered=%d dropped=%d failed=%d", s.Delivered, s.Dropped, s.Failed)
+}
+
+// BatchingSink sends the events to a sink asynchronously, in batches of
+// BatchSize events or every FlushInterval, from a queue of QueueSize events.
+// Events are dropped rather than blocking once the queue is full.
+type BatchingSink struct {
+	delivered, dropped, failed uint64
+	name                       string
+	sink                       Sink
+	options                    SinkOptions
+	queue                      chan EventLog
+	done                       chan struct{}
+	mutex                      sync.RWMutex
+	isclosed                   bool
+}
+
+// NewBatchingSink starts sending the events written to it to sink.
+func NewBatchingSink(name string, sink Sink, options SinkOptions) *BatchingSink {
+	if options.QueueSize <= 0 {
+		options.QueueSize = DefaultSinkQueueSize
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = DefaultSinkBatchSize
+	}
+	if options.FlushInterval <= 0 {
+		options.FlushInterval = DefaultSinkFlushInterval
+	}
+	s := &BatchingSink{name: name, sink: sink, options: options, queue: make(chan EventLog, options.QueueSize), done: make(chan struct{})}
+	go s.run()
+	return s
+}
+
+func (s *BatchingSink) Name() string {
+	return s.name
+}
+
+// Write queues the events selected by the filter and sampling of the sink.
+func (s *BatchingSink) Write(events []EventLog) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.isclosed {
+		atomic.AddUint64(&s.dropped, uint64(len(events)))
+		return fmt.Errorf("Sink %s is closed", s.name)
+	}
+	for _, e := range events {
+		if !s.options.Filter.Match(e) || !sampled(e, s.options.SampleRate) {
+			continue
+		}
+		select {
+		case s.queue <- e:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	}
+	return nil
+}
+
+func (s *BatchingSink) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.options.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]EventLog, 0, s.options.BatchSize)
+	for {
+		select {
+		case e, ok := <-s.queue:
+			if !ok {
+				s.flush(batch)
+				return
+			}
+			batch = append(batch, e)
+			if len(batch) >= s.options.BatchSize {
+				s.flush(batch)
+				// The sink is done with the batch, see Sink.
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			s.flush(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+func (s *BatchingSink) flush(batch []EventLog) {
+	if len(batch) == 0 {
+		return
+	}
+	if err := s.sink.Write(batch); err != nil {
+		log.Printf("Failed to send %d events to sink %s: %v\n", len(batch), s.name, err)
+		atomic.AddUint64(&s.failed, uint64(len(batch)))
+		return
+	}
+	atomic.AddUint64(&s.delivered, uint64(len(batch)))
+}
+
+// Stats returns the counters of the sink.
+func (s *BatchingSink) Stats() SinkStats {
+	return SinkStats{
+		Delivered: atomic.LoadUint64(&s.delivered),
+		Dropped:   atomic.LoadUint64(&s.dropped),
+		Failed:    atomic.LoadUint64(&s.failed),
+	}
+}
+
+// Close sends the queued events and closes the sink.
+func (s *BatchingSink) Close() error {
+	s.mutex.Lock()
+	if s.isclosed {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.isclosed = true
+	close(s.queue)
+	s.mutex.Unlock()
+	<-s.done
+	log.Printf("Sink %s: %s.\n", s.name, s.Stats())
+	if closer, ok := s.sink.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// SinkConfig is a sink given as type[:key=value,...], e.g.
+// "webhook:url=http://alerts/inkle,errors=true,sample=0.5". Options is left
+// with the keys specific to the type of the sink.
+type SinkConfig struct {
+	Type    string
+	Options map[string]string
+	SinkOptions
+}
+
+// ParseSinkConfig parses a sink. A comma which isn't followed by a key= is
+// part of the value before it, e.g. of a format template.
+func ParseSinkConfig(s string) (SinkConfig, error) {
+	config := SinkConfig{Options: map[string]string{}}
+	idx := strings.Index(s, ":")
+	if idx == -1 {
+		idx = len(s)
+	}
+	config.Type = strings.TrimSpace(s[:idx])
+	if config.Type == "" {
+		return config, fmt.Errorf("Invalid sink %s", s)
+	}
+	if idx == len(s) {
+		return config, nil
+	}
+
+	items := []string{}
+	for _, item := range strings.Split(s[idx+1:], ",") {
+		if eq := strings.Index(item, "="); len(items) > 0 && (eq <= 0 || !isOptionKey(item[:eq])) {
+			items[len(items)-1] += "," + item
+			continue
+		}
+		items = append(items, item)
+	}
+	for _, item := range items {
+		eq := strings.Index(item, "=")
+		if eq <= 0 {
+			return config, fmt.Errorf("Invalid sink option %s", item)
+		}
+		if err := config.setOption(item[:eq], item[eq+1:]); err != nil {
+			return config, err
+		}
+	}
+	return config, nil
+}
+
+func isOptionKey(key string) bool {
+	for _, r := range key {
+		if (r < 'a' || r > 'z') && r != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *SinkConfig) setOption(key string, value string) error {
+	var err error
+	switch key {
+	case "errors":
+		c.Filter.Errors, err = strconv.ParseBool(value)
+	case "method":
+		c.Filter.Method = value
+		_, err = path.Match(value, "")
+	case "min-duration":
+		c.Filter.MinDuration, err = time.ParseDuration(value)
+	case "sample":
+		c.SampleRate, err = strconv.ParseFloat(value, 64)
+		if err == nil && (c.SampleRate < 0 || c.SampleRate > 1) {
+			err = fmt.Errorf("out of range")
+		}
+	case "queue":
+		c.QueueSize, err = strconv.Atoi(value)
+	case "batch":
+		c.BatchSize, err = strconv.Atoi(value)
+	case "flush":
+		c.FlushInterval, err = time.ParseDuration(value)
+	default:
+		c.Options[key] = value
+	}
+	if err != nil {
+		return fmt.Errorf("Invalid sink option %s=%s", key, value)
+	}
+	return nil
+}
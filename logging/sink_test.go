@@ -0,0 +1,333 @@
+package logging
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abrampers/inkle/tracing"
+	"github.com/google/uuid"
+)
+
+func TestParseSinkConfig(t *testing.T) {
+	tests := []struct {
+		input string
+		want  SinkConfig
+		ok    bool
+	}{
+		{
+			input: "file",
+			want:  SinkConfig{Type: "file", Options: map[string]string{}},
+			ok:    true,
+		},
+		{
+			input: "webhook:url=http://alerts/inkle,errors=true,sample=0.5",
+			want: SinkConfig{
+				Type:        "webhook",
+				Options:     map[string]string{"url": "http://alerts/inkle"},
+				SinkOptions: SinkOptions{Filter: EventFilter{Errors: true}, SampleRate: 0.5},
+			},
+			ok: true,
+		},
+		{
+			input: "file:path=/var/log/errors.log,format={{csv .Service .Method}},method=helloworld.Greeter/*,min-duration=100ms,queue=10,batch=5,flush=2s",
+			want: SinkConfig{
+				Type:    "file",
+				Options: map[string]string{"path": "/var/log/errors.log", "format": "{{csv .Service .Method}}"},
+				SinkOptions: SinkOptions{
+					Filter:        EventFilter{Method: "helloworld.Greeter/*", MinDuration: 100 * time.Millisecond},
+					QueueSize:     10,
+					BatchSize:     5,
+					FlushInterval: 2 * time.Second,
+				},
+			},
+			ok: true,
+		},
+		{
+			input: `stdout:format={{printf "%s,%s" .Service .Method}}`,
+			want:  SinkConfig{Type: "stdout", Options: map[string]string{"format": `{{printf "%s,%s" .Service .Method}}`}},
+			ok:    true,
+		},
+		{
+			input: "",
+			ok:    false,
+		},
+		{
+			input: "file:path",
+			ok:    false,
+		},
+		{
+			input: "webhook:url=http://alerts/inkle,sample=2",
+			ok:    false,
+		},
+		{
+			input: "file:min-duration=soon",
+			ok:    false,
+		},
+		{
+			input: "file:method=[",
+			ok:    false,
+		},
+	}
+
+	for i, test := range tests {
+		ret, err := ParseSinkConfig(test.input)
+		if test.ok && err != nil {
+			t.Errorf("ParseSinkConfig(%s) (testcase %d): returns err = '%v', where there should be no error", test.input, i, err)
+		} else if !test.ok && err == nil {
+			t.Errorf("ParseSinkConfig(%s) (testcase %d): returns no err, where there should be error", test.input, i)
+		} else if test.ok && !reflect.DeepEqual(ret, test.want) {
+			t.Errorf("ParseSinkConfig(%s) (testcase %d): returns %+v while it should be %+v", test.input, i, ret, test.want)
+		}
+	}
+}
+
+func TestEventFilter(t *testing.T) {
+	tests := []struct {
+		filter EventFilter
+		event  EventLog
+		want   bool
+	}{
+		{
+			filter: EventFilter{},
+			event:  EventLog{servicename: "NULL", methodname: "NULL", info: "CONNECTION_OPEN"},
+			want:   true,
+		},
+		{
+			filter: EventFilter{Errors: true},
+			event:  EventLog{servicename: "helloworld.Greeter", methodname: "SayHello", grpcstatuscode: "0", info: "Request - Response"},
+			want:   false,
+		},
+		{
+			filter: EventFilter{Errors: true},
+			event:  EventLog{servicename: "helloworld.Greeter", methodname: "SayHello", grpcstatuscode: "14", info: "Request - Response"},
+			want:   true,
+		},
+		{
+			filter: EventFilter{Errors: true},
+			event:  EventLog{servicename: "helloworld.Greeter", methodname: "SayHello", info: "Request - TIMEOUT"},
+			want:   true,
+		},
+		{
+			filter: EventFilter{Errors: true},
+			event:  EventLog{servicename: "NULL", methodname: "NULL", grpcstatuscode: "-1", info: "CONNECTION_CLOSE"},
+			want:   false,
+		},
+		{
+			filter: EventFilter{Method: "helloworld.Greeter/*"},
+			event:  EventLog{servicename: "helloworld.Greeter", methodname: "SayHello"},
+			want:   true,
+		},
+		{
+			filter: EventFilter{Method: "helloworld.Greeter/*"},
+			event:  EventLog{servicename: "datetime.Datetime", methodname: "GetDatetime"},
+			want:   false,
+		},
+		{
+			filter: EventFilter{MinDuration: 100 * time.Millisecond},
+			event:  EventLog{duration: 50 * time.Millisecond},
+			want:   false,
+		},
+		{
+			filter: EventFilter{MinDuration: 100 * time.Millisecond},
+			event:  EventLog{duration: 100 * time.Millisecond},
+			want:   true,
+		},
+	}
+
+	for i, test := range tests {
+		if ret := test.filter.Match(test.event); ret != test.want {
+			t.Errorf("Match (testcase %d): returns %t while it should return %t", i, ret, test.want)
+		}
+	}
+}
+
+func Test_sampled(t *testing.T) {
+	trace := tracing.SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736"}
+	n := 0
+	for i := 0; i < 1000; i++ {
+		e := EventLog{id: uuid.New()}
+		if !sampled(e, 0) || !sampled(e, 1) {
+			t.Errorf("sampled: drops an event at rate 0 or 1")
+		}
+		if sampled(e, 0.3) {
+			n++
+		}
+		// Events of a trace are all kept or all dropped.
+		if sampled(EventLog{id: e.id, trace: trace}, 0.3) != sampled(EventLog{trace: trace}, 0.3) {
+			t.Errorf("sampled: samples the events of a trace differently")
+		}
+	}
+	if n < 200 || n > 400 {
+		t.Errorf("sampled: keeps %d events out of 1000 at rate 0.3", n)
+	}
+}
+
+// recordingSink records the batches written to it, blocking until unblocked.
+type recordingSink struct {
+	mutex   sync.Mutex
+	batches [][]EventLog
+	err     error
+	block   chan struct{}
+}
+
+func (s *recordingSink) Write(events []EventLog) error {
+	if s.block != nil {
+		<-s.block
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.batches = append(s.batches, append([]EventLog{}, events...))
+	return s.err
+}
+
+func (s *recordingSink) sizes() []int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	sizes := []int{}
+	for _, batch := range s.batches {
+		sizes = append(sizes, len(batch))
+	}
+	return sizes
+}
+
+func TestBatchingSink(t *testing.T) {
+	events := make([]EventLog, 5)
+	for i := range events {
+		events[i] = EventLog{servicename: "helloworld.Greeter", methodname: "SayHello", grpcstatuscode: fmt.Sprint(i % 2)}
+	}
+	tests := []struct {
+		options SinkOptions
+		err     error
+		sizes   []int
+		stats   SinkStats
+	}{
+		{
+			options: SinkOptions{BatchSize: 2, FlushInterval: time.Hour},
+			sizes:   []int{2, 2, 1},
+			stats:   SinkStats{Delivered: 5},
+		},
+		{
+			options: SinkOptions{Filter: EventFilter{Errors: true}, BatchSize: 10, FlushInterval: time.Hour},
+			sizes:   []int{2},
+			stats:   SinkStats{Delivered: 2},
+		},
+		{
+			options: SinkOptions{BatchSize: 3, FlushInterval: time.Hour},
+			err:     fmt.Errorf("unavailable"),
+			sizes:   []int{3, 2},
+			stats:   SinkStats{Failed: 5},
+		},
+	}
+
+	for i, test := range tests {
+		sink := &recordingSink{err: test.err}
+		s := NewBatchingSink("test", sink, test.options)
+		s.Write(events)
+		s.Close()
+		if sizes := sink.sizes(); !reflect.DeepEqual(sizes, test.sizes) {
+			t.Errorf("BatchingSink (testcase %d): writes batches of %v while it should write %v", i, sizes, test.sizes)
+		}
+		if stats := s.Stats(); stats != test.stats {
+			t.Errorf("BatchingSink (testcase %d): counts %s while it should count %s", i, stats, test.stats)
+		}
+	}
+}
+
+func TestBatchingSinkDrop(t *testing.T) {
+	sink := &recordingSink{block: make(chan struct{})}
+	s := NewBatchingSink("test", sink, SinkOptions{QueueSize: 2, BatchSize: 1, FlushInterval: time.Hour})
+	s.Write([]EventLog{{}})
+	// Wait for the first event to be taken from the queue by the blocked
+	// sink, then fill the queue.
+	for len(s.queue) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	s.Write([]EventLog{{}, {}, {}, {}})
+	close(sink.block)
+	s.Close()
+
+	if stats, want := s.Stats(), (SinkStats{Delivered: 3, Dropped: 2}); stats != want {
+		t.Errorf("BatchingSink: counts %s while it should count %s", stats, want)
+	}
+	if err := s.Write([]EventLog{{}}); err == nil {
+		t.Errorf("BatchingSink: accepts events once closed")
+	}
+}
+
+func TestBatchingSinkFlushInterval(t *testing.T) {
+	sink := &recordingSink{}
+	s := NewBatchingSink("test", sink, SinkOptions{BatchSize: 100, FlushInterval: 10 * time.Millisecond})
+	defer s.Close()
+	s.Write([]EventLog{{}, {}})
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(time.Millisecond) {
+		if sizes := sink.sizes(); reflect.DeepEqual(sizes, []int{2}) {
+			return
+		}
+	}
+	t.Errorf("BatchingSink: doesn't flush the events after its flush interval")
+}
+
+func TestWebhookSink(t *testing.T) {
+	var body, contenttype string
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, _ := ioutil.ReadAll(r.Body)
+		body, contenttype = string(content), r.Header.Get("Content-Type")
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	events := []EventLog{
+		{servicename: "helloworld.Greeter", methodname: "SayHello", ipsource: "::1", tcpsource: 58108, ipdest: "::1", tcpdest: 8000, grpcstatuscode: "0", info: "Request - Response"},
+		{servicename: "helloworld.Greeter", methodname: "SayHello", ipsource: "::1", tcpsource: 58109, ipdest: "::1", tcpdest: 8000, grpcstatuscode: "14", info: "Request - Response"},
+	}
+	tests := []struct {
+		format      string
+		status      int
+		body        string
+		contenttype string
+		ok          bool
+	}{
+		{
+			format:      "",
+			status:      http.StatusOK,
+			body:        jsonString(events[0]) + jsonString(events[1]),
+			contenttype: "application/x-ndjson",
+			ok:          true,
+		},
+		{
+			format:      "csv",
+			status:      http.StatusAccepted,
+			body:        logString(events[0]) + logString(events[1]),
+			contenttype: "text/plain",
+			ok:          true,
+		},
+		{
+			format: "json",
+			status: http.StatusServiceUnavailable,
+			ok:     false,
+		},
+	}
+
+	for i, test := range tests {
+		s, err := NewWebhookSink(server.URL, test.format, time.Second)
+		if err != nil {
+			t.Fatalf("NewWebhookSink (testcase %d): returns err = '%v'", i, err)
+		}
+		status = test.status
+		err = s.Write(events)
+		if test.ok && err != nil {
+			t.Errorf("Write (testcase %d): returns err = '%v', where there should be no error", i, err)
+		} else if !test.ok && err == nil {
+			t.Errorf("Write (testcase %d): returns no err, where there should be error", i)
+		} else if test.ok && (body != test.body || contenttype != test.contenttype) {
+			t.Errorf("Write (testcase %d): posts '%s' as %s while it should post '%s' as %s", i, body, contenttype, test.body, test.contenttype)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package logging
+
+import (
+	"strconv"
+	"time"
+)
+
+// tcpStats counts the TCP events of a connection, or of the calls pending
+// while they happened.
+type tcpStats struct {
+	duplicatesegments, dupacks, zerowindows int
+	// handshakertt is the time from the SYN to the ACK of the SYN-ACK.
+	handshakertt time.Duration
+}
+
+func (s tcpStats) columns() []string {
+	columns := []string{}
+	if s.duplicatesegments > 0 {
+		columns = append(columns, "duplicate_segments="+strconv.Itoa(s.duplicatesegments))
+	}
+	if s.dupacks > 0 {
+		columns = append(columns, "dup_acks="+strconv.Itoa(s.dupacks))
+	}
+	if s.zerowindows > 0 {
+		columns = append(columns, "zero_windows="+strconv.Itoa(s.zerowindows))
+	}
+	if s.handshakertt > 0 {
+		columns = append(columns, "handshake_rtt="+s.handshakertt.String())
+	}
+	return columns
+}
@@ -0,0 +1,53 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// WebhookSink posts the lines of batches of events to a URL, as JSON Lines
+// by default.
+type WebhookSink struct {
+	url         string
+	format      Formatter
+	contenttype string
+	client      *http.Client
+}
+
+// NewWebhookSink returns a sink posting the events to url in the format
+// named format, json if empty.
+func NewWebhookSink(url string, format string, timeout time.Duration) (*WebhookSink, error) {
+	if format == "" {
+		format = FormatJSON
+	}
+	formatter, err := ParseFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	contenttype := "text/plain"
+	if format == FormatJSON {
+		contenttype = "application/x-ndjson"
+	}
+	return &WebhookSink{url: url, format: formatter, contenttype: contenttype, client: &http.Client{Timeout: timeout}}, nil
+}
+
+func (s *WebhookSink) Write(events []EventLog) error {
+	var body strings.Builder
+	for _, e := range events {
+		body.WriteString(s.format(e))
+	}
+	resp, err := s.client.Post(s.url, s.contenttype, strings.NewReader(body.String()))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Webhook %s returned %s", s.url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+// Package metrics publishes the rate, errors and duration of the calls of
+// each method captured by inkle, scraped by Prometheus or pushed to StatsD.
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abrampers/inkle/logging"
+)
+
+// OtherValue replaces the values of a label past its limit.
+const OtherValue = "other"
+
+// Collector is a sink counting the calls by service, method, status code
+// and peer, and their durations by service and method.
+type Collector struct {
+	buckets []float64
+	local   *net.IPNet
+	mutex   sync.Mutex
+	// labelvalues are the values seen of each label, up to maxlabelvalues.
+	// Further values are counted in overflows and replaced by OtherValue.
+	labelvalues    map[string]map[string]bool
+	maxlabelvalues int
+	overflows      map[string]uint64
+	requests       map[requestKey]uint64
+	durations      map[methodKey]*histogram
+}
+
+type methodKey struct {
+	service, method string
+}
+
+type requestKey struct {
+	methodKey
+	code, peer string
+}
+
+// histogram counts the observations of each bucket, the last one being
+// +Inf, and keeps the last traced one as exemplar.
+type histogram struct {
+	counts    []uint64
+	exemplars []*exemplar
+	sum       float64
+	count     uint64
+}
+
+type exemplar struct {
+	traceid   string
+	value     float64
+	timestamp time.Time
+}
+
+// NewCollector returns a collector with histograms of buckets and at most
+// maxlabelvalues values per label, unlimited if 0. The peer of a call is
+// its client when its server is in local, its server otherwise.
+func NewCollector(buckets []float64, maxlabelvalues int, local *net.IPNet) *Collector {
+	return &Collector{
+		buckets:        buckets,
+		local:          local,
+		labelvalues:    map[string]map[string]bool{},
+		maxlabelvalues: maxlabelvalues,
+		overflows:      map[string]uint64{},
+		requests:       map[requestKey]uint64{},
+		durations:      map[methodKey]*histogram{},
+	}
+}
+
+// ParseBuckets parses comma separated increasing upper bounds in seconds,
+// e.g. 0.1,0.5,1.
+func ParseBuckets(s string) ([]float64, error) {
+	buckets := []float64{}
+	for _, field := range strings.Split(s, ",") {
+		bucket, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil || bucket <= 0 {
+			return nil, fmt.Errorf("Invalid bucket %s", field)
+		}
+		if len(buckets) > 0 && bucket <= buckets[len(buckets)-1] {
+			return nil, fmt.Errorf("Buckets are not increasing at %s", field)
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, nil
+}
+
+func (c *Collector) Write(events []logging.EventLog) error {
+	for _, e := range events {
+		c.observe(e.Record())
+	}
+	return nil
+}
+
+func (c *Collector) observe(r logging.Record) {
+	code, ok := statusCode(r)
+	if !ok {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	method := c.methodKey(r.Service, r.Method)
+	c.requests[requestKey{method, code, c.limit("peer", r.Peer(c.local).IP)}]++
+
+	h, ok := c.durations[method]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(c.buckets)+1), exemplars: make([]*exemplar, len(c.buckets)+1)}
+		c.durations[method] = h
+	}
+	value := r.DurationMs / 1000
+	idx := 0
+	for idx < len(c.buckets) && value > c.buckets[idx] {
+		idx++
+	}
+	h.counts[idx]++
+	h.sum += value
+	h.count++
+	if f := r.Fields; f != nil && f.TraceID != "" && (f.TraceSampled == nil || *f.TraceSampled) {
+		h.exemplars[idx] = &exemplar{traceid: f.TraceID, value: value, timestamp: *r.EndTime}
+	}
+}
+
+// statusCode returns the code label of the calls, the name of their status
+// or of their expiry. Other events, e.g. of connections, aren't calls, nor
+// are the events grouping the attempts of a call and the late responses of
+// the timed out ones, which are already counted.
+func statusCode(r logging.Record) (string, bool) {
+	if r.Service == "" || r.EndTime == nil || (r.Fields != nil && (r.Fields.Attempts > 0 || r.Fields.TimeoutEventID != "")) {
+		return "", false
+	}
+	switch {
+	case r.Status != nil:
+		return r.Status.Name, true
+	case strings.HasSuffix(r.Info, "TIMEOUT"):
+		return "TIMEOUT", true
+	case strings.HasSuffix(r.Info, "STREAM"):
+		return "STREAM", true
+	}
+	return "", false
+}
+
+// methodKey returns the labels of a method. Methods are limited per
+// service/method, so that a service keeps its label when its methods
+// overflow.
+func (c *Collector) methodKey(service string, method string) methodKey {
+	service = c.limit("service", service)
+	if c.limit("method", service+"/"+method) == OtherValue {
+		method = OtherValue
+	}
+	return methodKey{service, method}
+}
+
+// limit returns value, or OtherValue if label already has maxlabelvalues
+// other values.
+func (c *Collector) limit(label string, value string) string {
+	values, ok := c.labelvalues[label]
+	if !ok {
+		values = map[string]bool{}
+		c.labelvalues[label] = values
+	}
+	if values[value] || c.maxlabelvalues <= 0 || len(values) < c.maxlabelvalues {
+		values[value] = true
+		return value
+	}
+	c.overflows[label]++
+	return OtherValue
+}
+
+// inFlight returns the pending requests of inflight, by service/method, with
+// the labels of their methods.
+func (c *Collector) inFlight(inflight map[string]int) map[methodKey]int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	gauges := map[methodKey]int{}
+	// Methods without pending requests are reported as 0 rather than
+	// disappearing.
+	for method := range c.durations {
+		gauges[method] = 0
+	}
+	for name, count := range inflight {
+		idx := strings.Index(name, "/")
+		if idx == -1 {
+			continue
+		}
+		gauges[c.methodKey(name[:idx], name[idx+1:])] += count
+	}
+	return gauges
+}
@@ -0,0 +1,162 @@
+package metrics
+
+import (
+	"math"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/abrampers/inkle/logging"
+)
+
+var (
+	tend  = time.Date(2020, 4, 1, 10, 30, 0, 123000000, time.UTC)
+	local = &net.IPNet{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(24, 32)}
+)
+
+func testRecord(method string, code int, durationms float64, fields *logging.Fields) logging.Record {
+	r := logging.Record{
+		EndTime:     &tend,
+		Service:     "helloworld.Greeter",
+		Method:      method,
+		Source:      logging.Endpoint{IP: "10.0.1.7", Port: 58108},
+		Destination: logging.Endpoint{IP: "10.0.0.2", Port: 8000},
+		DurationMs:  durationms,
+		Info:        "Request - Response",
+		Fields:      fields,
+	}
+	if code >= 0 {
+		r.Status = &logging.Status{Code: code, Name: []string{"OK", "CANCELLED", "UNKNOWN", "INVALID_ARGUMENT", "DEADLINE_EXCEEDED"}[code]}
+	}
+	return r
+}
+
+func TestParseBuckets(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []float64
+		ok    bool
+	}{
+		{input: "0.1,0.5,1", want: []float64{0.1, 0.5, 1}, ok: true},
+		{input: "0.25", want: []float64{0.25}, ok: true},
+		{input: "0.5,0.1", ok: false},
+		{input: "0.1,0.1", ok: false},
+		{input: "0,1", ok: false},
+		{input: "1s", ok: false},
+		{input: "", ok: false},
+	}
+
+	for i, test := range tests {
+		ret, err := ParseBuckets(test.input)
+		if test.ok && err != nil {
+			t.Errorf("ParseBuckets (testcase %d): returns err = '%v', where there should be no error", i, err)
+		} else if !test.ok && err == nil {
+			t.Errorf("ParseBuckets (testcase %d): returns no err, where there should be error", i)
+		}
+		if test.ok && !reflect.DeepEqual(ret, test.want) {
+			t.Errorf("ParseBuckets (testcase %d): returns %v while it should be %v", i, ret, test.want)
+		}
+	}
+}
+
+func Test_statusCode(t *testing.T) {
+	timeout := testRecord("SayHello", -1, 800, nil)
+	timeout.Info = "Request - TIMEOUT"
+	stream := testRecord("Subscribe", -1, 800, nil)
+	stream.Info = "Request - STREAM"
+	unknown := testRecord("SayHello", -1, 800, nil)
+	pending := testRecord("SayHello", 0, 0, nil)
+	pending.EndTime = nil
+	tests := []struct {
+		input logging.Record
+		want  string
+		ok    bool
+	}{
+		{input: testRecord("SayHello", 0, 2, nil), want: "OK", ok: true},
+		{input: testRecord("SayHello", 4, 2, nil), want: "DEADLINE_EXCEEDED", ok: true},
+		{input: timeout, want: "TIMEOUT", ok: true},
+		{input: stream, want: "STREAM", ok: true},
+		{input: unknown, ok: false},
+		{input: pending, ok: false},
+		{input: logging.Record{EndTime: &tend, Info: "CONNECTION_CLOSE"}, ok: false},
+		{input: testRecord("SayHello", 0, 2, &logging.Fields{Attempts: 2}), ok: false},
+		{input: testRecord("SayHello", 0, 2, &logging.Fields{TimeoutEventID: "d96763c9-a9a4-49d0-9008-b63befa85b6d"}), ok: false},
+	}
+
+	for i, test := range tests {
+		ret, ok := statusCode(test.input)
+		if ret != test.want || ok != test.ok {
+			t.Errorf("statusCode (testcase %d): returns %s, %t while it should be %s, %t", i, ret, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestCollectorObserve(t *testing.T) {
+	c := NewCollector([]float64{0.01, 0.1}, 0, local)
+	c.observe(testRecord("SayHello", 0, 2, &logging.Fields{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736"}))
+	c.observe(testRecord("SayHello", 0, 50, &logging.Fields{TraceID: "a3ce929d0e0e4736", TraceSampled: new(bool)}))
+	c.observe(testRecord("SayHello", 4, 300, nil))
+	client := testRecord("SayHello", 0, 5, nil)
+	client.Source, client.Destination = client.Destination, logging.Endpoint{IP: "10.0.3.9", Port: 9000}
+	c.observe(client)
+	c.observe(logging.Record{EndTime: &tend, Info: "CONNECTION_CLOSE"})
+
+	sayhello := methodKey{"helloworld.Greeter", "SayHello"}
+	requests := map[requestKey]uint64{
+		{sayhello, "OK", "10.0.1.7"}:                2,
+		{sayhello, "DEADLINE_EXCEEDED", "10.0.1.7"}: 1,
+		{sayhello, "OK", "10.0.3.9"}:                1,
+	}
+	if !reflect.DeepEqual(c.requests, requests) {
+		t.Errorf("observe: counts requests %v while it should be %v", c.requests, requests)
+	}
+	h := c.durations[sayhello]
+	if h == nil || !reflect.DeepEqual(h.counts, []uint64{2, 1, 1}) || h.count != 4 || math.Abs(h.sum-0.357) > 1e-9 {
+		t.Errorf("observe: observes durations %+v while it should be counts [2 1 1] and sum 0.357", h)
+		return
+	}
+	want := []*exemplar{{traceid: "4bf92f3577b34da6a3ce929d0e0e4736", value: 0.002, timestamp: tend}, nil, nil}
+	if !reflect.DeepEqual(h.exemplars, want) {
+		t.Errorf("observe: keeps exemplars %v while it should be %v", h.exemplars, want)
+	}
+}
+
+func TestCollectorLimit(t *testing.T) {
+	c := NewCollector([]float64{0.1, 1}, 2, local)
+	tests := []struct {
+		service, method string
+		want            methodKey
+	}{
+		{service: "helloworld.Greeter", method: "SayHello", want: methodKey{"helloworld.Greeter", "SayHello"}},
+		{service: "helloworld.Greeter", method: "SayBye", want: methodKey{"helloworld.Greeter", "SayBye"}},
+		{service: "helloworld.Greeter", method: "Scan", want: methodKey{"helloworld.Greeter", OtherValue}},
+		{service: "helloworld.Greeter", method: "SayHello", want: methodKey{"helloworld.Greeter", "SayHello"}},
+		{service: "route.Guide", method: "GetFeature", want: methodKey{"route.Guide", OtherValue}},
+		{service: "scan.Scanner", method: "Scan", want: methodKey{OtherValue, OtherValue}},
+	}
+
+	for i, test := range tests {
+		if ret := c.methodKey(test.service, test.method); ret != test.want {
+			t.Errorf("methodKey (testcase %d): returns %v while it should be %v", i, ret, test.want)
+		}
+	}
+	overflows := map[string]uint64{"service": 1, "method": 3}
+	if !reflect.DeepEqual(c.overflows, overflows) {
+		t.Errorf("methodKey: counts overflows %v while it should be %v", c.overflows, overflows)
+	}
+}
+
+func TestCollectorInFlight(t *testing.T) {
+	c := NewCollector([]float64{0.1, 1}, 0, local)
+	c.observe(testRecord("SayBye", 0, 2, nil))
+	inflight := map[string]int{"helloworld.Greeter/SayHello": 3, "route.Guide/GetFeature": 1, "invalid": 1}
+	want := map[methodKey]int{
+		{"helloworld.Greeter", "SayHello"}: 3,
+		{"helloworld.Greeter", "SayBye"}:   0,
+		{"route.Guide", "GetFeature"}:      1,
+	}
+	if ret := c.inFlight(inflight); !reflect.DeepEqual(ret, want) {
+		t.Errorf("inFlight: returns %v while it should be %v", ret, want)
+	}
+}
@@ -0,0 +1,198 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/abrampers/inkle/logging"
+)
+
+const (
+	textContentType        = "text/plain; version=0.0.4; charset=utf-8"
+	openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+// Handler serves the metrics of a collector, the requests in flight and the
+// counters of the sinks in the Prometheus text format, or in OpenMetrics,
+// with the exemplars, when the scraper accepts it.
+type Handler struct {
+	collector *Collector
+	inflight  func() map[string]int
+	sinks     []logging.Sink
+}
+
+// statsSink is a sink counting its events, e.g. a logging.BatchingSink.
+type statsSink interface {
+	Name() string
+	Stats() logging.SinkStats
+}
+
+type label struct {
+	name, value string
+}
+
+// NewHandler returns a handler of the metrics of collector. inflight returns
+// the pending requests by service/method.
+func NewHandler(collector *Collector, inflight func() map[string]int, sinks []logging.Sink) *Handler {
+	return &Handler{collector: collector, inflight: inflight, sinks: sinks}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e := &encoder{openmetrics: strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")}
+	h.collector.encode(e)
+
+	e.family("inkle_rpc_in_flight", "gauge", "Requests waiting for their response by service and method.")
+	inflight := h.collector.inFlight(h.inflight())
+	for _, method := range sortedMethods(inflight) {
+		e.sample("inkle_rpc_in_flight", method.labels(), strconv.Itoa(inflight[method]), nil)
+	}
+
+	e.family("inkle_sink_events", "counter", "Events delivered to each sink, dropped because its queue was full and failed to be written.")
+	for _, sink := range h.sinks {
+		if sink, ok := sink.(statsSink); ok {
+			stats := sink.Stats()
+			for _, result := range []struct {
+				name  string
+				count uint64
+			}{{"delivered", stats.Delivered}, {"dropped", stats.Dropped}, {"failed", stats.Failed}} {
+				e.sample("inkle_sink_events_total", []label{{"sink", sink.Name()}, {"result", result.name}}, strconv.FormatUint(result.count, 10), nil)
+			}
+		}
+	}
+
+	contenttype := textContentType
+	if e.openmetrics {
+		e.buf.WriteString("# EOF\n")
+		contenttype = openMetricsContentType
+	}
+	w.Header().Set("Content-Type", contenttype)
+	w.Write(e.buf.Bytes())
+}
+
+func (c *Collector) encode(e *encoder) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	e.family("inkle_rpc_requests", "counter", "Calls by service, method, status code and peer.")
+	keys := make([]requestKey, 0, len(c.requests))
+	for key := range c.requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.methodKey != b.methodKey {
+			return a.methodKey.less(b.methodKey)
+		}
+		if a.code != b.code {
+			return a.code < b.code
+		}
+		return a.peer < b.peer
+	})
+	for _, key := range keys {
+		labels := append(key.labels(), label{"code", key.code}, label{"peer", key.peer})
+		e.sample("inkle_rpc_requests_total", labels, strconv.FormatUint(c.requests[key], 10), nil)
+	}
+
+	e.family("inkle_rpc_duration_seconds", "histogram", "Duration of the calls by service and method.")
+	methods := make(map[methodKey]int, len(c.durations))
+	for method := range c.durations {
+		methods[method] = 0
+	}
+	for _, method := range sortedMethods(methods) {
+		h := c.durations[method]
+		cumulative := uint64(0)
+		for i, count := range h.counts {
+			cumulative += count
+			le := math.Inf(1)
+			if i < len(c.buckets) {
+				le = c.buckets[i]
+			}
+			labels := append(method.labels(), label{"le", formatFloat(le)})
+			e.sample("inkle_rpc_duration_seconds_bucket", labels, strconv.FormatUint(cumulative, 10), h.exemplars[i])
+		}
+		e.sample("inkle_rpc_duration_seconds_sum", method.labels(), formatFloat(h.sum), nil)
+		e.sample("inkle_rpc_duration_seconds_count", method.labels(), strconv.FormatUint(h.count, 10), nil)
+	}
+
+	e.family("inkle_metrics_label_overflows", "counter", "Values replaced by other because their label reached its limit.")
+	labels := make([]string, 0, len(c.overflows))
+	for name := range c.overflows {
+		labels = append(labels, name)
+	}
+	sort.Strings(labels)
+	for _, name := range labels {
+		e.sample("inkle_metrics_label_overflows_total", []label{{"label", name}}, strconv.FormatUint(c.overflows[name], 10), nil)
+	}
+}
+
+func (k methodKey) labels() []label {
+	return []label{{"service", k.service}, {"method", k.method}}
+}
+
+func (k methodKey) less(other methodKey) bool {
+	if k.service != other.service {
+		return k.service < other.service
+	}
+	return k.method < other.method
+}
+
+func sortedMethods(methods map[methodKey]int) []methodKey {
+	keys := make([]methodKey, 0, len(methods))
+	for key := range methods {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].less(keys[j]) })
+	return keys
+}
+
+// encoder writes metric families in the Prometheus text format, or in
+// OpenMetrics, whose counter families are named without _total.
+type encoder struct {
+	buf         bytes.Buffer
+	openmetrics bool
+}
+
+func (e *encoder) family(name string, kind string, help string) {
+	if kind == "counter" && !e.openmetrics {
+		name += "_total"
+	}
+	e.buf.WriteString("# HELP " + name + " " + help + "\n")
+	e.buf.WriteString("# TYPE " + name + " " + kind + "\n")
+}
+
+func (e *encoder) sample(name string, labels []label, value string, ex *exemplar) {
+	e.buf.WriteString(name)
+	writeLabels(&e.buf, labels)
+	e.buf.WriteString(" " + value)
+	if ex != nil && e.openmetrics {
+		e.buf.WriteString(" # ")
+		writeLabels(&e.buf, []label{{"trace_id", ex.traceid}})
+		e.buf.WriteString(" " + formatFloat(ex.value))
+		e.buf.WriteString(" " + strconv.FormatFloat(float64(ex.timestamp.UnixNano())/1e9, 'f', 3, 64))
+	}
+	e.buf.WriteString("\n")
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func writeLabels(buf *bytes.Buffer, labels []label) {
+	buf.WriteString("{")
+	for i, l := range labels {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		buf.WriteString(l.name + `="` + labelEscaper.Replace(l.value) + `"`)
+	}
+	buf.WriteString("}")
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/abrampers/inkle/logging"
+)
+
+type testSink struct{}
+
+func (testSink) Write(events []logging.EventLog) error { return nil }
+
+func (testSink) Name() string { return "zipkin http://zipkin:9411" }
+
+func (testSink) Stats() logging.SinkStats {
+	return logging.SinkStats{Delivered: 40, Dropped: 2, Failed: 1}
+}
+
+func TestHandler(t *testing.T) {
+	c := NewCollector([]float64{0.01, 0.1}, 1, local)
+	c.observe(testRecord("SayHello", 0, 2, &logging.Fields{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736"}))
+	c.observe(testRecord("SayHello", 4, 300, nil))
+	c.observe(testRecord("SayBye", 0, 20, nil))
+	inflight := func() map[string]int { return map[string]int{"helloworld.Greeter/SayHello": 2} }
+	h := NewHandler(c, inflight, []logging.Sink{testSink{}, c})
+
+	tests := []struct {
+		accept      string
+		contenttype string
+		want        string
+	}{
+		{
+			accept:      "text/plain",
+			contenttype: "text/plain; version=0.0.4; charset=utf-8",
+			want: `# HELP inkle_rpc_requests_total Calls by service, method, status code and peer.
+# TYPE inkle_rpc_requests_total counter
+inkle_rpc_requests_total{service="helloworld.Greeter",method="SayHello",code="DEADLINE_EXCEEDED",peer="10.0.1.7"} 1
+inkle_rpc_requests_total{service="helloworld.Greeter",method="SayHello",code="OK",peer="10.0.1.7"} 1
+inkle_rpc_requests_total{service="helloworld.Greeter",method="other",code="OK",peer="10.0.1.7"} 1
+# HELP inkle_rpc_duration_seconds Duration of the calls by service and method.
+# TYPE inkle_rpc_duration_seconds histogram
+inkle_rpc_duration_seconds_bucket{service="helloworld.Greeter",method="SayHello",le="0.01"} 1
+inkle_rpc_duration_seconds_bucket{service="helloworld.Greeter",method="SayHello",le="0.1"} 1
+inkle_rpc_duration_seconds_bucket{service="helloworld.Greeter",method="SayHello",le="+Inf"} 2
+inkle_rpc_duration_seconds_sum{service="helloworld.Greeter",method="SayHello"} 0.302
+inkle_rpc_duration_seconds_count{service="helloworld.Greeter",method="SayHello"} 2
+inkle_rpc_duration_seconds_bucket{service="helloworld.Greeter",method="other",le="0.01"} 0
+inkle_rpc_duration_seconds_bucket{service="helloworld.Greeter",method="other",le="0.1"} 1
+inkle_rpc_duration_seconds_bucket{service="helloworld.Greeter",method="other",le="+Inf"} 1
+inkle_rpc_duration_seconds_sum{service="helloworld.Greeter",method="other"} 0.02
+inkle_rpc_duration_seconds_count{service="helloworld.Greeter",method="other"} 1
+# HELP inkle_metrics_label_overflows_total Values replaced by other because their label reached its limit.
+# TYPE inkle_metrics_label_overflows_total counter
+inkle_metrics_label_overflows_total{label="method"} 1
+# HELP inkle_rpc_in_flight Requests waiting for their response by service and method.
+# TYPE inkle_rpc_in_flight gauge
+inkle_rpc_in_flight{service="helloworld.Greeter",method="SayHello"} 2
+inkle_rpc_in_flight{service="helloworld.Greeter",method="other"} 0
+# HELP inkle_sink_events_total Events delivered to each sink, dropped because its queue was full and failed to be written.
+# TYPE inkle_sink_events_total counter
+inkle_sink_events_total{sink="zipkin http://zipkin:9411",result="delivered"} 40
+inkle_sink_events_total{sink="zipkin http://zipkin:9411",result="dropped"} 2
+inkle_sink_events_total{sink="zipkin http://zipkin:9411",result="failed"} 1
+`,
+		},
+		{
+			accept:      "application/openmetrics-text; version=1.0.0,text/plain;q=0.5",
+			contenttype: "application/openmetrics-text; version=1.0.0; charset=utf-8",
+			want: `# HELP inkle_rpc_requests Calls by service, method, status code and peer.
+# TYPE inkle_rpc_requests counter
+inkle_rpc_requests_total{service="helloworld.Greeter",method="SayHello",code="DEADLINE_EXCEEDED",peer="10.0.1.7"} 1
+inkle_rpc_requests_total{service="helloworld.Greeter",method="SayHello",code="OK",peer="10.0.1.7"} 1
+inkle_rpc_requests_total{service="helloworld.Greeter",method="other",code="OK",peer="10.0.1.7"} 1
+# HELP inkle_rpc_duration_seconds Duration of the calls by service and method.
+# TYPE inkle_rpc_duration_seconds histogram
+inkle_rpc_duration_seconds_bucket{service="helloworld.Greeter",method="SayHello",le="0.01"} 1 # {trace_id="4bf92f3577b34da6a3ce929d0e0e4736"} 0.002 1585737000.123
+inkle_rpc_duration_seconds_bucket{service="helloworld.Greeter",method="SayHello",le="0.1"} 1
+inkle_rpc_duration_seconds_bucket{service="helloworld.Greeter",method="SayHello",le="+Inf"} 2
+inkle_rpc_duration_seconds_sum{service="helloworld.Greeter",method="SayHello"} 0.302
+inkle_rpc_duration_seconds_count{service="helloworld.Greeter",method="SayHello"} 2
+inkle_rpc_duration_seconds_bucket{service="helloworld.Greeter",method="other",le="0.01"} 0
+inkle_rpc_duration_seconds_bucket{service="helloworld.Greeter",method="other",le="0.1"} 1
+inkle_rpc_duration_seconds_bucket{service="helloworld.Greeter",method="other",le="+Inf"} 1
+inkle_rpc_duration_seconds_sum{service="helloworld.Greeter",method="other"} 0.02
+inkle_rpc_duration_seconds_count{service="helloworld.Greeter",method="other"} 1
+# HELP inkle_metrics_label_overflows Values replaced by other because their label reached its limit.
+# TYPE inkle_metrics_label_overflows counter
+inkle_metrics_label_overflows_total{label="method"} 1
+# HELP inkle_rpc_in_flight Requests waiting for their response by service and method.
+# TYPE inkle_rpc_in_flight gauge
+inkle_rpc_in_flight{service="helloworld.Greeter",method="SayHello"} 2
+inkle_rpc_in_flight{service="helloworld.Greeter",method="other"} 0
+# HELP inkle_sink_events Events delivered to each sink, dropped because its queue was full and failed to be written.
+# TYPE inkle_sink_events counter
+inkle_sink_events_total{sink="zipkin http://zipkin:9411",result="delivered"} 40
+inkle_sink_events_total{sink="zipkin http://zipkin:9411",result="dropped"} 2
+inkle_sink_events_total{sink="zipkin http://zipkin:9411",result="failed"} 1
+# EOF
+`,
+		},
+	}
+
+	for i, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.Header.Set("Accept", test.accept)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if ret := rec.Header().Get("Content-Type"); ret != test.contenttype {
+			t.Errorf("ServeHTTP (testcase %d): returns Content-Type %s while it should be %s", i, ret, test.contenttype)
+		}
+		if ret := rec.Body.String(); ret != test.want {
+			t.Errorf("ServeHTTP (testcase %d): returns\n%s\nwhile it should be\n%s", i, ret, test.want)
+		}
+	}
+}
+
+func Test_writeLabels(t *testing.T) {
+	tests := []struct {
+		input []label
+		want  string
+	}{
+		{input: []label{{"service", "helloworld.Greeter"}}, want: `{service="helloworld.Greeter"}`},
+		{input: []label{{"sink", `C:\logs "inkle"` + "\n"}, {"result", "failed"}}, want: `{sink="C:\\logs \"inkle\"\n",result="failed"}`},
+	}
+
+	for i, test := range tests {
+		e := &encoder{}
+		writeLabels(&e.buf, test.input)
+		if ret := e.buf.String(); ret != test.want {
+			t.Errorf("writeLabels (testcase %d): returns %s while it should be %s", i, ret, test.want)
+		}
+	}
+}
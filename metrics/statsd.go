@@ -0,0 +1,203 @@
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/abrampers/inkle/logging"
+	"github.com/abrampers/inkle/utils"
+)
+
+// DefaultStatsDMTU is the default maximum size of a StatsD packet, which
+// fits in an Ethernet frame.
+const DefaultStatsDMTU = 1432
+
+// statsdTags are the tags of the StatsD metrics, in the order they are
+// appended to the names of plain StatsD metrics.
+var statsdTags = []string{"service", "method", "status", "node"}
+
+// StatsDOptions are the options of a StatsD sink. Tags renames the tags of
+// statsdTags, a tag renamed to "" being left out.
+type StatsDOptions struct {
+	Prefix     string
+	DogStatsD  bool
+	Tags       map[string]string
+	Node       string
+	MTU        int
+	SampleRate float64
+}
+
+// StatsDSink sends the counts, errors and durations of the calls of each
+// batch as UDP StatsD packets, with DogStatsD tags or with the tags in the
+// names of the metrics.
+type StatsDSink struct {
+	conn    net.Conn
+	options StatsDOptions
+}
+
+type statsdKey struct {
+	service, method, status string
+}
+
+// statsdCall is the aggregate of the calls of a key.
+type statsdCall struct {
+	count, errors int
+	durations     []float64
+}
+
+// NewStatsDSink returns a sink sending to address, the host:port of a
+// StatsD server.
+func NewStatsDSink(address string, options StatsDOptions) (*StatsDSink, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	if options.MTU <= 0 {
+		options.MTU = DefaultStatsDMTU
+	}
+	return &StatsDSink{conn: conn, options: options}, nil
+}
+
+// ParseTagMapping parses comma separated tag:name pairs renaming the tags
+// service, method, status and node, e.g. service:grpc_service,node:.
+func ParseTagMapping(s string) (map[string]string, error) {
+	tags := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		idx := strings.Index(pair, ":")
+		if idx == -1 {
+			return nil, fmt.Errorf("Invalid tag mapping %s", pair)
+		}
+		tag := strings.TrimSpace(pair[:idx])
+		if !utils.Contains(statsdTags, tag) {
+			return nil, fmt.Errorf("Unknown tag %s", tag)
+		}
+		tags[tag] = strings.TrimSpace(pair[idx+1:])
+	}
+	return tags, nil
+}
+
+func (s *StatsDSink) Write(events []logging.EventLog) error {
+	return s.send(s.lines(logging.Records(events)))
+}
+
+func (s *StatsDSink) Close() error {
+	return s.conn.Close()
+}
+
+// lines returns the StatsD lines of the calls among records: a requests
+// and an errors counter per key and a duration timer per call.
+func (s *StatsDSink) lines(records []logging.Record) []string {
+	calls := map[statsdKey]*statsdCall{}
+	for _, r := range records {
+		status, ok := statusCode(r)
+		if !ok {
+			continue
+		}
+		key := statsdKey{r.Service, r.Method, status}
+		call, ok := calls[key]
+		if !ok {
+			call = &statsdCall{}
+			calls[key] = call
+		}
+		call.count++
+		if status != "OK" && status != "STREAM" {
+			call.errors++
+		}
+		call.durations = append(call.durations, r.DurationMs)
+	}
+
+	keys := make([]statsdKey, 0, len(calls))
+	for key := range calls {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.service != b.service {
+			return a.service < b.service
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.status < b.status
+	})
+	lines := []string{}
+	for _, key := range keys {
+		call := calls[key]
+		lines = append(lines, s.line("requests", key, strconv.Itoa(call.count), "c"))
+		if call.errors > 0 {
+			lines = append(lines, s.line("errors", key, strconv.Itoa(call.errors), "c"))
+		}
+		for _, duration := range call.durations {
+			lines = append(lines, s.line("duration", key, strconv.FormatFloat(duration, 'f', -1, 64), "ms"))
+		}
+	}
+	return lines
+}
+
+// line returns the StatsD line of a metric of key, e.g.
+// inkle.requests:3|c|#service:helloworld.Greeter,method:SayHello,status:OK.
+func (s *StatsDSink) line(metric string, key statsdKey, value string, kind string) string {
+	name := metric
+	if s.options.Prefix != "" {
+		name = s.options.Prefix + "." + metric
+	}
+	values := map[string]string{"service": key.service, "method": key.method, "status": key.status, "node": s.options.Node}
+	tags := []string{}
+	for _, tag := range statsdTags {
+		tagname := tag
+		if mapped, ok := s.options.Tags[tag]; ok {
+			tagname = mapped
+		}
+		if tagname == "" || values[tag] == "" {
+			continue
+		}
+		if s.options.DogStatsD {
+			tags = append(tags, tagname+":"+dogstatsdEscaper.Replace(values[tag]))
+		} else {
+			name += "." + statsdEscaper.Replace(values[tag])
+		}
+	}
+
+	line := name + ":" + value + "|" + kind
+	if s.options.SampleRate > 0 && s.options.SampleRate < 1 {
+		line += "|@" + strconv.FormatFloat(s.options.SampleRate, 'f', -1, 64)
+	}
+	if len(tags) > 0 {
+		line += "|#" + strings.Join(tags, ",")
+	}
+	return line
+}
+
+// The separators of StatsD lines, and of the parts of the names of plain
+// StatsD metrics, are replaced in tags.
+var (
+	statsdEscaper    = strings.NewReplacer(".", "_", ":", "_", "|", "_", "@", "_", "/", "_", " ", "_", "\n", "_")
+	dogstatsdEscaper = strings.NewReplacer(",", "_", "|", "_", "#", "_", " ", "_", "\n", "_")
+)
+
+// send sends lines in packets of at most MTU bytes, a longer line in its own
+// packet.
+func (s *StatsDSink) send(lines []string) error {
+	packet := []byte{}
+	for _, line := range lines {
+		if len(packet) > 0 && len(packet)+1+len(line) > s.options.MTU {
+			if _, err := s.conn.Write(packet); err != nil {
+				return err
+			}
+			packet = packet[:0]
+		}
+		if len(packet) > 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, line...)
+	}
+	if len(packet) > 0 {
+		if _, err := s.conn.Write(packet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package metrics
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abrampers/inkle/logging"
+)
+
+func TestParseTagMapping(t *testing.T) {
+	tests := []struct {
+		input string
+		want  map[string]string
+		ok    bool
+	}{
+		{input: "service:grpc_service", want: map[string]string{"service": "grpc_service"}, ok: true},
+		{input: "method:grpc_method, node:", want: map[string]string{"method": "grpc_method", "node": ""}, ok: true},
+		{input: "peer:client", ok: false},
+		{input: "service", ok: false},
+	}
+
+	for i, test := range tests {
+		ret, err := ParseTagMapping(test.input)
+		if test.ok && err != nil {
+			t.Errorf("ParseTagMapping (testcase %d): returns err = '%v', where there should be no error", i, err)
+		} else if !test.ok && err == nil {
+			t.Errorf("ParseTagMapping (testcase %d): returns no err, where there should be error", i)
+		}
+		if test.ok && !reflect.DeepEqual(ret, test.want) {
+			t.Errorf("ParseTagMapping (testcase %d): returns %v while it should be %v", i, ret, test.want)
+		}
+	}
+}
+
+func TestStatsDSinkLines(t *testing.T) {
+	timeout := testRecord("SayHello", -1, 800, nil)
+	timeout.Info = "Request - TIMEOUT"
+	records := []logging.Record{
+		testRecord("SayHello", 0, 2, nil),
+		testRecord("SayHello", 0, 3.5, nil),
+		timeout,
+		{EndTime: &tend, Info: "CONNECTION_CLOSE"},
+	}
+	tests := []struct {
+		options StatsDOptions
+		want    []string
+	}{
+		{
+			options: StatsDOptions{Prefix: "inkle", DogStatsD: true, Node: "node-1"},
+			want: []string{
+				"inkle.requests:2|c|#service:helloworld.Greeter,method:SayHello,status:OK,node:node-1",
+				"inkle.duration:2|ms|#service:helloworld.Greeter,method:SayHello,status:OK,node:node-1",
+				"inkle.duration:3.5|ms|#service:helloworld.Greeter,method:SayHello,status:OK,node:node-1",
+				"inkle.requests:1|c|#service:helloworld.Greeter,method:SayHello,status:TIMEOUT,node:node-1",
+				"inkle.errors:1|c|#service:helloworld.Greeter,method:SayHello,status:TIMEOUT,node:node-1",
+				"inkle.duration:800|ms|#service:helloworld.Greeter,method:SayHello,status:TIMEOUT,node:node-1",
+			},
+		},
+		{
+			options: StatsDOptions{DogStatsD: true, Tags: map[string]string{"service": "grpc_service", "node": ""}, Node: "node-1", SampleRate: 0.5},
+			want: []string{
+				"requests:2|c|@0.5|#grpc_service:helloworld.Greeter,method:SayHello,status:OK",
+				"duration:2|ms|@0.5|#grpc_service:helloworld.Greeter,method:SayHello,status:OK",
+				"duration:3.5|ms|@0.5|#grpc_service:helloworld.Greeter,method:SayHello,status:OK",
+				"requests:1|c|@0.5|#grpc_service:helloworld.Greeter,method:SayHello,status:TIMEOUT",
+				"errors:1|c|@0.5|#grpc_service:helloworld.Greeter,method:SayHello,status:TIMEOUT",
+				"duration:800|ms|@0.5|#grpc_service:helloworld.Greeter,method:SayHello,status:TIMEOUT",
+			},
+		},
+		{
+			options: StatsDOptions{Prefix: "inkle", Tags: map[string]string{"status": ""}, Node: "node-1.cluster"},
+			want: []string{
+				"inkle.requests.helloworld_Greeter.SayHello.node-1_cluster:2|c",
+				"inkle.duration.helloworld_Greeter.SayHello.node-1_cluster:2|ms",
+				"inkle.duration.helloworld_Greeter.SayHello.node-1_cluster:3.5|ms",
+				"inkle.requests.helloworld_Greeter.SayHello.node-1_cluster:1|c",
+				"inkle.errors.helloworld_Greeter.SayHello.node-1_cluster:1|c",
+				"inkle.duration.helloworld_Greeter.SayHello.node-1_cluster:800|ms",
+			},
+		},
+	}
+
+	for i, test := range tests {
+		s := &StatsDSink{options: test.options}
+		if ret := s.lines(records); !reflect.DeepEqual(ret, test.want) {
+			t.Errorf("lines (testcase %d): returns %v while it should be %v", i, ret, test.want)
+		}
+	}
+}
+
+func TestStatsDSinkSend(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket: returns err = '%v'", err)
+	}
+	defer conn.Close()
+
+	line := "inkle.requests:1|c|#service:helloworld.Greeter,method:SayHello,status:OK"
+	tests := []struct {
+		mtu   int
+		lines []string
+		want  []string
+	}{
+		{mtu: 1432, lines: []string{line, line, line}, want: []string{line + "\n" + line + "\n" + line}},
+		{mtu: 2*len(line) + 1, lines: []string{line, line, line}, want: []string{line + "\n" + line, line}},
+		{mtu: 10, lines: []string{line, line}, want: []string{line, line}},
+		{mtu: 1432, lines: []string{}, want: []string{}},
+	}
+
+	for i, test := range tests {
+		s, err := NewStatsDSink(conn.LocalAddr().String(), StatsDOptions{MTU: test.mtu})
+		if err != nil {
+			t.Fatalf("NewStatsDSink (testcase %d): returns err = '%v'", i, err)
+		}
+		if err := s.send(test.lines); err != nil {
+			t.Errorf("send (testcase %d): returns err = '%v', where there should be no error", i, err)
+		}
+		s.Close()
+
+		packets := []string{}
+		buf := make([]byte, 65536)
+		for {
+			conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				break
+			}
+			packets = append(packets, string(buf[:n]))
+		}
+		if !reflect.DeepEqual(packets, test.want) {
+			t.Errorf("send (testcase %d): sends %q while it should send %q", i, packets, test.want)
+		}
+		for _, packet := range packets {
+			if len(packet) > test.mtu && strings.Contains(packet, "\n") {
+				t.Errorf("send (testcase %d): sends %d bytes over the MTU of %d", i, len(packet), test.mtu)
+			}
+		}
+	}
+}
@@ -0,0 +1,350 @@
+package protobuf
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/abrampers/inkle/utils"
+)
+
+// Field types as numbered in google.protobuf.FieldDescriptorProto.Type.
+const (
+	TypeDouble   = 1
+	TypeFloat    = 2
+	TypeInt64    = 3
+	TypeUint64   = 4
+	TypeInt32    = 5
+	TypeFixed64  = 6
+	TypeFixed32  = 7
+	TypeBool     = 8
+	TypeString   = 9
+	TypeGroup    = 10
+	TypeMessage  = 11
+	TypeBytes    = 12
+	TypeUint32   = 13
+	TypeEnum     = 14
+	TypeSfixed32 = 15
+	TypeSfixed64 = 16
+	TypeSint32   = 17
+	TypeSint64   = 18
+)
+
+const labelRepeated = 3
+
+type FieldDescriptor struct {
+	Name     string
+	Number   int
+	Type     int
+	TypeName string
+	Repeated bool
+}
+
+type MessageDescriptor struct {
+	Name   string
+	Fields map[int]FieldDescriptor
+}
+
+type MethodDescriptor struct {
+	Name       string
+	InputType  string
+	OutputType string
+}
+
+// Schema holds the message and service descriptors of a set of
+// FileDescriptorProtos, keyed by fully-qualified name without the leading dot.
+type Schema struct {
+	Files    map[string]bool
+	Messages map[string]*MessageDescriptor
+	Services map[string]map[string]MethodDescriptor
+}
+
+func NewSchema() *Schema {
+	return &Schema{
+		Files:    map[string]bool{},
+		Messages: map[string]*MessageDescriptor{},
+		Services: map[string]map[string]MethodDescriptor{},
+	}
+}
+
+// AddFile registers the messages and services of a serialized
+// google.protobuf.FileDescriptorProto and returns its name and dependencies.
+func (s *Schema) AddFile(data []byte) (name string, dependencies []string, err error) {
+	fields, err := Decode(data)
+	if err != nil {
+		return "", nil, err
+	}
+
+	pkg := ""
+	for _, f := range fields {
+		if f.Number == 2 && f.WireType == WireBytes {
+			pkg = string(f.Bytes)
+		}
+	}
+
+	for _, f := range fields {
+		if f.WireType != WireBytes {
+			continue
+		}
+		switch f.Number {
+		case 1:
+			name = string(f.Bytes)
+		case 3:
+			dependencies = append(dependencies, string(f.Bytes))
+		case 4:
+			if err := s.addMessage(pkg, f.Bytes); err != nil {
+				return "", nil, err
+			}
+		case 6:
+			if err := s.addService(pkg, f.Bytes); err != nil {
+				return "", nil, err
+			}
+		}
+	}
+	s.Files[name] = true
+	return name, dependencies, nil
+}
+
+func (s *Schema) addMessage(scope string, data []byte) error {
+	fields, err := Decode(data)
+	if err != nil {
+		return err
+	}
+
+	message := &MessageDescriptor{Fields: map[int]FieldDescriptor{}}
+	for _, f := range fields {
+		if f.Number == 1 && f.WireType == WireBytes {
+			message.Name = qualifiedName(scope, string(f.Bytes))
+		}
+	}
+	for _, f := range fields {
+		if f.WireType != WireBytes {
+			continue
+		}
+		switch f.Number {
+		case 2:
+			field, err := decodeFieldDescriptor(f.Bytes)
+			if err != nil {
+				return err
+			}
+			message.Fields[field.Number] = field
+		case 3:
+			if err := s.addMessage(message.Name, f.Bytes); err != nil {
+				return err
+			}
+		}
+	}
+	s.Messages[message.Name] = message
+	return nil
+}
+
+func decodeFieldDescriptor(data []byte) (FieldDescriptor, error) {
+	fields, err := Decode(data)
+	if err != nil {
+		return FieldDescriptor{}, err
+	}
+
+	field := FieldDescriptor{}
+	for _, f := range fields {
+		switch {
+		case f.Number == 1 && f.WireType == WireBytes:
+			field.Name = string(f.Bytes)
+		case f.Number == 3 && f.WireType == WireVarint:
+			field.Number = int(f.Value)
+		case f.Number == 4 && f.WireType == WireVarint:
+			field.Repeated = f.Value == labelRepeated
+		case f.Number == 5 && f.WireType == WireVarint:
+			field.Type = int(f.Value)
+		case f.Number == 6 && f.WireType == WireBytes:
+			field.TypeName = strings.TrimPrefix(string(f.Bytes), ".")
+		}
+	}
+	return field, nil
+}
+
+func (s *Schema) addService(pkg string, data []byte) error {
+	fields, err := Decode(data)
+	if err != nil {
+		return err
+	}
+
+	name := ""
+	methods := map[string]MethodDescriptor{}
+	for _, f := range fields {
+		if f.WireType != WireBytes {
+			continue
+		}
+		switch f.Number {
+		case 1:
+			name = qualifiedName(pkg, string(f.Bytes))
+		case 2:
+			method, err := decodeMethodDescriptor(f.Bytes)
+			if err != nil {
+				return err
+			}
+			methods[method.Name] = method
+		}
+	}
+	s.Services[name] = methods
+	return nil
+}
+
+func decodeMethodDescriptor(data []byte) (MethodDescriptor, error) {
+	fields, err := Decode(data)
+	if err != nil {
+		return MethodDescriptor{}, err
+	}
+
+	method := MethodDescriptor{}
+	for _, f := range fields {
+		if f.WireType != WireBytes {
+			continue
+		}
+		switch f.Number {
+		case 1:
+			method.Name = string(f.Bytes)
+		case 2:
+			method.InputType = strings.TrimPrefix(string(f.Bytes), ".")
+		case 3:
+			method.OutputType = strings.TrimPrefix(string(f.Bytes), ".")
+		}
+	}
+	return method, nil
+}
+
+func qualifiedName(scope string, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + "." + name
+}
+
+// Method returns the descriptor of servicename/methodname.
+func (s *Schema) Method(servicename string, methodname string) (MethodDescriptor, bool) {
+	method, ok := s.Services[servicename][methodname]
+	return method, ok
+}
+
+// Dump decodes a serialized message of type typename and formats it as a
+// compact tree with field names, e.g. {name:"Abram" age:30}. Fields unknown to
+// the schema are formatted by their number as in the schema-less Dump.
+func (s *Schema) Dump(data []byte, typename string, maxlen int) string {
+	fields, err := Decode(data)
+	if err != nil {
+		return "<malformed>"
+	}
+	var b strings.Builder
+	s.writeFields(&b, fields, typename, 0)
+	dump := b.String()
+	if maxlen > 0 && len(dump) > maxlen {
+		dump = utils.Truncate(dump, maxlen) + "..."
+	}
+	return dump
+}
+
+func (s *Schema) writeFields(b *strings.Builder, fields []Field, typename string, depth int) {
+	message, ok := s.Messages[typename]
+	if !ok || depth >= maxDepth {
+		writeFields(b, fields)
+		return
+	}
+
+	b.WriteString("{")
+	for i, field := range fields {
+		if i > 0 {
+			b.WriteString(" ")
+		}
+		descriptor, ok := message.Fields[field.Number]
+		if !ok {
+			writeField(b, field)
+			continue
+		}
+		b.WriteString(descriptor.Name)
+		b.WriteString(":")
+		s.writeValue(b, field, descriptor, depth)
+	}
+	b.WriteString("}")
+}
+
+func (s *Schema) writeValue(b *strings.Builder, field Field, descriptor FieldDescriptor, depth int) {
+	switch {
+	case descriptor.Type == TypeMessage && field.WireType == WireBytes:
+		nested, err := Decode(field.Bytes)
+		if err != nil {
+			b.WriteString(strconv.Quote(string(field.Bytes)))
+			return
+		}
+		s.writeFields(b, nested, descriptor.TypeName, depth+1)
+	case descriptor.Type == TypeString || descriptor.Type == TypeBytes:
+		b.WriteString(strconv.Quote(string(field.Bytes)))
+	case field.WireType == WireBytes:
+		// Packed repeated scalars.
+		values, err := unpack(field.Bytes, descriptor.Type)
+		if err != nil {
+			b.WriteString(strconv.Quote(string(field.Bytes)))
+			return
+		}
+		b.WriteString("[")
+		for i, value := range values {
+			if i > 0 {
+				b.WriteString(" ")
+			}
+			b.WriteString(formatScalar(value, descriptor.Type))
+		}
+		b.WriteString("]")
+	default:
+		b.WriteString(formatScalar(field.Value, descriptor.Type))
+	}
+}
+
+func unpack(data []byte, fieldtype int) ([]uint64, error) {
+	values := []uint64{}
+	size := 0
+	switch fieldtype {
+	case TypeDouble, TypeFixed64, TypeSfixed64:
+		size = 8
+	case TypeFloat, TypeFixed32, TypeSfixed32:
+		size = 4
+	}
+
+	idx := 0
+	for idx < len(data) {
+		if size > 0 {
+			if idx+size > len(data) {
+				return nil, fmt.Errorf("Packed field is truncated")
+			}
+			values = append(values, fixed(data[idx:idx+size]))
+			idx += size
+			continue
+		}
+		value, n := Varint(data[idx:])
+		if n <= 0 {
+			return nil, fmt.Errorf("Invalid varint")
+		}
+		values = append(values, value)
+		idx += n
+	}
+	return values, nil
+}
+
+func formatScalar(value uint64, fieldtype int) string {
+	switch fieldtype {
+	case TypeDouble:
+		return strconv.FormatFloat(math.Float64frombits(value), 'g', -1, 64)
+	case TypeFloat:
+		return strconv.FormatFloat(float64(math.Float32frombits(uint32(value))), 'g', -1, 32)
+	case TypeInt64, TypeSfixed64:
+		return strconv.FormatInt(int64(value), 10)
+	case TypeInt32, TypeEnum:
+		return strconv.FormatInt(int64(int32(value)), 10)
+	case TypeSfixed32:
+		return strconv.FormatInt(int64(int32(uint32(value))), 10)
+	case TypeSint32, TypeSint64:
+		return strconv.FormatInt(int64(value>>1)^-int64(value&1), 10)
+	case TypeBool:
+		return strconv.FormatBool(value != 0)
+	default:
+		return strconv.FormatUint(value, 10)
+	}
+}
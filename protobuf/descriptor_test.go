@@ -0,0 +1,179 @@
+package protobuf
+
+import (
+	"reflect"
+	"testing"
+)
+
+func fieldDescriptor(name string, number int, fieldtype int, typename string, repeated bool) []byte {
+	b := AppendStringField(nil, 1, name)
+	b = AppendVarintField(b, 3, uint64(number))
+	if repeated {
+		b = AppendVarintField(b, 4, labelRepeated)
+	} else {
+		b = AppendVarintField(b, 4, 1)
+	}
+	b = AppendVarintField(b, 5, uint64(fieldtype))
+	if typename != "" {
+		b = AppendStringField(b, 6, typename)
+	}
+	return b
+}
+
+// helloworldFile returns a FileDescriptorProto of the helloworld example with
+// a few extra fields on HelloRequest.
+func helloworldFile() []byte {
+	location := AppendStringField(nil, 1, "Location")
+	location = AppendBytesField(location, 2, fieldDescriptor("city", 1, TypeString, "", false))
+
+	request := AppendStringField(nil, 1, "HelloRequest")
+	request = AppendBytesField(request, 2, fieldDescriptor("name", 1, TypeString, "", false))
+	request = AppendBytesField(request, 2, fieldDescriptor("age", 2, TypeSint32, "", false))
+	request = AppendBytesField(request, 2, fieldDescriptor("location", 3, TypeMessage, ".helloworld.HelloRequest.Location", false))
+	request = AppendBytesField(request, 2, fieldDescriptor("lucky", 4, TypeInt32, "", true))
+	request = AppendBytesField(request, 2, fieldDescriptor("vip", 5, TypeBool, "", false))
+	request = AppendBytesField(request, 3, location)
+
+	reply := AppendStringField(nil, 1, "HelloReply")
+	reply = AppendBytesField(reply, 2, fieldDescriptor("message", 1, TypeString, "", false))
+
+	method := AppendStringField(nil, 1, "SayHello")
+	method = AppendStringField(method, 2, ".helloworld.HelloRequest")
+	method = AppendStringField(method, 3, ".helloworld.HelloReply")
+	service := AppendStringField(nil, 1, "Greeter")
+	service = AppendBytesField(service, 2, method)
+
+	file := AppendStringField(nil, 1, "helloworld.proto")
+	file = AppendStringField(file, 2, "helloworld")
+	file = AppendStringField(file, 3, "google/protobuf/empty.proto")
+	file = AppendBytesField(file, 4, request)
+	file = AppendBytesField(file, 4, reply)
+	file = AppendBytesField(file, 6, service)
+	return file
+}
+
+func TestAddFile(t *testing.T) {
+	schema := NewSchema()
+	name, dependencies, err := schema.AddFile(helloworldFile())
+	if err != nil {
+		t.Fatalf("AddFile: returns error '%v' where there should be no error", err)
+	}
+	if name != "helloworld.proto" || !schema.Files["helloworld.proto"] {
+		t.Errorf("AddFile: doesn't register file name")
+	}
+	if !reflect.DeepEqual(dependencies, []string{"google/protobuf/empty.proto"}) {
+		t.Errorf("AddFile: returns dependencies %v", dependencies)
+	}
+
+	want := map[string]*MessageDescriptor{
+		"helloworld.HelloRequest": &MessageDescriptor{
+			Name: "helloworld.HelloRequest",
+			Fields: map[int]FieldDescriptor{
+				1: FieldDescriptor{Name: "name", Number: 1, Type: TypeString},
+				2: FieldDescriptor{Name: "age", Number: 2, Type: TypeSint32},
+				3: FieldDescriptor{Name: "location", Number: 3, Type: TypeMessage, TypeName: "helloworld.HelloRequest.Location"},
+				4: FieldDescriptor{Name: "lucky", Number: 4, Type: TypeInt32, Repeated: true},
+				5: FieldDescriptor{Name: "vip", Number: 5, Type: TypeBool},
+			},
+		},
+		"helloworld.HelloRequest.Location": &MessageDescriptor{
+			Name: "helloworld.HelloRequest.Location",
+			Fields: map[int]FieldDescriptor{
+				1: FieldDescriptor{Name: "city", Number: 1, Type: TypeString},
+			},
+		},
+		"helloworld.HelloReply": &MessageDescriptor{
+			Name: "helloworld.HelloReply",
+			Fields: map[int]FieldDescriptor{
+				1: FieldDescriptor{Name: "message", Number: 1, Type: TypeString},
+			},
+		},
+	}
+	if !reflect.DeepEqual(schema.Messages, want) {
+		t.Errorf("AddFile: registers messages %v", schema.Messages)
+	}
+
+	method, ok := schema.Method("helloworld.Greeter", "SayHello")
+	if !ok || method != (MethodDescriptor{Name: "SayHello", InputType: "helloworld.HelloRequest", OutputType: "helloworld.HelloReply"}) {
+		t.Errorf("AddFile: registers method %v", method)
+	}
+	if _, ok := schema.Method("helloworld.Greeter", "SayGoodbye"); ok {
+		t.Errorf("Method: returns unknown method")
+	}
+
+	if _, _, err := schema.AddFile([]byte{0x0a, 0x05}); err == nil {
+		t.Errorf("AddFile: returns no error for malformed file")
+	}
+}
+
+func TestSchemaDump(t *testing.T) {
+	schema := NewSchema()
+	schema.AddFile(helloworldFile())
+
+	location := AppendStringField(nil, 1, "Bandung")
+	request := AppendStringField(nil, 1, "Abram")
+	request = AppendVarintField(request, 2, 3)
+	request = AppendBytesField(request, 3, location)
+	request = AppendBytesField(request, 4, []byte{0x07, 0x0d})
+	request = AppendVarintField(request, 5, 1)
+	request = AppendVarintField(request, 9, 42)
+
+	tests := []struct {
+		bytes    []byte
+		typename string
+		maxlen   int
+		want     string
+	}{
+		{
+			bytes:    request,
+			typename: "helloworld.HelloRequest",
+			want:     `{name:"Abram" age:-2 location:{city:"Bandung"} lucky:[7 13] vip:true 9:42}`,
+		},
+		{
+			bytes:    request,
+			typename: "helloworld.Unknown",
+			want:     `{1:"Abram" 2:3 3:{1:"Bandung"} 4:"\a\r" 5:1 9:42}`,
+		},
+		{
+			bytes:    AppendStringField(nil, 1, "Hello Abram"),
+			typename: "helloworld.HelloReply",
+			maxlen:   10,
+			want:     `{message:"...`,
+		},
+		{
+			bytes:    []byte{0x0a, 0x05},
+			typename: "helloworld.HelloReply",
+			want:     "<malformed>",
+		},
+	}
+
+	for i, test := range tests {
+		if ret := schema.Dump(test.bytes, test.typename, test.maxlen); ret != test.want {
+			t.Errorf("Schema.Dump (testcase %d): returns '%s' while it should be '%s'", i, ret, test.want)
+		}
+	}
+}
+
+func Test_formatScalar(t *testing.T) {
+	tests := []struct {
+		value     uint64
+		fieldtype int
+		want      string
+	}{
+		{value: 0x3ff8000000000000, fieldtype: TypeDouble, want: "1.5"},
+		{value: 0x3fc00000, fieldtype: TypeFloat, want: "1.5"},
+		{value: 1<<64 - 1, fieldtype: TypeInt64, want: "-1"},
+		{value: 1<<64 - 1, fieldtype: TypeInt32, want: "-1"},
+		{value: 1<<32 - 1, fieldtype: TypeSfixed32, want: "-1"},
+		{value: 3, fieldtype: TypeSint64, want: "-2"},
+		{value: 4, fieldtype: TypeSint32, want: "2"},
+		{value: 1<<64 - 1, fieldtype: TypeUint64, want: "18446744073709551615"},
+		{value: 0, fieldtype: TypeBool, want: "false"},
+	}
+
+	for i, test := range tests {
+		if ret := formatScalar(test.value, test.fieldtype); ret != test.want {
+			t.Errorf("formatScalar (testcase %d): returns '%s' while it should be '%s'", i, ret, test.want)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package protobuf
+
+func AppendVarint(b []byte, value uint64) []byte {
+	for value >= 0x80 {
+		b = append(b, byte(value)|0x80)
+		value >>= 7
+	}
+	return append(b, byte(value))
+}
+
+func AppendTag(b []byte, number int, wiretype WireType) []byte {
+	return AppendVarint(b, uint64(number)<<3|uint64(wiretype))
+}
+
+func AppendVarintField(b []byte, number int, value uint64) []byte {
+	b = AppendTag(b, number, WireVarint)
+	return AppendVarint(b, value)
+}
+
+func AppendBytesField(b []byte, number int, value []byte) []byte {
+	b = AppendTag(b, number, WireBytes)
+	b = AppendVarint(b, uint64(len(value)))
+	return append(b, value...)
+}
+
+func AppendStringField(b []byte, number int, value string) []byte {
+	return AppendBytesField(b, number, []byte(value))
+}
+
+func AppendFixed64Field(b []byte, number int, value uint64) []byte {
+	b = AppendTag(b, number, WireFixed64)
+	for i := uint(0); i < 64; i += 8 {
+		b = append(b, byte(value>>i))
+	}
+	return b
+}
@@ -0,0 +1,66 @@
+package protobuf
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAppendVarint(t *testing.T) {
+	tests := []struct {
+		value uint64
+		want  []byte
+	}{
+		{
+			value: 0,
+			want:  []byte{0x00},
+		},
+		{
+			value: 150,
+			want:  []byte{0x96, 0x01},
+		},
+		{
+			value: 1<<64 - 1,
+			want:  []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01},
+		},
+	}
+
+	for i, test := range tests {
+		if ret := AppendVarint(nil, test.value); !bytes.Equal(ret, test.want) {
+			t.Errorf("AppendVarint (testcase %d): returns %v while it should be %v", i, ret, test.want)
+		}
+	}
+}
+
+func TestAppendField(t *testing.T) {
+	tests := []struct {
+		ret  []byte
+		want []byte
+	}{
+		{
+			ret:  AppendVarintField(nil, 1, 150),
+			want: []byte{0x08, 0x96, 0x01},
+		},
+		{
+			ret:  AppendStringField(nil, 1, "Abram"),
+			want: []byte{0x0a, 0x05, 0x41, 0x62, 0x72, 0x61, 0x6d},
+		},
+		{
+			ret:  AppendBytesField([]byte{0x08, 0x01}, 3, []byte{0x08, 0x96, 0x01}),
+			want: []byte{0x08, 0x01, 0x1a, 0x03, 0x08, 0x96, 0x01},
+		},
+		{
+			ret:  AppendTag(nil, 16, WireFixed32),
+			want: []byte{0x85, 0x01},
+		},
+		{
+			ret:  AppendFixed64Field(nil, 7, 1585737000000000000),
+			want: []byte{0x39, 0x00, 0x90, 0x31, 0x60, 0x66, 0xab, 0x01, 0x16},
+		},
+	}
+
+	for i, test := range tests {
+		if !bytes.Equal(test.ret, test.want) {
+			t.Errorf("AppendField (testcase %d): returns %v while it should be %v", i, test.ret, test.want)
+		}
+	}
+}
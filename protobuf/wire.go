@@ -0,0 +1,189 @@
+package protobuf
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/abrampers/inkle/utils"
+)
+
+type WireType int
+
+const (
+	WireVarint     WireType = 0
+	WireFixed64    WireType = 1
+	WireBytes      WireType = 2
+	WireStartGroup WireType = 3
+	WireEndGroup   WireType = 4
+	WireFixed32    WireType = 5
+)
+
+// Nested messages deeper than this are left as raw bytes.
+const maxDepth = 16
+
+// Field is a single field decoded from the protobuf wire format without a
+// schema. Length-delimited fields are guessed to be either a printable
+// string, a nested message, or raw bytes.
+type Field struct {
+	Number   int
+	WireType WireType
+	Value    uint64
+	Bytes    []byte
+	Message  []Field
+}
+
+func (f Field) IsString() bool {
+	return f.WireType == WireBytes && f.Message == nil && isPrintable(f.Bytes)
+}
+
+func Decode(data []byte) ([]Field, error) {
+	return decode(data, 0)
+}
+
+func decode(data []byte, depth int) ([]Field, error) {
+	fields := []Field{}
+	idx := 0
+	for idx < len(data) {
+		tag, n := Varint(data[idx:])
+		if n <= 0 {
+			return nil, fmt.Errorf("Invalid field tag")
+		}
+		idx += n
+
+		if tag>>3 == 0 || tag>>3 > 1<<29-1 {
+			return nil, fmt.Errorf("Invalid field number")
+		}
+		field := Field{Number: int(tag >> 3), WireType: WireType(tag & 0x7)}
+
+		switch field.WireType {
+		case WireVarint:
+			value, n := Varint(data[idx:])
+			if n <= 0 {
+				return nil, fmt.Errorf("Invalid varint")
+			}
+			field.Value = value
+			idx += n
+		case WireFixed64:
+			if idx+8 > len(data) {
+				return nil, fmt.Errorf("Fixed64 field is truncated")
+			}
+			field.Value = fixed(data[idx : idx+8])
+			idx += 8
+		case WireFixed32:
+			if idx+4 > len(data) {
+				return nil, fmt.Errorf("Fixed32 field is truncated")
+			}
+			field.Value = fixed(data[idx : idx+4])
+			idx += 4
+		case WireBytes:
+			length, n := Varint(data[idx:])
+			if n <= 0 {
+				return nil, fmt.Errorf("Invalid length")
+			}
+			idx += n
+			if length > uint64(len(data)-idx) {
+				return nil, fmt.Errorf("Length-delimited field is truncated")
+			}
+			field.Bytes = data[idx : idx+int(length)]
+			idx += int(length)
+			if len(field.Bytes) > 0 && !isPrintable(field.Bytes) && depth < maxDepth {
+				if message, err := decode(field.Bytes, depth+1); err == nil {
+					field.Message = message
+				}
+			}
+		default:
+			return nil, fmt.Errorf("Unsupported wire type %d", field.WireType)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// Varint decodes a base 128 varint and returns the value with the number of
+// bytes read. The number of bytes is 0 if data ends before the varint does
+// and negative if the varint overflows 64 bits.
+func Varint(data []byte) (uint64, int) {
+	var value uint64
+	for i := 0; i < len(data); i++ {
+		if i == 10 {
+			return 0, -1
+		}
+		value |= uint64(data[i]&0x7f) << (7 * uint(i))
+		if data[i] < 0x80 {
+			return value, i + 1
+		}
+	}
+	return 0, 0
+}
+
+func fixed(data []byte) uint64 {
+	var value uint64
+	for i := len(data) - 1; i >= 0; i-- {
+		value = value<<8 | uint64(data[i])
+	}
+	return value
+}
+
+func isPrintable(data []byte) bool {
+	if !utf8.Valid(data) {
+		return false
+	}
+	for _, r := range string(data) {
+		if !unicode.IsPrint(r) && r != ' ' {
+			return false
+		}
+	}
+	return true
+}
+
+// String formats the fields as a compact tree, e.g. {1:"Abram" 2:{1:150}}.
+func String(fields []Field) string {
+	var b strings.Builder
+	writeFields(&b, fields)
+	return b.String()
+}
+
+func writeFields(b *strings.Builder, fields []Field) {
+	b.WriteString("{")
+	for i, field := range fields {
+		if i > 0 {
+			b.WriteString(" ")
+		}
+		writeField(b, field)
+	}
+	b.WriteString("}")
+}
+
+func writeField(b *strings.Builder, field Field) {
+	b.WriteString(strconv.Itoa(field.Number))
+	b.WriteString(":")
+	switch {
+	case field.WireType == WireFixed64:
+		fmt.Fprintf(b, "0x%016x", field.Value)
+	case field.WireType == WireFixed32:
+		fmt.Fprintf(b, "0x%08x", field.Value)
+	case field.Message != nil:
+		writeFields(b, field.Message)
+	case field.WireType == WireBytes:
+		b.WriteString(strconv.Quote(string(field.Bytes)))
+	default:
+		b.WriteString(strconv.FormatUint(field.Value, 10))
+	}
+}
+
+// Dump decodes a serialized message and formats it as a compact tree. The
+// result is cut to maxlen bytes when maxlen is positive.
+func Dump(data []byte, maxlen int) string {
+	fields, err := Decode(data)
+	if err != nil {
+		return "<malformed>"
+	}
+	dump := String(fields)
+	if maxlen > 0 && len(dump) > maxlen {
+		dump = utils.Truncate(dump, maxlen) + "..."
+	}
+	return dump
+}
@@ -0,0 +1,172 @@
+package protobuf
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVarint(t *testing.T) {
+	tests := []struct {
+		bytes []byte
+		value uint64
+		n     int
+	}{
+		{
+			bytes: []byte{0x01},
+			value: 1,
+			n:     1,
+		},
+		{
+			bytes: []byte{0x96, 0x01, 0xff},
+			value: 150,
+			n:     2,
+		},
+		{
+			bytes: []byte{0x96},
+			value: 0,
+			n:     0,
+		},
+		{
+			bytes: []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01},
+			value: 0,
+			n:     -1,
+		},
+	}
+
+	for i, test := range tests {
+		if value, n := Varint(test.bytes); value != test.value || n != test.n {
+			t.Errorf("Varint (testcase %d): returns (%d, %d) while it should be (%d, %d)", i, value, n, test.value, test.n)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		bytes []byte
+		want  []Field
+		err   bool
+	}{
+		{
+			bytes: []byte{},
+			want:  []Field{},
+		},
+		{
+			bytes: []byte{0x0a, 0x05, 0x41, 0x62, 0x72, 0x61, 0x6d},
+			want: []Field{
+				Field{Number: 1, WireType: WireBytes, Bytes: []byte("Abram")},
+			},
+		},
+		{
+			bytes: []byte{0x08, 0x96, 0x01, 0x1a, 0x03, 0x08, 0x96, 0x01, 0x25, 0x01, 0x00, 0x00, 0x00},
+			want: []Field{
+				Field{Number: 1, WireType: WireVarint, Value: 150},
+				Field{Number: 3, WireType: WireBytes, Bytes: []byte{0x08, 0x96, 0x01}, Message: []Field{
+					Field{Number: 1, WireType: WireVarint, Value: 150},
+				}},
+				Field{Number: 4, WireType: WireFixed32, Value: 1},
+			},
+		},
+		{
+			bytes: []byte{0x11, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x80},
+			want: []Field{
+				Field{Number: 2, WireType: WireFixed64, Value: 0x8000000000000001},
+			},
+		},
+		{
+			bytes: []byte{0x0a, 0x02, 0xff, 0xfe},
+			want: []Field{
+				Field{Number: 1, WireType: WireBytes, Bytes: []byte{0xff, 0xfe}},
+			},
+		},
+		{
+			bytes: []byte{0x0a, 0x05, 0x41},
+			err:   true,
+		},
+		{
+			bytes: []byte{0x00, 0x01},
+			err:   true,
+		},
+		{
+			bytes: []byte{0x0b, 0x01},
+			err:   true,
+		},
+	}
+
+	for i, test := range tests {
+		ret, err := Decode(test.bytes)
+		if test.err && err == nil {
+			t.Errorf("Decode (testcase %d): returns no error where there should be error", i)
+		} else if !test.err && err != nil {
+			t.Errorf("Decode (testcase %d): returns error '%v' where there should be no error", i, err)
+		} else if !test.err && !reflect.DeepEqual(ret, test.want) {
+			t.Errorf("Decode (testcase %d): returns %v while it should be %v", i, ret, test.want)
+		}
+	}
+}
+
+func TestIsString(t *testing.T) {
+	tests := []struct {
+		field Field
+		want  bool
+	}{
+		{
+			field: Field{Number: 1, WireType: WireBytes, Bytes: []byte("Abram")},
+			want:  true,
+		},
+		{
+			field: Field{Number: 1, WireType: WireBytes, Bytes: []byte{0xff}},
+			want:  false,
+		},
+		{
+			field: Field{Number: 1, WireType: WireVarint, Value: 1},
+			want:  false,
+		},
+	}
+
+	for i, test := range tests {
+		if ret := test.field.IsString(); ret != test.want {
+			t.Errorf("IsString (testcase %d): returns '%t' while it should be '%t'", i, ret, test.want)
+		}
+	}
+}
+
+func TestDump(t *testing.T) {
+	tests := []struct {
+		bytes  []byte
+		maxlen int
+		want   string
+	}{
+		{
+			bytes:  []byte{0x0a, 0x05, 0x41, 0x62, 0x72, 0x61, 0x6d},
+			maxlen: 0,
+			want:   `{1:"Abram"}`,
+		},
+		{
+			bytes:  []byte{0x08, 0x96, 0x01, 0x1a, 0x03, 0x08, 0x96, 0x01, 0x25, 0x01, 0x00, 0x00, 0x00, 0x12, 0x01, 0xff},
+			maxlen: 0,
+			want:   `{1:150 3:{1:150} 4:0x00000001 2:"\xff"}`,
+		},
+		{
+			bytes:  []byte{0x0a, 0x05, 0x41, 0x62, 0x72, 0x61, 0x6d},
+			maxlen: 5,
+			want:   `{1:"A...`,
+		},
+		{
+			// The cut doesn't split the 2 bytes of é.
+			bytes:  []byte{0x0a, 0x06, 0x68, 0xc3, 0xa9, 0x6c, 0x6c, 0x6f},
+			maxlen: 6,
+			want:   `{1:"h...`,
+		},
+		{
+			bytes:  []byte{0x0a, 0x05, 0x41},
+			maxlen: 0,
+			want:   "<malformed>",
+		},
+	}
+
+	for i, test := range tests {
+		if ret := Dump(test.bytes, test.maxlen); ret != test.want {
+			t.Errorf("Dump (testcase %d): returns '%s' while it should be '%s'", i, ret, test.want)
+		}
+	}
+}
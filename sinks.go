@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abrampers/inkle/export"
+	"github.com/abrampers/inkle/logging"
+	"github.com/abrampers/inkle/metrics"
+	"github.com/abrampers/inkle/utils"
+)
+
+const (
+	webhookTimeout time.Duration = 5 * time.Second
+	exportTimeout  time.Duration = 10 * time.Second
+	spillSize      int64         = 100 * 1024 * 1024
+)
+
+// sinkList collects the repeated -sink flags.
+type sinkList []string
+
+func (l *sinkList) String() string {
+	return strings.Join(*l, " ")
+}
+
+func (l *sinkList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// sinkOptions are the options of each type of sink, besides the filter,
+// sampling and batching ones.
+var sinkOptions = map[string][]string{
+	"file":          {"path", "format"},
+	"stdout":        {"format"},
+	"webhook":       {"url", "format", "timeout"},
+	"otlp":          {"endpoint", "protocol", "timeout", "retries"},
+	"zipkin":        {"url", "timeout", "retries"},
+	"statsd":        {"address", "prefix", "tags", "node", "mtu"},
+	"dogstatsd":     {"address", "prefix", "tags", "node", "mtu"},
+	"elasticsearch": {"url", "index", "template", "spill", "spill-size", "timeout", "retries"},
+	"lumberjack":    {"address", "window", "compression", "timeout", "retries"},
+}
+
+// newSinks returns the batched sinks of configs, or of -stdout or -output if
+// there are none. local is the network of the captured device.
+func newSinks(configs []string, policy logging.RotationPolicy, local *net.IPNet) ([]logging.Sink, error) {
+	if len(configs) == 0 {
+		configs = []string{"file"}
+		if *isstdout {
+			configs = []string{"stdout"}
+		}
+	}
+	sinks := []logging.Sink{}
+	for _, s := range configs {
+		config, err := logging.ParseSinkConfig(s)
+		if err != nil {
+			return nil, err
+		}
+		sink, err := newSink(config, policy, local)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Printing logs to %s.\n", sink.Name())
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+func newSink(config logging.SinkConfig, policy logging.RotationPolicy, local *net.IPNet) (*logging.BatchingSink, error) {
+	keys, ok := sinkOptions[config.Type]
+	if !ok {
+		return nil, fmt.Errorf("Unknown sink type %s", config.Type)
+	}
+	for key := range config.Options {
+		if !utils.Contains(keys, key) {
+			return nil, fmt.Errorf("Unknown option %s of sink %s", key, config.Type)
+		}
+	}
+
+	var sink logging.Sink
+	var name string
+	switch config.Type {
+	case "file", "stdout":
+		formatter, err := logging.ParseFormat(option(config, "format", *format))
+		if err != nil {
+			return nil, err
+		}
+		path := option(config, "path", filepath.Join(*outputdir, filename))
+		f, err := outputFile(config.Type == "stdout", path, policy)
+		if err != nil {
+			return nil, err
+		}
+		if rf, ok := f.(*logging.RotatingFile); ok {
+			go reopenOnSignal(rf)
+		}
+		sink, name = logging.NewWriterSink(f, formatter), f.Name()
+	case "webhook":
+		url := config.Options["url"]
+		if url == "" {
+			return nil, fmt.Errorf("Missing url of sink webhook")
+		}
+		timeout, err := time.ParseDuration(option(config, "timeout", webhookTimeout.String()))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid timeout of sink webhook %s", config.Options["timeout"])
+		}
+		sink, err = logging.NewWebhookSink(url, config.Options["format"], timeout)
+		if err != nil {
+			return nil, err
+		}
+		name = url
+	case "otlp":
+		timeout, backoff, err := exportOptions(config)
+		if err != nil {
+			return nil, err
+		}
+		endpoint := option(config, "endpoint", "http://localhost:4318")
+		sink, err = export.NewOTLPSink(endpoint, option(config, "protocol", export.OTLPHTTP), timeout, backoff, local)
+		if err != nil {
+			return nil, err
+		}
+		name = "otlp " + endpoint
+	case "zipkin":
+		timeout, backoff, err := exportOptions(config)
+		if err != nil {
+			return nil, err
+		}
+		url := option(config, "url", "http://localhost:9411")
+		sink, err = export.NewZipkinSink(url, timeout, backoff, local)
+		if err != nil {
+			return nil, err
+		}
+		name = "zipkin " + url
+	case "elasticsearch":
+		timeout, backoff, err := exportOptions(config)
+		if err != nil {
+			return nil, err
+		}
+		template := export.ElasticsearchTemplate
+		if path, ok := config.Options["template"]; ok {
+			if template, err = ioutil.ReadFile(path); err != nil {
+				return nil, err
+			}
+		}
+		var spill *export.Spill
+		if dir := config.Options["spill"]; dir != "" {
+			size, err := strconv.ParseInt(option(config, "spill-size", strconv.FormatInt(spillSize, 10)), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid spill-size of sink elasticsearch %s", config.Options["spill-size"])
+			}
+			if spill, err = export.OpenSpill(dir, size); err != nil {
+				return nil, err
+			}
+		}
+		url := option(config, "url", "http://localhost:9200")
+		sink, err = export.NewElasticsearchSink(url, option(config, "index", "inkle"), template, timeout, backoff, spill)
+		if err != nil {
+			return nil, err
+		}
+		name = "elasticsearch " + url
+	case "lumberjack":
+		timeout, backoff, err := exportOptions(config)
+		if err != nil {
+			return nil, err
+		}
+		window, err := strconv.Atoi(option(config, "window", strconv.Itoa(export.DefaultLumberjackWindow)))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid window of sink lumberjack %s", config.Options["window"])
+		}
+		compression, err := strconv.Atoi(option(config, "compression", "3"))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid compression of sink lumberjack %s", config.Options["compression"])
+		}
+		address := option(config, "address", "localhost:5044")
+		sink, err = export.NewLumberjackSink(address, window, compression, timeout, backoff)
+		if err != nil {
+			return nil, err
+		}
+		name = "lumberjack " + address
+	case "statsd", "dogstatsd":
+		options, err := statsdOptions(config)
+		if err != nil {
+			return nil, err
+		}
+		address := option(config, "address", "localhost:8125")
+		sink, err = metrics.NewStatsDSink(address, options)
+		if err != nil {
+			return nil, err
+		}
+		name = config.Type + " " + address
+		// The calls are aggregated over the flush interval rather than
+		// batches of the default size.
+		if config.BatchSize == 0 {
+			config.BatchSize = config.QueueSize
+			if config.BatchSize <= 0 {
+				config.BatchSize = logging.DefaultSinkQueueSize
+			}
+		}
+	}
+	return logging.NewBatchingSink(name, sink, config.SinkOptions), nil
+}
+
+// exportOptions returns the timeout and the backoff of the exports of
+// config.
+func exportOptions(config logging.SinkConfig) (time.Duration, export.Backoff, error) {
+	backoff := export.DefaultBackoff
+	timeout, err := time.ParseDuration(option(config, "timeout", exportTimeout.String()))
+	if err != nil {
+		return 0, backoff, fmt.Errorf("Invalid timeout of sink %s %s", config.Type, config.Options["timeout"])
+	}
+	if backoff.Retries, err = strconv.Atoi(option(config, "retries", strconv.Itoa(backoff.Retries))); err != nil {
+		return 0, backoff, fmt.Errorf("Invalid retries of sink %s %s", config.Type, config.Options["retries"])
+	}
+	return timeout, backoff, nil
+}
+
+// statsdOptions returns the options of the statsd and dogstatsd sinks of
+// config.
+func statsdOptions(config logging.SinkConfig) (metrics.StatsDOptions, error) {
+	options := metrics.StatsDOptions{
+		Prefix:     option(config, "prefix", "inkle"),
+		DogStatsD:  config.Type == "dogstatsd",
+		Node:       config.Options["node"],
+		SampleRate: config.SampleRate,
+	}
+	if options.Node == "" {
+		options.Node, _ = os.Hostname()
+	}
+	var err error
+	if tags, ok := config.Options["tags"]; ok {
+		if options.Tags, err = metrics.ParseTagMapping(tags); err != nil {
+			return options, err
+		}
+	}
+	if options.MTU, err = strconv.Atoi(option(config, "mtu", strconv.Itoa(metrics.DefaultStatsDMTU))); err != nil || options.MTU <= 0 {
+		return options, fmt.Errorf("Invalid mtu of sink %s %s", config.Type, config.Options["mtu"])
+	}
+	return options, nil
+}
+
+// option returns the option key of config, or value if it isn't set.
+func option(config logging.SinkConfig, key string, value string) string {
+	if v, ok := config.Options[key]; ok {
+		return v
+	}
+	return value
+}
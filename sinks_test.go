@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net"
+	"testing"
+
+	"github.com/abrampers/inkle/logging"
+)
+
+func Test_newSink(t *testing.T) {
+	tests := []struct {
+		input string
+		name  string
+		ok    bool
+	}{
+		{
+			input: "stdout:format=json,errors=true",
+			name:  "/dev/stdout",
+			ok:    true,
+		},
+		{
+			input: "webhook:url=http://alerts/inkle,timeout=1s",
+			name:  "http://alerts/inkle",
+			ok:    true,
+		},
+		{
+			input: "otlp:endpoint=collector:4317,protocol=grpc,retries=2",
+			name:  "otlp collector:4317",
+			ok:    true,
+		},
+		{
+			input: "otlp:protocol=udp",
+			ok:    false,
+		},
+		{
+			input: "otlp:retries=many",
+			ok:    false,
+		},
+		{
+			input: "zipkin:url=http://zipkin:9411",
+			name:  "zipkin http://zipkin:9411",
+			ok:    true,
+		},
+		{
+			input: "zipkin:url=zipkin:9411",
+			ok:    false,
+		},
+		{
+			input: "dogstatsd:address=127.0.0.1:8125,tags=service:grpc_service,node:,mtu=512",
+			name:  "dogstatsd 127.0.0.1:8125",
+			ok:    true,
+		},
+		{
+			input: "statsd:tags=peer:client",
+			ok:    false,
+		},
+		{
+			input: "statsd:mtu=0",
+			ok:    false,
+		},
+		{
+			input: "elasticsearch:url=http://127.0.0.1:1,index=grpc,timeout=10ms,retries=0",
+			name:  "elasticsearch http://127.0.0.1:1",
+			ok:    true,
+		},
+		{
+			input: "elasticsearch:template=/nonexistent/inkle.json",
+			ok:    false,
+		},
+		{
+			input: "elasticsearch:spill=/tmp/inkle-spill,spill-size=big",
+			ok:    false,
+		},
+		{
+			input: "lumberjack:address=logstash:5044,compression=0,window=512",
+			name:  "lumberjack logstash:5044",
+			ok:    true,
+		},
+		{
+			input: "lumberjack:compression=best",
+			ok:    false,
+		},
+		{
+			input: "lumberjack:window=0",
+			ok:    false,
+		},
+		{
+			input: "kafka:topic=inkle",
+			ok:    false,
+		},
+		{
+			input: "stdout:path=/var/log/inkle.log",
+			ok:    false,
+		},
+		{
+			input: "stdout:format=xml",
+			ok:    false,
+		},
+		{
+			input: "webhook:errors=true",
+			ok:    false,
+		},
+		{
+			input: "webhook:url=http://alerts/inkle,timeout=soon",
+			ok:    false,
+		},
+	}
+
+	for i, test := range tests {
+		config, err := logging.ParseSinkConfig(test.input)
+		if err != nil {
+			t.Fatalf("newSink (testcase %d): failed to parse %s: %v", i, test.input, err)
+		}
+		ret, err := newSink(config, logging.RotationPolicy{}, &net.IPNet{})
+		if test.ok && err != nil {
+			t.Errorf("newSink(%s) (testcase %d): returns err = '%v', where there should be no error", test.input, i, err)
+		} else if !test.ok && err == nil {
+			t.Errorf("newSink(%s) (testcase %d): returns no err, where there should be error", test.input, i)
+		} else if test.ok && ret.Name() != test.name {
+			t.Errorf("newSink(%s) (testcase %d): returns sink %s while it should be %s", test.input, i, ret.Name(), test.name)
+		}
+		if ret != nil {
+			ret.Close()
+		}
+	}
+}
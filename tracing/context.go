@@ -0,0 +1,190 @@
+package tracing
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// Values of SpanContext.Sampled. The sampling decision may be deferred to
+// the receiver, in which case it is unknown.
+const (
+	SampledUnknown = ""
+	SampledYes     = "1"
+	SampledNo      = "0"
+)
+
+// SpanContext is the trace context propagated in the headers of a request.
+// IDs are lowercase hex strings.
+type SpanContext struct {
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Sampled      string
+	TraceState   string
+}
+
+// Extract returns the trace context of request headers. W3C Trace Context is
+// preferred over B3, which is preferred over the OpenCensus grpc-trace-bin
+// header.
+func Extract(headers map[string]string) (SpanContext, bool) {
+	if ctx, ok := parseTraceparent(headers["traceparent"]); ok {
+		ctx.TraceState = headers["tracestate"]
+		return ctx, true
+	}
+	if ctx, ok := parseB3Single(headers["b3"]); ok {
+		return ctx, true
+	}
+	if ctx, ok := parseB3Multi(headers); ok {
+		return ctx, true
+	}
+	if ctx, ok := parseGrpcTraceBin(headers["grpc-trace-bin"]); ok {
+		return ctx, true
+	}
+	return SpanContext{}, false
+}
+
+// parseTraceparent parses version-traceid-parentid-flags, e.g.
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01.
+func parseTraceparent(value string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || !isHex(parts[0]) {
+		return SpanContext{}, false
+	}
+	// Version 00 has exactly 4 fields, later versions may append more.
+	if parts[0] == "00" && len(parts) != 4 {
+		return SpanContext{}, false
+	}
+	traceid, spanid, flags := parts[1], parts[2], parts[3]
+	if !isID(traceid, 32) || !isID(spanid, 16) || len(flags) != 2 || !isHex(flags) {
+		return SpanContext{}, false
+	}
+
+	flagbits, _ := hex.DecodeString(flags)
+	ctx := SpanContext{TraceID: strings.ToLower(traceid), SpanID: strings.ToLower(spanid), Sampled: SampledNo}
+	if flagbits[0]&0x01 != 0 {
+		ctx.Sampled = SampledYes
+	}
+	return ctx, true
+}
+
+// parseB3Single parses traceid-spanid[-sampled[-parentspanid]]. A lone
+// sampling state carries no IDs, so it isn't a trace context.
+func parseB3Single(value string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 2 || len(parts) > 4 {
+		return SpanContext{}, false
+	}
+	traceid, spanid := parts[0], parts[1]
+	if !isB3TraceID(traceid) || !isID(spanid, 16) {
+		return SpanContext{}, false
+	}
+
+	ctx := SpanContext{TraceID: strings.ToLower(traceid), SpanID: strings.ToLower(spanid)}
+	if len(parts) > 2 {
+		sampled, ok := b3Sampled(parts[2])
+		if !ok {
+			return SpanContext{}, false
+		}
+		ctx.Sampled = sampled
+	}
+	if len(parts) > 3 {
+		if !isID(parts[3], 16) {
+			return SpanContext{}, false
+		}
+		ctx.ParentSpanID = strings.ToLower(parts[3])
+	}
+	return ctx, true
+}
+
+func parseB3Multi(headers map[string]string) (SpanContext, bool) {
+	traceid, spanid := headers["x-b3-traceid"], headers["x-b3-spanid"]
+	if !isB3TraceID(traceid) || !isID(spanid, 16) {
+		return SpanContext{}, false
+	}
+
+	ctx := SpanContext{TraceID: strings.ToLower(traceid), SpanID: strings.ToLower(spanid)}
+	if parent, ok := headers["x-b3-parentspanid"]; ok {
+		if !isID(parent, 16) {
+			return SpanContext{}, false
+		}
+		ctx.ParentSpanID = strings.ToLower(parent)
+	}
+	if sampled, ok := headers["x-b3-sampled"]; ok {
+		if ctx.Sampled, ok = b3Sampled(sampled); !ok {
+			return SpanContext{}, false
+		}
+	}
+	// Debug implies an accept sampling decision.
+	if headers["x-b3-flags"] == "1" {
+		ctx.Sampled = SampledYes
+	}
+	return ctx, true
+}
+
+func b3Sampled(value string) (string, bool) {
+	switch value {
+	case "1", "d", "true":
+		return SampledYes, true
+	case "0", "false":
+		return SampledNo, true
+	}
+	return "", false
+}
+
+// parseGrpcTraceBin parses the OpenCensus binary format: a version byte
+// followed by fields prefixed by their ID, 0 for the 16 bytes trace ID, 1 for
+// the 8 bytes span ID and 2 for the 1 byte trace options.
+func parseGrpcTraceBin(value string) (SpanContext, bool) {
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		if data, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(value, "=")); err != nil {
+			return SpanContext{}, false
+		}
+	}
+	if len(data) == 0 || data[0] != 0 {
+		return SpanContext{}, false
+	}
+
+	ctx := SpanContext{}
+	idx := 1
+	for idx < len(data) {
+		fieldid := data[idx]
+		idx++
+		switch {
+		case fieldid == 0 && idx+16 <= len(data):
+			ctx.TraceID = hex.EncodeToString(data[idx : idx+16])
+			idx += 16
+		case fieldid == 1 && idx+8 <= len(data):
+			ctx.SpanID = hex.EncodeToString(data[idx : idx+8])
+			idx += 8
+		case fieldid == 2 && idx+1 <= len(data):
+			ctx.Sampled = SampledNo
+			if data[idx]&0x01 != 0 {
+				ctx.Sampled = SampledYes
+			}
+			idx++
+		default:
+			// Unknown fields can't be skipped as their length isn't known.
+			idx = len(data)
+		}
+	}
+	if !isID(ctx.TraceID, 32) || !isID(ctx.SpanID, 16) {
+		return SpanContext{}, false
+	}
+	return ctx, true
+}
+
+func isB3TraceID(id string) bool {
+	return isID(id, 16) || isID(id, 32)
+}
+
+// isID reports whether id is a non-zero hex ID of length characters.
+func isID(id string, length int) bool {
+	return len(id) == length && isHex(id) && strings.Trim(id, "0") != ""
+}
+
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,124 @@
+package tracing
+
+import (
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		headers map[string]string
+		want    SpanContext
+		ok      bool
+	}{
+		{
+			headers: map[string]string{":path": "/helloworld.Greeter/SayHello"},
+			ok:      false,
+		},
+		{
+			headers: map[string]string{
+				"traceparent": "00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-01",
+				"tracestate":  "congo=t61rcWkgMzE",
+			},
+			want: SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Sampled: SampledYes, TraceState: "congo=t61rcWkgMzE"},
+			ok:   true,
+		},
+		{
+			headers: map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"},
+			want:    SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Sampled: SampledNo},
+			ok:      true,
+		},
+		{
+			// Future versions may append fields.
+			headers: map[string]string{"traceparent": "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-ab"},
+			want:    SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Sampled: SampledYes},
+			ok:      true,
+		},
+		{
+			headers: map[string]string{"traceparent": "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+			ok:      false,
+		},
+		{
+			headers: map[string]string{"traceparent": "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+			ok:      false,
+		},
+		{
+			headers: map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-ab"},
+			ok:      false,
+		},
+		{
+			// An invalid traceparent falls back to B3.
+			headers: map[string]string{
+				"traceparent": "00-4bf92f3577b34da6-00f067aa0ba902b7-01",
+				"b3":          "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1-05e3ac9a4f6e3b90",
+			},
+			want: SpanContext{TraceID: "80f198ee56343ba864fe8b2a57d3eff7", SpanID: "e457b5a2e4d86bd1", ParentSpanID: "05e3ac9a4f6e3b90", Sampled: SampledYes},
+			ok:   true,
+		},
+		{
+			headers: map[string]string{"b3": "a3ce929d0e0e4736-00f067aa0ba902b7"},
+			want:    SpanContext{TraceID: "a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7"},
+			ok:      true,
+		},
+		{
+			headers: map[string]string{"b3": "a3ce929d0e0e4736-00f067aa0ba902b7-d"},
+			want:    SpanContext{TraceID: "a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Sampled: SampledYes},
+			ok:      true,
+		},
+		{
+			headers: map[string]string{"b3": "0"},
+			ok:      false,
+		},
+		{
+			headers: map[string]string{"b3": "a3ce929d0e0e4736-00f067aa0ba902b7-x"},
+			ok:      false,
+		},
+		{
+			headers: map[string]string{
+				"x-b3-traceid":      "463ac35c9f6413ad48485a3953bb6124",
+				"x-b3-spanid":       "a2fb4a1d1a96d312",
+				"x-b3-parentspanid": "0020000000000001",
+				"x-b3-sampled":      "0",
+			},
+			want: SpanContext{TraceID: "463ac35c9f6413ad48485a3953bb6124", SpanID: "a2fb4a1d1a96d312", ParentSpanID: "0020000000000001", Sampled: SampledNo},
+			ok:   true,
+		},
+		{
+			headers: map[string]string{
+				"x-b3-traceid": "463ac35c9f6413ad48485a3953bb6124",
+				"x-b3-spanid":  "a2fb4a1d1a96d312",
+				"x-b3-flags":   "1",
+			},
+			want: SpanContext{TraceID: "463ac35c9f6413ad48485a3953bb6124", SpanID: "a2fb4a1d1a96d312", Sampled: SampledYes},
+			ok:   true,
+		},
+		{
+			headers: map[string]string{"x-b3-traceid": "463ac35c9f6413ad48485a3953bb6124"},
+			ok:      false,
+		},
+		{
+			headers: map[string]string{"grpc-trace-bin": "AABL+S81d7NNpqPOkp0ODkc2AQDwZ6oLqQK3AgE="},
+			want:    SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Sampled: SampledYes},
+			ok:      true,
+		},
+		{
+			headers: map[string]string{"grpc-trace-bin": "AABL+S81d7NNpqPOkp0ODkc2AQDwZ6oLqQK3"},
+			want:    SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7"},
+			ok:      true,
+		},
+		{
+			headers: map[string]string{"grpc-trace-bin": "AABL+S81d7NNpqPOkp0ODkc2"},
+			ok:      false,
+		},
+		{
+			headers: map[string]string{"grpc-trace-bin": "not base64"},
+			ok:      false,
+		},
+	}
+
+	for i, test := range tests {
+		ret, ok := Extract(test.headers)
+		if ok != test.ok || ret != test.want {
+			t.Errorf("Extract (testcase %d): returns (%+v, %t) while it should be (%+v, %t)", i, ret, ok, test.want, test.ok)
+		}
+	}
+}
@@ -3,7 +3,12 @@ package utils
 import (
 	"fmt"
 	"net"
+	"path"
 	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/google/gopacket/pcap"
 )
@@ -19,6 +24,32 @@ func ParseGrpcPath(path string) (servicename string, methodname string, err erro
 	return matches[1], matches[2], nil
 }
 
+var grpcTimeoutUnits = map[byte]time.Duration{
+	'H': time.Hour,
+	'M': time.Minute,
+	'S': time.Second,
+	'm': time.Millisecond,
+	'u': time.Microsecond,
+	'n': time.Nanosecond,
+}
+
+// ParseGrpcTimeout parses a grpc-timeout header value, at most 8 digits
+// followed by a unit, e.g. "999968u".
+func ParseGrpcTimeout(value string) (time.Duration, error) {
+	if len(value) < 2 || len(value) > 9 {
+		return 0, fmt.Errorf("Invalid grpc-timeout %s", value)
+	}
+	unit, ok := grpcTimeoutUnits[value[len(value)-1]]
+	if !ok {
+		return 0, fmt.Errorf("Invalid grpc-timeout unit %s", value)
+	}
+	amount, err := strconv.ParseUint(value[:len(value)-1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid grpc-timeout %s", value)
+	}
+	return time.Duration(amount) * unit, nil
+}
+
 func CIDR(dname string) *net.IPNet {
 	devices, err := pcap.FindAllDevs()
 	if err != nil {
@@ -26,7 +57,7 @@ func CIDR(dname string) *net.IPNet {
 	}
 
 	for _, device := range devices {
-		if device.Name == dname {
+		if device.Name == dname && len(device.Addresses) > 0 {
 			address := device.Addresses[0]
 			return &net.IPNet{IP: address.IP, Mask: address.Netmask}
 		}
@@ -34,3 +65,47 @@ func CIDR(dname string) *net.IPNet {
 
 	return &net.IPNet{}
 }
+
+// Contains reports whether s is an item of list.
+func Contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Truncate cuts value to at most maxlen bytes on a rune boundary.
+func Truncate(value string, maxlen int) string {
+	if len(value) <= maxlen {
+		return value
+	}
+	n := maxlen
+	for n > 0 && !utf8.RuneStart(value[n]) {
+		n--
+	}
+	return value[:n]
+}
+
+// SplitList splits a comma separated flag value, ignoring empty items.
+func SplitList(s string) []string {
+	items := []string{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// MatchMethod reports whether servicename/methodname matches any of the glob
+// patterns, e.g. "helloworld.Greeter/*" or "*/Get*".
+func MatchMethod(patterns []string, servicename string, methodname string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, servicename+"/"+methodname); ok {
+			return true
+		}
+	}
+	return false
+}
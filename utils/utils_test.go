@@ -1,7 +1,9 @@
 package utils
 
 import (
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestParseGrpcPath(t *testing.T) {
@@ -50,3 +52,162 @@ func TestParseGrpcPath(t *testing.T) {
 		}
 	}
 }
+
+func TestParseGrpcTimeout(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{value: "999968u", want: 999968 * time.Microsecond, ok: true},
+		{value: "1H", want: time.Hour, ok: true},
+		{value: "30M", want: 30 * time.Minute, ok: true},
+		{value: "5S", want: 5 * time.Second, ok: true},
+		{value: "200m", want: 200 * time.Millisecond, ok: true},
+		{value: "99999999n", want: 99999999 * time.Nanosecond, ok: true},
+		{value: "0n", want: 0, ok: true},
+		{value: "", ok: false},
+		{value: "S", ok: false},
+		{value: "100", ok: false},
+		{value: "100s", ok: false},
+		{value: "-1S", ok: false},
+		{value: "123456789S", ok: false},
+	}
+
+	for i, test := range tests {
+		ret, err := ParseGrpcTimeout(test.value)
+		if test.ok && err != nil {
+			t.Errorf("ParseGrpcTimeout(%s) (testcase %d): returns err = '%v', where there should be no error", test.value, i, err)
+		} else if !test.ok && err == nil {
+			t.Errorf("ParseGrpcTimeout(%s) (testcase %d): returns no err, where there should be error", test.value, i)
+		} else if ret != test.want {
+			t.Errorf("ParseGrpcTimeout(%s) (testcase %d): returns %v, where it should be %v", test.value, i, ret, test.want)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		value  string
+		maxlen int
+		want   string
+	}{
+		{
+			value:  "Abram",
+			maxlen: 8,
+			want:   "Abram",
+		},
+		{
+			value:  "Abram",
+			maxlen: 3,
+			want:   "Abr",
+		},
+		{
+			// é is 2 bytes long.
+			value:  "héllo",
+			maxlen: 2,
+			want:   "h",
+		},
+		{
+			value:  "héllo",
+			maxlen: 3,
+			want:   "hé",
+		},
+	}
+
+	for i, test := range tests {
+		if ret := Truncate(test.value, test.maxlen); ret != test.want {
+			t.Errorf("Truncate (testcase %d): returns '%s', where it should be '%s'", i, ret, test.want)
+		}
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{
+			input: "",
+			want:  []string{},
+		},
+		{
+			input: "helloworld.Greeter/*",
+			want:  []string{"helloworld.Greeter/*"},
+		},
+		{
+			input: "helloworld.Greeter/*, */Get*,,",
+			want:  []string{"helloworld.Greeter/*", "*/Get*"},
+		},
+	}
+
+	for i, test := range tests {
+		if ret := SplitList(test.input); !reflect.DeepEqual(ret, test.want) {
+			t.Errorf("SplitList(%s) (testcase %d): returns %v, where it should be %v", test.input, i, ret, test.want)
+		}
+	}
+}
+
+func TestMatchMethod(t *testing.T) {
+	tests := []struct {
+		patterns    []string
+		servicename string
+		methodname  string
+		want        bool
+	}{
+		{
+			patterns:    []string{},
+			servicename: "helloworld.Greeter",
+			methodname:  "SayHello",
+			want:        false,
+		},
+		{
+			patterns:    []string{"helloworld.Greeter/*"},
+			servicename: "helloworld.Greeter",
+			methodname:  "SayHello",
+			want:        true,
+		},
+		{
+			patterns:    []string{"datetime.Datetime/*", "*/Say*"},
+			servicename: "helloworld.Greeter",
+			methodname:  "SayHello",
+			want:        true,
+		},
+		{
+			patterns:    []string{"*"},
+			servicename: "helloworld.Greeter",
+			methodname:  "SayHello",
+			want:        false,
+		},
+		{
+			patterns:    []string{"*/*"},
+			servicename: "helloworld.Greeter",
+			methodname:  "SayHello",
+			want:        true,
+		},
+	}
+
+	for i, test := range tests {
+		if ret := MatchMethod(test.patterns, test.servicename, test.methodname); ret != test.want {
+			t.Errorf("MatchMethod(%v) (testcase %d): returns '%t', where it should be '%t'", test.patterns, i, ret, test.want)
+		}
+	}
+}
+
+func TestContains(t *testing.T) {
+	tests := []struct {
+		list []string
+		s    string
+		want bool
+	}{
+		{list: nil, s: "a", want: false},
+		{list: []string{"a", "b"}, s: "b", want: true},
+		{list: []string{"a", "b"}, s: "c", want: false},
+	}
+
+	for i, test := range tests {
+		if ret := Contains(test.list, test.s); ret != test.want {
+			t.Errorf("Contains(%v, %s) (testcase %d): returns %t while it should be %t", test.list, test.s, i, ret, test.want)
+		}
+	}
+}